@@ -2,7 +2,7 @@
 login = document.getElementById("loginbtn");
 signup = document.getElementById("signupbtn");
 login.addEventListener("click", () => {
-    fetch("/login", {
+    fetch("login", {
         method : 'POST',
         headers: {
             'Accept': 'application/json',
@@ -15,7 +15,7 @@ login.addEventListener("click", () => {
     })
     .then(async response => {
         if(response.status == 200) {
-            window.location.href = "/todo";
+            window.location.href = "todo";
         } else {
             let body = await response.json();
             if(body.error) {
@@ -33,7 +33,7 @@ login.addEventListener("click", () => {
 });
 
 signup.addEventListener("click", () => {
-    fetch("/signup", {
+    fetch("signup", {
         method : 'POST',
         headers: {
             'Accept': 'application/json',
@@ -47,7 +47,7 @@ signup.addEventListener("click", () => {
     })
     .then(async response => {
         if(response.status == 200) {
-            window.location.href = "/todo";
+            window.location.href = "todo";
         } else {
             let body = await response.json();
             if(body.error) {
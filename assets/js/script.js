@@ -15,9 +15,8 @@ filters.forEach(btn => {
 });
 
 function changeUsername(){
+    // The page is rendered with the username, so only the id is read here
     let userid = getCookie("userID");
-    let username = getCookie("username");
-    document.getElementById("username").innerText = username;
     return userid;
 
 }
@@ -166,7 +165,7 @@ function findAndEditTodo(id,name,status) {
 
 async function ClearAllTodos() {
 
-    const response = await fetch('/todos/' + userid, {
+    const response = await fetch('todos/' + userid, {
         method: 'DELETE',
         headers: {
             'Accept': 'application/json',
@@ -182,7 +181,7 @@ async function ClearAllTodos() {
 }
 
 async function updateTodo(id,name,status) {
-    const response = await fetch('/todo', {
+    const response = await fetch('todo', {
         method: 'PUT',
         headers: {
             'Accept': 'application/json',
@@ -205,7 +204,7 @@ async function updateTodo(id,name,status) {
 }
 
 async function addTodo(todo) { 
-    const response = await fetch('/todo/' + userid, {
+    const response = await fetch('todo/' + userid, {
         method: 'POST',
         headers: {
             'Accept': 'application/json',
@@ -226,7 +225,7 @@ async function addTodo(todo) {
 }
 
 async function fetchTodos() {
-    const response = await fetch('/todos/' + userid, );
+    const response = await fetch('todos/' + userid, );
     const todos = await response.json();
     if(response.status != 200) {
         var str = JSON.stringify(todos);
@@ -236,7 +235,7 @@ async function fetchTodos() {
 }
 
 async function deleteTodos(id) {
-    const response = await fetch('/todo/' + userid+ '/' + id, {
+    const response = await fetch('todo/' + userid+ '/' + id, {
         method: 'DELETE'
     });
     const todos = await response.json();
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, display, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(display) != apiKeyDisplayLength || !strings.HasPrefix(key, display) {
+		t.Fatalf("key %q, display %q", key, display)
+	}
+	if other, _, _ := GenerateAPIKey(); other == key {
+		t.Fatal("two keys are equal")
+	}
+	if HashAPIKey(key) == key || HashAPIKey(key) != HashAPIKey(key) {
+		t.Fatal("HashAPIKey is not a stable digest")
+	}
+}
+
+func TestBearerAPIKey(t *testing.T) {
+	for header, want := range map[string]bool{
+		"Bearer sk_abc":         true,
+		"bearer sk_abc":         true,
+		"Bearer eyJhbGciOiJIUz": false,
+		"sk_abc":                false,
+		"":                      false,
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("Authorization", header)
+		if _, ok := bearerAPIKey(c); ok != want {
+			t.Errorf("Authorization %q: API key %v, want %v", header, ok, want)
+		}
+	}
+}
@@ -1,46 +1,159 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"net/http"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/ctxkeys"
+	"github.com/jeffthorne/tasky/featureflags"
+	"github.com/jeffthorne/tasky/secrets"
 )
 
+// RoleAdmin is the user role allowed to call the /admin endpoints.
+const RoleAdmin = "admin"
+
 type Claims struct {
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+	// Version must match the user's token version; bumping it revokes every
+	// token issued before
+	Version int `json:"ver,omitempty"`
 	jwt.StandardClaims
 }
 
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
+var (
+	secretKeyOnce sync.Once
+	secretKey     []byte
+)
+
+// SecretKey returns the key that signs and verifies every session token. It
+// is resolved once, on first use, so it must not be used before any .env
+// file has been applied; main resolves it right after loading one.
+func SecretKey() []byte {
+	secretKeyOnce.Do(func() {
+		secretKey = []byte(secrets.Resolve("SECRET_KEY"))
+	})
+	return secretKey
+}
+
+// maxTokenLength bounds the session tokens worth parsing; real ones are a
+// few hundred bytes.
+const maxTokenLength = 4096
+
+// now is the clock for every expiry decision in this package, including the
+// exp checks jwt-go performs while parsing. Tests replace it to exercise
+// expiry boundaries deterministically.
+var now = time.Now
+
+func init() {
+	jwt.TimeFunc = func() time.Time { return now() }
+}
+
+// ErrSessionRevoked is returned by a SessionChecker when the account behind a
+// well-formed token may no longer use it.
+var ErrSessionRevoked = errors.New("session revoked")
+
+// SessionChecker confirms that the account behind a validly signed token may
+// still use it, for example that it has not been deactivated or logged out
+// everywhere. It returns ErrSessionRevoked to reject the session.
+type SessionChecker func(c *gin.Context, claims *Claims) error
+
+var sessionChecker SessionChecker
+
+// SetSessionChecker installs the check run after every successful token
+// validation.
+func SetSessionChecker(check SessionChecker) {
+	sessionChecker = check
+}
+
+func checkSession(c *gin.Context, claims *Claims) error {
+	if sessionChecker == nil {
+		return nil
+	}
+	return sessionChecker(c, claims)
+}
 
 func ValidateSession(c *gin.Context) bool {
-	cookie, err := c.Cookie("token")
+	cookie, err := sessionToken(c)
 	if err != nil {
 		// For HTML endpoints, don't send JSON errors - let caller handle redirect
 		return false
 	}
 
 	token, err := ValidateJWT(cookie)
-	if err != nil {
+	grace := graceRead(c, token, err)
+	if err != nil && !grace {
 		// For HTML endpoints, don't send JSON errors - let caller handle redirect
+		tokenFailures.Inc(tokenFailureReason(err))
 		return false
 	}
 
-	if !token.Valid {
+	if !token.Valid && !grace {
 		// For HTML endpoints, don't send JSON errors - let caller handle redirect
+		tokenFailures.Inc(failureMalformed)
+		return false
+	}
+
+	claims := token.Claims.(*Claims)
+	ctxkeys.SetUserID(c, claims.Username)
+	ctxkeys.SetRole(c, claims.Role)
+
+	if err := checkSession(c, claims); err != nil {
+		if errors.Is(err, ErrSessionRevoked) {
+			tokenFailures.Inc(failureRevoked)
+		}
 		return false
 	}
 	return true
 }
 
-// ValidateSessionAPI is for API endpoints that need JSON error responses
+// graceReadWindow is how long after expiry a token can still be used for
+// reads when grace reads are enabled.
+const graceReadWindow = 5 * time.Minute
+
+// graceRead reports whether token, which ValidateJWT rejected with err, may
+// still authenticate this request: grace reads are on, the request is a read,
+// and the token is correctly signed and expired within graceReadWindow. The
+// response then carries X-Token-Expired so the client refreshes it. Writes
+// always need a valid token.
+func graceRead(c *gin.Context, token jwt.Token, err error) bool {
+	if err == nil || !featureflags.GraceReads() {
+		return false
+	}
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+	// jwt-go reports every problem it found, so an error that is only
+	// ValidationErrorExpired means the signature checked out
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Errors != jwt.ValidationErrorExpired {
+		return false
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || now().Sub(time.Unix(claims.ExpiresAt, 0)) > graceReadWindow {
+		return false
+	}
+	c.Header("X-Token-Expired", "true")
+	return true
+}
+
+// ValidateSessionAPI is for API endpoints that need JSON error responses.
+// Besides the session token it accepts an API key as a bearer token, unless
+// TOKEN_TRANSPORT is cookie.
 func ValidateSessionAPI(c *gin.Context) bool {
-	cookie, err := c.Cookie("token")
+	if key, ok := bearerAPIKey(c); ok && HeadersEnabled() {
+		return validateAPIKey(c, key)
+	}
+
+	cookie, err := sessionToken(c)
 	if err != nil {
-		if err == http.ErrNoCookie {
+		if err == errNoToken {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired, please login again"})
 			return false
 		}
@@ -49,52 +162,168 @@ func ValidateSessionAPI(c *gin.Context) bool {
 	}
 
 	token, err := ValidateJWT(cookie)
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, signature invalid"})
+	grace := graceRead(c, token, err)
+	if err != nil && !grace {
+		tokenFailures.Inc(tokenFailureReason(err))
+		var validationErr *jwt.ValidationError
+		if !errors.As(err, &validationErr) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while validating token"})
 			return false
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while validating token"})
+		switch {
+		case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, signature invalid"})
+		case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired, please login again"})
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, invalid token"})
+		}
 		return false
 	}
 
-	if !token.Valid {
+	if !token.Valid && !grace {
+		tokenFailures.Inc(failureMalformed)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, invalid token"})
 		return false
 	}
+
+	// Expose the session's user id so handlers can scope queries to the caller
+	claims := token.Claims.(*Claims)
+	ctxkeys.SetUserID(c, claims.Username)
+	ctxkeys.SetRole(c, claims.Role)
+	ctxkeys.Set(c, ctxkeys.Claims, claims)
+
+	if err := checkSession(c, claims); err != nil {
+		if errors.Is(err, ErrSessionRevoked) {
+			tokenFailures.Inc(failureRevoked)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired, please login again"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while validating session"})
+		return false
+	}
+	return true
+}
+
+func validateAPIKey(c *gin.Context, key string) bool {
+	if apiKeyResolver == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, invalid API key"})
+		return false
+	}
+	userID, role, err := apiKeyResolver(c, key)
+	if err != nil {
+		if errors.Is(err, ErrSessionRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, invalid API key"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while validating API key"})
+		return false
+	}
+	ctxkeys.SetUserID(c, userID)
+	ctxkeys.SetRole(c, role)
 	return true
 }
 
-func GenerateJWT(userid string) (string, error, time.Time) {
+// SessionClaims returns the claims of the token ValidateSessionAPI accepted.
+// Requests authenticated with an API key have none.
+func SessionClaims(c *gin.Context) (*Claims, bool) {
+	value, ok := ctxkeys.Get(c, ctxkeys.Claims)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*Claims)
+	return claims, ok
+}
+
+// ExpiresIn returns how long the token behind claims remains valid.
+func ExpiresIn(claims *Claims) time.Duration {
+	return time.Unix(claims.ExpiresAt, 0).Sub(now())
+}
+
+// TokenUserID returns the user id in the request's session token if it is
+// validly signed and unexpired. It does not consult the database, so it
+// suits cheap decisions like rate limiting, not authorization.
+func TokenUserID(c *gin.Context) (string, bool) {
+	cookie, err := sessionToken(c)
+	if err != nil {
+		return "", false
+	}
+	token, err := ValidateJWT(cookie)
+	if err != nil || !token.Valid {
+		return "", false
+	}
+	return token.Claims.(*Claims).Username, true
+}
+
+// ValidateAdminAPI is ValidateSessionAPI for endpoints restricted to admins.
+func ValidateAdminAPI(c *gin.Context) bool {
+	if !ValidateSessionAPI(c) {
+		return false
+	}
+	if role, _ := ctxkeys.GetRole(c); role != RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return false
+	}
+	return true
+}
+
+func GenerateJWT(userid string, role string, version int) (string, error, time.Time) {
 	// Declare the expiration time of the token
 	// Extended to 2 hours for better demo experience
-	expirationTime := time.Now().Add(2 * time.Hour)
+	expirationTime := now().Add(2 * time.Hour)
 	// Create the JWT claims, which includes the username and expiry time
 	claims := &Claims{
 		Username: userid,
+		Role:     role,
+		Version:  version,
 		StandardClaims: jwt.StandardClaims{
 			// In JWT, the expiry time is expressed as unix milliseconds
 			ExpiresAt: expirationTime.Unix(),
+			IssuedAt:  now().Unix(),
 		},
 	}
+	// The token id names the session, so its activity can be tracked
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err, time.Time{}
+	}
+	claims.Id = hex.EncodeToString(id)
 
 	// Declare the token with the algorithm used for signing, and the claims
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	// Create the JWT string
-	tokenString, err := token.SignedString([]byte(SECRET_KEY))
+	tokenString, err := token.SignedString(SecretKey())
 
 	return tokenString, err, expirationTime
 }
 
+// ValidateJWT parses and verifies a session token. Malformed, oversized,
+// expired and badly signed tokens all fail with a *jwt.ValidationError; the
+// returned token is then invalid and must not be used.
 func ValidateJWT(token string) (jwt.Token, error) {
 	claims := &Claims{}
+	if len(token) > maxTokenLength {
+		return jwt.Token{Claims: claims}, jwt.NewValidationError("token is too long", jwt.ValidationErrorMalformed)
+	}
 	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(SECRET_KEY), nil
+		return SecretKey(), nil
 	})
+	// The parser returns no token at all for some malformed input, and a
+	// token without claims when the header does not decode
+	if tkn == nil {
+		return jwt.Token{Claims: claims}, err
+	}
+	if tkn.Claims == nil {
+		tkn.Claims = claims
+	}
 	return *tkn, err
 }
 
 func RefreshToken(c *gin.Context) (bool, error, time.Time) {
+	// Without cookies every login issues a fresh token
+	if !CookiesEnabled() {
+		return true, nil, time.Time{}
+	}
 
 	token, err := c.Cookie("token")
 	if err != nil {
@@ -104,17 +333,17 @@ func RefreshToken(c *gin.Context) (bool, error, time.Time) {
 		return true, err, time.Time{}
 	}
 
-	claims := &Claims{}
-	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(SECRET_KEY), nil
-	})
+	tkn, err := ValidateJWT(token)
 	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
+		// A token that fails validation is simply replaced at login
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) {
 			return true, nil, time.Time{}
 		}
 		return false, err, time.Time{}
 	}
-	if !tkn.Valid || time.Until(time.Unix(claims.ExpiresAt, 0)) > 30*time.Second {
+	claims := tkn.Claims.(*Claims)
+	if !tkn.Valid || time.Unix(claims.ExpiresAt, 0).Sub(now()) > 30*time.Second {
 		return true, nil, time.Unix(claims.ExpiresAt, 0)
 	}
 	return false, nil, time.Unix(claims.ExpiresAt, 0)
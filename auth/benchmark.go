@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// HashBenchmark is the cost of one password hash and one verification with
+// the configured hasher.
+type HashBenchmark struct {
+	Algorithm string  `json:"algorithm"`
+	Params    string  `json:"params"`
+	HashMS    float64 `json:"hash_ms"`
+	VerifyMS  float64 `json:"verify_ms"`
+}
+
+// BenchmarkHashing times hashing and verifying a random password with the
+// hasher new passwords use, so operators can size BCRYPT_COST against their
+// CPUs. It takes a hashing slot like a login does and stores nothing.
+func BenchmarkHashing() (HashBenchmark, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return HashBenchmark{}, err
+	}
+	password := base64.RawURLEncoding.EncodeToString(raw)
+
+	release, err := acquireHashSlot()
+	if err != nil {
+		return HashBenchmark{}, err
+	}
+	defer release()
+
+	hasher := NewPasswordHasher()
+	result := HashBenchmark{}
+	switch h := hasher.(type) {
+	case BcryptHasher:
+		result.Algorithm, result.Params = "bcrypt", fmt.Sprintf("cost=%d", h.Cost)
+	case Argon2idHasher:
+		result.Algorithm, result.Params = "argon2id", fmt.Sprintf("m=%d,t=%d,p=%d", h.Memory, h.Time, h.Threads)
+	}
+
+	start := time.Now()
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		return HashBenchmark{}, err
+	}
+	result.HashMS = milliseconds(time.Since(start))
+
+	start = time.Now()
+	ok, err := hasher.Verify(password, hash)
+	if err != nil {
+		return HashBenchmark{}, err
+	}
+	if !ok {
+		return HashBenchmark{}, errors.New("password did not verify against its own hash")
+	}
+	result.VerifyMS = milliseconds(time.Since(start))
+	return result, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBenchmarkHashing(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	for algo, params := range map[string]string{"bcrypt": "cost=4", "argon2id": "m="} {
+		t.Setenv("PASSWORD_ALGO", algo)
+		result, err := BenchmarkHashing()
+		if err != nil {
+			t.Fatalf("%s: %v", algo, err)
+		}
+		if result.Algorithm != algo || !strings.HasPrefix(result.Params, params) {
+			t.Errorf("%s: benchmarked %s with %q", algo, result.Algorithm, result.Params)
+		}
+		if result.HashMS <= 0 || result.VerifyMS <= 0 {
+			t.Errorf("%s: durations %v and %v, want both positive", algo, result.HashMS, result.VerifyMS)
+		}
+	}
+}
+
+func TestBenchmarkHashingTakesASlot(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	limitHashing(t, 1)
+	release, err := acquireHashSlot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	if _, err := BenchmarkHashing(); !errors.Is(err, ErrBusy) {
+		t.Fatalf("BenchmarkHashing with every slot taken: %v, want ErrBusy", err)
+	}
+}
+
+func TestBcryptCost(t *testing.T) {
+	for value, want := range map[string]int{"": defaultBcrypt.Cost, "4": 4, "12": 12, "3": defaultBcrypt.Cost, "32": defaultBcrypt.Cost, "cheap": defaultBcrypt.Cost} {
+		t.Setenv("BCRYPT_COST", value)
+		if got := BcryptCost(); got != want {
+			t.Errorf("BCRYPT_COST=%q: got %d, want %d", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrBusy is returned by HashPassword and VerifyPassword when every hashing
+// slot stayed taken for hashQueueTimeout.
+var ErrBusy = errors.New("password hashing is saturated")
+
+// hashQueueTimeout is how long a request waits for a hashing slot before
+// giving up with ErrBusy. Tests shorten it.
+var hashQueueTimeout = 2 * time.Second
+
+var (
+	hashSlotsOnce sync.Once
+	hashSlots     chan struct{}
+)
+
+// authMaxConcurrency reads AUTH_MAX_CONCURRENCY, the number of password
+// hashes computed at once. It defaults to the number of CPUs so hashing
+// cannot starve every other request.
+func authMaxConcurrency() int {
+	value := os.Getenv("AUTH_MAX_CONCURRENCY")
+	if value == "" {
+		return runtime.NumCPU()
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Invalid AUTH_MAX_CONCURRENCY %q, using %d", value, runtime.NumCPU())
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// acquireHashSlot waits for a free hashing slot and returns the function
+// releasing it.
+func acquireHashSlot() (release func(), err error) {
+	hashSlotsOnce.Do(func() {
+		hashSlots = make(chan struct{}, authMaxConcurrency())
+	})
+
+	timer := time.NewTimer(hashQueueTimeout)
+	defer timer.Stop()
+	select {
+	case hashSlots <- struct{}{}:
+		return func() { <-hashSlots }, nil
+	case <-timer.C:
+		return nil, ErrBusy
+	}
+}
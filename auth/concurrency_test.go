@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// limitHashing gives the test its own n hashing slots and a short queue
+// timeout.
+func limitHashing(t *testing.T, n int) {
+	// Create the real slots first, so they are what the cleanup restores
+	release, err := acquireHashSlot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	previousSlots, previousTimeout := hashSlots, hashQueueTimeout
+	hashSlots, hashQueueTimeout = make(chan struct{}, n), 50*time.Millisecond
+	t.Cleanup(func() { hashSlots, hashQueueTimeout = previousSlots, previousTimeout })
+}
+
+func TestHashingBeyondLimitIsBusy(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	limitHashing(t, 2)
+
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := acquireHashSlot()
+		if err != nil {
+			t.Fatalf("slot %d: %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+
+	if _, err := HashPassword("pw"); !errors.Is(err, ErrBusy) {
+		t.Fatalf("HashPassword with every slot taken: %v, want ErrBusy", err)
+	}
+	if _, err := VerifyPassword("pw", "$2a$04$abcdefghijklmnopqrstuu5Vq3Zt0mC2lLr7oY0y5vJ0S2QqDpcm."); !errors.Is(err, ErrBusy) {
+		t.Fatalf("VerifyPassword with every slot taken: %v, want ErrBusy", err)
+	}
+
+	releases[0]()
+	if _, err := HashPassword("pw"); err != nil {
+		t.Fatalf("HashPassword after a slot was freed: %v", err)
+	}
+	releases[1]()
+}
+
+func TestHashingRunsAtMostLimitAtOnce(t *testing.T) {
+	limitHashing(t, 2)
+	hashQueueTimeout = time.Second
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := acquireHashSlot()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if peak != 2 {
+		t.Fatalf("%d hashes ran at once, want 2", peak)
+	}
+}
+
+func TestAuthMaxConcurrency(t *testing.T) {
+	t.Setenv("AUTH_MAX_CONCURRENCY", "3")
+	if got := authMaxConcurrency(); got != 3 {
+		t.Errorf("AUTH_MAX_CONCURRENCY=3: got %d", got)
+	}
+	for _, value := range []string{"0", "-1", "lots"} {
+		t.Setenv("AUTH_MAX_CONCURRENCY", value)
+		if got := authMaxConcurrency(); got < 1 {
+			t.Errorf("AUTH_MAX_CONCURRENCY=%q: got %d, want the CPU default", value, got)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jeffthorne/tasky/metrics"
+)
+
+// Reasons a session token is rejected, used as the metric label.
+const (
+	failureExpired          = "expired"
+	failureSignatureInvalid = "signature_invalid"
+	failureMalformed        = "malformed"
+	failureRevoked          = "revoked"
+)
+
+// tokenFailures counts rejected session tokens by reason, so floods of
+// expired or tampered tokens show up in monitoring.
+var tokenFailures = metrics.NewCounterVec(
+	"tasky_jwt_validation_failures_total",
+	"Session tokens rejected during validation, by reason.",
+	"reason",
+	failureExpired, failureSignatureInvalid, failureMalformed, failureRevoked,
+)
+
+// tokenFailureReason maps a ValidateJWT error onto one of the fixed reasons.
+// Tokens signed with an unexpected algorithm fail signature verification.
+func tokenFailureReason(err error) string {
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) {
+		return failureMalformed
+	}
+	switch {
+	case validationErr.Errors&(jwt.ValidationErrorSignatureInvalid|jwt.ValidationErrorUnverifiable) != 0:
+		return failureSignatureInvalid
+	case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+		return failureExpired
+	default:
+		return failureMalformed
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+// failureDelta runs reject and returns how much each reason's counter grew.
+func failureDelta(reject func()) map[string]float64 {
+	reasons := []string{failureExpired, failureSignatureInvalid, failureMalformed, failureRevoked}
+	before := map[string]float64{}
+	for _, reason := range reasons {
+		before[reason] = tokenFailures.Value(reason)
+	}
+	reject()
+	delta := map[string]float64{}
+	for _, reason := range reasons {
+		if d := tokenFailures.Value(reason) - before[reason]; d != 0 {
+			delta[reason] = d
+		}
+	}
+	return delta
+}
+
+func TestTokenFailuresCountedByReason(t *testing.T) {
+	setNow(t, issued)
+	expired, _, _ := GenerateJWT("user", "", 0)
+	foreign, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{Username: "user"}).SignedString([]byte("another key"))
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, &Claims{Username: "user"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	setNow(t, issued.Add(3*time.Hour))
+
+	for name, tc := range map[string]struct {
+		token  string
+		reason string
+	}{
+		"expired":         {expired, failureExpired},
+		"wrong key":       {foreign, failureSignatureInvalid},
+		"unsigned (none)": {unsigned, failureSignatureInvalid},
+		"garbage":         {"not-a-jwt", failureMalformed},
+	} {
+		for _, validate := range []func(*gin.Context) bool{ValidateSessionAPI, ValidateSession} {
+			delta := failureDelta(func() {
+				c, _ := cookieContext(tc.token)
+				validate(c)
+			})
+			if len(delta) != 1 || delta[tc.reason] != 1 {
+				t.Errorf("%s: counters grew by %v, want %s by 1", name, delta, tc.reason)
+			}
+		}
+	}
+}
+
+func TestRevokedSessionsCounted(t *testing.T) {
+	SetSessionChecker(func(*gin.Context, *Claims) error { return ErrSessionRevoked })
+	defer SetSessionChecker(nil)
+
+	token, _, _ := GenerateJWT("user", "", 0)
+	delta := failureDelta(func() {
+		c, _ := cookieContext(token)
+		ValidateSessionAPI(c)
+	})
+	if len(delta) != 1 || delta[failureRevoked] != 1 {
+		t.Fatalf("counters grew by %v, want revoked by 1", delta)
+	}
+}
+
+func TestTokenFailureReasonDefaultsToMalformed(t *testing.T) {
+	if reason := tokenFailureReason(errors.New("not a validation error")); reason != failureMalformed {
+		t.Fatalf("reason = %q, want %q", reason, failureMalformed)
+	}
+	unverifiable := jwt.NewValidationError("no key", jwt.ValidationErrorUnverifiable)
+	if reason := tokenFailureReason(unverifiable); reason != failureSignatureInvalid {
+		t.Fatalf("unverifiable: reason = %q, want %q", reason, failureSignatureInvalid)
+	}
+}
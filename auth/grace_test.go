@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/featureflags"
+)
+
+// setGraceReads turns ALLOW_GRACE_READS on or off until the test ends.
+func setGraceReads(t *testing.T, enabled bool) {
+	t.Helper()
+	value := "false"
+	if enabled {
+		value = "true"
+	}
+	// Registered first so it runs after the variable is restored
+	t.Cleanup(func() { featureflags.Load() })
+	t.Setenv("ALLOW_GRACE_READS", value)
+	featureflags.Load()
+}
+
+// expiredToken returns a token that expired ago before the test clock.
+func expiredToken(t *testing.T, ago time.Duration) string {
+	t.Helper()
+	setNow(t, issued)
+	token, _, _ := GenerateJWT("user", "", 0)
+	setNow(t, issued.Add(2*time.Hour+ago))
+	return token
+}
+
+// requestWith returns a context for a method request carrying token, and
+// the headers of its response.
+func requestWith(method string, token string) (*gin.Context, http.Header) {
+	c, w := cookieContext(token)
+	c.Request.Method = method
+	return c, w.Header()
+}
+
+func TestGraceReadsAcceptRecentlyExpiredReads(t *testing.T) {
+	setGraceReads(t, true)
+	token := expiredToken(t, time.Minute)
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		c, header := requestWith(method, token)
+		if !ValidateSessionAPI(c) {
+			t.Fatalf("%s with a token expired a minute ago was rejected", method)
+		}
+		if header.Get("X-Token-Expired") != "true" {
+			t.Errorf("%s: X-Token-Expired = %q, want true", method, header.Get("X-Token-Expired"))
+		}
+	}
+
+	c, header := requestWith(http.MethodGet, token)
+	if !ValidateSession(c) || header.Get("X-Token-Expired") != "true" {
+		t.Error("the HTML session check does not allow the grace read")
+	}
+}
+
+func TestGraceReadsRejectWrites(t *testing.T) {
+	setGraceReads(t, true)
+	token := expiredToken(t, time.Minute)
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		c, _ := requestWith(method, token)
+		if ValidateSessionAPI(c) {
+			t.Errorf("%s with an expired token was accepted", method)
+		}
+	}
+}
+
+func TestGraceReadsWindow(t *testing.T) {
+	setGraceReads(t, true)
+	c, _ := requestWith(http.MethodGet, expiredToken(t, graceReadWindow+time.Second))
+	if ValidateSessionAPI(c) {
+		t.Fatal("a token expired beyond the grace window was accepted")
+	}
+}
+
+func TestGraceReadsRequireValidSignature(t *testing.T) {
+	setGraceReads(t, true)
+	token := expiredToken(t, time.Minute)
+	tampered := token[:len(token)-4] + "AAAA"
+	c, _ := requestWith(http.MethodGet, tampered)
+	if ValidateSessionAPI(c) {
+		t.Fatal("an expired token with a bad signature was accepted")
+	}
+}
+
+func TestGraceReadsOffByDefault(t *testing.T) {
+	setGraceReads(t, false)
+	token := expiredToken(t, time.Minute)
+	c, header := requestWith(http.MethodGet, token)
+	if ValidateSessionAPI(c) {
+		t.Fatal("an expired token was accepted with grace reads off")
+	}
+	if header.Get("X-Token-Expired") != "" {
+		t.Error("X-Token-Expired was set with grace reads off")
+	}
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"hash"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// IsLegacyHash reports whether stored was not produced by any PasswordHasher,
+// such as seed data or passwords from before hashing was introduced.
+func IsLegacyHash(stored string) bool {
+	if strings.HasPrefix(stored, argon2idPrefix) {
+		return false
+	}
+	_, err := bcrypt.Cost([]byte(stored))
+	return err != nil
+}
+
+// VerifyLegacyPassword checks password against a legacy stored value using
+// the scheme named by LEGACY_PASSWORD_SCHEME: plaintext, or a hex digest made
+// with md5, sha1 or sha256. With no scheme configured it always fails, so
+// legacy users stay locked out until an operator opts in.
+func VerifyLegacyPassword(password, stored string) bool {
+	var newHash func() hash.Hash
+	switch strings.ToLower(os.Getenv("LEGACY_PASSWORD_SCHEME")) {
+	case "plaintext":
+		return subtle.ConstantTimeCompare([]byte(password), []byte(stored)) == 1
+	case "md5":
+		newHash = md5.New
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	default:
+		return false
+	}
+
+	h := newHash()
+	h.Write([]byte(password))
+	digest := hex.EncodeToString(h.Sum(nil))
+	return subtle.ConstantTimeCompare([]byte(digest), []byte(strings.ToLower(stored))) == 1
+}
+
+// Kinds of stored password hash reported by HashKind.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+	HashLegacy   = "legacy"
+)
+
+// HashKind classifies a stored password hash, returning the bcrypt cost for
+// bcrypt hashes and 0 otherwise.
+func HashKind(stored string) (kind string, cost int) {
+	if strings.HasPrefix(stored, argon2idPrefix) {
+		return HashArgon2id, 0
+	}
+	cost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		return HashLegacy, 0
+	}
+	return HashBcrypt, cost
+}
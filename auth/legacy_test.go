@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestIsLegacyHash(t *testing.T) {
+	bcryptHash, _ := BcryptHasher{Cost: bcrypt.MinCost}.Hash("pw")
+	argon2Hash, _ := Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}.Hash("pw")
+	for stored, want := range map[string]bool{
+		bcryptHash:                         false,
+		argon2Hash:                         false,
+		"hunter2":                          true,
+		"2ab96390c7dbe3439de74d0c9b0b1767": true,
+		"":                                 true,
+	} {
+		if got := IsLegacyHash(stored); got != want {
+			t.Errorf("IsLegacyHash(%q) = %v, want %v", stored, got, want)
+		}
+	}
+
+	if kind, cost := HashKind(bcryptHash); kind != HashBcrypt || cost != bcrypt.MinCost {
+		t.Errorf("HashKind(bcrypt) = %s, %d", kind, cost)
+	}
+	if kind, _ := HashKind(argon2Hash); kind != HashArgon2id {
+		t.Errorf("HashKind(argon2id) = %s", kind)
+	}
+	if kind, _ := HashKind("hunter2"); kind != HashLegacy {
+		t.Errorf("HashKind(plaintext) = %s", kind)
+	}
+}
+
+func TestVerifyLegacyPassword(t *testing.T) {
+	tests := []struct {
+		scheme string
+		stored string
+	}{
+		{"plaintext", "hunter2"},
+		{"md5", "2ab96390c7dbe3439de74d0c9b0b1767"},
+		{"sha1", "F3BBBD66A63D4BF1747940578EC3D0103530E21D"},
+		{"sha256", "f52fbd32b2b3b86ff88ef6c490628285f482af15ddcb29541f94bcf526a3f6c7"},
+	}
+	for _, tt := range tests {
+		t.Setenv("LEGACY_PASSWORD_SCHEME", tt.scheme)
+		if !VerifyLegacyPassword("hunter2", tt.stored) {
+			t.Errorf("%s: the right password was rejected", tt.scheme)
+		}
+		if VerifyLegacyPassword("hunter3", tt.stored) {
+			t.Errorf("%s: a wrong password was accepted", tt.scheme)
+		}
+	}
+
+	t.Setenv("LEGACY_PASSWORD_SCHEME", "")
+	if VerifyLegacyPassword("hunter2", "hunter2") {
+		t.Error("a legacy password was accepted without a configured scheme")
+	}
+}
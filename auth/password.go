@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2idPrefix marks stored hashes produced by Argon2idHasher. Hashes
+// without it are treated as bcrypt, which covers every existing user.
+const argon2idPrefix = "$argon2id$"
+
+var errInvalidArgon2Hash = errors.New("invalid argon2id hash")
+
+// PasswordHasher hashes passwords for storage and checks them at login.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+}
+
+// BcryptHasher hashes passwords with bcrypt at the given cost.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(bytes), err
+}
+
+func (h BcryptHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Argon2idHasher hashes passwords with Argon2id, encoding its parameters in
+// the PHC string format so they can change without breaking old hashes.
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32 // in KiB
+	Threads uint8
+	KeyLen  uint32
+	SaltLen int
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks password against hash using the parameters stored in hash,
+// not the receiver's, so hashes created with older settings keep working.
+func (h Argon2idHasher) Verify(password, hash string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errInvalidArgon2Hash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errInvalidArgon2Hash
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errInvalidArgon2Hash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errInvalidArgon2Hash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, errInvalidArgon2Hash
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+var (
+	defaultBcrypt   = BcryptHasher{Cost: 14}
+	defaultArgon2id = Argon2idHasher{Time: 1, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+)
+
+// BcryptCost reads BCRYPT_COST, falling back to the default cost when it is
+// unset or outside what bcrypt accepts.
+func BcryptCost() int {
+	value := os.Getenv("BCRYPT_COST")
+	if value == "" {
+		return defaultBcrypt.Cost
+	}
+	cost, err := strconv.Atoi(value)
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		log.Printf("Invalid BCRYPT_COST %q, using %d", value, defaultBcrypt.Cost)
+		return defaultBcrypt.Cost
+	}
+	return cost
+}
+
+// NewPasswordHasher returns the hasher for new passwords selected by
+// PASSWORD_ALGO ("bcrypt" or "argon2id"), defaulting to bcrypt at
+// BCRYPT_COST.
+func NewPasswordHasher() PasswordHasher {
+	switch strings.ToLower(os.Getenv("PASSWORD_ALGO")) {
+	case "argon2id":
+		return defaultArgon2id
+	default:
+		return BcryptHasher{Cost: BcryptCost()}
+	}
+}
+
+// hasherFor picks the hasher that produced a stored hash from its prefix.
+func hasherFor(hash string) PasswordHasher {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		return defaultArgon2id
+	}
+	return defaultBcrypt
+}
+
+// HashPassword hashes password with the configured algorithm.
+func HashPassword(password string) (string, error) {
+	release, err := acquireHashSlot()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return NewPasswordHasher().Hash(password)
+}
+
+// VerifyPassword checks password against a stored hash created by any
+// supported algorithm, so deployments can switch PASSWORD_ALGO without
+// locking out existing users.
+func VerifyPassword(password, hash string) (bool, error) {
+	release, err := acquireHashSlot()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return hasherFor(hash).Verify(password, hash)
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastArgon2id keeps the tests quick; Verify reads the parameters from the hash.
+var fastArgon2id = Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+
+func TestHashers(t *testing.T) {
+	for name, hasher := range map[string]PasswordHasher{
+		"bcrypt":   BcryptHasher{Cost: bcrypt.MinCost},
+		"argon2id": fastArgon2id,
+	} {
+		hash, err := hasher.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("%s: Hash: %v", name, err)
+		}
+		if ok, err := hasher.Verify("correct horse", hash); !ok || err != nil {
+			t.Errorf("%s: the right password did not verify: %v", name, err)
+		}
+		if ok, err := hasher.Verify("wrong horse", hash); ok || err != nil {
+			t.Errorf("%s: a wrong password verified or failed: %v", name, err)
+		}
+	}
+}
+
+func TestArgon2idHashFormat(t *testing.T) {
+	hash, err := fastArgon2id.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("hash %q does not carry its parameters", hash)
+	}
+	if _, err := fastArgon2id.Verify("correct horse", "$argon2id$v=19$garbage"); err == nil {
+		t.Fatal("a malformed hash was accepted")
+	}
+}
+
+func TestVerifyPasswordAcrossAlgorithms(t *testing.T) {
+	bcryptHash, _ := BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	argon2Hash, _ := fastArgon2id.Hash("correct horse")
+
+	for _, algo := range []string{"bcrypt", "argon2id"} {
+		t.Setenv("PASSWORD_ALGO", algo)
+		for _, hash := range []string{bcryptHash, argon2Hash} {
+			if ok, err := VerifyPassword("correct horse", hash); !ok || err != nil {
+				t.Errorf("PASSWORD_ALGO=%s: %.10s... did not verify: %v", algo, hash, err)
+			}
+		}
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	t.Setenv("PASSWORD_ALGO", "argon2id")
+	if _, ok := NewPasswordHasher().(Argon2idHasher); !ok {
+		t.Error("PASSWORD_ALGO=argon2id did not select Argon2id")
+	}
+	t.Setenv("PASSWORD_ALGO", "")
+	if _, ok := NewPasswordHasher().(BcryptHasher); !ok {
+		t.Error("bcrypt is not the default")
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	_ "embed"
+	"strings"
+	"unicode"
+)
+
+// MaxPasswordScore is the score of a password that passes every check.
+const MaxPasswordScore = 4
+
+//go:embed common-passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	set := map[string]bool{}
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[strings.ToLower(line)] = true
+		}
+	}
+	return set
+}()
+
+// PasswordStrength scores password from 0 (trivially guessable) to
+// MaxPasswordScore and lists what would make it stronger. It only inspects
+// the value; nothing is stored or logged.
+func PasswordStrength(password string) (int, []string) {
+	suggestions := []string{}
+
+	if commonPasswords[strings.ToLower(password)] {
+		return 0, append(suggestions, "Avoid common passwords that appear in breach lists")
+	}
+
+	var lower, upper, digit, symbol bool
+	length := 0
+	for _, r := range password {
+		length++
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+
+	score := 0
+	if length >= 8 {
+		score++
+	} else {
+		suggestions = append(suggestions, "Use at least 8 characters")
+	}
+	if length >= 12 {
+		score++
+	} else if length >= 8 {
+		suggestions = append(suggestions, "Use 12 or more characters")
+	}
+	if classes >= 3 {
+		score++
+	} else {
+		suggestions = append(suggestions, "Mix upper and lower case letters, numbers and symbols")
+	}
+	if classes == 4 || length >= 16 {
+		score++
+	} else if classes == 3 {
+		suggestions = append(suggestions, "Add a symbol or make the password longer")
+	}
+
+	return score, suggestions
+}
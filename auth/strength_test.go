@@ -0,0 +1,28 @@
+package auth
+
+import "testing"
+
+func TestPasswordStrengthWeak(t *testing.T) {
+	for _, password := range []string{"password", "Password", "abc", "short1!"} {
+		score, suggestions := PasswordStrength(password)
+		if score > 1 || len(suggestions) == 0 {
+			t.Errorf("PasswordStrength(%q) = %d, %v; want a low score with suggestions", password, score, suggestions)
+		}
+	}
+}
+
+func TestPasswordStrengthCommonPassword(t *testing.T) {
+	score, suggestions := PasswordStrength("QWERTY123")
+	if score != 0 || len(suggestions) != 1 {
+		t.Fatalf("a common password scored %d with %v", score, suggestions)
+	}
+}
+
+func TestPasswordStrengthStrong(t *testing.T) {
+	for _, password := range []string{"Tr1cky-Horse-Battery", "Zebra#Lamp7Quiet"} {
+		score, suggestions := PasswordStrength(password)
+		if score != MaxPasswordScore || len(suggestions) != 0 {
+			t.Errorf("PasswordStrength(%q) = %d, %v; want the maximum score", password, score, suggestions)
+		}
+	}
+}
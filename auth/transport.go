@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Session token transports, selected with TOKEN_TRANSPORT.
+const (
+	TransportCookie = "cookie"
+	TransportHeader = "header"
+	TransportBoth   = "both"
+)
+
+// errNoToken is returned by sessionToken when the request carries no session
+// token in any enabled transport.
+var errNoToken = errors.New("no session token")
+
+// TokenTransport returns where session tokens travel: in the token cookie,
+// in an Authorization bearer header, or both, the default. Unknown values
+// also mean both.
+func TokenTransport() string {
+	switch transport := strings.ToLower(os.Getenv("TOKEN_TRANSPORT")); transport {
+	case TransportCookie, TransportHeader:
+		return transport
+	default:
+		return TransportBoth
+	}
+}
+
+// CookiesEnabled reports whether session tokens are set and read as cookies.
+func CookiesEnabled() bool {
+	return TokenTransport() != TransportHeader
+}
+
+// HeadersEnabled reports whether session tokens and API keys are read from
+// the Authorization header, and tokens are returned in response bodies.
+func HeadersEnabled() bool {
+	return TokenTransport() != TransportCookie
+}
+
+// bearerToken returns the credential sent as an Authorization bearer token.
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[len("Bearer "):])
+	return token, token != ""
+}
+
+// sessionToken returns the request's session token from the transports
+// TOKEN_TRANSPORT enables, preferring the Authorization header. API keys
+// sent as bearer tokens are not session tokens.
+func sessionToken(c *gin.Context) (string, error) {
+	if HeadersEnabled() {
+		if token, ok := bearerToken(c); ok && !strings.HasPrefix(token, APIKeyPrefix) {
+			return token, nil
+		}
+	}
+	if !CookiesEnabled() {
+		return "", errNoToken
+	}
+	cookie, err := c.Cookie("token")
+	if err == http.ErrNoCookie {
+		return "", errNoToken
+	}
+	return cookie, err
+}
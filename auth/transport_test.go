@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenTransport(t *testing.T) {
+	for value, want := range map[string]string{"": TransportBoth, "cookie": TransportCookie, "HEADER": TransportHeader, "both": TransportBoth, "carrier-pigeon": TransportBoth} {
+		t.Setenv("TOKEN_TRANSPORT", value)
+		if got := TokenTransport(); got != want {
+			t.Errorf("TOKEN_TRANSPORT=%q: got %q, want %q", value, got, want)
+		}
+	}
+}
+
+// headerContext returns a test context whose request carries token as an
+// Authorization bearer token.
+func headerContext(token string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("Authorization", "Bearer "+token)
+	return c, w
+}
+
+func TestSessionTransports(t *testing.T) {
+	token, _, _ := GenerateJWT("user", "", 0)
+	for _, tc := range []struct {
+		transport      string
+		cookie, header bool
+	}{
+		{TransportBoth, true, true},
+		{TransportCookie, true, false},
+		{TransportHeader, false, true},
+	} {
+		t.Setenv("TOKEN_TRANSPORT", tc.transport)
+
+		c, w := cookieContext(token)
+		if got := ValidateSessionAPI(c); got != tc.cookie {
+			t.Errorf("TOKEN_TRANSPORT=%s: cookie accepted = %v, want %v", tc.transport, got, tc.cookie)
+		}
+		if !tc.cookie && w.Code != http.StatusUnauthorized {
+			t.Errorf("TOKEN_TRANSPORT=%s: rejected cookie status = %d, want 401", tc.transport, w.Code)
+		}
+		if c, _ := cookieContext(token); ValidateSession(c) != tc.cookie {
+			t.Errorf("TOKEN_TRANSPORT=%s: page session from cookie accepted = %v, want %v", tc.transport, !tc.cookie, tc.cookie)
+		}
+
+		c, w = headerContext(token)
+		if got := ValidateSessionAPI(c); got != tc.header {
+			t.Errorf("TOKEN_TRANSPORT=%s: header accepted = %v, want %v", tc.transport, got, tc.header)
+		}
+		if !tc.header && w.Code != http.StatusUnauthorized {
+			t.Errorf("TOKEN_TRANSPORT=%s: rejected header status = %d, want 401", tc.transport, w.Code)
+		}
+	}
+}
+
+func TestRefreshTokenWithoutCookies(t *testing.T) {
+	t.Setenv("TOKEN_TRANSPORT", TransportHeader)
+	token, _, _ := GenerateJWT("user", "", 0)
+	if refresh, err, _ := RefreshToken(refreshContext(token)); !refresh || err != nil {
+		t.Fatalf("RefreshToken = %v, %v; want a fresh token for every login", refresh, err)
+	}
+}
@@ -0,0 +1,65 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNoopVerifier(t *testing.T) {
+	if ok, _ := (NoopVerifier{}).Verify(context.Background(), "", ""); ok {
+		t.Error("an empty token was accepted")
+	}
+	if ok, _ := (NoopVerifier{}).Verify(context.Background(), "anything", ""); !ok {
+		t.Error("a token was rejected")
+	}
+}
+
+func TestSiteVerifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("secret") != "s3cret" || r.PostFormValue("remoteip") != "192.0.2.1" {
+			t.Errorf("form = %v", r.PostForm)
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"success": r.PostFormValue("response") == "good"})
+	}))
+	defer server.Close()
+	verifier := SiteVerifier{URL: server.URL, Secret: "s3cret", Client: server.Client()}
+
+	for token, want := range map[string]bool{"good": true, "bad": false} {
+		ok, err := verifier.Verify(context.Background(), token, "192.0.2.1")
+		if err != nil || ok != want {
+			t.Errorf("Verify(%q) = %v, %v; want %v", token, ok, err, want)
+		}
+	}
+}
+
+func TestSiteVerifierReportsProviderErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ok, err := SiteVerifier{URL: server.URL, Client: server.Client()}.Verify(context.Background(), "good", "")
+	if ok || err == nil {
+		t.Fatalf("Verify = %v, %v; want an error", ok, err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("CAPTCHA_SECRET", "s3cret")
+	for provider, want := range map[string]string{"hcaptcha": HCaptchaURL, "Turnstile": TurnstileURL} {
+		t.Setenv("CAPTCHA_PROVIDER", provider)
+		verifier, ok := FromEnv().(SiteVerifier)
+		if !ok || verifier.URL != want || verifier.Secret != "s3cret" {
+			t.Errorf("CAPTCHA_PROVIDER=%s: got %+v", provider, verifier)
+		}
+	}
+	for _, provider := range []string{"", "none", "recaptcha"} {
+		t.Setenv("CAPTCHA_PROVIDER", provider)
+		if _, ok := FromEnv().(NoopVerifier); !ok {
+			t.Errorf("CAPTCHA_PROVIDER=%q did not fall back to NoopVerifier", provider)
+		}
+	}
+}
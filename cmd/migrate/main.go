@@ -0,0 +1,44 @@
+// Command migrate brings existing data up to the current schema: it converts
+// todo owners to ObjectIDs, backfills timestamps and default statuses,
+// lowercases emails and creates the indexes the server relies on, in the
+// default database and every tenant database. It is safe to run repeatedly.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	controller "github.com/jeffthorne/tasky/controllers"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/migrate"
+)
+
+func main() {
+	if database.Client == nil {
+		log.Fatal("migrate needs a MongoDB connection; unset SKIP_DB_INIT")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	failed := false
+	for _, tenant := range append([]string{""}, database.Tenants()...) {
+		db := database.Client.Database(database.TenantDatabase(tenant))
+		report, err := migrate.Run(ctx, db)
+		fmt.Print(report)
+		if err != nil {
+			log.Printf("Migration of %v failed: %v", db.Name(), err)
+			failed = true
+			continue
+		}
+		if err := controller.EnsureIndexes(ctx, tenant); err != nil {
+			log.Printf("Migration of %v failed: %v", db.Name(), err)
+			failed = true
+		}
+	}
+	if failed {
+		log.Fatal("migration incomplete")
+	}
+}
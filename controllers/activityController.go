@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxActivityDays is the longest range one activity report may cover.
+const maxActivityDays = 366
+
+// ActivityDay is the number of todos last modified on one day.
+type ActivityDay struct {
+	Date  string `json:"date" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// activityReport is the single document produced by the activity aggregation.
+type activityReport struct {
+	Todos []models.Todo `json:"todos" bson:"todos"`
+	Days  []ActivityDay `json:"days" bson:"days"`
+}
+
+// TodoActivity lists the session user's todos last modified between the from
+// and to query parameters, newest first, along with a per-day count for an
+// activity heatmap. Days are bucketed in the tz time zone (default UTC) and
+// days without activity are omitted.
+func TodoActivity(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	from, err := parseSearchTime(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time or a YYYY-MM-DD date"})
+		return
+	}
+	to, err := parseSearchTime(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time or a YYYY-MM-DD date"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	if to.Sub(from) > maxActivityDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the range may cover at most " + strconv.Itoa(maxActivityDays) + " days"})
+		return
+	}
+	loc, ok := locationFromQuery(c)
+	if !ok {
+		return
+	}
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	// One round trip: the matching todos and their daily counts side by side
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{
+			"userid":     ownerMatch(owner),
+			"updated_at": bson.M{"$gte": from, "$lte": to},
+		}},
+		bson.M{"$facet": bson.M{
+			"todos": bson.A{
+				bson.M{"$sort": bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: 1}}},
+				bson.M{"$project": bson.M{"notes": 0}},
+			},
+			"days": bson.A{
+				bson.M{"$group": bson.M{
+					"_id": bson.M{"$dateToString": bson.M{
+						"format":   "%Y-%m-%d",
+						"date":     "$updated_at",
+						"timezone": loc.String(),
+					}},
+					"count": bson.M{"$sum": 1},
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+		}},
+	}
+	cursor, err := todosForRead(c, owner.Hex()).Aggregate(ctx, pipeline)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	var results []activityReport
+	if err := cursor.All(ctx, &results); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	report := activityReport{Todos: []models.Todo{}, Days: []ActivityDay{}}
+	if len(results) > 0 {
+		if results[0].Todos != nil {
+			report.Todos = results[0].Todos
+		}
+		if results[0].Days != nil {
+			report.Days = results[0].Days
+		}
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// activityReportFor requests the session user's activity report with query.
+func activityReportFor(t *testing.T, query string) testRequest {
+	return testRequest{method: http.MethodGet, route: "/todos/activity", path: "/todos/activity?" + query, cookie: sessionCookie(t, newTestUser(t, ""))}
+}
+
+// aggregatePipeline returns the stages of the aggregate command sent.
+func aggregatePipeline(t *testing.T, mt *mtest.T) bson.Raw {
+	t.Helper()
+	for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+		if evt.CommandName == "aggregate" {
+			return evt.Command.Lookup("pipeline").Array()
+		}
+	}
+	t.Fatal("no aggregate command was sent")
+	return nil
+}
+
+func TestTodoActivityRangeAndDays(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	edits := map[string]time.Time{
+		"before":     time.Date(2024, 6, 1, 21, 59, 59, 0, time.UTC),
+		"first":      time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC),
+		"late night": time.Date(2024, 6, 2, 23, 30, 0, 0, time.UTC),
+		"same day":   time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC),
+		"last":       time.Date(2024, 6, 3, 21, 59, 59, 0, time.UTC),
+		"after":      time.Date(2024, 6, 3, 22, 0, 0, 0, time.UTC),
+	}
+
+	withMockDB(t, "paris", func(mt *mtest.T) {
+		reply := bson.M{
+			"todos": bson.A{bson.M{"_id": primitive.NewObjectID(), "name": "last", "status": "pending"}},
+			"days":  bson.A{bson.M{"_id": "2024-06-02", "count": 1}, bson.M{"_id": "2024-06-03", "count": 3}},
+		}
+		mt.AddMockResponses(cursorResponse(reply))
+		w := serve(TodoActivity, activityReportFor(t, "from=2024-06-01T22:00:00Z&to=2024-06-03T21:59:59Z&tz=Europe/Paris"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		pipeline := aggregatePipeline(t, mt)
+		match := pipeline.Index(0).Value().Document().Lookup("$match", "updated_at")
+		from, to := match.Document().Lookup("$gte").Time(), match.Document().Lookup("$lte").Time()
+		group := pipeline.Index(1).Value().Document().Lookup("$facet", "days").Array().Index(0).Value().Document()
+		zone := group.Lookup("$group", "_id", "$dateToString", "timezone").StringValue()
+		loc, err := time.LoadLocation(zone)
+		if err != nil || loc.String() != paris.String() {
+			t.Fatalf("days bucketed in %q, want Europe/Paris", zone)
+		}
+
+		days := map[string]int{}
+		for name, at := range edits {
+			within := !at.Before(from) && !at.After(to)
+			if want := name != "before" && name != "after"; within != want {
+				t.Errorf("the %s edit at %v is in the range: %v, want %v", name, at, within, want)
+			}
+			if within {
+				days[at.In(loc).Format("2006-01-02")]++
+			}
+		}
+		if want := map[string]int{"2024-06-02": 1, "2024-06-03": 3}; !reflect.DeepEqual(days, want) {
+			t.Errorf("daily counts %v, want %v", days, want)
+		}
+
+		var report struct {
+			Todos []struct {
+				Name string `json:"name"`
+			} `json:"todos"`
+			Days []ActivityDay `json:"days"`
+		}
+		decodeBody(t, w, &report)
+		if len(report.Todos) != 1 || !reflect.DeepEqual(report.Days, []ActivityDay{{"2024-06-02", 1}, {"2024-06-03", 3}}) {
+			t.Errorf("report %+v", report)
+		}
+	})
+
+	withMockDB(t, "no activity", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"todos": bson.A{}, "days": bson.A{}}))
+		w := serve(TodoActivity, activityReportFor(t, "from=2024-06-01&to=2024-06-03"))
+		if w.Code != http.StatusOK || w.Body.String() != `{"todos":[],"days":[]}` {
+			t.Errorf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestTodoActivityValidatesRange(t *testing.T) {
+	for _, query := range []string{
+		"to=2024-06-03",
+		"from=2024-06-01",
+		"from=June&to=2024-06-03",
+		"from=2024-06-03T00:00:00Z&to=2024-06-03T00:00:00Z",
+		"from=2024-06-03&to=2024-06-01",
+		"from=2023-01-01&to=2024-06-03",
+		"from=2024-06-01&to=2024-06-03&tz=Mars/Olympus",
+	} {
+		if w := serve(TodoActivity, activityReportFor(t, query)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/featureflags"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetFlags reports the effective feature flags for operators.
+func GetFlags(c *gin.Context) {
+	if !auth.ValidateAdminAPI(c) {
+		return
+	}
+	c.JSON(http.StatusOK, featureflags.Current())
+}
+
+// ReactivateUser restores a deactivated account so it can log in again.
+// Tokens revoked at deactivation stay revoked.
+func ReactivateUser(c *gin.Context) {
+	if !auth.ValidateAdminAPI(c) {
+		return
+	}
+
+	objId, ok := parseID(c, "id", "user")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	updateResult, err := usersFor(c).UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": bson.M{"active": true, "updated_at": models.Now()}})
+	if err != nil {
+		log.Printf("Error reactivating user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "account was not reactivated"})
+		return
+	}
+	if updateResult.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	invalidateSessionUser(c, objId)
+
+	c.JSON(http.StatusOK, gin.H{"success": "account reactivated"})
+}
+
+// adminUser is the view of an account shown to admins; it leaves out the
+// password hash and tokens.
+type adminUser struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Username  string             `json:"username" bson:"name"`
+	Email     string             `json:"email" bson:"email"`
+	Role      string             `json:"role,omitempty" bson:"role,omitempty"`
+	Active    *bool              `json:"-" bson:"active,omitempty"`
+	CreatedAt models.JSONTime    `json:"created_at" bson:"created_at,omitempty"`
+}
+
+// MarshalJSON reports the account state as a plain boolean.
+func (u adminUser) MarshalJSON() ([]byte, error) {
+	type user adminUser
+	return json.Marshal(struct {
+		user
+		Active bool `json:"active"`
+	}{user(u), u.Active == nil || *u.Active})
+}
+
+// userPage is the paginated envelope for the admin user list.
+type userPage struct {
+	Items []adminUser `json:"items"`
+	Page  int         `json:"page"`
+	Limit int         `json:"limit"`
+	Total int64       `json:"total"`
+}
+
+// ListUsers lists accounts for admins, newest first. q matches a substring
+// of the username or email, and created_from/created_to bound the signup
+// time, for cohort analysis.
+func ListUsers(c *gin.Context) {
+	if !auth.ValidateAdminAPI(c) {
+		return
+	}
+
+	filter := bson.M{}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+		filter["$or"] = bson.A{bson.M{"name": pattern}, bson.M{"email": pattern}}
+	}
+	created, ok := timeRange(c, "created_from", "created_to")
+	if !ok {
+		return
+	}
+	if created != nil {
+		filter["created_at"] = created
+	}
+	page, limit, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	total, err := usersFor(c).CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	findOptions := options.Find().
+		SetProjection(bson.M{"name": 1, "email": 1, "role": 1, "active": 1, "created_at": 1}).
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := usersFor(c).Find(ctx, filter, findOptions)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	users := []adminUser{}
+	if err := cursor.All(ctx, &users); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userPage{Items: users, Page: page, Limit: limit, Total: total})
+}
+
+// MaintenanceGate refuses writes with 503 while maintenance mode is enabled,
+// leaving reads available.
+func MaintenanceGate(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if featureflags.MaintenanceMode() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"code": "MAINTENANCE", "error": "the service is in maintenance mode, please try again later"})
+			return
+		}
+	}
+	c.Next()
+}
+
+// AuthBenchmark times one password hash and verification at the configured
+// algorithm and cost, to help operators choose BCRYPT_COST. Nothing is
+// stored.
+func AuthBenchmark(c *gin.Context) {
+	if !auth.ValidateAdminAPI(c) {
+		return
+	}
+
+	result, err := auth.BenchmarkHashing()
+	if errors.Is(err, auth.ErrBusy) {
+		respondAuthBusy(c)
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// hashAuditTimeout bounds the user scan behind HashAudit.
+const hashAuditTimeout = time.Minute
+
+// hashAudit counts stored password hashes by kind and bcrypt cost.
+type hashAudit struct {
+	Total int `json:"total"`
+	// BcryptCosts maps each bcrypt cost to the number of hashes using it
+	BcryptCosts map[int]int `json:"bcrypt_costs"`
+	Argon2id    int         `json:"argon2id"`
+	Legacy      int         `json:"legacy"`
+	Missing     int         `json:"missing"`
+	// TargetCost is BCRYPT_COST; BelowTarget counts bcrypt hashes cheaper
+	// than it, which are upgraded only when those users next change password
+	TargetCost  int `json:"target_cost"`
+	BelowTarget int `json:"below_target"`
+}
+
+func newHashAudit(targetCost int) *hashAudit {
+	return &hashAudit{BcryptCosts: map[int]int{}, TargetCost: targetCost}
+}
+
+func (a *hashAudit) add(stored *string) {
+	a.Total++
+	if stored == nil || *stored == "" {
+		a.Missing++
+		return
+	}
+	switch kind, cost := auth.HashKind(*stored); kind {
+	case auth.HashBcrypt:
+		a.BcryptCosts[cost]++
+		if cost < a.TargetCost {
+			a.BelowTarget++
+		}
+	case auth.HashArgon2id:
+		a.Argon2id++
+	default:
+		a.Legacy++
+	}
+}
+
+// HashAudit reports how the stored password hashes break down by algorithm
+// and bcrypt cost, so operators can follow a BCRYPT_COST rollout. Users are
+// streamed with only their hash projected, never loaded all at once.
+func HashAudit(c *gin.Context) {
+	if !auth.ValidateAdminAPI(c) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), hashAuditTimeout)
+	defer cancel()
+
+	findOptions := options.Find().
+		SetProjection(bson.M{"password": 1}).
+		SetBatchSize(500)
+	cursor, err := usersFor(c).Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	audit := newHashAudit(auth.BcryptCost())
+	for cursor.Next(ctx) {
+		var user struct {
+			Password *string `bson:"password"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		audit.add(user.Password)
+	}
+	if err := cursor.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, audit)
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/featureflags"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetFlags(t *testing.T) {
+	admin := newTestUser(t, auth.RoleAdmin)
+	w := serve(GetFlags, testRequest{method: http.MethodGet, route: "/admin/flags", path: "/admin/flags", cookie: sessionCookie(t, admin)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var flags featureflags.Flags
+	decodeBody(t, w, &flags)
+	if flags != featureflags.Current() {
+		t.Fatalf("flags = %+v, want %+v", flags, featureflags.Current())
+	}
+}
+
+func TestGetFlagsRequiresAdmin(t *testing.T) {
+	user := newTestUser(t, "")
+	w := serve(GetFlags, testRequest{method: http.MethodGet, route: "/admin/flags", path: "/admin/flags", cookie: sessionCookie(t, user)})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+	w = serve(GetFlags, testRequest{method: http.MethodGet, route: "/admin/flags", path: "/admin/flags"})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d without a session, want 401", w.Code)
+	}
+}
+
+func TestReactivateUser(t *testing.T) {
+	admin := newTestUser(t, auth.RoleAdmin)
+	id := primitive.NewObjectID()
+	reactivate := testRequest{method: http.MethodPost, route: "/admin/users/:id/reactivate", path: "/admin/users/" + id.Hex() + "/reactivate", cookie: sessionCookie(t, admin)}
+
+	withMockDB(t, "reactivate", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		if w := serve(ReactivateUser, reactivate); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if !statement.Lookup("u", "$set", "active").Boolean() || statement.Lookup("q", "_id").ObjectID() != id {
+			t.Fatalf("update %v does not reactivate the user", statement)
+		}
+	})
+
+	withMockDB(t, "missing", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		if w := serve(ReactivateUser, reactivate); w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", w.Code)
+		}
+	})
+}
+
+// listUsers lists users as admin with the given query string.
+func listUsers(t *testing.T, query string) testRequest {
+	admin := newTestUser(t, auth.RoleAdmin)
+	return testRequest{method: http.MethodGet, route: "/admin/users", path: "/admin/users?" + query, cookie: sessionCookie(t, admin)}
+}
+
+func TestListUsersSignupRange(t *testing.T) {
+	before := time.Date(2024, 2, 29, 23, 59, 59, 0, time.UTC)
+	first := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(2024, 3, 31, 23, 30, 0, 0, time.UTC)
+	after := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	withMockDB(t, "march", func(mt *mtest.T) {
+		within := []interface{}{
+			bson.M{"_id": primitive.NewObjectID(), "name": "Last", "email": "last@example.com", "created_at": last},
+			bson.M{"_id": primitive.NewObjectID(), "name": "First", "email": "first@example.com", "created_at": first},
+		}
+		mt.AddMockResponses(cursorResponse(bson.M{"n": 2}), cursorResponse(within...))
+		w := serve(ListUsers, listUsers(t, "created_from=2024-03-01&created_to=2024-03-31&q=example&limit=10&page=2"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var page struct {
+			Items []struct {
+				Username  string `json:"username"`
+				CreatedAt string `json:"created_at"`
+			} `json:"items"`
+			Page  int   `json:"page"`
+			Limit int   `json:"limit"`
+			Total int64 `json:"total"`
+		}
+		decodeBody(t, w, &page)
+		if page.Total != 2 || len(page.Items) != 2 || page.Page != 2 || page.Limit != 10 {
+			t.Fatalf("page = %+v", page)
+		}
+
+		var find bson.Raw
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "find" {
+				find = evt.Command
+			}
+		}
+		from := find.Lookup("filter", "created_at", "$gte").Time()
+		to := find.Lookup("filter", "created_at", "$lte").Time()
+		for signup, want := range map[time.Time]bool{before: false, first: true, last: true, after: false} {
+			if got := !signup.Before(from) && !signup.After(to); got != want {
+				t.Errorf("a signup at %v matches the range: %v, want %v", signup, got, want)
+			}
+		}
+		if _, err := find.LookupErr("filter", "$or"); err != nil {
+			t.Error("q is not combined with the date range")
+		}
+		if skip := find.Lookup("skip").AsInt64(); skip != 10 {
+			t.Errorf("skip = %d, want 10", skip)
+		}
+	})
+}
+
+func TestListUsersRejectsBadRanges(t *testing.T) {
+	for _, query := range []string{
+		"created_from=yesterday",
+		"created_to=2024-13-01",
+		"created_from=2024-04-01&created_to=2024-03-01",
+		"created_from=2024-03-02T00:00:00Z&created_to=2024-03-01T23:59:59Z",
+	} {
+		if w := serve(ListUsers, listUsers(t, query)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestAuthBenchmark(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	benchmark := func(role string) testRequest {
+		return testRequest{method: http.MethodGet, route: "/admin/auth-benchmark", path: "/admin/auth-benchmark", cookie: sessionCookie(t, newTestUser(t, role))}
+	}
+
+	if w := serve(AuthBenchmark, benchmark("")); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: status = %d, want 403", w.Code)
+	}
+
+	withMockDB(t, "admin", func(mt *mtest.T) {
+		w := serve(AuthBenchmark, benchmark("admin"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var result auth.HashBenchmark
+		decodeBody(t, w, &result)
+		if result.HashMS <= 0 || result.VerifyMS <= 0 || result.Params != "cost=4" {
+			t.Errorf("benchmark %+v, want positive durations at cost 4", result)
+		}
+		if evt := mt.GetStartedEvent(); evt != nil {
+			t.Errorf("the benchmark sent %s to the database", evt.CommandName)
+		}
+	})
+}
+
+func TestHashAudit(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "5")
+	admin := newTestUser(t, "admin")
+	hash := func(cost int) string {
+		h, _ := auth.BcryptHasher{Cost: cost}.Hash("pw")
+		return h
+	}
+	argon2Hash, _ := auth.Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}.Hash("pw")
+	cost4, cost5, cost6 := hash(4), hash(5), hash(6)
+
+	withMockDB(t, "mixed costs", func(mt *mtest.T) {
+		var users []interface{}
+		for _, stored := range []string{cost4, cost4, cost4, cost5, cost6, argon2Hash, "hunter2"} {
+			users = append(users, bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "password", Value: stored}})
+		}
+		users = append(users, bson.D{{Key: "_id", Value: primitive.NewObjectID()}})
+		mt.AddMockResponses(cursorResponse(users...))
+
+		w := serve(HashAudit, testRequest{method: http.MethodGet, route: "/admin/hash-audit", path: "/admin/hash-audit", cookie: sessionCookie(t, admin)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var audit hashAudit
+		decodeBody(t, w, &audit)
+		want := hashAudit{
+			Total: 8, BcryptCosts: map[int]int{4: 3, 5: 1, 6: 1},
+			Argon2id: 1, Legacy: 1, Missing: 1, TargetCost: 5, BelowTarget: 3,
+		}
+		if !reflect.DeepEqual(audit, want) {
+			t.Errorf("audit %+v, want %+v", audit, want)
+		}
+
+		evt := mt.GetStartedEvent()
+		if evt == nil || evt.CommandName != "find" {
+			t.Fatalf("got %v, want a find of the users", evt)
+		}
+		if elems, _ := evt.Command.Lookup("projection").Document().Elements(); len(elems) != 1 || elems[0].Key() != "password" {
+			t.Errorf("users loaded with projection %v, want only the password", evt.Command.Lookup("projection"))
+		}
+	})
+
+	w := serve(HashAudit, testRequest{method: http.MethodGet, route: "/admin/hash-audit", path: "/admin/hash-audit", cookie: sessionCookie(t, newTestUser(t, ""))})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: status = %d, want 403", w.Code)
+	}
+}
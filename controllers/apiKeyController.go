@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxAPIKeyNameLength caps the label users give their API keys.
+const maxAPIKeyNameLength = 100
+
+func init() {
+	auth.SetAPIKeyResolver(resolveAPIKey)
+
+	ensureIndex("api_keys", mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+}
+
+// apiKeysFor returns the API key collection of the request's tenant.
+func apiKeysFor(c *gin.Context) *mongo.Collection {
+	return database.OpenTenantCollection(database.Client, requestTenant(c), "api_keys")
+}
+
+// resolveAPIKey authenticates an API key for auth.ValidateSessionAPI. The
+// owner's role and active state are read on every request, as for sessions.
+func resolveAPIKey(c *gin.Context, key string) (string, string, error) {
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	var apiKey models.APIKey
+	err := apiKeysFor(c).FindOne(ctx, bson.M{"hash": auth.HashAPIKey(key)}).Decode(&apiKey)
+	if err == mongo.ErrNoDocuments {
+		return "", "", auth.ErrSessionRevoked
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	objId, err := primitive.ObjectIDFromHex(apiKey.UserID)
+	if err != nil {
+		return "", "", auth.ErrSessionRevoked
+	}
+	user, err := sessionUser(ctx, c, objId)
+	if err == mongo.ErrNoDocuments || err == nil && !user.IsActive() {
+		return "", "", auth.ErrSessionRevoked
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := apiKeysFor(c).UpdateOne(ctx, bson.M{"_id": apiKey.ID}, bson.M{"$set": bson.M{"last_used_at": models.Now()}}); err != nil {
+		log.Printf("Error recording API key use: %v", err)
+	}
+	return apiKey.UserID, user.Role, nil
+}
+
+// CreateAPIKey issues an API key for the session user. The key itself is
+// only in this response; afterwards it is listed by prefix.
+func CreateAPIKey(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	if utf8.RuneCountInString(body.Name) > maxAPIKeyNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is too long"})
+		return
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate API key"})
+		return
+	}
+	apiKey := models.APIKey{
+		ID:        primitive.NewObjectID(),
+		UserID:    sessionUserID(c),
+		Name:      body.Name,
+		Prefix:    prefix,
+		Hash:      auth.HashAPIKey(key),
+		CreatedAt: models.Now(),
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	_, err = apiKeysFor(c).InsertOne(ctx, apiKey)
+	if database.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"code": "DUPLICATE_KEY", "error": "API key already exists, please retry"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error storing API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "API key was not created"})
+		return
+	}
+
+	recordAudit(c, apiKey.UserID, auditAPIKeyCreated)
+	c.JSON(http.StatusCreated, gin.H{"key": key, "api_key": apiKey})
+}
+
+// ListAPIKeys lists the session user's API keys without their secrets.
+func ListAPIKeys(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := apiKeysFor(c).Find(ctx, bson.M{"user_id": sessionUserID(c)}, findOptions)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	apiKeys := []models.APIKey{}
+	if err := cursor.All(ctx, &apiKeys); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeys)
+}
+
+// RevokeAPIKey deletes one of the session user's API keys.
+func RevokeAPIKey(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	objId, ok := parseID(c, "id", "API key")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	deleteResult, err := apiKeysFor(c).DeleteOne(ctx, bson.M{"_id": objId, "user_id": sessionUserID(c)})
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if deleteResult.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	recordAudit(c, sessionUserID(c), auditAPIKeyRevoked)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jeffthorne/tasky/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// listWithAPIKey lists API keys authenticated only by key.
+func listWithAPIKey(key string) testRequest {
+	return testRequest{
+		method: http.MethodGet, route: "/me/api-keys", path: "/me/api-keys",
+		headers: map[string]string{"Authorization": "Bearer " + key},
+	}
+}
+
+func TestCreateAPIKeyStoresOnlyHash(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "create", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		w := serve(CreateAPIKey, testRequest{method: http.MethodPost, route: "/me/api-keys", path: "/me/api-keys", body: `{"name": "backup script"}`, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var response struct {
+			Key    string `json:"key"`
+			APIKey struct {
+				Prefix string `json:"prefix"`
+			} `json:"api_key"`
+		}
+		decodeBody(t, w, &response)
+		if !strings.HasPrefix(response.Key, auth.APIKeyPrefix) || !strings.HasPrefix(response.Key, response.APIKey.Prefix) {
+			t.Fatalf("key %q with prefix %q", response.Key, response.APIKey.Prefix)
+		}
+
+		stored := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if hash := stored.Lookup("hash").StringValue(); hash != auth.HashAPIKey(response.Key) {
+			t.Errorf("stored hash %q, want the key's hash", hash)
+		}
+		if owner := stored.Lookup("user_id").StringValue(); owner != user.ID.Hex() {
+			t.Errorf("stored owner %q, want %q", owner, user.ID.Hex())
+		}
+		if strings.Contains(stored.String(), response.Key) {
+			t.Error("the plaintext key was stored")
+		}
+	})
+}
+
+func TestAuthenticateWithAPIKey(t *testing.T) {
+	user := newTestUser(t, "")
+	key, prefix, _ := auth.GenerateAPIKey()
+	stored := bson.M{"_id": primitive.NewObjectID(), "user_id": user.ID.Hex(), "prefix": prefix, "hash": auth.HashAPIKey(key)}
+
+	withMockDB(t, "valid key", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(stored),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			cursorResponse(stored),
+		)
+		w := serve(ListAPIKeys, listWithAPIKey(key))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if strings.Contains(w.Body.String(), auth.HashAPIKey(key)) || !strings.Contains(w.Body.String(), prefix) {
+			t.Fatalf("listing %s should show the prefix and not the hash", w.Body)
+		}
+
+		if lookup := commandFilter(t, mt, "find"); lookup.Lookup("hash").StringValue() != auth.HashAPIKey(key) {
+			t.Errorf("looked the key up by %v", lookup)
+		}
+		if owner := commandFilter(t, mt, "find").Lookup("user_id").StringValue(); owner != user.ID.Hex() {
+			t.Errorf("listed the keys of %q, want the key's owner", owner)
+		}
+	})
+
+	withMockDB(t, "unknown key", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		if w := serve(ListAPIKeys, listWithAPIKey(key)); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", w.Code)
+		}
+	})
+
+	t.Setenv("TOKEN_TRANSPORT", auth.TransportCookie)
+	if w := serve(ListAPIKeys, listWithAPIKey(key)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("TOKEN_TRANSPORT=cookie: status = %d, want 401", w.Code)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	user := newTestUser(t, "")
+	id := primitive.NewObjectID()
+	revoke := testRequest{method: http.MethodDelete, route: "/me/api-keys/:id", path: "/me/api-keys/" + id.Hex(), cookie: sessionCookie(t, user)}
+
+	withMockDB(t, "revoke", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), mtest.CreateSuccessResponse())
+		if w := serve(RevokeAPIKey, revoke); w.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		filter := commandFilter(t, mt, "delete")
+		if filter.Lookup("_id").ObjectID() != id || filter.Lookup("user_id").StringValue() != user.ID.Hex() {
+			t.Fatalf("deleted %v, want the session user's key %v", filter, id)
+		}
+
+		// The revoked key no longer resolves
+		key, _, _ := auth.GenerateAPIKey()
+		mt.AddMockResponses(cursorResponse())
+		if w := serve(ListAPIKeys, listWithAPIKey(key)); w.Code != http.StatusUnauthorized {
+			t.Fatalf("revoked key: status = %d, want 401", w.Code)
+		}
+	})
+
+	withMockDB(t, "someone else's key", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+		if w := serve(RevokeAPIKey, revoke); w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", w.Code)
+		}
+	})
+}
+
+func TestCreateAPIKeyDuplicateIsConflict(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "duplicate", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "E11000 duplicate key error"}))
+		w := serve(CreateAPIKey, testRequest{method: http.MethodPost, route: "/me/api-keys", path: "/me/api-keys", body: `{"name": "backup script"}`, cookie: sessionCookie(t, user)})
+		assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusConflict, "DUPLICATE_KEY")
+	})
+
+	withMockDB(t, "other error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 121, Message: "Document failed validation"}))
+		w := serve(CreateAPIKey, testRequest{method: http.MethodPost, route: "/me/api-keys", path: "/me/api-keys", body: `{"name": "backup script"}`, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500", w.Code)
+		}
+	})
+}
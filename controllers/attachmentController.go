@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Limits on the links attached to a single todo.
+const (
+	maxAttachments          = 20
+	maxAttachmentNameLength = 200
+	maxAttachmentURLLength  = 2048
+)
+
+// AddAttachment attaches a link to one of the session user's todos.
+func AddAttachment(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	if !validAttachmentURL(body.URL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http or https URL"})
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		body.Name = body.URL
+	}
+	if utf8.RuneCountInString(body.Name) > maxAttachmentNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be at most %d characters", maxAttachmentNameLength)})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	attachment := models.Attachment{
+		ID:      primitive.NewObjectID(),
+		Name:    body.Name,
+		URL:     body.URL,
+		AddedAt: models.Now(),
+	}
+
+	// The cap is part of the filter so concurrent adds cannot exceed it
+	capped := bson.M{}
+	for key, value := range filter {
+		capped[key] = value
+	}
+	capped[fmt.Sprintf("attachments.%d", maxAttachments-1)] = bson.M{"$exists": false}
+	update := bson.M{
+		"$push": bson.M{"attachments": attachment},
+		"$set":  bson.M{"updated_at": models.Now()},
+	}
+	updateResult, err := todosFor(c).UpdateOne(ctx, capped, update)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if updateResult.MatchedCount == 0 {
+		count, err := todosFor(c).CountDocuments(ctx, filter)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a todo can have at most %d attachments", maxAttachments)})
+		return
+	}
+	todosChanged(c, sessionUserID(c))
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// DeleteAttachment removes an attachment from one of the session user's todos.
+func DeleteAttachment(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
+		return
+	}
+	attachmentID, ok := parseID(c, "attachmentId", "attachment")
+	if !ok {
+		return
+	}
+	filter["attachments._id"] = attachmentID
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	update := bson.M{
+		"$pull": bson.M{"attachments": bson.M{"_id": attachmentID}},
+		"$set":  bson.M{"updated_at": models.Now()},
+	}
+	updateResult, err := todosFor(c).UpdateOne(ctx, filter, update)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if updateResult.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return
+	}
+	todosChanged(c, sessionUserID(c))
+
+	c.Status(http.StatusNoContent)
+}
+
+// validAttachmentURL accepts only absolute http and https URLs, so stored
+// links cannot run script when clicked.
+func validAttachmentURL(raw string) bool {
+	if raw == "" || len(raw) > maxAttachmentURLLength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// addAttachment posts body to the attachments of todoID.
+func addAttachment(todoID primitive.ObjectID, cookie *http.Cookie, body string) testRequest {
+	return testRequest{method: http.MethodPost, route: "/todos/:id/attachments", path: "/todos/" + todoID.Hex() + "/attachments", body: body, cookie: cookie}
+}
+
+func TestAddAttachment(t *testing.T) {
+	user := newTestUser(t, "")
+	todoID := primitive.NewObjectID()
+	cookie := sessionCookie(t, user)
+
+	withMockDB(t, "add", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		w := serve(AddAttachment, addAttachment(todoID, cookie, `{"name": "Spec", "url": "https://example.com/spec.pdf"}`))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if _, err := statement.LookupErr("q", "userid"); err != nil {
+			t.Error("the update is not scoped to the owner")
+		}
+		capKey := fmt.Sprintf("attachments.%d", maxAttachments-1)
+		if exists := statement.Lookup("q", capKey, "$exists"); exists.Boolean() {
+			t.Errorf("filter does not require fewer than %d attachments", maxAttachments)
+		}
+		if url := statement.Lookup("u", "$push", "attachments", "url").StringValue(); url != "https://example.com/spec.pdf" {
+			t.Errorf("pushed url %q", url)
+		}
+	})
+}
+
+func TestAddAttachmentCountCap(t *testing.T) {
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+	body := `{"url": "https://example.com/a"}`
+
+	withMockDB(t, "full", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), cursorResponse(bson.M{"n": 1}))
+		if w := serve(AddAttachment, addAttachment(primitive.NewObjectID(), cookie, body)); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400 at the cap", w.Code)
+		}
+	})
+
+	withMockDB(t, "missing todo", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), cursorResponse(bson.M{"n": 0}))
+		if w := serve(AddAttachment, addAttachment(primitive.NewObjectID(), cookie, body)); w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", w.Code)
+		}
+	})
+}
+
+func TestAddAttachmentRejectsUnsafeURLs(t *testing.T) {
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+	for _, url := range []string{
+		"javascript:alert(1)",
+		"data:text/html,<script>alert(1)</script>",
+		"ftp://example.com/file",
+		"/relative/path",
+		"https://",
+		"",
+	} {
+		body := fmt.Sprintf(`{"url": %q}`, url)
+		if w := serve(AddAttachment, addAttachment(primitive.NewObjectID(), cookie, body)); w.Code != http.StatusBadRequest {
+			t.Errorf("url %q: status = %d, want 400", url, w.Code)
+		}
+	}
+
+	for _, url := range []string{"http://example.com", "https://example.com/a?b=c#d"} {
+		if !validAttachmentURL(url) {
+			t.Errorf("%q was rejected", url)
+		}
+	}
+}
+
+func TestDeleteAttachment(t *testing.T) {
+	user := newTestUser(t, "")
+	todoID, attachmentID := primitive.NewObjectID(), primitive.NewObjectID()
+	request := testRequest{
+		method: http.MethodDelete, route: "/todos/:id/attachments/:attachmentId",
+		path:   "/todos/" + todoID.Hex() + "/attachments/" + attachmentID.Hex(),
+		cookie: sessionCookie(t, user),
+	}
+
+	withMockDB(t, "delete", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		if w := serve(DeleteAttachment, request); w.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if id := statement.Lookup("u", "$pull", "attachments", "_id").ObjectID(); id != attachmentID {
+			t.Errorf("pulled %v, want %v", id, attachmentID)
+		}
+		if _, err := statement.LookupErr("q", "userid"); err != nil {
+			t.Error("the update is not scoped to the owner")
+		}
+	})
+
+	withMockDB(t, "unknown attachment", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+		if w := serve(DeleteAttachment, request); w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", w.Code)
+		}
+	})
+}
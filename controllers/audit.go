@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Audited authentication events.
+const (
+	auditSignup        = "signup"
+	auditLoginSuccess  = "login_success"
+	auditLoginFailure  = "login_failure"
+	auditDeactivated   = "account_deactivated"
+	auditAPIKeyCreated = "api_key_created"
+	auditAPIKeyRevoked = "api_key_revoked"
+	auditUserImported  = "user_imported"
+)
+
+const (
+	// defaultAuditMaxDays is the longest range one export may cover unless
+	// AUDIT_EXPORT_MAX_DAYS says otherwise.
+	defaultAuditMaxDays  = 31
+	auditExportBatchSize = 500
+	// auditExportTimeout bounds a whole export, which may stream many rows.
+	auditExportTimeout = 5 * time.Minute
+)
+
+func init() {
+	ensureIndex("audit_log", mongo.IndexModel{Keys: bson.D{{Key: "timestamp", Value: 1}}})
+}
+
+// auditLogFor returns the audit log collection of the request's tenant.
+func auditLogFor(c *gin.Context) *mongo.Collection {
+	return database.OpenTenantCollection(database.Client, requestTenant(c), "audit_log")
+}
+
+// recordAudit appends an event to the audit log. It deliberately runs outside
+// the request's transaction, so failed attempts are kept even though their
+// request is rolled back. Failures are only logged.
+func recordAudit(c *gin.Context, user string, event string) {
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	entry := models.AuditEvent{
+		ID:        primitive.NewObjectID(),
+		Timestamp: models.Now(),
+		User:      user,
+		Event:     event,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if _, err := auditLogFor(c).InsertOne(ctx, entry); err != nil {
+		log.Printf("Error recording audit event %v: %v", event, err)
+	}
+}
+
+// auditExportMaxSpan reads AUDIT_EXPORT_MAX_DAYS, the longest range a single
+// export may cover.
+func auditExportMaxSpan() time.Duration {
+	days := defaultAuditMaxDays
+	if value := os.Getenv("AUDIT_EXPORT_MAX_DAYS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			days = n
+		} else {
+			log.Printf("Invalid AUDIT_EXPORT_MAX_DAYS %q, using %d", value, defaultAuditMaxDays)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ExportAuditLog serves the audit events between from and to as CSV,
+// honoring Range requests with 206 Partial Content.
+func ExportAuditLog(c *gin.Context) {
+	if !auth.ValidateAdminAPI(c) {
+		return
+	}
+
+	if format := c.DefaultQuery("format", "csv"); format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv"})
+		return
+	}
+	from, err := parseSearchTime(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time or a YYYY-MM-DD date"})
+		return
+	}
+	to, err := parseSearchTime(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time or a YYYY-MM-DD date"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	if maxSpan := auditExportMaxSpan(); to.Sub(from) > maxSpan {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the range may cover at most " + strconv.Itoa(int(maxSpan.Hours()/24)) + " days"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), auditExportTimeout)
+	defer cancel()
+
+	filter := bson.M{"timestamp": bson.M{"$gte": from, "$lte": to}}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}).
+		SetBatchSize(auditExportBatchSize)
+	cursor, err := auditLogFor(c).Find(ctx, filter, findOptions)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// The export is spooled to a temporary file so its length is known and
+	// an interrupted download can resume with a Range request
+	file, err := os.CreateTemp("", "audit-export-*.csv")
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	buffered := bufio.NewWriter(io.MultiWriter(file, hash))
+	w := csv.NewWriter(buffered)
+	w.Write([]string{"timestamp", "user", "event", "ip", "user_agent"})
+	for cursor.Next(ctx) {
+		var entry models.AuditEvent
+		if err := cursor.Decode(&entry); err != nil {
+			log.Printf("Error decoding audit event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "audit log export failed"})
+			return
+		}
+		w.Write([]string{
+			entry.Timestamp.UTC().Format(time.RFC3339),
+			csvSafe(entry.User),
+			csvSafe(entry.Event),
+			csvSafe(entry.IP),
+			csvSafe(entry.UserAgent),
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Error reading audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "audit log export failed"})
+		return
+	}
+	w.Flush()
+	if err := w.Error(); err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		log.Printf("Error spooling audit log export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "audit log export failed"})
+		return
+	}
+
+	// The ETag lets a resumed download's If-Range detect that the export
+	// changed in the meantime and send it whole instead
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="audit-log.csv"`)
+	c.Header("ETag", `"`+hex.EncodeToString(hash.Sum(nil)[:16])+`"`)
+	http.ServeContent(c.Writer, c.Request, "audit-log.csv", time.Time{}, file)
+}
+
+// csvSafe stops spreadsheet applications from evaluating a cell as a formula.
+func csvSafe(value string) string {
+	if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@') {
+		return "'" + value
+	}
+	return value
+}
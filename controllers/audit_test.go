@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func exportRequest(query string, cookie *http.Cookie) testRequest {
+	return testRequest{method: http.MethodGet, route: "/admin/audit/export", path: "/admin/audit/export?" + query, cookie: cookie}
+}
+
+func TestExportAuditLogCSV(t *testing.T) {
+	admin := newTestUser(t, "admin")
+	at := time.Date(2024, 1, 3, 8, 15, 0, 0, time.UTC)
+	events := []interface{}{
+		bson.M{"_id": primitive.NewObjectID(), "timestamp": at, "user": "64b7f0c2a1", "event": auditLoginSuccess, "ip": "192.0.2.10", "user_agent": "curl/8.0"},
+		bson.M{"_id": primitive.NewObjectID(), "timestamp": at.Add(time.Hour), "user": "=HYPERLINK(\"x\")", "event": auditLoginFailure, "ip": "192.0.2.11", "user_agent": "Mozilla/5.0, like Gecko"},
+	}
+
+	withMockDB(t, "export", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(events...))
+		w := serve(ExportAuditLog, exportRequest("from=2024-01-01&to=2024-01-07", sessionCookie(t, admin)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+			t.Errorf("Content-Type = %q", ct)
+		}
+
+		rows, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("response is not CSV: %v", err)
+		}
+		want := [][]string{
+			{"timestamp", "user", "event", "ip", "user_agent"},
+			{"2024-01-03T08:15:00Z", "64b7f0c2a1", auditLoginSuccess, "192.0.2.10", "curl/8.0"},
+			{"2024-01-03T09:15:00Z", "'=HYPERLINK(\"x\")", auditLoginFailure, "192.0.2.11", "Mozilla/5.0, like Gecko"},
+		}
+		if len(rows) != len(want) {
+			t.Fatalf("got %d rows, want %d", len(rows), len(want))
+		}
+		for i := range want {
+			if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+				t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+			}
+		}
+
+		filter := commandFilter(t, mt, "find")
+		from := filter.Lookup("timestamp", "$gte").Time()
+		to := filter.Lookup("timestamp", "$lte").Time()
+		if !from.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || to.Before(time.Date(2024, 1, 7, 23, 59, 59, 0, time.UTC)) || to.After(time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("exported %v to %v, want 1 to 7 January inclusive", from, to)
+		}
+	})
+}
+
+func TestExportAuditLogValidatesRange(t *testing.T) {
+	t.Setenv("AUDIT_EXPORT_MAX_DAYS", "7")
+	admin := newTestUser(t, "admin")
+	for _, query := range []string{
+		"to=2024-01-07",
+		"from=2024-01-01",
+		"from=2024-01-07&to=2024-01-01",
+		"from=2024-01-01&to=2024-01-09",
+		"from=yesterday&to=2024-01-02",
+		"from=2024-01-01&to=2024-01-02&format=json",
+	} {
+		w := serve(ExportAuditLog, exportRequest(query, sessionCookie(t, admin)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestExportAuditLogRequiresAdmin(t *testing.T) {
+	user := newTestUser(t, "")
+	w := serve(ExportAuditLog, exportRequest("from=2024-01-01&to=2024-01-02", sessionCookie(t, user)))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+}
+
+func TestExportAuditLogRanges(t *testing.T) {
+	admin := newTestUser(t, "admin")
+	at := time.Date(2024, 1, 3, 8, 15, 0, 0, time.UTC)
+	events := []interface{}{
+		bson.M{"_id": primitive.NewObjectID(), "timestamp": at, "user": "u1", "event": auditLoginSuccess, "ip": "192.0.2.10", "user_agent": "curl/8.0"},
+		bson.M{"_id": primitive.NewObjectID(), "timestamp": at.Add(time.Hour), "user": "u2", "event": auditLoginFailure, "ip": "192.0.2.11", "user_agent": "curl/8.0"},
+	}
+	export := func(headers map[string]string) *httptest.ResponseRecorder {
+		var w *httptest.ResponseRecorder
+		withMockDB(t, "export", func(mt *mtest.T) {
+			mt.AddMockResponses(cursorResponse(events...))
+			request := exportRequest("from=2024-01-01&to=2024-01-07", sessionCookie(t, admin))
+			request.headers = headers
+			w = serve(ExportAuditLog, request)
+		})
+		return w
+	}
+
+	full := export(nil)
+	if full.Code != http.StatusOK || full.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("without a range: status = %d, Accept-Ranges %q", full.Code, full.Header().Get("Accept-Ranges"))
+	}
+	whole := full.Body.String()
+	etag := full.Header().Get("ETag")
+
+	partial := export(map[string]string{"Range": "bytes=10-29"})
+	if partial.Code != http.StatusPartialContent {
+		t.Fatalf("ranged request: status = %d, want 206", partial.Code)
+	}
+	if got, want := partial.Header().Get("Content-Range"), fmt.Sprintf("bytes 10-29/%d", len(whole)); got != want {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+	if partial.Body.String() != whole[10:30] {
+		t.Errorf("ranged body %q, want %q", partial.Body, whole[10:30])
+	}
+
+	tail := export(map[string]string{"Range": "bytes=-5"})
+	if tail.Code != http.StatusPartialContent || tail.Body.String() != whole[len(whole)-5:] {
+		t.Errorf("suffix range: status = %d, body %q", tail.Code, tail.Body)
+	}
+
+	if w := export(map[string]string{"Range": fmt.Sprintf("bytes=%d-", len(whole)+10)}); w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("range past the end: status = %d, want 416", w.Code)
+	}
+
+	resumed := export(map[string]string{"Range": "bytes=10-29", "If-Range": etag})
+	if resumed.Code != http.StatusPartialContent {
+		t.Errorf("If-Range with the current ETag: status = %d, want 206", resumed.Code)
+	}
+	changed := export(map[string]string{"Range": "bytes=10-29", "If-Range": `"stale"`})
+	if changed.Code != http.StatusOK || changed.Body.String() != whole {
+		t.Errorf("If-Range with a stale ETag: status = %d, want the whole export", changed.Code)
+	}
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxBlockers is the most todos a single todo may be blocked by.
+const maxBlockers = 50
+
+// SetBlockers replaces the todos blocking a todo owned by the session user
+// with the blocked_by ids in the body; an empty list clears them. Blockers
+// must be the user's own todos, and a todo may not block itself, directly or
+// through a chain of blockers. Blocking is informational: a blocked todo can
+// still be completed.
+func SetBlockers(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
+		return
+	}
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		BlockedBy []string `json:"blocked_by"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	if len(body.BlockedBy) > maxBlockers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a todo may be blocked by at most " + strconv.Itoa(maxBlockers) + " todos"})
+		return
+	}
+	blockers := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, value := range body.BlockedBy {
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			respondInvalidID(c, "blocker")
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			blockers = append(blockers, id)
+		}
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	var todo models.Todo
+	err := todosFor(c).FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&todo)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if seen[todo.ID] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a todo cannot block itself", "code": "BLOCKER_CYCLE"})
+		return
+	}
+
+	if len(blockers) > 0 {
+		owned, err := todosFor(c).CountDocuments(ctx, bson.M{"_id": bson.M{"$in": blockers}, "userid": ownerMatch(owner)})
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		if int(owned) != len(blockers) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "blocked_by must name your own todos"})
+			return
+		}
+
+		graph, err := blockerGraph(ctx, todosFor(c), owner)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		if blocksItself(graph, todo.ID, blockers) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "these blockers would make the todo block itself", "code": "BLOCKER_CYCLE"})
+			return
+		}
+	}
+
+	update := bson.M{"$set": bson.M{"blocked_by": blockers, "updated_at": models.Now()}}
+	if len(blockers) == 0 {
+		update = bson.M{"$set": bson.M{"updated_at": models.Now()}, "$unset": bson.M{"blocked_by": ""}}
+	}
+	err = todosFor(c).FindOneAndUpdate(ctx, bson.M{"_id": todo.ID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&todo)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todosChanged(c, owner.Hex())
+
+	todos := []models.Todo{todo}
+	if err := markBlocked(ctx, todosFor(c), todos); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, todos[0])
+}
+
+// blockerGraph maps each of owner's todos that has blockers to them.
+func blockerGraph(ctx context.Context, collection *mongo.Collection, owner primitive.ObjectID) (map[primitive.ObjectID][]primitive.ObjectID, error) {
+	filter := bson.M{"userid": ownerMatch(owner), "blocked_by.0": bson.M{"$exists": true}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"blocked_by": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var todos []models.Todo
+	if err := cursor.All(ctx, &todos); err != nil {
+		return nil, err
+	}
+	graph := make(map[primitive.ObjectID][]primitive.ObjectID, len(todos))
+	for _, todo := range todos {
+		graph[todo.ID] = todo.BlockedBy
+	}
+	return graph, nil
+}
+
+// blocksItself reports whether giving id the blockers would close a cycle,
+// that is whether id is among the blockers or is reachable from them through
+// the existing edges in graph.
+func blocksItself(graph map[primitive.ObjectID][]primitive.ObjectID, id primitive.ObjectID, blockers []primitive.ObjectID) bool {
+	visited := map[primitive.ObjectID]bool{}
+	pending := append([]primitive.ObjectID{}, blockers...)
+	for len(pending) > 0 {
+		next := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if next == id {
+			return true
+		}
+		if visited[next] {
+			continue
+		}
+		visited[next] = true
+		pending = append(pending, graph[next]...)
+	}
+	return false
+}
+
+// markBlocked sets IsBlocked on each todo with a blocker that still exists
+// and is not completed, looking all of them up in one query.
+func markBlocked(ctx context.Context, collection *mongo.Collection, todos []models.Todo) error {
+	ids := []primitive.ObjectID{}
+	for _, todo := range todos {
+		ids = append(ids, todo.BlockedBy...)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"_id": bson.M{"$in": ids}, "status": bson.M{"$ne": statusCompleted}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var open []models.Todo
+	if err := cursor.All(ctx, &open); err != nil {
+		return err
+	}
+	isOpen := make(map[primitive.ObjectID]bool, len(open))
+	for _, todo := range open {
+		isOpen[todo.ID] = true
+	}
+
+	for i := range todos {
+		todos[i].IsBlocked = false
+		for _, blocker := range todos[i].BlockedBy {
+			if isOpen[blocker] {
+				todos[i].IsBlocked = true
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestBlocksItself(t *testing.T) {
+	a, b, c, d := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	// b waits for c, and c waits for a
+	graph := map[primitive.ObjectID][]primitive.ObjectID{b: {c}, c: {a}}
+
+	cases := []struct {
+		name     string
+		id       primitive.ObjectID
+		blockers []primitive.ObjectID
+		want     bool
+	}{
+		{"self reference", a, []primitive.ObjectID{a}, true},
+		{"direct cycle", a, []primitive.ObjectID{c}, true},
+		{"indirect cycle", a, []primitive.ObjectID{b}, true},
+		{"independent blocker", a, []primitive.ObjectID{d}, false},
+		{"blocker of a blocker", d, []primitive.ObjectID{b}, false},
+		{"no blockers", a, nil, false},
+	}
+	for _, tc := range cases {
+		if got := blocksItself(graph, tc.id, tc.blockers); got != tc.want {
+			t.Errorf("%s: blocksItself = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSetBlockersRejectsSelfReference(t *testing.T) {
+	user := newTestUser(t, "")
+	id := primitive.NewObjectID()
+	withMockDB(t, "self", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"_id": id}))
+		w := serve(SetBlockers, testRequest{
+			method: http.MethodPut, route: "/todos/:id/blocked-by", path: "/todos/" + id.Hex() + "/blocked-by",
+			body: `{"blocked_by": ["` + id.Hex() + `"]}`, cookie: sessionCookie(t, user),
+		})
+		assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusBadRequest, "BLOCKER_CYCLE")
+	})
+}
+
+func TestSetBlockersRejectsCycle(t *testing.T) {
+	user := newTestUser(t, "")
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	withMockDB(t, "cycle", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(bson.M{"_id": a}),
+			cursorResponse(bson.M{"n": 1}),
+			// b already waits for a
+			cursorResponse(bson.M{"_id": b, "blocked_by": bson.A{a}}),
+		)
+		w := serve(SetBlockers, testRequest{
+			method: http.MethodPut, route: "/todos/:id/blocked-by", path: "/todos/" + a.Hex() + "/blocked-by",
+			body: `{"blocked_by": ["` + b.Hex() + `"]}`, cookie: sessionCookie(t, user),
+		})
+		assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusBadRequest, "BLOCKER_CYCLE")
+	})
+}
+
+func TestMarkBlocked(t *testing.T) {
+	open, done := primitive.NewObjectID(), primitive.NewObjectID()
+	todos := []models.Todo{
+		{ID: primitive.NewObjectID(), BlockedBy: []primitive.ObjectID{open, done}},
+		{ID: primitive.NewObjectID(), BlockedBy: []primitive.ObjectID{done}},
+		{ID: primitive.NewObjectID()},
+	}
+	withMockDB(t, "mark", func(mt *mtest.T) {
+		// Only blockers that are not completed are returned
+		mt.AddMockResponses(cursorResponse(bson.M{"_id": open}))
+		if err := markBlocked(context.Background(), database.OpenCollection(mt.Client, "todos"), todos); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want := []bool{true, false, false}
+	for i, todo := range todos {
+		if todo.IsBlocked != want[i] {
+			t.Errorf("todo %d: is_blocked = %v, want %v", i, todo.IsBlocked, want[i])
+		}
+	}
+}
+
+func TestUpdateTodoIsScopedToSessionOwner(t *testing.T) {
+	user := newTestUser(t, "")
+	other := primitive.NewObjectID()
+	id := primitive.NewObjectID()
+	withMockDB(t, "update", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.M{"_id": id, "name": "renamed", "status": statusPending, "userid": user.ID}}))
+		body := `{"ID": "` + id.Hex() + `", "name": "renamed", "status": "pending", "user_id": "` + other.Hex() + `",
+			"blocked_by": ["` + other.Hex() + `"], "short_id": "x", "version": 9, "order": 3, "draft": true}`
+		w := serve(UpdateTodo, testRequest{method: http.MethodPut, route: "/todo", path: "/todo", body: body, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		evt := mt.GetStartedEvent()
+		owners := evt.Command.Lookup("query", "userid", "$in").Array()
+		if owner, _ := owners.Index(0).Value().ObjectIDOK(); owner != user.ID {
+			t.Fatalf("update filtered on owner %v, want the session user", owners)
+		}
+		elements, _ := evt.Command.Lookup("update", "$set").Document().Elements()
+		for _, element := range elements {
+			switch element.Key() {
+			case "name", "status", "updated_at":
+			default:
+				t.Errorf("update sets %s", element.Key())
+			}
+		}
+	})
+}
+
+func TestUpdateTodoValidatesFields(t *testing.T) {
+	user := newTestUser(t, "")
+	id := primitive.NewObjectID().Hex()
+	for _, body := range []string{
+		`{"ID": "` + id + `", "name": "  "}`,
+		`{"ID": "` + id + `", "name": "x", "status": "maybe"}`,
+		`{"ID": "` + id + `", "name": "x", "priority": "urgent"}`,
+	} {
+		w := serve(UpdateTodo, testRequest{method: http.MethodPut, route: "/todo", path: "/todo", body: body, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestUpdateTodoOfAnotherUserIsNotFound(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "missing", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+		body := `{"ID": "` + primitive.NewObjectID().Hex() + `", "name": "x"}`
+		w := serve(UpdateTodo, testRequest{method: http.MethodPut, route: "/todo", path: "/todo", body: body, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", w.Code)
+		}
+	})
+}
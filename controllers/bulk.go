@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// itemResult reports the outcome of one item in a non-atomic bulk request.
+type itemResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// atomicMode reads the atomic query parameter of a bulk endpoint. Bulk
+// operations are all-or-nothing unless the client passes atomic=false.
+// It responds with 400 and returns ok=false for an invalid value.
+func atomicMode(c *gin.Context) (atomic bool, ok bool) {
+	value := c.DefaultQuery("atomic", "true")
+	atomic, err := strconv.ParseBool(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "atomic must be true or false"})
+		return false, false
+	}
+	return atomic, true
+}
+
+// respondMultiStatus writes per-item outcomes with 207 Multi-Status.
+func respondMultiStatus(c *gin.Context, results []itemResult) {
+	c.JSON(http.StatusMultiStatus, gin.H{"results": results})
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/ics"
+	"github.com/jeffthorne/tasky/models"
+	"github.com/jeffthorne/tasky/server"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateFeedToken issues a new calendar feed token for the session user,
+// replacing any previous one. Only a hash of the token is stored.
+func CreateFeedToken(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	objId, err := primitive.ObjectIDFromHex(sessionUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate feed token"})
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	update := bson.M{"$set": bson.M{"feed_token": hashFeedToken(token), "updated_at": models.Now()}}
+	if _, err := usersFor(c).UpdateOne(ctx, bson.M{"_id": objId}, update); err != nil {
+		log.Printf("Error storing feed token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "feed token was not created"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "url": server.BasePath() + "/todos/calendar.ics?token=" + token})
+}
+
+// CalendarFeed serves the due-dated todos of the feed token's owner as an
+// iCalendar feed. Calendar apps cannot send the session cookie, so the token
+// in the query string is the only credential.
+func CalendarFeed(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "feed token required"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	var user models.User
+	err := usersFor(c).FindOne(ctx, bson.M{"feed_token": hashFeedToken(token)}).Decode(&user)
+	if err == mongo.ErrNoDocuments || err == nil && !user.IsActive() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid feed token"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	filter := bson.M{
+		"userid":   ownerMatch(user.ID),
+		"archived": bson.M{"$ne": true},
+		"draft":    bson.M{"$ne": true},
+		"due_date": bson.M{"$type": "date"},
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "due_date", Value: 1}})
+	cursor, err := todosForRead(c, user.ID.Hex()).Find(ctx, filter, findOptions)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	var todos []models.Todo
+	if err := cursor.All(ctx, &todos); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	cal := ics.Calendar{ProductID: "-//tasky//todos//EN", Name: "Tasky todos"}
+	for _, todo := range todos {
+		cal.Events = append(cal.Events, ics.Event{
+			UID:     todo.ID.Hex() + "@tasky",
+			Start:   todo.DueDate.Time,
+			Summary: todo.Name,
+		})
+	}
+
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(cal.Encode(time.Now())))
+}
+
+// hashFeedToken returns the form of a feed token stored in the database.
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCalendarFeedServesDueDatedTodos(t *testing.T) {
+	owner := primitive.NewObjectID()
+	todo := primitive.NewObjectID()
+	due := time.Date(2024, 7, 4, 16, 0, 0, 0, time.UTC)
+	withMockDB(t, "feed", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(bson.M{"_id": owner, "feed_token": hashFeedToken("feed-token")}),
+			cursorResponse(bson.M{"_id": todo, "name": "Fireworks, BBQ", "userid": owner, "due_date": due}),
+		)
+		w := serve(CalendarFeed, testRequest{method: http.MethodGet, route: "/todos/calendar.ics", path: "/todos/calendar.ics?token=feed-token"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+			t.Errorf("Content-Type = %q", ct)
+		}
+
+		body := w.Body.String()
+		for _, want := range []string{"BEGIN:VCALENDAR", "BEGIN:VEVENT", "UID:" + todo.Hex() + "@tasky", "DTSTART:20240704T160000Z", `SUMMARY:Fireworks\, BBQ`, "END:VCALENDAR"} {
+			if !strings.Contains(body, want+"\r\n") {
+				t.Errorf("feed is missing %q:\n%s", want, body)
+			}
+		}
+
+		lookup := commandFilter(t, mt, "find")
+		if got := lookup.Lookup("feed_token").StringValue(); got != hashFeedToken("feed-token") {
+			t.Errorf("looked up feed_token %q, want the token's hash", got)
+		}
+		// Undated todos are left out by the query
+		filter := commandFilter(t, mt, "find")
+		if got := filter.Lookup("due_date", "$type").StringValue(); got != "date" {
+			t.Errorf("due_date condition = %v, want only todos with a date", filter.Lookup("due_date"))
+		}
+	})
+}
+
+func TestCalendarFeedWithoutEvents(t *testing.T) {
+	withMockDB(t, "empty", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"_id": primitive.NewObjectID()}), cursorResponse())
+		w := serve(CalendarFeed, testRequest{method: http.MethodGet, route: "/todos/calendar.ics", path: "/todos/calendar.ics?token=feed-token"})
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "VEVENT") {
+			t.Fatalf("status = %d, body %q", w.Code, w.Body)
+		}
+	})
+}
+
+func TestCalendarFeedRejectsBadTokens(t *testing.T) {
+	if w := serve(CalendarFeed, testRequest{method: http.MethodGet, route: "/todos/calendar.ics", path: "/todos/calendar.ics"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: status = %d, want 401", w.Code)
+	}
+
+	withMockDB(t, "unknown", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		w := serve(CalendarFeed, testRequest{method: http.MethodGet, route: "/todos/calendar.ics", path: "/todos/calendar.ics?token=stale"})
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("unknown token: status = %d, want 401", w.Code)
+		}
+	})
+
+	withMockDB(t, "deactivated", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"_id": primitive.NewObjectID(), "active": false}))
+		w := serve(CalendarFeed, testRequest{method: http.MethodGet, route: "/todos/calendar.ics", path: "/todos/calendar.ics?token=feed-token"})
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("deactivated owner: status = %d, want 401", w.Code)
+		}
+	})
+}
+
+func TestCreateFeedTokenStoresHash(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "create", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		w := serve(CreateFeedToken, testRequest{method: http.MethodPost, route: "/feed-token", path: "/feed-token", cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var response struct {
+			Token string `json:"token"`
+			URL   string `json:"url"`
+		}
+		decodeBody(t, w, &response)
+		if response.Token == "" || !strings.HasSuffix(response.URL, "/todos/calendar.ics?token="+response.Token) {
+			t.Fatalf("response = %+v", response)
+		}
+
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if stored := statement.Lookup("u", "$set", "feed_token").StringValue(); stored != hashFeedToken(response.Token) {
+			t.Fatalf("stored %q, want the hash of the token", stored)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/featureflags"
+)
+
+// PublicConfig is the part of the effective configuration that clients adapt
+// their UI to. It is served without authentication, so it only holds
+// switches and limits, never secrets, hosts or other internal details.
+type PublicConfig struct {
+	SignupsEnabled  bool `json:"signups_enabled"`
+	MaintenanceMode bool `json:"maintenance_mode"`
+	// EmailVerificationRequired and TwoFactorAvailable are always false, as
+	// neither is implemented; they are listed so clients need not guess
+	EmailVerificationRequired bool `json:"email_verification_required"`
+	TwoFactorAvailable        bool `json:"two_factor_available"`
+	// TokenTransport tells clients whether to keep the session cookie, send
+	// the token as a bearer header, or either
+	TokenTransport string `json:"token_transport"`
+	MaxTodoLength  int    `json:"max_todo_length"`
+	MaxNotesLength int    `json:"max_notes_length"`
+	MaxBatchGetIDs int    `json:"max_batch_get_ids"`
+	MaxBlockers    int    `json:"max_blockers"`
+}
+
+// newPublicConfig builds the public configuration from the given flags and
+// the current limits.
+func newPublicConfig(flags featureflags.Flags) PublicConfig {
+	return PublicConfig{
+		SignupsEnabled:  flags.SignupsEnabled,
+		MaintenanceMode: flags.MaintenanceMode,
+		TokenTransport:  auth.TokenTransport(),
+		MaxTodoLength:   importLimitsFromEnv().nameLength,
+		MaxNotesLength:  maxNotesLength,
+		MaxBatchGetIDs:  maxBatchGetIDs,
+		MaxBlockers:     maxBlockers,
+	}
+}
+
+// GetConfig returns the public configuration. It needs no session, so the
+// login and signup pages can use it too.
+func GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, newPublicConfig(featureflags.Current()))
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultCORSMaxAge is how long, in seconds, browsers may cache a preflight
+// result unless CORS_MAX_AGE says otherwise.
+const defaultCORSMaxAge = 600
+
+// corsAllowedMethods and corsAllowedHeaders are granted to every allowed
+// origin in preflight responses.
+const (
+	corsAllowedMethods = "GET, HEAD, POST, PUT, PATCH, DELETE"
+	corsAllowedHeaders = "Authorization, Content-Type, Idempotency-Key, " + tenantHeader
+)
+
+// corsMaxAge reads CORS_MAX_AGE, the number of seconds a browser may cache a
+// preflight result. 0 asks browsers not to cache it.
+func corsMaxAge() int {
+	if value := os.Getenv("CORS_MAX_AGE"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+		log.Printf("Invalid CORS_MAX_AGE %q, using %d", value, defaultCORSMaxAge)
+	}
+	return defaultCORSMaxAge
+}
+
+// CORS returns middleware that lets the origins listed in the comma-separated
+// CORS_ALLOWED_ORIGINS call the API with credentials, and answers their
+// preflight requests itself. Without any allowed origins it does nothing.
+func CORS() gin.HandlerFunc {
+	allowed := map[string]bool{}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			allowed[origin] = true
+		}
+	}
+	maxAge := strconv.Itoa(corsMaxAge())
+
+	return func(c *gin.Context) {
+		if len(allowed) == 0 {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		origin := c.GetHeader("Origin")
+		if !allowed[origin] {
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Allow-Credentials", "true")
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", corsAllowedMethods)
+			c.Header("Access-Control-Allow-Headers", corsAllowedHeaders)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
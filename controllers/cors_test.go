@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsRouter returns a router with the CORS middleware in front of GET /todos.
+func corsRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(CORS())
+	router.GET("/todos", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+// preflight sends a preflight request from origin through router.
+func preflight(router *gin.Engine, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodOptions, "/todos", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSPreflightMaxAge(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com/, https://other.example.com")
+	for value, want := range map[string]string{"": "600", "86400": "86400", "0": "0", "-5": "600", "a day": "600"} {
+		t.Setenv("CORS_MAX_AGE", value)
+		w := preflight(corsRouter(), "https://app.example.com")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("CORS_MAX_AGE=%q: preflight status = %d, want 204", value, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Max-Age"); got != want {
+			t.Errorf("CORS_MAX_AGE=%q: Access-Control-Max-Age = %q, want %q", value, got, want)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("Access-Control-Allow-Origin = %q", got)
+		}
+	}
+}
+
+func TestCORSIgnoresOtherOrigins(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	w := preflight(corsRouter(), "https://evil.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Max-Age") != "" {
+		t.Errorf("an unlisted origin got CORS headers: %v", w.Header())
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	w = preflight(corsRouter(), "https://app.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Vary") != "" {
+		t.Errorf("CORS headers without any allowed origin: %v", w.Header())
+	}
+}
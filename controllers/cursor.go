@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// todoCursorPage is the envelope for keyset-paginated todo listings.
+type todoCursorPage struct {
+	Items      []models.Todo `json:"items"`
+	Limit      int           `json:"limit"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// todoCursor is the position after the last todo of a page, in the
+// (pinned, created_at, _id) descending order used by keyset pagination.
+type todoCursor struct {
+	Pinned    bool               `json:"p,omitempty"`
+	CreatedAt time.Time          `json:"t"`
+	ID        primitive.ObjectID `json:"id"`
+}
+
+func encodeTodoCursor(todo models.Todo) string {
+	data, _ := json.Marshal(todoCursor{Pinned: todo.Pinned, CreatedAt: todo.CreatedAt.Time, ID: todo.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTodoCursor(value string) (todoCursor, bool) {
+	var cursor todoCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(data, &cursor) != nil || cursor.ID.IsZero() {
+		return todoCursor{}, false
+	}
+	return cursor, true
+}
+
+// after returns a filter matching the todos that follow the cursor. Pinned
+// todos come first, like in the unpaginated list, and unpinned todos have no
+// pinned field. Todos created before timestamps existed have no created_at
+// and sort last within their group.
+func (cursor todoCursor) after() bson.M {
+	later := bson.M{"$or": bson.A{
+		bson.M{"created_at": bson.M{"$lt": cursor.CreatedAt}},
+		bson.M{"created_at": cursor.CreatedAt, "_id": bson.M{"$lt": cursor.ID}},
+		bson.M{"created_at": bson.M{"$exists": false}},
+	}}
+	if cursor.CreatedAt.IsZero() {
+		later = bson.M{"created_at": bson.M{"$exists": false}, "_id": bson.M{"$lt": cursor.ID}}
+	}
+	if !cursor.Pinned {
+		return bson.M{"$and": bson.A{bson.M{"pinned": bson.M{"$ne": true}}, later}}
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"$and": bson.A{bson.M{"pinned": true}, later}},
+		bson.M{"pinned": bson.M{"$ne": true}},
+	}}
+}
+
+// wantsCursorPage reports whether a list request asked for keyset pagination.
+func wantsCursorPage(c *gin.Context) bool {
+	_, hasLimit := c.GetQuery("limit")
+	_, hasCursor := c.GetQuery("cursor")
+	return hasLimit || hasCursor
+}
+
+// listTodoCursorPage responds with one keyset page of the todos in collection
+// matching filter, pinned first and then newest first.
+func listTodoCursorPage(ctx context.Context, c *gin.Context, collection *mongo.Collection, filter bson.M) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxPageSize)})
+		return
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, ok := decodeTodoCursor(value)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		filter = bson.M{"$and": bson.A{filter, cursor.after()}}
+	}
+
+	// One extra todo tells whether another page follows
+	findOptions := options.Find().
+		SetProjection(bson.M{"notes": 0}).
+		SetSort(bson.D{{Key: "pinned", Value: -1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todos := []models.Todo{}
+	if err := cursor.All(ctx, &todos); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := markBlocked(ctx, collection, todos); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	page := todoCursorPage{Items: todos, Limit: limit}
+	if len(todos) > limit {
+		page.Items = todos[:limit]
+		page.NextCursor = encodeTodoCursor(todos[limit-1])
+	}
+	c.JSON(http.StatusOK, page)
+}
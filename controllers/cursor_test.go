@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// keysetMatches evaluates the filters built by todoCursor.after against a
+// todo, as MongoDB would.
+func keysetMatches(todo models.Todo, filter bson.M) bool {
+	for key, condition := range filter {
+		if key == "$and" {
+			for _, part := range condition.(bson.A) {
+				if !keysetMatches(todo, part.(bson.M)) {
+					return false
+				}
+			}
+			continue
+		}
+		if key == "pinned" {
+			if ops, ok := condition.(bson.M); ok {
+				if todo.Pinned == ops["$ne"].(bool) {
+					return false
+				}
+			} else if todo.Pinned != condition.(bool) {
+				return false
+			}
+			continue
+		}
+		if key == "$or" {
+			matched := false
+			for _, alternative := range condition.(bson.A) {
+				matched = matched || keysetMatches(todo, alternative.(bson.M))
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+
+		var value interface{}
+		if key == "_id" {
+			value = todo.ID
+		} else if !todo.CreatedAt.IsZero() {
+			value = todo.CreatedAt.Time
+		}
+		ops, ok := condition.(bson.M)
+		if !ok {
+			ops = bson.M{"$eq": condition}
+		}
+		for op, operand := range ops {
+			var ok bool
+			switch op {
+			case "$exists":
+				ok = (value != nil) == operand.(bool)
+			case "$eq":
+				ok = value != nil && compareKey(value, operand) == 0
+			case "$lt":
+				ok = value != nil && compareKey(value, operand) < 0
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func compareKey(a, b interface{}) int {
+	switch a := a.(type) {
+	case time.Time:
+		switch b := b.(time.Time); {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	case primitive.ObjectID:
+		id := b.(primitive.ObjectID)
+		return bytes.Compare(a[:], id[:])
+	}
+	panic("unexpected key type")
+}
+
+// seedTodos returns n todos in list order, pinned and then newest first:
+// some are pinned, many share a creation time, and the oldest have none.
+func seedTodos(n int) []models.Todo {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	todos := make([]models.Todo, n)
+	for i := range todos {
+		todos[i].ID = primitive.NewObjectID()
+		if i%10 != 0 {
+			todos[i].CreatedAt = models.NewJSONTime(base.Add(time.Duration(i/4) * time.Second))
+		}
+		todos[i].Pinned = i%7 == 0
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		a, b := todos[i], todos[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		if a.CreatedAt.IsZero() != b.CreatedAt.IsZero() {
+			return b.CreatedAt.IsZero()
+		}
+		if c := compareKey(a.CreatedAt.Time, b.CreatedAt.Time); c != 0 {
+			return c > 0
+		}
+		return compareKey(a.ID, b.ID) > 0
+	})
+	return todos
+}
+
+func TestTodoCursorWalksEveryTodoOnce(t *testing.T) {
+	todos := seedTodos(1000)
+	const limit = 37
+
+	var walked []models.Todo
+	next := ""
+	for pages := 0; ; pages++ {
+		if pages > len(todos) {
+			t.Fatal("the walk does not terminate")
+		}
+		remaining := todos
+		if next != "" {
+			cursor, ok := decodeTodoCursor(next)
+			if !ok {
+				t.Fatalf("could not decode cursor %q", next)
+			}
+			remaining = nil
+			for _, todo := range todos {
+				if keysetMatches(todo, cursor.after()) {
+					remaining = append(remaining, todo)
+				}
+			}
+		}
+		if len(remaining) > limit {
+			walked = append(walked, remaining[:limit]...)
+			next = encodeTodoCursor(remaining[limit-1])
+			continue
+		}
+		walked = append(walked, remaining...)
+		break
+	}
+
+	if len(walked) != len(todos) {
+		t.Fatalf("walked %d todos, want %d", len(walked), len(todos))
+	}
+	for i := range todos {
+		if walked[i].ID != todos[i].ID {
+			t.Fatalf("todo %d is %v, want %v", i, walked[i].ID, todos[i].ID)
+		}
+	}
+}
+
+func TestDecodeTodoCursorRejectsGarbage(t *testing.T) {
+	for _, value := range []string{"%%%", "bm90IGpzb24", "e30"} {
+		if _, ok := decodeTodoCursor(value); ok {
+			t.Errorf("decoded %q", value)
+		}
+	}
+}
+
+func TestListTodosCursorPages(t *testing.T) {
+	user := newTestUser(t, "")
+	todos := seedTodos(3)
+	docs := make([]interface{}, len(todos))
+	for i, todo := range todos {
+		docs[i] = bson.M{"_id": todo.ID, "name": "todo", "userid": user.ID, "created_at": todo.CreatedAt.Time}
+	}
+
+	withMockDB(t, "first page", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(docs...))
+		w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + "?limit=2", cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var page todoCursorPage
+		decodeBody(t, w, &page)
+		if len(page.Items) != 2 || page.NextCursor != encodeTodoCursor(todos[1]) {
+			t.Fatalf("got %d items and cursor %q, want 2 and the second todo's", len(page.Items), page.NextCursor)
+		}
+		find := mt.GetStartedEvent().Command
+		if limit := find.Lookup("limit").AsInt64(); limit != 3 {
+			t.Errorf("limit = %d, want one more than the page", limit)
+		}
+		if first := find.Lookup("sort").Document().Index(0).Key(); first != "pinned" {
+			t.Errorf("pages are sorted by %s first, want pinned", first)
+		}
+	})
+
+	withMockDB(t, "last page", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(docs[2]))
+		path := "/todos/" + user.ID.Hex() + "?limit=2&cursor=" + encodeTodoCursor(todos[1])
+		w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: path, cookie: sessionCookie(t, user)})
+		var page todoCursorPage
+		decodeBody(t, w, &page)
+		if len(page.Items) != 1 || page.NextCursor != "" {
+			t.Fatalf("got %d items and cursor %q, want the last todo only", len(page.Items), page.NextCursor)
+		}
+		conditions, _ := commandFilter(t, mt, "find").Lookup("$and").Array().Values()
+		if len(conditions) != 2 {
+			t.Fatalf("filter does not combine the list filter with the cursor: %v", conditions)
+		}
+	})
+
+	withMockDB(t, "invalid cursor", func(mt *mtest.T) {
+		w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + "?cursor=nonsense", cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", w.Code)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondCacheable answers 200 with body as JSON and a strong ETag of its
+// content. A request whose If-None-Match lists that ETag gets 304 instead,
+// and a HEAD request gets the same headers, Content-Length included, without
+// the body.
+func respondCacheable(c *gin.Context, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Header("Content-Type", gin.MIMEJSON+"; charset=utf-8")
+	c.Header("Content-Length", strconv.Itoa(len(data)))
+	c.Status(http.StatusOK)
+	if c.Request.Method != http.MethodHead {
+		c.Writer.Write(data)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header value lists etag or is
+// the wildcard. Weak validators compare equal to their strong form.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
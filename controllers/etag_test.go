@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestHeadTodoMatchesGetWithoutBody(t *testing.T) {
+	user := newTestUser(t, "")
+	todo := models.Todo{ID: primitive.NewObjectID(), Name: "check", Status: statusPending, UserID: user.ID}
+
+	var get, head struct {
+		etag, length string
+		body         int
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		withMockDB(t, method, func(mt *mtest.T) {
+			mt.AddMockResponses(cursorResponse(todo))
+			w := serve(GetTodo, testRequest{method: method, route: "/todo/:id", path: "/todo/" + todo.ID.Hex(), cookie: sessionCookie(t, user)})
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s status = %d, want 200", method, w.Code)
+			}
+			result := &get
+			if method == http.MethodHead {
+				result = &head
+			}
+			result.etag, result.length, result.body = w.Header().Get("ETag"), w.Header().Get("Content-Length"), w.Body.Len()
+		})
+	}
+
+	if head.body != 0 {
+		t.Fatalf("HEAD returned a %d byte body", head.body)
+	}
+	if head.etag == "" || head.etag != get.etag {
+		t.Fatalf("HEAD ETag %q, GET ETag %q", head.etag, get.etag)
+	}
+	if head.length != get.length || head.length != strconv.Itoa(get.body) {
+		t.Fatalf("HEAD Content-Length %q, GET Content-Length %q for %d bytes", head.length, get.length, get.body)
+	}
+}
+
+func TestHeadMissingTodoIsNotFound(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "missing", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		w := serve(GetTodo, testRequest{method: http.MethodHead, route: "/todo/:id", path: "/todo/" + primitive.NewObjectID().Hex(), cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", w.Code)
+		}
+	})
+}
+
+func TestHeadTodoRequiresSession(t *testing.T) {
+	w := serve(GetTodo, testRequest{method: http.MethodHead, route: "/todo/:id", path: "/todo/" + primitive.NewObjectID().Hex()})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+}
+
+func TestMatchingETagIsNotModified(t *testing.T) {
+	user := newTestUser(t, "")
+	todo := models.Todo{ID: primitive.NewObjectID(), Name: "check", Status: statusPending, UserID: user.ID}
+	var etag string
+	withMockDB(t, "first", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(todo))
+		w := serve(GetTodo, testRequest{method: http.MethodGet, route: "/todo/:id", path: "/todo/" + todo.ID.Hex(), cookie: sessionCookie(t, user)})
+		etag = w.Header().Get("ETag")
+	})
+	withMockDB(t, "revalidate", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(todo))
+		w := serve(GetTodo, testRequest{
+			method: http.MethodGet, route: "/todo/:id", path: "/todo/" + todo.ID.Hex(),
+			cookie: sessionCookie(t, user), headers: map[string]string{"If-None-Match": etag},
+		})
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("status = %d with %d bytes, want an empty 304", w.Code, w.Body.Len())
+		}
+	})
+}
+
+func TestETagMatches(t *testing.T) {
+	cases := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"x", "abc"`, true},
+		{`*`, true},
+		{`"x"`, false},
+		{``, false},
+	}
+	for _, tc := range cases {
+		if got := etagMatches(tc.header, `"abc"`); got != tc.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NextTodo returns the one todo the session user should work on next, as
+// chosen by nextTodo, or 204 when nothing is actionable. Completed, draft,
+// archived and blocked todos are never chosen.
+func NextTodo(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	filter := bson.M{
+		"userid":   ownerMatch(owner),
+		"status":   bson.M{"$ne": statusCompleted},
+		"draft":    bson.M{"$ne": true},
+		"archived": bson.M{"$ne": true},
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	todos := todosForRead(c, owner.Hex())
+	cursor, err := todos.Find(ctx, filter, options.Find().SetProjection(bson.M{"notes": 0, "attachments": 0, "snoozes": 0}))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	candidates := []models.Todo{}
+	if err := cursor.All(ctx, &candidates); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := markBlocked(ctx, todos, candidates); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	next, ok := nextTodo(candidates, time.Now())
+	if !ok {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, next)
+}
+
+// nextTodo picks the most pressing actionable todo: overdue before not
+// overdue, then by priority, then the nearest due date, with undated todos
+// after dated ones. Remaining ties go to the oldest todo. ok is false when
+// every todo is completed, a draft, archived or blocked.
+func nextTodo(todos []models.Todo, now time.Time) (next models.Todo, ok bool) {
+	for _, todo := range todos {
+		if todo.Status == statusCompleted || todo.Draft || todo.Archived || todo.IsBlocked {
+			continue
+		}
+		if !ok || morePressing(todo, next, now) {
+			next, ok = todo, true
+		}
+	}
+	return next, ok
+}
+
+// morePressing reports whether a should be worked on before b.
+func morePressing(a, b models.Todo, now time.Time) bool {
+	if aOverdue, bOverdue := a.IsOverdue(now), b.IsOverdue(now); aOverdue != bOverdue {
+		return aOverdue
+	}
+	if aRank, bRank := priorityRank(a.Priority), priorityRank(b.Priority); aRank != bRank {
+		return aRank < bRank
+	}
+	if aDated, bDated := !a.DueDate.IsZero(), !b.DueDate.IsZero(); aDated != bDated {
+		return aDated
+	}
+	if !a.DueDate.Equal(b.DueDate.Time) {
+		return a.DueDate.Before(b.DueDate.Time)
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt.Time) {
+		return a.CreatedAt.Before(b.CreatedAt.Time)
+	}
+	return a.ID.Hex() < b.ID.Hex()
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestNextTodoScoring(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) models.JSONTime { return models.NewJSONTime(now.Add(offset)) }
+	todo := func(name, priority string, due models.JSONTime) models.Todo {
+		return models.Todo{ID: primitive.NewObjectID(), Name: name, Status: statusPending, Priority: priority, DueDate: due, CreatedAt: at(-24 * time.Hour)}
+	}
+	older := todo("older", priorityMedium, models.JSONTime{})
+	older.CreatedAt = at(-48 * time.Hour)
+
+	for _, tc := range []struct {
+		name  string
+		todos []models.Todo
+		want  string
+	}{
+		{"overdue before priority", []models.Todo{
+			todo("high later", priorityHigh, at(time.Hour)),
+			todo("low overdue", priorityLow, at(-time.Hour)),
+		}, "low overdue"},
+		{"priority before due date", []models.Todo{
+			todo("medium soon", priorityMedium, at(time.Hour)),
+			todo("high next week", priorityHigh, at(7*24*time.Hour)),
+			todo("none sooner", "", at(time.Minute)),
+		}, "high next week"},
+		{"nearest due date", []models.Todo{
+			todo("tomorrow", priorityMedium, at(24*time.Hour)),
+			todo("tonight", priorityMedium, at(6*time.Hour)),
+		}, "tonight"},
+		{"dated before undated", []models.Todo{
+			todo("someday", priorityMedium, models.JSONTime{}),
+			todo("next month", priorityMedium, at(30*24*time.Hour)),
+		}, "next month"},
+		{"oldest breaks ties", []models.Todo{
+			todo("newer", priorityMedium, models.JSONTime{}),
+			older,
+		}, "older"},
+		{"most overdue among overdue at equal priority", []models.Todo{
+			todo("yesterday", priorityHigh, at(-24*time.Hour)),
+			todo("last week", priorityHigh, at(-7*24*time.Hour)),
+		}, "last week"},
+	} {
+		// The answer must not depend on the order the todos were fetched in
+		for _, todos := range [][]models.Todo{tc.todos, reversed(tc.todos)} {
+			next, ok := nextTodo(todos, now)
+			if !ok || next.Name != tc.want {
+				t.Errorf("%s: picked %q (ok %v), want %q", tc.name, next.Name, ok, tc.want)
+			}
+		}
+	}
+}
+
+func reversed(todos []models.Todo) []models.Todo {
+	out := make([]models.Todo, len(todos))
+	for i, todo := range todos {
+		out[len(todos)-1-i] = todo
+	}
+	return out
+}
+
+func TestNextTodoSkipsUnactionable(t *testing.T) {
+	now := time.Now()
+	overdue := models.NewJSONTime(now.Add(-time.Hour))
+	unactionable := []models.Todo{
+		{Name: "done", Status: statusCompleted, Priority: priorityHigh, DueDate: overdue},
+		{Name: "draft", Status: statusPending, Draft: true, Priority: priorityHigh, DueDate: overdue},
+		{Name: "archived", Status: statusPending, Archived: true, Priority: priorityHigh, DueDate: overdue},
+		{Name: "blocked", Status: statusPending, IsBlocked: true, Priority: priorityHigh, DueDate: overdue},
+	}
+	if next, ok := nextTodo(unactionable, now); ok {
+		t.Errorf("picked %q from unactionable todos", next.Name)
+	}
+	if next, ok := nextTodo(nil, now); ok {
+		t.Errorf("picked %q from no todos", next.Name)
+	}
+
+	actionable := append(unactionable, models.Todo{Name: "plain", Status: statusPending})
+	if next, ok := nextTodo(actionable, now); !ok || next.Name != "plain" {
+		t.Errorf("picked %q (ok %v), want the only actionable todo", next.Name, ok)
+	}
+}
+
+func TestNextTodoEndpoint(t *testing.T) {
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+	next := testRequest{method: http.MethodGet, route: "/todos/next", path: "/todos/next", cookie: cookie}
+
+	withMockDB(t, "picks one", func(mt *mtest.T) {
+		blocker, blocked := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			cursorResponse(
+				bson.D{{Key: "_id", Value: blocked}, {Key: "name", Value: "blocked"}, {Key: "status", Value: statusPending}, {Key: "priority", Value: priorityHigh}, {Key: "blocked_by", Value: bson.A{blocker}}},
+				bson.D{{Key: "_id", Value: blocker}, {Key: "name", Value: "blocker"}, {Key: "status", Value: statusPending}, {Key: "priority", Value: priorityLow}},
+			),
+			cursorResponse(bson.D{{Key: "_id", Value: blocker}}),
+		)
+		w := serve(NextTodo, next)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var body struct {
+			Name string `json:"name"`
+		}
+		decodeBody(t, w, &body)
+		if body.Name != "blocker" {
+			t.Errorf("picked %q, want the todo that is not blocked", body.Name)
+		}
+
+		filter := commandFilter(t, mt, "find")
+		for _, field := range []string{"status", "draft", "archived"} {
+			if _, err := filter.LookupErr(field, "$ne"); err != nil {
+				t.Errorf("filter %s does not exclude by %s", filter, field)
+			}
+		}
+		if owner := filter.Lookup("userid", "$in").Array().Index(0).Value().ObjectID(); owner != user.ID {
+			t.Errorf("filter %s is not scoped to the session user", filter)
+		}
+	})
+
+	withMockDB(t, "nothing actionable", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		w := serve(NextTodo, next)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("204 has body %s", w.Body)
+		}
+	})
+
+	if w := serve(NextTodo, testRequest{method: http.MethodGet, route: "/todos/next", path: "/todos/next"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a session: status = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/server"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// readinessTimeout bounds the database ping behind /readyz, so a probe never
+// waits on a hung connection.
+const readinessTimeout = 2 * time.Second
+
+// Healthz reports that the process is alive. It stays 200 while draining,
+// so orchestrators do not restart an instance that is shutting down cleanly.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the instance should receive traffic: it is not
+// draining and MongoDB answers a ping.
+func Readyz(c *gin.Context) {
+	if server.Draining() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+	if database.Client == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "database unavailable"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+	if err := database.Client.Ping(ctx, readpref.Primary()); err != nil {
+		log.Printf("Readiness check failed: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "database unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// Drain makes /readyz fail from now on, so the load balancer stops routing
+// new requests here ahead of a deploy. Requests already in flight, and any
+// that still arrive, are served normally.
+func Drain(c *gin.Context) {
+	if !auth.ValidateAdminAPI(c) {
+		return
+	}
+	server.StartDraining()
+	log.Printf("Draining: /readyz now reports not ready")
+	c.JSON(http.StatusAccepted, gin.H{"status": "draining"})
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jeffthorne/tasky/database"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestReadyzWithoutDatabase(t *testing.T) {
+	previous := database.Client
+	database.Client = nil
+	defer func() { database.Client = previous }()
+
+	if w := serve(Readyz, testRequest{method: http.MethodGet, route: "/readyz", path: "/readyz"}); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+}
+
+// TestDrain leaves the process draining, which cannot be undone; no other
+// test depends on /readyz reporting ready.
+func TestDrain(t *testing.T) {
+	healthz := testRequest{method: http.MethodGet, route: "/healthz", path: "/healthz"}
+	readyz := testRequest{method: http.MethodGet, route: "/readyz", path: "/readyz"}
+	drain := func(role string) testRequest {
+		return testRequest{method: http.MethodPost, route: "/admin/drain", path: "/admin/drain", cookie: sessionCookie(t, newTestUser(t, role))}
+	}
+
+	withMockDB(t, "ready", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if w := serve(Readyz, readyz); w.Code != http.StatusOK {
+			t.Fatalf("before draining: /readyz status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	if w := serve(Drain, drain("")); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin drain: status = %d, want 403", w.Code)
+	}
+	if w := serve(Drain, drain("admin")); w.Code != http.StatusAccepted {
+		t.Fatalf("drain: status = %d, body %s", w.Code, w.Body)
+	}
+
+	withMockDB(t, "draining", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		w := serve(Readyz, readyz)
+		var body struct {
+			Status string `json:"status"`
+		}
+		decodeBody(t, w, &body)
+		if w.Code != http.StatusServiceUnavailable || body.Status != "draining" {
+			t.Errorf("after draining: /readyz = %d %s, want 503 draining", w.Code, w.Body)
+		}
+	})
+	if w := serve(Healthz, healthz); w.Code != http.StatusOK {
+		t.Errorf("after draining: /healthz status = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultSignupIdempotencyTTL = 24 * time.Hour
+	maxIdempotencyKeyLength     = 255
+)
+
+// signupIdempotency remembers which user a signup with an Idempotency-Key
+// created. MongoDB deletes it once expires_at has passed.
+type signupIdempotency struct {
+	Key       string             `bson:"_id"`
+	Email     string             `bson:"email"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+func init() {
+	ensureIndex("signup_idempotency", mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+}
+
+// signupIdempotencyTTL reads SIGNUP_IDEMPOTENCY_TTL, how long a retried
+// signup is recognized.
+func signupIdempotencyTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("SIGNUP_IDEMPOTENCY_TTL"))
+	if err != nil || ttl <= 0 {
+		return defaultSignupIdempotencyTTL
+	}
+	return ttl
+}
+
+func signupIdempotencyFor(c *gin.Context) *mongo.Collection {
+	return tenantCollection(c, "signup_idempotency")
+}
+
+func storeSignupIdempotency(ctx context.Context, c *gin.Context, key string, email string, userID primitive.ObjectID) error {
+	record := signupIdempotency{Key: key, Email: email, UserID: userID, ExpiresAt: time.Now().Add(signupIdempotencyTTL())}
+	_, err := signupIdempotencyFor(c).ReplaceOne(ctx, bson.M{"_id": key}, record, options.Replace().SetUpsert(true))
+	if database.IsDuplicateKeyError(err) {
+		// A concurrent upsert of the same key stored it first
+		return nil
+	}
+	return err
+}
+
+// replaySignup answers a signup whose Idempotency-Key matches an earlier
+// successful one with that signup's result and a fresh session. The email
+// and password must match the original, so a leaked key is not a login. It
+// returns false, without responding, when there is nothing to replay.
+func replaySignup(ctx context.Context, c *gin.Context, key string, user models.User) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		return true
+	}
+
+	var record signupIdempotency
+	err := signupIdempotencyFor(c).FindOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking the idempotency key"})
+		return true
+	}
+
+	var original models.User
+	err = usersFor(c).FindOne(ctx, bson.M{"_id": record.UserID}).Decode(&original)
+	if err == mongo.ErrNoDocuments {
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking the idempotency key"})
+		return true
+	}
+
+	matches := record.Email == *user.Email
+	if matches {
+		matches, err = auth.VerifyPassword(*user.Password, *original.Password)
+		if errors.Is(err, auth.ErrBusy) {
+			respondAuthBusy(c)
+			return true
+		}
+	}
+	if !matches {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"code": "IDEMPOTENCY_KEY_REUSED", "error": "Idempotency-Key was already used for a different signup"})
+		return true
+	}
+
+	if !original.IsActive() {
+		c.JSON(http.StatusForbidden, gin.H{"code": "ACCOUNT_DEACTIVATED", "error": "this account has been deactivated"})
+		return true
+	}
+
+	if token, ok := startSession(c, original); ok {
+		c.JSON(http.StatusOK, withSessionToken(gin.H{"InsertedID": record.UserID}, token))
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeffthorne/tasky/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const signupPassword = "correct horse battery staple"
+
+// signUpWithKey posts a signup for email carrying idempotency key.
+func signUpWithKey(email string, key string) *httptest.ResponseRecorder {
+	return serve(SignUp, testRequest{
+		method: http.MethodPost, route: "/signup", path: "/signup",
+		body:    `{"username": "Jo", "email": "` + email + `", "password": "` + signupPassword + `"}`,
+		headers: map[string]string{"Idempotency-Key": key},
+	})
+}
+
+// idempotencyRecord is the stored result of an earlier signup of user with key.
+func idempotencyRecord(key string, email string, userID primitive.ObjectID) bson.D {
+	return bson.D{
+		{Key: "_id", Value: key},
+		{Key: "email", Value: email},
+		{Key: "user_id", Value: userID},
+		{Key: "expires_at", Value: time.Now().Add(time.Hour)},
+	}
+}
+
+func TestSignUpStoresIdempotencyKey(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	withMockDB(t, "new key", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(), // no earlier signup with the key
+			cursorResponse(), // the email is free
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: "signup-new"}}}}),
+		)
+		w := signUpWithKey("new-key@example.com", "signup-new")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var body struct {
+			InsertedID string `json:"InsertedID"`
+		}
+		decodeBody(t, w, &body)
+
+		var stored bson.Raw
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "update" && evt.Command.Lookup("update").StringValue() == "signup_idempotency" {
+				stored = evt.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+			}
+		}
+		if stored == nil {
+			t.Fatal("the idempotency key was not stored")
+		}
+		if key := stored.Lookup("_id").StringValue(); key != "signup-new" {
+			t.Errorf("stored key %q", key)
+		}
+		if userID := stored.Lookup("user_id").ObjectID().Hex(); userID != body.InsertedID {
+			t.Errorf("stored user %s, signup created %s", userID, body.InsertedID)
+		}
+	})
+}
+
+func TestSignUpReplaysRetriedKey(t *testing.T) {
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash(signupPassword)
+	user := storedUser(hash)
+
+	withMockDB(t, "retry", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(idempotencyRecord("signup-retry", *user.Email, user.ID)), cursorResponse(user))
+		w := signUpWithKey(*user.Email, "signup-retry")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var body struct {
+			InsertedID string `json:"InsertedID"`
+		}
+		decodeBody(t, w, &body)
+		if body.InsertedID != user.ID.Hex() {
+			t.Errorf("InsertedID = %s, want the original %s", body.InsertedID, user.ID.Hex())
+		}
+		if !strings.Contains(w.Header().Get("Set-Cookie"), "token=") {
+			t.Error("no fresh session cookie was set")
+		}
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "insert" || evt.CommandName == "count" || evt.CommandName == "aggregate" {
+				t.Errorf("the retry sent %s", evt.CommandName)
+			}
+		}
+	})
+}
+
+func TestSignUpRejectsReusedKey(t *testing.T) {
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash(signupPassword)
+	user := storedUser(hash)
+
+	withMockDB(t, "other email", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(idempotencyRecord("signup-reused", *user.Email, user.ID)), cursorResponse(user))
+		w := signUpWithKey("someone-else@example.com", "signup-reused")
+		assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED")
+	})
+
+	withMockDB(t, "too long", func(mt *mtest.T) {
+		if w := signUpWithKey("long-key@example.com", strings.Repeat("k", maxIdempotencyKeyLength+1)); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", w.Code)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxActivityWriteInterval bounds how stale the stored last_seen of an active
+// session may get.
+const maxActivityWriteInterval = time.Minute
+
+func init() {
+	// A session record is useless once its token has expired
+	ensureIndex("sessions", mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+}
+
+// idleTimeout reads IDLE_TIMEOUT, how long a session may go without requests
+// before it is treated as expired; 0, the default, disables the check.
+func idleTimeout() time.Duration {
+	value := os.Getenv("IDLE_TIMEOUT")
+	if value == "" {
+		return 0
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		log.Printf("Invalid IDLE_TIMEOUT %q, idle sessions are not expired", value)
+		return 0
+	}
+	return timeout
+}
+
+// sessionsFor returns the session activity collection of the request's
+// tenant.
+func sessionsFor(c *gin.Context) *mongo.Collection {
+	return tenantCollection(c, "sessions")
+}
+
+var sessionActivity = &activityTracker{entries: map[string]*activity{}}
+
+// activityTracker remembers when each session was last seen. Requests update
+// memory; the shared last_seen in the sessions collection is only written
+// once per interval per session, so a busy session costs one write a minute
+// rather than one per request. Other replicas' writes are read back before a
+// session is declared idle.
+type activityTracker struct {
+	mu      sync.Mutex
+	entries map[string]*activity
+}
+
+type activity struct {
+	seen    time.Time
+	written time.Time
+}
+
+// checkIdle rejects the session behind claims if it has been idle longer than
+// IDLE_TIMEOUT, and otherwise records this request as activity. Tokens issued
+// before sessions had ids are not tracked.
+func checkIdle(ctx context.Context, c *gin.Context, claims *auth.Claims) error {
+	timeout := idleTimeout()
+	if timeout == 0 || claims.Id == "" {
+		return nil
+	}
+	key := tenantScoped(c, claims.Id)
+	now := time.Now()
+
+	seen, written := sessionActivity.get(key)
+	if now.Sub(seen) > timeout {
+		// Another replica may have served the session since
+		stored, err := storedLastSeen(ctx, c, claims.Id)
+		if err != nil {
+			return err
+		}
+		if stored.After(seen) {
+			seen = stored
+		}
+		if seen.IsZero() {
+			seen = time.Unix(claims.IssuedAt, 0)
+		}
+		if now.Sub(seen) > timeout {
+			return auth.ErrSessionRevoked
+		}
+	}
+
+	if now.Sub(written) < activityWriteInterval(timeout) {
+		sessionActivity.set(key, now, written, timeout)
+		return nil
+	}
+	update := bson.M{"$set": bson.M{
+		"user":       claims.Username,
+		"last_seen":  now,
+		"expires_at": time.Unix(claims.ExpiresAt, 0),
+	}}
+	if _, err := sessionsFor(c).UpdateOne(ctx, bson.M{"_id": claims.Id}, update, options.Update().SetUpsert(true)); err != nil {
+		// Activity is kept in memory and written on a later request
+		log.Printf("Error recording session activity: %v", err)
+		sessionActivity.set(key, now, written, timeout)
+		return nil
+	}
+	sessionActivity.set(key, now, now, timeout)
+	return nil
+}
+
+// activityWriteInterval is how often an active session's last_seen is
+// written: often enough that other replicas never see it as idle.
+func activityWriteInterval(timeout time.Duration) time.Duration {
+	if interval := timeout / 4; interval < maxActivityWriteInterval {
+		return interval
+	}
+	return maxActivityWriteInterval
+}
+
+// storedLastSeen returns the last_seen shared by all replicas, or the zero
+// time when the session has no record yet.
+func storedLastSeen(ctx context.Context, c *gin.Context, id string) (time.Time, error) {
+	var record struct {
+		LastSeen time.Time `bson:"last_seen"`
+	}
+	err := sessionsFor(c).FindOne(ctx, bson.M{"_id": id}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	return record.LastSeen, err
+}
+
+func (t *activityTracker) get(key string) (seen time.Time, written time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if a, ok := t.entries[key]; ok {
+		return a.seen, a.written
+	}
+	return time.Time{}, time.Time{}
+}
+
+// set records activity for key. Adding a session also drops those idle past
+// timeout, so sessions that ended do not accumulate.
+func (t *activityTracker) set(key string, seen time.Time, written time.Time, timeout time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.entries[key]; !ok {
+		for other, a := range t.entries {
+			if seen.Sub(a.seen) > timeout {
+				delete(t.entries, other)
+			}
+		}
+	}
+	t.entries[key] = &activity{seen: seen, written: written}
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// idleProbe is an API handler that only authenticates the caller.
+func idleProbe(c *gin.Context) {
+	if !auth.ValidateSessionAPI(c) {
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// sessionID returns the session id in cookie's token.
+func sessionID(t *testing.T, cookie *http.Cookie) string {
+	t.Helper()
+	token, err := auth.ValidateJWT(cookie.Value)
+	if err != nil {
+		t.Fatalf("ValidateJWT: %v", err)
+	}
+	id := token.Claims.(*auth.Claims).Id
+	if id == "" {
+		t.Fatal("token has no session id")
+	}
+	return id
+}
+
+func TestIdleSessions(t *testing.T) {
+	t.Setenv("IDLE_TIMEOUT", "30m")
+	user := newTestUser(t, "")
+	probe := func(cookie *http.Cookie) testRequest {
+		return testRequest{method: http.MethodGet, route: "/probe", path: "/probe", cookie: cookie}
+	}
+
+	withMockDB(t, "active", func(mt *mtest.T) {
+		cookie := sessionCookie(t, user)
+		now := time.Now()
+		sessionActivity.set(sessionID(t, cookie), now.Add(-time.Minute), now, 30*time.Minute)
+		// Recently written activity is kept in memory, so no database call
+		if w := serve(idleProbe, probe(cookie)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if evt := mt.GetStartedEvent(); evt != nil {
+			t.Errorf("unexpected %s command", evt.CommandName)
+		}
+	})
+
+	withMockDB(t, "idle", func(mt *mtest.T) {
+		cookie := sessionCookie(t, user)
+		now := time.Now()
+		sessionActivity.set(sessionID(t, cookie), now.Add(-31*time.Minute), now.Add(-31*time.Minute), 30*time.Minute)
+		mt.AddMockResponses(cursorResponse())
+		if w := serve(idleProbe, probe(cookie)); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", w.Code)
+		}
+	})
+
+	withMockDB(t, "seen by another replica", func(mt *mtest.T) {
+		cookie := sessionCookie(t, user)
+		id := sessionID(t, cookie)
+		now := time.Now()
+		sessionActivity.set(id, now.Add(-31*time.Minute), now.Add(-31*time.Minute), 30*time.Minute)
+		mt.AddMockResponses(
+			cursorResponse(bson.D{{Key: "_id", Value: id}, {Key: "last_seen", Value: now.Add(-time.Minute)}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		if w := serve(idleProbe, probe(cookie)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if filter := commandFilter(t, mt, "update"); filter.Lookup("_id").StringValue() != id {
+			t.Errorf("activity written for %s, want %s", filter, id)
+		}
+		if seen, _ := sessionActivity.get(id); now.Sub(seen) > time.Minute {
+			t.Errorf("last seen %v, want refreshed", seen)
+		}
+	})
+
+	withMockDB(t, "disabled", func(mt *mtest.T) {
+		t.Setenv("IDLE_TIMEOUT", "0")
+		cookie := sessionCookie(t, user)
+		sessionActivity.set(sessionID(t, cookie), time.Now().Add(-24*time.Hour), time.Time{}, 30*time.Minute)
+		if w := serve(idleProbe, probe(cookie)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestIdleTimeoutFromEnv(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":      0,
+		"0":     0,
+		"15m":   15 * time.Minute,
+		"-5m":   0,
+		"never": 0,
+	} {
+		t.Setenv("IDLE_TIMEOUT", value)
+		if got := idleTimeout(); got != want {
+			t.Errorf("IDLE_TIMEOUT=%q: got %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestActivityWriteInterval(t *testing.T) {
+	if got := activityWriteInterval(30 * time.Minute); got != maxActivityWriteInterval {
+		t.Errorf("interval for 30m = %v, want %v", got, maxActivityWriteInterval)
+	}
+	if got := activityWriteInterval(2 * time.Minute); got != 30*time.Second {
+		t.Errorf("interval for 2m = %v, want 30s", got)
+	}
+}
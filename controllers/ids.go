@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// invalidIDCode is the error code of every 400 for a malformed id, so clients
+// can tell a bad id from other bad requests.
+const invalidIDCode = "INVALID_ID"
+
+// respondInvalidID rejects a malformed id; kind names what it identifies.
+func respondInvalidID(c *gin.Context, kind string) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + kind + " id", "code": invalidIDCode})
+}
+
+// parseID reads the ObjectID in the named route parameter. It responds with
+// 400 and returns ok=false if the parameter is not a valid ObjectID.
+func parseID(c *gin.Context, name string, kind string) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param(name))
+	if err != nil {
+		respondInvalidID(c, kind)
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+// todoIDParam matches the todo named by the route parameter, which may hold
+// its ObjectID or its short id. It responds with 400 and returns ok=false for
+// anything else.
+func todoIDParam(c *gin.Context, name string) (bson.M, bool) {
+	filter, ok := todoIDFilter(c.Param(name))
+	if !ok {
+		respondInvalidID(c, "todo")
+		return nil, false
+	}
+	return filter, true
+}
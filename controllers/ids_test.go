@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMalformedIDsAreInvalidID(t *testing.T) {
+	user := newTestUser(t, auth.RoleAdmin)
+	cookie := sessionCookie(t, user)
+	const garbage = "not-an-id"
+	todoID := primitive.NewObjectID().Hex()
+
+	for _, tc := range []struct {
+		handler gin.HandlerFunc
+		method  string
+		route   string
+		path    string
+		body    string
+	}{
+		{GetTodo, http.MethodGet, "/todo/:id", "/todo/" + garbage, ""},
+		{DeleteTodo, http.MethodDelete, "/todo/:userid/:id", "/todo/" + user.ID.Hex() + "/" + garbage, ""},
+		{UpdateNotes, http.MethodPut, "/todos/:id/notes", "/todos/" + garbage + "/notes", `{"notes": "n"}`},
+		{SetBlockers, http.MethodPut, "/todos/:id/blocked-by", "/todos/" + garbage + "/blocked-by", `{"ids": []}`},
+		{ReplaceTodo, http.MethodPut, "/todos/:id", "/todos/" + garbage, `{"name": "n", "status": "pending"}`},
+		{PatchTodo, http.MethodPatch, "/todos/:id", "/todos/" + garbage, `{"name": "n"}`},
+		{ArchiveTodo, http.MethodPost, "/todos/:id/archive", "/todos/" + garbage + "/archive", ""},
+		{PinTodo, http.MethodPost, "/todos/:id/pin", "/todos/" + garbage + "/pin", ""},
+		{PublishTodo, http.MethodPost, "/todos/:id/publish", "/todos/" + garbage + "/publish", ""},
+		{SnoozeTodo, http.MethodPost, "/todos/:id/snooze", "/todos/" + garbage + "/snooze", `{"duration": "1h"}`},
+		{AddAttachment, http.MethodPost, "/todos/:id/attachments", "/todos/" + garbage + "/attachments", `{"url": "https://example.com/a"}`},
+		{DeleteAttachment, http.MethodDelete, "/todos/:id/attachments/:attachmentId", "/todos/" + todoID + "/attachments/" + garbage, ""},
+		{RevokeAPIKey, http.MethodDelete, "/me/api-keys/:id", "/me/api-keys/" + garbage, ""},
+		{ReactivateUser, http.MethodPost, "/admin/users/:id/reactivate", "/admin/users/" + garbage + "/reactivate", ""},
+	} {
+		t.Run(tc.method+" "+tc.route, func(t *testing.T) {
+			w := serve(tc.handler, testRequest{method: tc.method, route: tc.route, path: tc.path, body: tc.body, cookie: cookie})
+			assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusBadRequest, invalidIDCode)
+		})
+	}
+}
+
+func TestTodoIDParamAcceptsShortIDs(t *testing.T) {
+	echo := func(c *gin.Context) {
+		if filter, ok := todoIDParam(c, "id"); ok {
+			c.JSON(http.StatusOK, filter)
+		}
+	}
+	for id, want := range map[string]int{
+		primitive.NewObjectID().Hex(): http.StatusOK,
+		"Ab3dE9xZ":                    http.StatusOK,
+		"Ab3dE9x":                     http.StatusBadRequest,
+		"Ab3d-9xZ":                    http.StatusBadRequest,
+	} {
+		w := serve(echo, testRequest{method: http.MethodGet, route: "/todo/:id", path: "/todo/" + id})
+		if w.Code != want {
+			t.Errorf("%s: status = %d, want %d", id, w.Code, want)
+		}
+	}
+}
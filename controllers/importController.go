@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"github.com/jeffthorne/tasky/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Import limits used when the IMPORT_MAX_* variables are unset or invalid.
+const (
+	defaultImportMaxItems      = 1000
+	defaultImportMaxBytes      = 1 << 20
+	defaultImportMaxNameLength = 500
+	maxImportTags              = 20
+)
+
+// importLimits bounds what a single import may contain. Every limit is
+// checked while the body is read, before anything is written.
+type importLimits struct {
+	items      int
+	bytes      int64
+	nameLength int
+}
+
+func importLimitsFromEnv() importLimits {
+	return importLimits{
+		items:      positiveIntFromEnv("IMPORT_MAX_ITEMS", defaultImportMaxItems),
+		bytes:      int64(positiveIntFromEnv("IMPORT_MAX_BYTES", defaultImportMaxBytes)),
+		nameLength: positiveIntFromEnv("IMPORT_MAX_NAME_LENGTH", defaultImportMaxNameLength),
+	}
+}
+
+// positiveIntFromEnv reads a positive integer setting, falling back when it
+// is unset or invalid.
+func positiveIntFromEnv(name string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n < 1 {
+		return fallback
+	}
+	return n
+}
+
+// importItem is one todo in a JSON import.
+type importItem = models.TodoInput
+
+// errImportTooLarge is returned by importBody once the body exceeds the byte
+// limit, and when the item limit is exceeded.
+var errImportTooLarge = errors.New("import is too large")
+
+// importBody fails reads with errImportTooLarge once more than limit bytes
+// have been read, instead of truncating the body.
+type importBody struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (b *importBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return 0, errImportTooLarge
+	}
+	return n, err
+}
+
+// ImportTodos creates todos for the session user from a JSON array of todos
+// (application/json) or one todo name per line (text/plain). The whole import
+// is validated before the first insert, so a rejected import writes nothing.
+func ImportTodos(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	limits := importLimitsFromEnv()
+	if c.Request.ContentLength > limits.bytes {
+		respondImportTooLarge(c, limits)
+		return
+	}
+	body := &importBody{r: c.Request.Body, limit: limits.bytes}
+
+	var items []importItem
+	var err error
+	switch c.ContentType() {
+	case gin.MIMEJSON:
+		items, err = decodeJSONImport(body, limits)
+	case gin.MIMEPlain:
+		items, err = decodeTextImport(body, limits)
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"code": "UNSUPPORTED_MEDIA_TYPE", "error": "Content-Type must be application/json or text/plain"})
+		return
+	}
+	if errors.Is(err, errImportTooLarge) {
+		respondImportTooLarge(c, limits)
+		return
+	}
+	if tooComplex, ok := payloadComplexity(err); ok {
+		respondPayloadTooComplex(c, tooComplex)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "import must contain at least one todo"})
+		return
+	}
+
+	userid, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	order, err := nextTodoOrder(ctx, todosFor(c), userid)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(items))
+	created := make([]models.Todo, 0, len(items))
+	for i, item := range items {
+		// Items were validated while decoding
+		todo, err := models.NewTodo(userid, item)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("todo %d: %v", i+1, err), "imported": len(ids)})
+			return
+		}
+		todo.Order = order + i
+		if err := insertWithShortID(ctx, todosFor(c), todo); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "imported": len(ids)})
+			return
+		}
+		ids = append(ids, todo.ID)
+		created = append(created, *todo)
+	}
+	todosChanged(c, userid.Hex())
+	dispatchTodoEvent(c, userid, webhook.TodoCreated, created...)
+
+	c.JSON(http.StatusCreated, gin.H{"imported": len(ids), "ids": ids})
+}
+
+func respondImportTooLarge(c *gin.Context, limits importLimits) {
+	msg := fmt.Sprintf("import must be at most %d bytes and %d todos", limits.bytes, limits.items)
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{"code": "IMPORT_TOO_LARGE", "error": msg})
+}
+
+// decodeJSONImport reads a JSON array one element at a time, so an
+// oversized import is rejected without being held in memory.
+func decodeJSONImport(r io.Reader, limits importLimits) ([]importItem, error) {
+	dec := guardedJSONDecoder(r)
+	if tok, err := dec.Token(); err != nil {
+		return nil, importDecodeError(err)
+	} else if tok != json.Delim('[') {
+		return nil, errors.New("import must be a JSON array of todos")
+	}
+
+	var items []importItem
+	for dec.More() {
+		if len(items) == limits.items {
+			return nil, errImportTooLarge
+		}
+		var item importItem
+		if err := dec.Decode(&item); err != nil {
+			return nil, importDecodeError(err)
+		}
+		if err := validateImportItem(item, limits); err != nil {
+			return nil, fmt.Errorf("todo %d: %w", len(items), err)
+		}
+		items = append(items, item)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, importDecodeError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("import must contain a single JSON array")
+	}
+	return items, nil
+}
+
+// decodeTextImport reads one todo name per line, skipping blank lines.
+func decodeTextImport(r io.Reader, limits importLimits) ([]importItem, error) {
+	scanner := bufio.NewScanner(r)
+	// A line may hold a name of nameLength runes of up to 4 bytes each
+	scanner.Buffer(make([]byte, 0, 64), 4*limits.nameLength+2)
+
+	var items []importItem
+	for line := 1; scanner.Scan(); line++ {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" {
+			continue
+		}
+		if len(items) == limits.items {
+			return nil, errImportTooLarge
+		}
+		item := importItem{Name: name}
+		if err := validateImportItem(item, limits); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("names must be at most %d characters", limits.nameLength)
+		}
+		return nil, importDecodeError(err)
+	}
+	return items, nil
+}
+
+func importDecodeError(err error) error {
+	if _, tooComplex := payloadComplexity(err); tooComplex || errors.Is(err, errImportTooLarge) {
+		return err
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("import ended unexpectedly")
+	}
+	return fmt.Errorf("import is not valid: %w", err)
+}
+
+// validateTodoName applies the name rules shared by every create and edit:
+// not blank and at most IMPORT_MAX_NAME_LENGTH characters.
+func validateTodoName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name is required")
+	}
+	if maxLength := importLimitsFromEnv().nameLength; utf8.RuneCountInString(name) > maxLength {
+		return fmt.Errorf("name must be at most %d characters", maxLength)
+	}
+	return nil
+}
+
+func validateImportItem(item importItem, limits importLimits) error {
+	if err := item.Validate(); err != nil {
+		return err
+	}
+	if err := validateTodoName(item.Name); err != nil {
+		return err
+	}
+	if len(item.Tags) > maxImportTags {
+		return fmt.Errorf("at most %d tags are allowed", maxImportTags)
+	}
+	for _, tag := range item.Tags {
+		if utf8.RuneCountInString(tag) > limits.nameLength {
+			return fmt.Errorf("tags must be at most %d characters", limits.nameLength)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// importTodos posts body to the import endpoint with the given content type.
+func importTodos(t *testing.T, contentType string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	cookie := sessionCookie(t, newTestUser(t, ""))
+	return serve(ImportTodos, testRequest{
+		method: http.MethodPost, route: "/todos/import", path: "/todos/import", body: body, cookie: cookie,
+		headers: map[string]string{"Content-Type": contentType},
+	})
+}
+
+// jsonImport is a JSON import of n todos.
+func jsonImport(n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"name": "todo %d"}`, i+1)
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+// expectInserts replies to an import of n todos: no existing order, n
+// inserts and no webhook.
+func expectInserts(mt *mtest.T, n int) {
+	mt.AddMockResponses(cursorResponse())
+	for i := 0; i < n; i++ {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+	}
+	mt.AddMockResponses(cursorResponse())
+}
+
+// countInserts returns how many insert commands were sent.
+func countInserts(mt *mtest.T) int {
+	n := 0
+	for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+		if evt.CommandName == "insert" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestImportItemCountBoundary(t *testing.T) {
+	t.Setenv("IMPORT_MAX_ITEMS", "3")
+
+	withMockDB(t, "at the limit", func(mt *mtest.T) {
+		expectInserts(mt, 3)
+		w := importTodos(t, "application/json", jsonImport(3))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if n := countInserts(mt); n != 3 {
+			t.Errorf("inserted %d todos, want 3", n)
+		}
+	})
+
+	withMockDB(t, "over the limit", func(mt *mtest.T) {
+		w := importTodos(t, "application/json", jsonImport(4))
+		assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusRequestEntityTooLarge, "IMPORT_TOO_LARGE")
+		if n := countInserts(mt); n != 0 {
+			t.Errorf("a rejected import inserted %d todos", n)
+		}
+	})
+
+	withMockDB(t, "text over the limit", func(mt *mtest.T) {
+		w := importTodos(t, "text/plain", "one\n\ntwo\nthree\nfour\n")
+		assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusRequestEntityTooLarge, "IMPORT_TOO_LARGE")
+	})
+}
+
+func TestImportByteSizeBoundary(t *testing.T) {
+	body := jsonImport(2)
+	t.Setenv("IMPORT_MAX_BYTES", fmt.Sprint(len(body)))
+
+	withMockDB(t, "at the limit", func(mt *mtest.T) {
+		expectInserts(mt, 2)
+		if w := importTodos(t, "application/json", body); w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	withMockDB(t, "one byte over", func(mt *mtest.T) {
+		w := importTodos(t, "application/json", body+" ")
+		assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusRequestEntityTooLarge, "IMPORT_TOO_LARGE")
+	})
+
+	// Without a Content-Length the limit is enforced while reading
+	withMockDB(t, "chunked", func(mt *mtest.T) {
+		req := httptest.NewRequest(http.MethodPost, "/todos/import", strings.NewReader(body+"   "))
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(sessionCookie(t, newTestUser(t, "")))
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+		ImportTodos(c)
+		assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusRequestEntityTooLarge, "IMPORT_TOO_LARGE")
+	})
+}
+
+func TestImportFieldLimits(t *testing.T) {
+	t.Setenv("IMPORT_MAX_NAME_LENGTH", "5")
+	for name, tc := range map[string]struct {
+		contentType string
+		body        string
+	}{
+		"long name":      {"application/json", `[{"name": "toolong"}]`},
+		"long tag":       {"application/json", `[{"name": "ok", "tags": ["toolong"]}]`},
+		"too many tags":  {"application/json", `[{"name": "ok", "tags": [` + strings.Repeat(`"t",`, maxImportTags) + `"t"]}]`},
+		"blank name":     {"application/json", `[{"name": "  "}]`},
+		"long text line": {"text/plain", "ok\n" + strings.Repeat("x", 100) + "\n"},
+		"not an array":   {"application/json", `{"name": "ok"}`},
+		"empty":          {"application/json", `[]`},
+		"trailing data":  {"application/json", `[] []`},
+	} {
+		if w := importTodos(t, tc.contentType, tc.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, w.Code)
+		}
+	}
+
+	if w := importTodos(t, "application/xml", "<todos/>"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("xml: status = %d, want 415", w.Code)
+	}
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultJSONMaxDepth is used when JSON_MAX_DEPTH is unset or invalid. The
+// guarded payloads need three levels at most.
+const defaultJSONMaxDepth = 10
+
+// errPayloadTooComplex is returned when a guarded payload nests too deeply
+// or, with JSON_REJECT_UNKNOWN_FIELDS, names a field the endpoint ignores.
+type errPayloadTooComplex struct {
+	reason string
+}
+
+func (e errPayloadTooComplex) Error() string {
+	return e.reason
+}
+
+func jsonMaxDepth() int {
+	return positiveIntFromEnv("JSON_MAX_DEPTH", defaultJSONMaxDepth)
+}
+
+func rejectUnknownFields() bool {
+	reject, _ := strconv.ParseBool(os.Getenv("JSON_REJECT_UNKNOWN_FIELDS"))
+	return reject
+}
+
+// jsonDepthReader fails reads with errPayloadTooComplex once the JSON passing
+// through it nests deeper than max, before the decoder builds anything. It
+// only tracks brackets and strings, leaving syntax errors to the decoder.
+type jsonDepthReader struct {
+	r        io.Reader
+	max      int
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+func (d *jsonDepthReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	for _, b := range p[:n] {
+		switch {
+		case d.escaped:
+			d.escaped = false
+		case d.inString:
+			if b == '\\' {
+				d.escaped = true
+			} else if b == '"' {
+				d.inString = false
+			}
+		case b == '"':
+			d.inString = true
+		case b == '[' || b == '{':
+			d.depth++
+			if d.depth > d.max {
+				return 0, errPayloadTooComplex{fmt.Sprintf("JSON must nest at most %d levels deep", d.max)}
+			}
+		case b == ']' || b == '}':
+			d.depth--
+		}
+	}
+	return n, err
+}
+
+// guardedJSONDecoder decodes r with the nesting limit and, if configured,
+// unknown fields rejected.
+func guardedJSONDecoder(r io.Reader) *json.Decoder {
+	dec := json.NewDecoder(&jsonDepthReader{r: r, max: jsonMaxDepth()})
+	if rejectUnknownFields() {
+		dec.DisallowUnknownFields()
+	}
+	return dec
+}
+
+// payloadComplexity maps a guarded decoder error onto errPayloadTooComplex
+// when it is one, and returns ok=false otherwise.
+func payloadComplexity(err error) (errPayloadTooComplex, bool) {
+	var tooComplex errPayloadTooComplex
+	if errors.As(err, &tooComplex) {
+		return tooComplex, true
+	}
+	// encoding/json has no error type for unknown fields
+	if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return errPayloadTooComplex{strings.TrimPrefix(err.Error(), "json: ")}, true
+	}
+	return errPayloadTooComplex{}, false
+}
+
+func respondPayloadTooComplex(c *gin.Context, err errPayloadTooComplex) {
+	c.JSON(http.StatusBadRequest, gin.H{"code": "PAYLOAD_TOO_COMPLEX", "error": err.Error()})
+}
+
+// bindGuardedJSON is bindJSON for batch endpoints, whose bodies are decoded
+// through the nesting limit. Too complex payloads get 400 PAYLOAD_TOO_COMPLEX.
+func bindGuardedJSON(c *gin.Context, obj interface{}) bool {
+	if c.ContentType() != gin.MIMEJSON {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"code": "UNSUPPORTED_MEDIA_TYPE", "error": "Content-Type must be application/json"})
+		return false
+	}
+	err := guardedJSONDecoder(c.Request.Body).Decode(obj)
+	if tooComplex, ok := payloadComplexity(err); ok {
+		respondPayloadTooComplex(c, tooComplex)
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
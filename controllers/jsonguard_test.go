@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nested returns a JSON array nested depth levels deep.
+func nested(depth int) string {
+	return strings.Repeat("[", depth) + strings.Repeat("]", depth)
+}
+
+func TestJSONDepthReader(t *testing.T) {
+	for _, tc := range []struct {
+		body     string
+		max      int
+		rejected bool
+	}{
+		{nested(3), 3, false},
+		{nested(4), 3, true},
+		{`{"a": {"b": [1, {"c": 2}]}}`, 4, false},
+		{`{"a": {"b": [1, {"c": 2}]}}`, 3, true},
+		{`{"name": "[[[[{{{{"}`, 1, false},
+		{`{"name": "quote \" then [[[["}`, 1, false},
+		{`[] [] [] []`, 1, false},
+	} {
+		_, err := io.ReadAll(&jsonDepthReader{r: strings.NewReader(tc.body), max: tc.max})
+		if _, rejected := err.(errPayloadTooComplex); rejected != tc.rejected {
+			t.Errorf("%s with max %d: err = %v, want rejected %v", tc.body, tc.max, err, tc.rejected)
+		}
+	}
+}
+
+func TestJSONMaxDepthFromEnv(t *testing.T) {
+	for value, want := range map[string]int{"": defaultJSONMaxDepth, "4": 4, "0": defaultJSONMaxDepth, "deep": defaultJSONMaxDepth} {
+		t.Setenv("JSON_MAX_DEPTH", value)
+		if got := jsonMaxDepth(); got != want {
+			t.Errorf("JSON_MAX_DEPTH=%q: got %d, want %d", value, got, want)
+		}
+	}
+}
+
+// guardedRequests returns a request with body for each endpoint whose
+// payload goes through the JSON guard.
+func guardedRequests(t *testing.T, body string) map[string]struct {
+	handler gin.HandlerFunc
+	request testRequest
+} {
+	cookie := sessionCookie(t, newTestUser(t, ""))
+	post := func(route string) testRequest {
+		return testRequest{method: http.MethodPost, route: route, path: route, body: body, cookie: cookie}
+	}
+	return map[string]struct {
+		handler gin.HandlerFunc
+		request testRequest
+	}{
+		"reorder":      {ReorderTodos, post("/todos/reorder")},
+		"batch-delete": {BatchDeleteTodos, post("/todos/batch-delete")},
+		"batch-get":    {BatchGetTodos, post("/todos/batch-get")},
+		"import":       {ImportTodos, post("/todos/import")},
+	}
+}
+
+func TestGuardedEndpointsRejectDeepNesting(t *testing.T) {
+	t.Setenv("JSON_MAX_DEPTH", "5")
+	deep := `{"ids": ` + nested(8) + `}`
+
+	for name, endpoint := range guardedRequests(t, deep) {
+		if name == "import" {
+			endpoint.request.body = `[{"name": "deep", "tags": ` + nested(8) + `}]`
+		}
+		t.Run(name, func(t *testing.T) {
+			w := serve(endpoint.handler, endpoint.request)
+			assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusBadRequest, "PAYLOAD_TOO_COMPLEX")
+		})
+	}
+}
+
+func TestGuardedEndpointsRejectUnknownFields(t *testing.T) {
+	body := `{"ids": [], "everything": true}`
+
+	t.Setenv("JSON_REJECT_UNKNOWN_FIELDS", "true")
+	for name, endpoint := range guardedRequests(t, body) {
+		if name == "import" {
+			endpoint.request.body = `[{"name": "todo", "everything": true}]`
+		}
+		t.Run(name, func(t *testing.T) {
+			w := serve(endpoint.handler, endpoint.request)
+			assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusBadRequest, "PAYLOAD_TOO_COMPLEX")
+			if !strings.Contains(w.Body.String(), "everything") {
+				t.Errorf("error %s does not name the unknown field", w.Body)
+			}
+		})
+	}
+
+	t.Setenv("JSON_REJECT_UNKNOWN_FIELDS", "")
+	for name, endpoint := range guardedRequests(t, body) {
+		if name == "import" {
+			continue
+		}
+		if w := serve(endpoint.handler, endpoint.request); strings.Contains(w.Body.String(), "PAYLOAD_TOO_COMPLEX") {
+			t.Errorf("%s: unknown fields rejected by default: %s", name, w.Body)
+		}
+	}
+}
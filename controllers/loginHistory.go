@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func init() {
+	ensureIndex("audit_log", mongo.IndexModel{Keys: bson.D{{Key: "user", Value: 1}, {Key: "timestamp", Value: -1}}})
+}
+
+// LoginAttempt is one login to the caller's account as shown to its owner.
+type LoginAttempt struct {
+	Timestamp models.JSONTime `json:"timestamp"`
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Success   bool            `json:"success"`
+}
+
+// loginHistoryPage is the paginated envelope for the login history.
+type loginHistoryPage struct {
+	Items []LoginAttempt `json:"items"`
+	Page  int            `json:"page"`
+	Limit int            `json:"limit"`
+	Total int64          `json:"total"`
+}
+
+// LoginHistory lists the recent logins to the session user's account from
+// the audit log, newest first, with page/limit pagination. result=success or
+// result=failure keeps only that outcome. Attempts with an email that
+// matched no account are not tied to anyone and never appear.
+func LoginHistory(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	events := bson.A{auditLoginSuccess, auditLoginFailure}
+	switch c.Query("result") {
+	case "":
+	case "success":
+		events = bson.A{auditLoginSuccess}
+	case "failure":
+		events = bson.A{auditLoginFailure}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "result must be success or failure"})
+		return
+	}
+	filter := bson.M{"user": owner.Hex(), "event": bson.M{"$in": events}}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	total, err := auditLogFor(c).CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := auditLogFor(c).Find(ctx, filter, findOptions)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	var entries []models.AuditEvent
+	if err := cursor.All(ctx, &entries); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	attempts := make([]LoginAttempt, 0, len(entries))
+	for _, entry := range entries {
+		attempts = append(attempts, LoginAttempt{
+			Timestamp: entry.Timestamp,
+			IP:        entry.IP,
+			UserAgent: entry.UserAgent,
+			Success:   entry.Event == auditLoginSuccess,
+		})
+	}
+
+	c.JSON(http.StatusOK, loginHistoryPage{Items: attempts, Page: page, Limit: limit, Total: total})
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// loginHistory requests the login history of the session in cookie.
+func loginHistory(t *testing.T, cookie *http.Cookie, query string) testRequest {
+	return testRequest{method: http.MethodGet, route: "/me/login-history", path: "/me/login-history?" + query, cookie: cookie}
+}
+
+func TestLoginHistoryOwnEventsOnly(t *testing.T) {
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+	at := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+
+	withMockDB(t, "own", func(mt *mtest.T) {
+		attempt := func(event string, ip string, ago time.Duration) bson.M {
+			return bson.M{"_id": primitive.NewObjectID(), "timestamp": at.Add(-ago), "user": user.ID.Hex(), "event": event, "ip": ip, "user_agent": "curl/8"}
+		}
+		mt.AddMockResponses(
+			cursorResponse(bson.M{"n": 2}),
+			cursorResponse(attempt(auditLoginFailure, "198.51.100.7", 0), attempt(auditLoginSuccess, "192.0.2.1", time.Hour)),
+		)
+		w := serve(LoginHistory, loginHistory(t, cookie, "limit=5"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		var page loginHistoryPage
+		decodeBody(t, w, &page)
+		if page.Total != 2 || len(page.Items) != 2 || page.Limit != 5 {
+			t.Fatalf("page = %+v", page)
+		}
+		if failure := page.Items[0]; failure.Success || failure.IP != "198.51.100.7" || failure.UserAgent != "curl/8" {
+			t.Errorf("failed attempt listed as %+v", failure)
+		}
+		if !page.Items[1].Success {
+			t.Errorf("successful login listed as %+v", page.Items[1])
+		}
+
+		find := commandFilter(t, mt, "find")
+		if owner := find.Lookup("user").StringValue(); owner != user.ID.Hex() {
+			t.Errorf("history of %q listed, want only the session user's", owner)
+		}
+		events, _ := find.Lookup("event", "$in").Array().Values()
+		if len(events) != 2 {
+			t.Errorf("events %v, want successes and failures", events)
+		}
+	})
+
+	withMockDB(t, "failures", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"n": 0}), cursorResponse())
+		if w := serve(LoginHistory, loginHistory(t, cookie, "result=failure")); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		events, _ := commandFilter(t, mt, "find").Lookup("event", "$in").Array().Values()
+		if len(events) != 1 || events[0].StringValue() != auditLoginFailure {
+			t.Errorf("result=failure lists events %v", events)
+		}
+	})
+
+	if w := serve(LoginHistory, loginHistory(t, cookie, "result=maybe")); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for an unknown result", w.Code)
+	}
+	if w := serve(LoginHistory, loginHistory(t, nil, "")); w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401 without a session", w.Code)
+	}
+}
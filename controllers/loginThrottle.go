@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jeffthorne/tasky/captcha"
+	"github.com/jeffthorne/tasky/ratelimit"
+)
+
+// loginFailureWindow is how long failed logins count towards the captcha
+// threshold.
+const loginFailureWindow = 15 * time.Minute
+
+// defaultLoginCaptchaAfter is how many failed logins, per client IP or per
+// email, are allowed before a captcha is required.
+const defaultLoginCaptchaAfter = 5
+
+var (
+	loginFailures   = newFailureTracker(loginFailureWindow)
+	captchaVerifier = captcha.FromEnv()
+)
+
+// loginCaptchaAfter reads LOGIN_CAPTCHA_AFTER; 0 turns the captcha off.
+func loginCaptchaAfter() int {
+	value := os.Getenv("LOGIN_CAPTCHA_AFTER")
+	if value == "" {
+		return defaultLoginCaptchaAfter
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Invalid LOGIN_CAPTCHA_AFTER %q, using %d", value, defaultLoginCaptchaAfter)
+		return defaultLoginCaptchaAfter
+	}
+	return n
+}
+
+// loginThrottleKeys returns the failure counters a login attempt touches.
+func loginThrottleKeys(ip string, email string) []string {
+	return []string{"ip:" + ip, "email:" + strings.ToLower(email)}
+}
+
+// captchaRequired reports whether any of keys has reached the threshold.
+func captchaRequired(keys []string) bool {
+	threshold := loginCaptchaAfter()
+	if threshold == 0 {
+		return false
+	}
+	for _, key := range keys {
+		if loginFailures.count(key) >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// failureTracker counts failures per key in the shared counter store,
+// forgetting them once a window has passed since the first failure. Store
+// errors are logged and treated as no failures, so logins keep working.
+type failureTracker struct {
+	window time.Duration
+}
+
+func newFailureTracker(window time.Duration) *failureTracker {
+	return &failureTracker{window: window}
+}
+
+func (t *failureTracker) record(keys ...string) {
+	for _, key := range keys {
+		if _, _, err := ratelimit.DefaultStore().Incr("login:"+key, t.window); err != nil {
+			log.Printf("Error recording login failure: %v", err)
+		}
+	}
+}
+
+func (t *failureTracker) count(key string) int {
+	n, err := ratelimit.DefaultStore().Count("login:" + key)
+	if err != nil {
+		log.Printf("Error reading login failures: %v", err)
+	}
+	return n
+}
+
+func (t *failureTracker) clear(keys ...string) {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = "login:" + key
+	}
+	if err := ratelimit.DefaultStore().Reset(prefixed...); err != nil {
+		log.Printf("Error clearing login failures: %v", err)
+	}
+}
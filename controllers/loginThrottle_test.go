@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/captcha"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeVerifier accepts only the token "solved".
+type fakeVerifier struct{}
+
+func (fakeVerifier) Verify(ctx context.Context, token string, remoteIP string) (bool, error) {
+	return token == "solved", nil
+}
+
+// useVerifier swaps the captcha verifier for the rest of the test.
+func useVerifier(t *testing.T, verifier captcha.Verifier) {
+	previous := captchaVerifier
+	captchaVerifier = verifier
+	t.Cleanup(func() { captchaVerifier = previous })
+}
+
+func TestLoginRequiresCaptchaAfterThreshold(t *testing.T) {
+	t.Setenv("LOGIN_CAPTCHA_AFTER", "2")
+	useVerifier(t, fakeVerifier{})
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	user := storedUser(hash)
+
+	withMockDB(t, "throttle", func(mt *mtest.T) {
+		var response struct {
+			Code            string `json:"code"`
+			CaptchaRequired bool   `json:"captcha_required"`
+		}
+		for attempt := 1; attempt <= 2; attempt++ {
+			w := login(t, mt, user, "wrong horse")
+			decodeBody(t, w, &response)
+			if w.Code != http.StatusUnauthorized || response.CaptchaRequired != (attempt == 2) {
+				t.Fatalf("failure %d: status %d, captcha_required %v", attempt, w.Code, response.CaptchaRequired)
+			}
+		}
+
+		// Past the threshold the password is not checked without a captcha
+		for mt.GetStartedEvent() != nil {
+			// skip the commands of the failed attempts
+		}
+		w := serve(Login, testRequest{
+			method: http.MethodPost, route: "/login", path: "/login",
+			body: `{"email": "` + *user.Email + `", "password": "correct horse"}`,
+		})
+		assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusUnauthorized, "CAPTCHA_REQUIRED")
+		if evt := mt.GetStartedEvent(); evt != nil {
+			t.Fatalf("sent %s before the captcha was solved", evt.CommandName)
+		}
+
+		// A solved captcha lets the attempt through and clears the failures
+		mt.AddMockResponses(cursorResponse(user), mtest.CreateSuccessResponse())
+		w = serve(Login, testRequest{
+			method: http.MethodPost, route: "/login", path: "/login",
+			body: `{"email": "` + *user.Email + `", "password": "correct horse", "captcha_token": "solved"}`,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("login with a solved captcha: status = %d, body %s", w.Code, w.Body)
+		}
+		if captchaRequired(loginThrottleKeys(testClientIP, *user.Email)) {
+			t.Fatal("failures were not cleared by the successful login")
+		}
+	})
+}
+
+func TestLoginRejectsUnsolvedCaptcha(t *testing.T) {
+	t.Setenv("LOGIN_CAPTCHA_AFTER", "1")
+	useVerifier(t, fakeVerifier{})
+	user := storedUser("")
+	keys := loginThrottleKeys(testClientIP, *user.Email)
+	loginFailures.record(keys...)
+	t.Cleanup(func() { loginFailures.clear(keys...) })
+
+	w := serve(Login, testRequest{
+		method: http.MethodPost, route: "/login", path: "/login",
+		body: `{"email": "` + *user.Email + `", "password": "anything", "captcha_token": "guessed"}`,
+	})
+	assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusUnauthorized, "CAPTCHA_REQUIRED")
+}
+
+func TestCaptchaRequiredPerKey(t *testing.T) {
+	t.Setenv("LOGIN_CAPTCHA_AFTER", "3")
+	email := "Someone@Example.com"
+	keys := loginThrottleKeys("198.51.100.7", email)
+	t.Cleanup(func() { loginFailures.clear(keys...) })
+
+	// Failures for the email from other addresses still count
+	for i := 0; i < 3; i++ {
+		loginFailures.record(loginThrottleKeys("203.0.113.9", "someone@example.com")[1])
+	}
+	if !captchaRequired(keys) {
+		t.Fatal("failures for the email did not require a captcha from a new address")
+	}
+
+	t.Setenv("LOGIN_CAPTCHA_AFTER", "0")
+	if captchaRequired(keys) {
+		t.Fatal("LOGIN_CAPTCHA_AFTER=0 still requires a captcha")
+	}
+}
+
+func TestLoginIgnoresSpoofedForwardedFor(t *testing.T) {
+	email := "spoofed@example.com"
+	keys := loginThrottleKeys(testClientIP, email)
+	spoofed := loginThrottleKeys("203.0.113.50", email)
+	t.Cleanup(func() { loginFailures.clear(append(keys, spoofed...)...) })
+
+	withMockDB(t, "spoofed", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(), mtest.CreateSuccessResponse())
+		w := serve(Login, testRequest{
+			method: http.MethodPost, route: "/login", path: "/login",
+			body:    `{"email": "` + email + `", "password": "anything"}`,
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.50"},
+		})
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if loginFailures.count(keys[0]) != 1 || loginFailures.count(spoofed[0]) != 0 {
+			t.Fatal("the failure was counted against the forwarded IP rather than the connection")
+		}
+
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "insert" {
+				if ip := evt.Command.Lookup("documents", "0", "ip").StringValue(); ip != testClientIP {
+					t.Fatalf("audit event IP = %q, want %s", ip, testClientIP)
+				}
+				return
+			}
+		}
+		t.Fatal("no audit event was recorded")
+	})
+}
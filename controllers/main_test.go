@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"github.com/jeffthorne/tasky/server"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// The tests run without MongoDB: start them with SKIP_DB_INIT=true, and
+// handlers that query the database run against an mtest mock deployment.
+func TestMain(m *testing.M) {
+	os.Setenv("SECRET_KEY", "controller-tests")
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testClientIP is the client address of every httptest request.
+const testClientIP = "192.0.2.1"
+
+// testNamespace is the namespace given to mocked cursor replies.
+const testNamespace = database.DefaultDatabase + ".todos"
+
+// newTestUser returns an active user and caches its session fields, so
+// requests signed in as it pass the session check without a database.
+func newTestUser(t *testing.T, role string) models.User {
+	t.Helper()
+	name, email := "Test User", primitive.NewObjectID().Hex()+"@example.com"
+	user := models.User{ID: primitive.NewObjectID(), Name: &name, Email: &email, Role: role}
+	sessionUserCache.store(user.ID.Hex(), user)
+	return user
+}
+
+// sessionCookie returns a session cookie for user.
+func sessionCookie(t *testing.T, user models.User) *http.Cookie {
+	t.Helper()
+	token, err, _ := auth.GenerateJWT(user.ID.Hex(), user.Role, user.TokenVersion)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	return &http.Cookie{Name: "token", Value: token}
+}
+
+// withMockDB runs fn with database.Client pointing at a fresh mock
+// deployment. Each database operation a handler makes consumes the next
+// response added with mt.AddMockResponses.
+func withMockDB(t *testing.T, name string, fn func(mt *mtest.T)) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run(name, func(mt *mtest.T) {
+		previous := database.Client
+		database.Client = mt.Client
+		defer func() { database.Client = previous }()
+		fn(mt)
+	})
+}
+
+// testRequest describes one request to a single-route router.
+type testRequest struct {
+	method  string
+	route   string
+	path    string
+	body    string
+	cookie  *http.Cookie
+	headers map[string]string
+}
+
+// serve runs r through a router that only has handler on r.route.
+func serve(handler gin.HandlerFunc, r testRequest) *httptest.ResponseRecorder {
+	router := gin.New()
+	// Forwarded headers are trusted as in main, from TRUSTED_PROXIES only
+	if err := server.TrustProxies(router); err != nil {
+		panic(err)
+	}
+	router.Handle(r.method, r.route, handler)
+
+	var body io.Reader
+	if r.body != "" {
+		body = strings.NewReader(r.body)
+	}
+	req := httptest.NewRequest(r.method, r.path, body)
+	if r.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range r.headers {
+		req.Header.Set(name, value)
+	}
+	if r.cookie != nil {
+		req.AddCookie(r.cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// decodeBody unmarshals the JSON response body into v.
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+// cursorResponse is a mocked reply holding docs as the only batch.
+func cursorResponse(docs ...interface{}) bson.D {
+	batch := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			panic(err)
+		}
+		var d bson.D
+		if err := bson.Unmarshal(raw, &d); err != nil {
+			panic(err)
+		}
+		batch = append(batch, d)
+	}
+	return mtest.CreateCursorResponse(0, testNamespace, mtest.FirstBatch, batch...)
+}
+
+// commandFilter returns the filter of the next command named commandName:
+// a find, or the first statement of an update or delete.
+func commandFilter(t *testing.T, mt *mtest.T, commandName string) bson.Raw {
+	t.Helper()
+	for {
+		evt := mt.GetStartedEvent()
+		if evt == nil {
+			t.Fatalf("no %s command was sent", commandName)
+		}
+		if evt.CommandName != commandName {
+			continue
+		}
+		switch commandName {
+		case "find":
+			return evt.Command.Lookup("filter").Document()
+		case "update", "delete":
+			statement := evt.Command.Lookup(commandName + "s").Array().Index(0).Value().Document()
+			return statement.Lookup("q").Document()
+		default:
+			t.Fatalf("commandFilter does not know %s", commandName)
+		}
+	}
+}
+
+// assertErrorCode checks an error response's status and "code" field.
+func assertErrorCode(t *testing.T, status int, body []byte, wantStatus int, wantCode string) {
+	t.Helper()
+	var response struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(body, &response)
+	if status != wantStatus || response.Code != wantCode {
+		t.Fatalf("got %d %s, want %d with code %s", status, body, wantStatus, wantCode)
+	}
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/ctxkeys"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sessionUserID returns the authenticated user's id, empty before
+// authentication.
+func sessionUserID(c *gin.Context) string {
+	id, _ := ctxkeys.GetUserID(c)
+	return id
+}
+
+// sessionOwner returns the session user's id as the ObjectID todos are owned
+// by. It responds with 400 and returns ok=false if the id is malformed.
+func sessionOwner(c *gin.Context) (primitive.ObjectID, bool) {
+	return parseOwner(c, sessionUserID(c))
+}
+
+// paramOwner checks that the named route parameter holds the session user's
+// id and returns it. The session is the authority on whose todos a request
+// may touch; a path naming another user gets 403 and a malformed id 400.
+func paramOwner(c *gin.Context, name string) (primitive.ObjectID, bool) {
+	requested, ok := parseOwner(c, c.Param(name))
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	if requested != owner {
+		c.JSON(http.StatusForbidden, gin.H{"code": "FORBIDDEN", "error": "cannot access another user's todos"})
+		return primitive.NilObjectID, false
+	}
+	return owner, true
+}
+
+func parseOwner(c *gin.Context, id string) (primitive.ObjectID, bool) {
+	owner, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		respondInvalidID(c, "user")
+		return primitive.NilObjectID, false
+	}
+	return owner, true
+}
+
+// ownerMatch matches the userid field of todos owned by owner. Todos written
+// before owners were stored as ObjectIDs hold the hex string instead, until
+// cmd/migrate converts them.
+func ownerMatch(owner primitive.ObjectID) bson.M {
+	return bson.M{"$in": bson.A{owner, owner.Hex()}}
+}
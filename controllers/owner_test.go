@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestPathOwnerMustBeSessionUser(t *testing.T) {
+	user := newTestUser(t, "")
+	other := primitive.NewObjectID().Hex()
+	todo := primitive.NewObjectID().Hex()
+
+	requests := []struct {
+		name    string
+		handler func(*testing.T) int
+	}{
+		{"list", func(t *testing.T) int {
+			return serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + other, cookie: sessionCookie(t, user)}).Code
+		}},
+		{"add", func(t *testing.T) int {
+			return serve(AddTodo, testRequest{method: http.MethodPost, route: "/todo/:userid", path: "/todo/" + other, body: `{"name": "x"}`, cookie: sessionCookie(t, user)}).Code
+		}},
+		{"delete", func(t *testing.T) int {
+			return serve(DeleteTodo, testRequest{method: http.MethodDelete, route: "/todo/:userid/:id", path: "/todo/" + other + "/" + todo, cookie: sessionCookie(t, user)}).Code
+		}},
+		{"clear", func(t *testing.T) int {
+			return serve(ClearAll, testRequest{method: http.MethodDelete, route: "/todos/:id", path: "/todos/" + other, cookie: sessionCookie(t, user)}).Code
+		}},
+	}
+	for _, r := range requests {
+		// No mock responses: the request must be refused before any query
+		withMockDB(t, r.name, func(mt *mtest.T) {
+			if code := r.handler(mt.T); code != http.StatusForbidden {
+				t.Fatalf("%s for another user: status = %d, want 403", r.name, code)
+			}
+			if evt := mt.GetStartedEvent(); evt != nil {
+				t.Fatalf("%s for another user sent %s", r.name, evt.CommandName)
+			}
+		})
+	}
+}
+
+func TestMalformedPathOwnerIsBadRequest(t *testing.T) {
+	user := newTestUser(t, "")
+	w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/not-an-id", cookie: sessionCookie(t, user)})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	var body map[string]string
+	decodeBody(t, w, &body)
+	if body["code"] != "INVALID_ID" {
+		t.Fatalf("code = %q, want INVALID_ID", body["code"])
+	}
+}
+
+func TestOwnerFilterUsesObjectID(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "own list", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex(), cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		owners := commandFilter(t, mt, "find").Lookup("userid", "$in").Array()
+		if id, ok := owners.Index(0).Value().ObjectIDOK(); !ok || id != user.ID {
+			t.Fatalf("owner filter %v does not match the ObjectID first", owners)
+		}
+	})
+}
+
+func TestOwnerMatchAcceptsLegacyHexOwners(t *testing.T) {
+	owner := primitive.NewObjectID()
+	want := bson.M{"$in": bson.A{owner, owner.Hex()}}
+	got := ownerMatch(owner)
+	if len(got["$in"].(bson.A)) != 2 || got["$in"].(bson.A)[0] != want["$in"].(bson.A)[0] || got["$in"].(bson.A)[1] != owner.Hex() {
+		t.Fatalf("ownerMatch = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/featureflags"
+	"github.com/jeffthorne/tasky/server"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Themes selectable with APP_THEME; each is a body class in the stylesheets.
+var themes = map[string]bool{"default": true, "dark": true}
+
+// PageData is what the HTML templates are rendered with. html/template
+// escapes every field, so user-controlled values such as Username are safe.
+type PageData struct {
+	BasePath string
+	AppName  string
+	Version  string
+	Theme    string
+	Username string
+	Flags    featureflags.Flags
+}
+
+// NewPageData builds the template data for a page shown to username, which
+// is empty before login. APP_NAME and APP_THEME brand the pages.
+func NewPageData(username string) PageData {
+	appName := os.Getenv("APP_NAME")
+	if appName == "" {
+		appName = "Tasky"
+	}
+	theme := os.Getenv("APP_THEME")
+	if !themes[theme] {
+		theme = "default"
+	}
+	return PageData{
+		BasePath: server.BasePath(),
+		AppName:  appName,
+		Version:  server.Version,
+		Theme:    theme,
+		Username: username,
+		Flags:    featureflags.Current(),
+	}
+}
+
+// sessionUsername returns the display name of the user validated by
+// auth.ValidateSession, or "" if it cannot be loaded.
+func sessionUsername(c *gin.Context) string {
+	objId, err := primitive.ObjectIDFromHex(sessionUserID(c))
+	if err != nil {
+		return ""
+	}
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	user, err := sessionUser(ctx, c, objId)
+	if err != nil || user.Name == nil {
+		return ""
+	}
+	return *user.Name
+}
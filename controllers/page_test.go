@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// renderTodoPage requests the todo page, rendered from the real template.
+func renderTodoPage(cookie *http.Cookie) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.LoadHTMLFiles("../assets/todo.html")
+	router.GET("/todo", Todo)
+
+	req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTodoPageShowsUsername(t *testing.T) {
+	t.Setenv("APP_NAME", "Acme Tasks")
+	t.Setenv("APP_THEME", "dark")
+	name, email := `Ada <script>alert("hi")</script>`, primitive.NewObjectID().Hex()+"@example.com"
+	user := models.User{ID: primitive.NewObjectID(), Name: &name, Email: &email}
+	sessionUserCache.store(user.ID.Hex(), user)
+
+	w := renderTodoPage(sessionCookie(t, user))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	page := w.Body.String()
+	if !strings.Contains(page, `<span id="username">Ada &lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt;</span>`) {
+		t.Errorf("page does not show the escaped username:\n%s", page)
+	}
+	if strings.Contains(page, "<script>alert") {
+		t.Error("username was rendered unescaped")
+	}
+	for _, want := range []string{"<title>Acme Tasks</title>", `class="theme-dark"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page does not contain %s", want)
+		}
+	}
+}
+
+func TestTodoPageRedirectsWithoutSession(t *testing.T) {
+	w := renderTodoPage(nil)
+	if w.Code < 300 || w.Code > 399 {
+		t.Fatalf("status = %d, want a redirect", w.Code)
+	}
+	if strings.Contains(w.Body.String(), `id="username"`) {
+		t.Error("the todo page was rendered without a session")
+	}
+}
+
+func TestNewPageDataDefaults(t *testing.T) {
+	t.Setenv("APP_NAME", "")
+	t.Setenv("APP_THEME", "neon")
+	data := NewPageData("")
+	if data.AppName != "Tasky" || data.Theme != "default" || data.Username != "" {
+		t.Errorf("got %+v, want the default name and theme", data)
+	}
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prettyByDefault reads PRETTY_JSON, which makes indented JSON the default
+// for development.
+func prettyByDefault() bool {
+	pretty, _ := strconv.ParseBool(os.Getenv("PRETTY_JSON"))
+	return pretty
+}
+
+// PrettyJSON indents JSON responses when the request passes pretty=true, or
+// when PRETTY_JSON is set and the request does not pass pretty=false.
+// Handlers keep calling c.JSON; the body is re-indented on its way out.
+func PrettyJSON(c *gin.Context) {
+	pretty := prettyByDefault()
+	if value, ok := c.GetQuery("pretty"); ok {
+		pretty, _ = strconv.ParseBool(value)
+	}
+	if !pretty {
+		c.Next()
+		return
+	}
+
+	w := &prettyWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+	w.flush()
+}
+
+// prettyWriter holds back JSON bodies so they can be indented once complete.
+// Other content types pass straight through.
+type prettyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *prettyWriter) isJSON() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+}
+
+func (w *prettyWriter) Write(data []byte) (int, error) {
+	if !w.isJSON() {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *prettyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *prettyWriter) flush() {
+	if w.body.Len() == 0 {
+		return
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, w.body.Bytes(), "", "    "); err != nil {
+		w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+	// Indenting changes the length a handler may have declared
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.Write(indented.Bytes())
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// servePretty requests path from a router whose /json and /text routes run
+// behind PrettyJSON.
+func servePretty(path string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Use(PrettyJSON)
+	router.GET("/json", func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"name": "milk", "tags": []string{"shop"}})
+	})
+	router.GET("/text", func(c *gin.Context) {
+		c.String(http.StatusOK, "{not: json}")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestPrettyJSON(t *testing.T) {
+	const compact = `{"name":"milk","tags":["shop"]}`
+	const indented = "{\n    \"name\": \"milk\",\n    \"tags\": [\n        \"shop\"\n    ]\n}"
+
+	tests := []struct {
+		env  string
+		path string
+		want string
+	}{
+		{"", "/json", compact},
+		{"", "/json?pretty=true", indented},
+		{"", "/json?pretty=false", compact},
+		{"true", "/json", indented},
+		{"true", "/json?pretty=false", compact},
+		{"true", "/text", "{not: json}"},
+		{"", "/text?pretty=true", "{not: json}"},
+	}
+	for _, tt := range tests {
+		t.Setenv("PRETTY_JSON", tt.env)
+		w := servePretty(tt.path)
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("PRETTY_JSON=%q %s: body %q, want %q", tt.env, tt.path, got, tt.want)
+		}
+		if tt.path == "/json?pretty=true" && w.Code != http.StatusCreated {
+			t.Errorf("status = %d, want the handler's 201", w.Code)
+		}
+	}
+}
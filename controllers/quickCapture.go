@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"github.com/jeffthorne/tasky/webhook"
+)
+
+// maxQuickCaptureBytes bounds a quick capture body; the text itself is held
+// to the import name length.
+const maxQuickCaptureBytes = 16 << 10
+
+// QuickCapture creates a todo for the session user from nothing but its
+// text, for browser extensions and share sheets. The body is the text itself
+// (text/plain) or {"text": "..."} (application/json). The todo is pending,
+// medium priority and has no due date.
+func QuickCapture(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	var text string
+	switch c.ContentType() {
+	case gin.MIMEPlain:
+		raw, err := io.ReadAll(io.LimitReader(c.Request.Body, maxQuickCaptureBytes+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(raw) > maxQuickCaptureBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("text must be at most %d bytes", maxQuickCaptureBytes)})
+			return
+		}
+		text = string(raw)
+	case gin.MIMEJSON:
+		var body struct {
+			Text string `json:"text"`
+		}
+		if !bindJSON(c, &body) {
+			return
+		}
+		text = body.Text
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"code": "UNSUPPORTED_MEDIA_TYPE", "error": "Content-Type must be text/plain or application/json"})
+		return
+	}
+
+	text = strings.TrimSpace(text)
+	maxLength := importLimitsFromEnv().nameLength
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		return
+	}
+	if !utf8.ValidString(text) || utf8.RuneCountInString(text) > maxLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("text must be valid UTF-8 of at most %d characters", maxLength)})
+		return
+	}
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	order, err := nextTodoOrder(ctx, todosFor(c), owner)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todo, err := models.NewTodo(owner, models.TodoInput{Name: text, Priority: priorityMedium})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	todo.Order = order
+	if err := insertWithShortID(ctx, todosFor(c), todo); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todosChanged(c, owner.Hex())
+	dispatchTodoEvent(c, owner, webhook.TodoCreated, *todo)
+
+	c.JSON(http.StatusCreated, todo)
+}
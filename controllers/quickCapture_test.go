@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// quickCapture posts body as contentType to the quick capture endpoint.
+func quickCapture(t *testing.T, contentType string, body string) testRequest {
+	return testRequest{
+		method: http.MethodPost, route: "/todos/quick", path: "/todos/quick", body: body,
+		cookie: sessionCookie(t, newTestUser(t, "")), headers: map[string]string{"Content-Type": contentType},
+	}
+}
+
+// insertedTodo returns the document of the first todo insert sent.
+func insertedTodo(t *testing.T, mt *mtest.T) bson.Raw {
+	t.Helper()
+	for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+		if evt.CommandName == "insert" {
+			return evt.Command.Lookup("documents").Array().Index(0).Value().Document()
+		}
+	}
+	t.Fatal("no insert command was sent")
+	return nil
+}
+
+func TestQuickCaptureContentTypes(t *testing.T) {
+	for name, tc := range map[string]struct {
+		contentType string
+		body        string
+	}{
+		"plain text":         {"text/plain", "buy milk  \n"},
+		"plain text charset": {"text/plain; charset=utf-8", "  buy milk"},
+		"json":               {"application/json", `{"text": "buy milk\t"}`},
+	} {
+		withMockDB(t, name, func(mt *mtest.T) {
+			expectInserts(mt, 1)
+			w := serve(QuickCapture, quickCapture(t, tc.contentType, tc.body))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			var todo struct {
+				Name     string `json:"name"`
+				Status   string `json:"status"`
+				Priority string `json:"priority"`
+				DueDate  string `json:"due_date"`
+			}
+			decodeBody(t, w, &todo)
+			if todo.Name != "buy milk" {
+				t.Errorf("name = %q, want the trimmed text", todo.Name)
+			}
+			if todo.Status != "pending" || todo.Priority != priorityMedium || todo.DueDate != "" {
+				t.Errorf("created %+v, want a pending medium priority todo without a due date", todo)
+			}
+
+			doc := insertedTodo(t, mt)
+			if priority := doc.Lookup("priority").StringValue(); priority != priorityMedium {
+				t.Errorf("stored priority %q", priority)
+			}
+			if _, err := doc.LookupErr("due_date"); err == nil {
+				t.Errorf("stored a due date: %v", doc)
+			}
+		})
+	}
+}
+
+func TestQuickCaptureRejects(t *testing.T) {
+	t.Setenv("IMPORT_MAX_NAME_LENGTH", "10")
+	for name, tc := range map[string]struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		"blank text":        {"text/plain", " \n\t", http.StatusBadRequest},
+		"blank json":        {"application/json", `{"text": "  "}`, http.StatusBadRequest},
+		"too long":          {"text/plain", "eleven char", http.StatusBadRequest},
+		"oversized body":    {"text/plain", strings.Repeat("x", maxQuickCaptureBytes+1), http.StatusRequestEntityTooLarge},
+		"form content type": {"application/x-www-form-urlencoded", "text=x", http.StatusUnsupportedMediaType},
+	} {
+		if w := serve(QuickCapture, quickCapture(t, tc.contentType, tc.body)); w.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", name, w.Code, tc.status)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/database"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultReadAfterWriteWindow is how long a user's reads stay on the primary
+// after they change a todo, when READ_AFTER_WRITE_WINDOW is unset or invalid.
+const defaultReadAfterWriteWindow = 10 * time.Second
+
+// maxTrackedWriters bounds recentWrites; expired entries are pruned once it
+// holds more users than this.
+const maxTrackedWriters = 10000
+
+var recentWrites = &writeTracker{writes: map[string]time.Time{}}
+
+// writeTracker remembers when each user last changed a todo. It is per
+// instance, so a read served by another instance right after a write may
+// still see a lagging secondary.
+type writeTracker struct {
+	mu     sync.Mutex
+	writes map[string]time.Time
+}
+
+func readAfterWriteWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("READ_AFTER_WRITE_WINDOW"))
+	if err != nil || window < 0 {
+		return defaultReadAfterWriteWindow
+	}
+	return window
+}
+
+func (w *writeTracker) record(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	if len(w.writes) >= maxTrackedWriters {
+		window := readAfterWriteWindow()
+		for k, at := range w.writes {
+			if now.Sub(at) > window {
+				delete(w.writes, k)
+			}
+		}
+	}
+	w.writes[key] = now
+}
+
+func (w *writeTracker) recent(key string) bool {
+	w.mu.Lock()
+	at, ok := w.writes[key]
+	w.mu.Unlock()
+	return ok && time.Since(at) <= readAfterWriteWindow()
+}
+
+// todosChanged records that owner's todos changed: once the change has
+// committed, their cached lists are dropped and their reads stay on the
+// primary for a while.
+func todosChanged(c *gin.Context, owner string) {
+	key := tenantScoped(c, owner)
+	afterCommit(c, func() {
+		todoListCache.invalidate(key)
+		recentWrites.record(key)
+	})
+}
+
+// todosForRead returns the todo collection for a read of owner's todos that
+// tolerates replication lag. With READ_FROM_SECONDARY it prefers a secondary,
+// unless owner changed a todo recently, so users always see their own writes.
+func todosForRead(c *gin.Context, owner string) *mongo.Collection {
+	todos := todosFor(c)
+	if !database.ReadFromSecondary() || recentWrites.recent(tenantScoped(c, owner)) {
+		return todos
+	}
+	return database.SecondaryPreferred(todos)
+}
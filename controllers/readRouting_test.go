@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// secondaryRead reports whether a command was sent with the secondaryPreferred
+// read preference. Against the mock deployment, primary reads are sent as
+// primaryPreferred, as for any single server.
+func secondaryRead(evt bson.Raw) bool {
+	mode, err := evt.LookupErr("$readPreference", "mode")
+	return err == nil && mode.StringValue() == "secondaryPreferred"
+}
+
+// listTodos lists user's todos.
+func listTodos(t *testing.T, user models.User) testRequest {
+	return testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex(), cookie: sessionCookie(t, user)}
+}
+
+func TestReadsUseSecondaryWhenEnabled(t *testing.T) {
+	user := newTestUser(t, "")
+
+	withMockDB(t, "disabled", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		serve(GetTodos, listTodos(t, user))
+		if secondaryRead(mt.GetStartedEvent().Command) {
+			t.Error("list read from a secondary without READ_FROM_SECONDARY")
+		}
+	})
+
+	t.Setenv("READ_FROM_SECONDARY", "true")
+	withMockDB(t, "list", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		serve(GetTodos, listTodos(t, user))
+		if !secondaryRead(mt.GetStartedEvent().Command) {
+			t.Error("list did not prefer a secondary")
+		}
+	})
+	withMockDB(t, "count", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"n": 0}))
+		serve(CountTodos, testRequest{method: http.MethodGet, route: "/todos/count", path: "/todos/count", cookie: sessionCookie(t, user)})
+		if !secondaryRead(mt.GetStartedEvent().Command) {
+			t.Error("count did not prefer a secondary")
+		}
+	})
+}
+
+func TestWritesStayOnPrimary(t *testing.T) {
+	t.Setenv("READ_FROM_SECONDARY", "true")
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+
+	withMockDB(t, "create", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(), mtest.CreateSuccessResponse(), cursorResponse())
+		w := serve(AddTodo, testRequest{method: http.MethodPost, route: "/todo/:userid", path: "/todo/" + user.ID.Hex(), body: `{"name": "Buy milk"}`, cookie: cookie})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if secondaryRead(evt.Command) {
+				t.Errorf("%s preferred a secondary", evt.CommandName)
+			}
+		}
+	})
+}
+
+func TestReadAfterWriteStaysOnPrimary(t *testing.T) {
+	t.Setenv("READ_FROM_SECONDARY", "true")
+	user := newTestUser(t, "")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	todosChanged(c, user.ID.Hex())
+
+	withMockDB(t, "after write", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		serve(GetTodos, listTodos(t, user))
+		if secondaryRead(mt.GetStartedEvent().Command) {
+			t.Error("a read right after a write preferred a secondary")
+		}
+	})
+
+	t.Setenv("READ_AFTER_WRITE_WINDOW", "1ms")
+	time.Sleep(5 * time.Millisecond)
+	withMockDB(t, "window passed", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		serve(GetTodos, listTodos(t, user))
+		if !secondaryRead(mt.GetStartedEvent().Command) {
+			t.Error("reads stayed on the primary after the window")
+		}
+	})
+}
+
+func TestWriteTrackerPrunes(t *testing.T) {
+	t.Setenv("READ_AFTER_WRITE_WINDOW", "1s")
+	tracker := &writeTracker{writes: map[string]time.Time{}}
+	for i := 0; i < maxTrackedWriters; i++ {
+		tracker.writes[strconv.Itoa(i)] = time.Now().Add(-time.Minute)
+	}
+	tracker.record("fresh")
+	if len(tracker.writes) != 1 || !tracker.recent("fresh") {
+		t.Fatalf("tracker holds %d users after pruning, want only the fresh one", len(tracker.writes))
+	}
+}
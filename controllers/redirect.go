@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/server"
+)
+
+// safeRedirect redirects to target if safeRedirectTarget allows it, and to
+// the login page otherwise. Every redirect whose target could come from the
+// client must go through it.
+func safeRedirect(c *gin.Context, target string) {
+	c.Redirect(http.StatusFound, safeRedirectTarget(target))
+}
+
+// safeRedirectTarget returns target when it is a path on this site or an
+// http(s) URL on a host listed in REDIRECT_ALLOWED_HOSTS, and the app root
+// otherwise. Protocol-relative targets such as //evil.com are rejected, as are
+// backslashes and control characters, which browsers may rewrite into one.
+func safeRedirectTarget(target string) string {
+	fallback := server.BasePath() + "/"
+	if target == "" || strings.ContainsAny(target, "\\") || strings.IndexFunc(target, isControl) >= 0 {
+		return fallback
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return fallback
+	}
+	if u.Scheme == "" && u.Host == "" {
+		if strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") {
+			return target
+		}
+		return fallback
+	}
+	if (u.Scheme == "https" || u.Scheme == "http") && u.User == nil && redirectHostAllowed(u.Hostname()) {
+		return target
+	}
+	return fallback
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+// redirectHostAllowed reports whether host is listed in the comma-separated
+// REDIRECT_ALLOWED_HOSTS.
+func redirectHostAllowed(host string) bool {
+	for _, allowed := range strings.Split(os.Getenv("REDIRECT_ALLOWED_HOSTS"), ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed != "" && strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
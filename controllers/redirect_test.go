@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jeffthorne/tasky/auth"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSafeRedirectTarget(t *testing.T) {
+	t.Setenv("REDIRECT_ALLOWED_HOSTS", "app.example.com, Docs.Example.com")
+	for target, want := range map[string]string{
+		"/todo":                         "/todo",
+		"/todo?filter=open#top":         "/todo?filter=open#top",
+		"https://app.example.com/todo":  "https://app.example.com/todo",
+		"https://docs.example.com/help": "https://docs.example.com/help",
+		"":                              "/",
+		"todo":                          "/",
+		"https://evil.com/":             "/",
+		"http://evil.com":               "/",
+		"//evil.com":                    "/",
+		"///evil.com":                   "/",
+		"/\\evil.com":                   "/",
+		"/\tevil.com":                   "/",
+		"javascript:alert(1)":           "/",
+		"https://user@app.example.com/": "/",
+		"https://app.example.com.evil/": "/",
+	} {
+		if got := safeRedirectTarget(target); got != want {
+			t.Errorf("safeRedirectTarget(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestSafeRedirectTargetFallsBackUnderBasePath(t *testing.T) {
+	t.Setenv("BASE_PATH", "/tasky")
+	t.Setenv("REDIRECT_ALLOWED_HOSTS", "")
+	if got := safeRedirectTarget("https://evil.com/"); got != "/tasky/" {
+		t.Fatalf("got %q, want /tasky/", got)
+	}
+}
+
+func TestLoginRedirectsToSafeNext(t *testing.T) {
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	for next, want := range map[string]string{
+		"/todo?filter=open": "/todo?filter=open",
+		"https://evil.com/": "/",
+		"//evil.com/phish":  "/",
+		"":                  "/todo",
+	} {
+		withMockDB(t, "next", func(mt *mtest.T) {
+			user := storedUser(hash)
+			t.Cleanup(func() { loginFailures.clear(loginThrottleKeys(testClientIP, *user.Email)...) })
+			mt.AddMockResponses(cursorResponse(user), mtest.CreateSuccessResponse())
+			path := "/login"
+			if next != "" {
+				path += "?next=" + next
+			}
+			w := serve(Login, testRequest{
+				method: http.MethodPost, route: "/login", path: path,
+				body:    `{"email": "` + *user.Email + `", "password": "correct horse"}`,
+				headers: map[string]string{"Accept": "text/html"},
+			})
+			if w.Code != http.StatusFound || w.Header().Get("Location") != want {
+				t.Errorf("next=%q: got %d to %q, want a redirect to %q", next, w.Code, w.Header().Get("Location"), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindJSON decodes the JSON request body into obj. It responds with 415 when
+// the request is not declared as JSON and 400 when the body does not decode,
+// returning false in either case.
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	if c.ContentType() != gin.MIMEJSON {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"code": "UNSUPPORTED_MEDIA_TYPE", "error": "Content-Type must be application/json"})
+		return false
+	}
+	if err := c.ShouldBindJSON(obj); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// wantsHTML reports whether the client prefers an HTML response, as browsers
+// do for form posts and page loads. API clients, and requests without an
+// Accept header, get JSON.
+func wantsHTML(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+}
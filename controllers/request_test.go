@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestBindJSONRequiresJSONContentType(t *testing.T) {
+	user := newTestUser(t, "")
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"form encoded", "application/x-www-form-urlencoded", "name=milk"},
+		{"missing content type", "", `{"name": "milk"}`},
+		{"plain text", "text/plain", `{"name": "milk"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(AddTodo, testRequest{
+				method:  http.MethodPost,
+				route:   "/todo/:userid",
+				path:    "/todo/" + user.ID.Hex(),
+				body:    tt.body,
+				cookie:  sessionCookie(t, user),
+				headers: map[string]string{"Content-Type": tt.contentType},
+			})
+			assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE")
+		})
+	}
+}
+
+func TestSignUpRejectsFormBody(t *testing.T) {
+	w := serve(SignUp, testRequest{
+		method:  http.MethodPost,
+		route:   "/signup",
+		path:    "/signup",
+		body:    "email=a%40example.com&password=secret",
+		headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded", "Accept": "application/json"},
+	})
+	assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE")
+}
+
+func TestBindJSONAcceptsCharsetParameter(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "charset", func(mt *mtest.T) {
+		w := serve(AddTodo, testRequest{
+			method:  http.MethodPost,
+			route:   "/todo/:userid",
+			path:    "/todo/" + user.ID.Hex(),
+			body:    `{"name": ""}`,
+			cookie:  sessionCookie(t, user),
+			headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		})
+		if w.Code == http.StatusUnsupportedMediaType {
+			t.Fatalf("a JSON body with a charset was rejected: %s", w.Body)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"github.com/jeffthorne/tasky/sweeper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SetRetention sets how many days the session user's archived todos are kept
+// before the sweeper purges them. A null days returns the user to the global
+// ARCHIVE_RETENTION_DAYS.
+func SetRetention(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Days *int `json:"days"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	update := bson.M{"$unset": bson.M{"retention_days": ""}, "$set": bson.M{"updated_at": models.Now()}}
+	if body.Days != nil {
+		if *body.Days < sweeper.MinRetentionDays || *body.Days > sweeper.MaxRetentionDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days must be between %d and %d", sweeper.MinRetentionDays, sweeper.MaxRetentionDays)})
+			return
+		}
+		update = bson.M{"$set": bson.M{"retention_days": *body.Days, "updated_at": models.Now()}}
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	if _, err := usersFor(c).UpdateOne(ctx, bson.M{"_id": owner}, update); err != nil {
+		log.Printf("Error storing retention policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "retention policy was not saved"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"retention_days": body.Days, "default_retention_days": sweeper.RetentionDaysFromEnv()})
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// retentionUpdate returns the update document of the user update SetRetention
+// sent.
+func retentionUpdate(t *testing.T, mt *mtest.T) bson.Raw {
+	t.Helper()
+	for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+		if evt.CommandName == "update" {
+			return evt.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		}
+	}
+	t.Fatal("no update command was sent")
+	return nil
+}
+
+func TestSetRetention(t *testing.T) {
+	t.Setenv("ARCHIVE_RETENTION_DAYS", "90")
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+	setRetention := func(body string) testRequest {
+		return testRequest{method: http.MethodPut, route: "/me/retention", path: "/me/retention", body: body, cookie: cookie}
+	}
+
+	withMockDB(t, "set", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		w := serve(SetRetention, setRetention(`{"days": 7}`))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if days := retentionUpdate(t, mt).Lookup("$set", "retention_days").AsInt64(); days != 7 {
+			t.Errorf("retention_days set to %d, want 7", days)
+		}
+
+		var body struct {
+			Days    *int `json:"retention_days"`
+			Default int  `json:"default_retention_days"`
+		}
+		decodeBody(t, w, &body)
+		if body.Days == nil || *body.Days != 7 || body.Default != 90 {
+			t.Errorf("response %+v", body)
+		}
+	})
+
+	withMockDB(t, "reset", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		if w := serve(SetRetention, setRetention(`{"days": null}`)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		update := retentionUpdate(t, mt)
+		if _, err := update.LookupErr("$unset", "retention_days"); err != nil {
+			t.Errorf("update %v does not unset retention_days", update)
+		}
+	})
+
+	for _, body := range []string{`{"days": 0}`, `{"days": 3651}`, `{"days": -1}`} {
+		if w := serve(SetRetention, setRetention(body)); w.Code != http.StatusBadRequest {
+			t.Errorf("body %s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
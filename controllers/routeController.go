@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotFound answers requests for unknown paths with a JSON error instead of
+// gin's plain-text default.
+func NotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{"code": "NOT_FOUND", "error": "resource not found"})
+}
+
+// MethodNotAllowed returns a handler for requests whose path exists under a
+// different method. The Allow header lists the methods that routes reports
+// for the requested path.
+func MethodNotAllowed(routes func() gin.RoutesInfo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Allow", strings.Join(allowedMethods(routes(), c.Request.URL.Path), ", "))
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"code": "METHOD_NOT_ALLOWED", "error": "method not allowed"})
+	}
+}
+
+func allowedMethods(routes gin.RoutesInfo, path string) []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, route := range routes {
+		if !seen[route.Method] && routeMatches(route.Path, path) {
+			seen[route.Method] = true
+			methods = append(methods, route.Method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// routeMatches reports whether path satisfies a gin route pattern, treating
+// :name as a single segment and *name as the remainder of the path.
+func routeMatches(pattern, path string) bool {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(pathParts)
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRoutedRouter returns a router with the JSON 404 and 405 handlers and a
+// few routes to miss.
+func newRoutedRouter() *gin.Engine {
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(NotFound)
+	router.NoMethod(MethodNotAllowed(router.Routes))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/todo/:id", ok)
+	router.DELETE("/todo/:userid/:id", ok)
+	router.GET("/todos/:userid", ok)
+	router.PATCH("/todos/:id", ok)
+	return router
+}
+
+func TestUnknownPathIsJSONNotFound(t *testing.T) {
+	w := httptest.NewRecorder()
+	newRoutedRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusNotFound, "NOT_FOUND")
+}
+
+func TestWrongMethodListsAllowedMethods(t *testing.T) {
+	w := httptest.NewRecorder()
+	newRoutedRouter().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos/abc", nil))
+	assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED")
+	if allow := w.Header().Get("Allow"); allow != "GET, PATCH" {
+		t.Fatalf("Allow = %q, want GET, PATCH", allow)
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/todo/:id", "/todo/abc", true},
+		{"/todo/:id", "/todo/abc/def", false},
+		{"/todo/:id", "/todo/", false},
+		{"/assets/*filepath", "/assets/css/style.css", true},
+		{"/todos/count", "/todos/count", true},
+		{"/todos/count", "/todos/counts", false},
+	}
+	for _, tc := range cases {
+		if got := routeMatches(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("routeMatches(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// todoPage is the paginated envelope for todo listings.
+type todoPage struct {
+	Items []models.Todo `json:"items"`
+	Page  int           `json:"page"`
+	Limit int           `json:"limit"`
+	Total int64         `json:"total"`
+}
+
+// SearchTodos lists the session user's todos matching every given filter:
+// q (name substring), tags (comma separated, all required), priority,
+// status, from and to (creation time), and archived.
+func SearchTodos(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	filter, ok := todoListFilter(c, owner)
+	if !ok {
+		return
+	}
+	if !addSearchFilters(c, filter) {
+		return
+	}
+	page, limit, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	collection := todosForRead(c, owner.Hex())
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	findOptions := options.Find().
+		SetProjection(bson.M{"notes": 0}).
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	todos := []models.Todo{}
+	if err := cursor.All(ctx, &todos); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, todoPage{Items: todos, Page: page, Limit: limit, Total: total})
+}
+
+// addSearchFilters extends a todo list filter with the search-only query
+// parameters. It responds with 400 and returns false on an invalid value.
+func addSearchFilters(c *gin.Context, filter bson.M) bool {
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+	}
+
+	if tags := c.Query("tags"); tags != "" {
+		var all []string
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				all = append(all, tag)
+			}
+		}
+		if len(all) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tags must list at least one tag"})
+			return false
+		}
+		filter["tags"] = bson.M{"$all": all}
+	}
+
+	if priority := c.Query("priority"); priority != "" {
+		if !validPriority(priority) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be low, medium or high"})
+			return false
+		}
+		filter["priority"] = priority
+	}
+
+	created, ok := timeRange(c, "from", "to")
+	if !ok {
+		return false
+	}
+	if created != nil {
+		filter["created_at"] = created
+	}
+
+	return true
+}
+
+// timeRange reads a time range from the fromParam and toParam query
+// parameters as a filter condition, or nil when neither is set. It responds
+// with 400 and returns ok=false for an invalid value or a range that ends
+// before it starts.
+func timeRange(c *gin.Context, fromParam string, toParam string) (bson.M, bool) {
+	created := bson.M{}
+	for _, bound := range []struct{ param, op string }{{fromParam, "$gte"}, {toParam, "$lte"}} {
+		param, op := bound.param, bound.op
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := parseSearchTime(value, param == toParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 time or a YYYY-MM-DD date"})
+			return nil, false
+		}
+		created[op] = t
+	}
+	if from, ok := created["$gte"].(time.Time); ok {
+		if to, ok := created["$lte"].(time.Time); ok && to.Before(from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fromParam + " must not be after " + toParam})
+			return nil, false
+		}
+	}
+	if len(created) == 0 {
+		return nil, true
+	}
+	return created, true
+}
+
+// parseSearchTime accepts an RFC 3339 time or a plain date. A date used as
+// the end of a range covers the whole day.
+func parseSearchTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// pagination reads the page and limit query parameters. It responds with 400
+// and returns ok=false for an invalid value.
+func pagination(c *gin.Context) (page int, limit int, ok bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+		return 0, 0, false
+	}
+	limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxPageSize)})
+		return 0, 0, false
+	}
+	return page, limit, true
+}
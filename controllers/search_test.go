@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSearchTodosCombinesFilters(t *testing.T) {
+	user := newTestUser(t, "")
+	match := bson.M{"_id": primitive.NewObjectID(), "name": "Pay rent", "userid": user.ID, "tags": bson.A{"home", "money"}, "priority": "high", "status": "pending"}
+	withMockDB(t, "search", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"n": 1}), cursorResponse(match))
+		path := "/todos/search?q=rent.&tags=home,%20money&priority=high&status=pending&from=2024-01-01&to=2024-01-31&page=2&limit=5"
+		w := serve(SearchTodos, testRequest{method: http.MethodGet, route: "/todos/search", path: path, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			Page, Limit int
+			Total       int64
+		}
+		decodeBody(t, w, &page)
+		if len(page.Items) != 1 || page.Items[0].Name != "Pay rent" || page.Page != 2 || page.Limit != 5 || page.Total != 1 {
+			t.Fatalf("page = %+v", page)
+		}
+
+		mt.GetStartedEvent() // the count, which uses the same filter
+		find := mt.GetStartedEvent()
+		filter := find.Command.Lookup("filter").Document()
+		if got := filter.Lookup("name", "$regex").StringValue(); got != `rent\.` {
+			t.Errorf("name regex = %q, want the quoted query", got)
+		}
+		tags, _ := filter.Lookup("tags", "$all").Array().Values()
+		if len(tags) != 2 || tags[0].StringValue() != "home" || tags[1].StringValue() != "money" {
+			t.Errorf("tags = %v, want all of home and money", tags)
+		}
+		if got := filter.Lookup("priority").StringValue(); got != "high" {
+			t.Errorf("priority = %q", got)
+		}
+		if got := filter.Lookup("status").StringValue(); got != "pending" {
+			t.Errorf("status = %q", got)
+		}
+		if _, err := filter.LookupErr("userid"); err != nil {
+			t.Error("search is not scoped to the session user")
+		}
+		from := filter.Lookup("created_at", "$gte").Time()
+		to := filter.Lookup("created_at", "$lte").Time()
+		if !from.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || to.Before(time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)) {
+			t.Errorf("created_at range = %v to %v, want all of January", from, to)
+		}
+		if skip := find.Command.Lookup("skip").AsInt64(); skip != 5 {
+			t.Errorf("skip = %d, want 5 for page 2", skip)
+		}
+	})
+}
+
+func TestSearchTodosValidatesParameters(t *testing.T) {
+	user := newTestUser(t, "")
+	for _, query := range []string{
+		"priority=urgent",
+		"status=done",
+		"tags=,",
+		"from=last-week",
+		"from=2024-02-01&to=2024-01-01",
+		"page=0",
+		"limit=500",
+	} {
+		w := serve(SearchTodos, testRequest{method: http.MethodGet, route: "/todos/search", path: "/todos/search?" + query, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+)
+
+// defaultTenantName is reported as the tenant of sessions in the default
+// database.
+const defaultTenantName = "default"
+
+// sessionClaims is the part of a session token safe to show its holder.
+// The signature and anything derived from the secret are left out.
+type sessionClaims struct {
+	Subject  string `json:"sub"`
+	Expires  int64  `json:"exp"`
+	IssuedAt *int64 `json:"iat"`
+	Role     string `json:"role"`
+	// IssuedFor is the tenant the token was issued in; it is only accepted
+	// there
+	IssuedFor        string `json:"issued_for"`
+	ExpiresInSeconds int64  `json:"expires_in_seconds"`
+}
+
+// SessionInfo returns the decoded claims of the caller's session token, to
+// help debug client integrations.
+func SessionInfo(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	claims, ok := auth.SessionClaims(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API keys have no session token", "code": "NO_SESSION_TOKEN"})
+		return
+	}
+
+	view := sessionClaims{
+		Subject:          claims.Username,
+		Expires:          claims.ExpiresAt,
+		Role:             claims.Role,
+		IssuedFor:        requestTenant(c),
+		ExpiresInSeconds: int64(auth.ExpiresIn(claims).Seconds()),
+	}
+	// Tokens issued before iat was recorded have none
+	if claims.IssuedAt != 0 {
+		view.IssuedAt = &claims.IssuedAt
+	}
+	if view.IssuedFor == "" {
+		view.IssuedFor = defaultTenantName
+	}
+	c.JSON(http.StatusOK, view)
+}
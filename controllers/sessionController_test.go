@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jeffthorne/tasky/auth"
+)
+
+// sessionInfo fetches the claims of the session in cookie.
+func sessionInfo(t *testing.T, cookie *http.Cookie) sessionClaims {
+	t.Helper()
+	w := serve(SessionInfo, testRequest{method: http.MethodGet, route: "/auth/session", path: "/auth/session", cookie: cookie})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), cookie.Value) {
+		t.Error("the response contains the raw token")
+	}
+	var claims sessionClaims
+	decodeBody(t, w, &claims)
+	return claims
+}
+
+// tokenIssuedAgo signs a two-hour token for user as if issued age ago.
+func tokenIssuedAgo(t *testing.T, userID string, age time.Duration) *http.Cookie {
+	t.Helper()
+	issued := time.Now().Add(-age)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+		Username: userID,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  issued.Unix(),
+			ExpiresAt: issued.Add(2 * time.Hour).Unix(),
+		},
+	}).SignedString(auth.SecretKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: "token", Value: token}
+}
+
+func TestSessionInfo(t *testing.T) {
+	user := newTestUser(t, auth.RoleAdmin)
+	claims := sessionInfo(t, sessionCookie(t, user))
+
+	if claims.Subject != user.ID.Hex() {
+		t.Errorf("sub = %q, want the logged-in user %q", claims.Subject, user.ID.Hex())
+	}
+	if claims.Role != auth.RoleAdmin || claims.IssuedFor != defaultTenantName {
+		t.Errorf("role %q issued for %q", claims.Role, claims.IssuedFor)
+	}
+	if claims.IssuedAt == nil || claims.Expires <= *claims.IssuedAt {
+		t.Errorf("iat %v, exp %d", claims.IssuedAt, claims.Expires)
+	}
+	if claims.ExpiresInSeconds <= 0 || claims.ExpiresInSeconds > int64((2*time.Hour).Seconds()) {
+		t.Errorf("expires_in_seconds = %d, want within the two-hour lifetime", claims.ExpiresInSeconds)
+	}
+}
+
+func TestSessionInfoExpiresInDecreases(t *testing.T) {
+	user := newTestUser(t, "")
+	fresh := sessionInfo(t, tokenIssuedAgo(t, user.ID.Hex(), 0))
+	older := sessionInfo(t, tokenIssuedAgo(t, user.ID.Hex(), 30*time.Minute))
+	if older.ExpiresInSeconds >= fresh.ExpiresInSeconds || older.ExpiresInSeconds <= 0 {
+		t.Fatalf("expires_in_seconds: fresh %d, 30 minutes old %d; want fewer left on the older token", fresh.ExpiresInSeconds, older.ExpiresInSeconds)
+	}
+	if diff := fresh.ExpiresInSeconds - older.ExpiresInSeconds; diff < 1799 || diff > 1801 {
+		t.Errorf("the older token has %ds less, want 1800s", diff)
+	}
+}
+
+func TestSessionInfoRequiresSession(t *testing.T) {
+	w := serve(SessionInfo, testRequest{method: http.MethodGet, route: "/auth/session", path: "/auth/session"})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+}
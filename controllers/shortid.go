@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+const (
+	shortIDLength      = 8
+	shortIDAlphabet    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	maxShortIDAttempts = 5
+)
+
+// newShortID returns a random, URL-safe base62 identifier.
+func newShortID() (string, error) {
+	max := big.NewInt(int64(len(shortIDAlphabet)))
+	id := make([]byte, shortIDLength)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id[i] = shortIDAlphabet[n.Int64()]
+	}
+	return string(id), nil
+}
+
+// isShortID reports whether id has the shape of a generated short id.
+func isShortID(id string) bool {
+	if len(id) != shortIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestNewShortIDsAreUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id, err := newShortID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isShortID(id) {
+			t.Fatalf("%q is not a short id", id)
+		}
+		if seen[id] {
+			t.Fatalf("%q was generated twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestTodoIDFilter(t *testing.T) {
+	objectID := primitive.NewObjectID()
+	if filter, ok := todoIDFilter(objectID.Hex()); !ok || filter["_id"] != objectID {
+		t.Errorf("ObjectID filter = %v, %v", filter, ok)
+	}
+	if filter, ok := todoIDFilter("Ab3dE5gH"); !ok || filter["short_id"] != "Ab3dE5gH" {
+		t.Errorf("short id filter = %v, %v", filter, ok)
+	}
+	for _, id := range []string{"", "short", "Ab3dE5g!", "Ab3dE5gHi"} {
+		if _, ok := todoIDFilter(id); ok {
+			t.Errorf("todoIDFilter(%q) accepted a malformed id", id)
+		}
+	}
+}
+
+func TestGetTodoByEitherID(t *testing.T) {
+	user := newTestUser(t, "")
+	todo := models.Todo{ID: primitive.NewObjectID(), ShortID: "Ab3dE5gH", Name: "share", Status: statusPending, UserID: user.ID}
+	for _, id := range []string{todo.ID.Hex(), todo.ShortID} {
+		withMockDB(t, id, func(mt *mtest.T) {
+			mt.AddMockResponses(cursorResponse(todo))
+			w := serve(GetTodo, testRequest{method: http.MethodGet, route: "/todo/:id", path: "/todo/" + id, cookie: sessionCookie(t, user)})
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET /todo/%s: status = %d", id, w.Code)
+			}
+			var got models.Todo
+			decodeBody(t, w, &got)
+			if got.ID != todo.ID || got.ShortID != todo.ShortID {
+				t.Fatalf("GET /todo/%s returned %+v", id, got)
+			}
+		})
+	}
+}
+
+func TestInsertWithShortIDRetriesCollisions(t *testing.T) {
+	withMockDB(t, "collision", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}),
+			mtest.CreateSuccessResponse(),
+		)
+		todo := &models.Todo{ID: primitive.NewObjectID(), Name: "retry"}
+		if err := insertWithShortID(context.Background(), database.OpenCollection(mt.Client, "todos"), todo); err != nil {
+			t.Fatal(err)
+		}
+
+		var sent []string
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			doc := evt.Command.Lookup("documents").Array().Index(0).Value().Document()
+			sent = append(sent, doc.Lookup("short_id").StringValue())
+		}
+		if len(sent) != 2 || sent[0] == sent[1] || sent[1] != todo.ShortID {
+			t.Fatalf("inserted short ids %v, want a new one on the retry", sent)
+		}
+	})
+}
+
+func TestInsertWithShortIDGivesUp(t *testing.T) {
+	withMockDB(t, "exhausted", func(mt *mtest.T) {
+		for i := 0; i < maxShortIDAttempts; i++ {
+			mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}))
+		}
+		todo := &models.Todo{ID: primitive.NewObjectID(), Name: "retry"}
+		if err := insertWithShortID(context.Background(), database.OpenCollection(mt.Client, "todos"), todo); err == nil {
+			t.Fatal("insert succeeded although every short id collided")
+		}
+	})
+}
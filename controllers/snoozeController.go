@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxSnoozeHistory caps the deferrals remembered per todo.
+const maxSnoozeHistory = 50
+
+// SnoozeTodo defers the due date of one of the session user's todos, either
+// to an absolute time (until) or by a duration such as "24h". A duration
+// counts from the current due date, or from now if that has passed.
+func SnoozeTodo(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Until    models.JSONTime `json:"until"`
+		Duration string          `json:"duration"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	if body.Until.IsZero() == (body.Duration == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "give exactly one of until or duration"})
+		return
+	}
+	var duration time.Duration
+	if body.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(body.Duration)
+		if err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duration must be a positive duration such as 30m or 24h"})
+			return
+		}
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	var todo models.Todo
+	findOptions := options.FindOne().SetProjection(bson.M{"due_date": 1})
+	err := todosFor(c).FindOne(ctx, filter, findOptions).Decode(&todo)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	now := time.Now()
+	until := body.Until.Time
+	if duration > 0 {
+		from := now
+		if todo.DueDate.After(now) {
+			from = todo.DueDate.Time
+		}
+		until = from.Add(duration)
+	}
+	if !until.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the new due date must be in the future"})
+		return
+	}
+	if !todo.DueDate.IsZero() && !until.After(todo.DueDate.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the new due date must be later than the current one"})
+		return
+	}
+
+	snooze := models.Snooze{From: todo.DueDate, Until: models.NewJSONTime(until), SnoozedAt: models.NewJSONTime(now)}
+	update := bson.M{
+		"$set": bson.M{"due_date": snooze.Until, "updated_at": snooze.SnoozedAt},
+		"$push": bson.M{"snoozes": bson.M{
+			"$each":  bson.A{snooze},
+			"$slice": -maxSnoozeHistory,
+		}},
+	}
+	if _, err := todosFor(c).UpdateOne(ctx, filter, update); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todosChanged(c, sessionUserID(c))
+
+	c.JSON(http.StatusOK, gin.H{"due_date": snooze.Until, "snooze": snooze})
+}
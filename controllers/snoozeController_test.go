@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// snoozeTodo posts body to the snooze action of todoID.
+func snoozeTodo(todoID primitive.ObjectID, cookie *http.Cookie, body string) testRequest {
+	return testRequest{method: http.MethodPost, route: "/todos/:id/snooze", path: "/todos/" + todoID.Hex() + "/snooze", body: body, cookie: cookie}
+}
+
+// snoozeUpdate returns the update document of the todo update SnoozeTodo sent.
+func snoozeUpdate(t *testing.T, mt *mtest.T) bson.Raw {
+	t.Helper()
+	for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+		if evt.CommandName == "update" {
+			return evt.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		}
+	}
+	t.Fatal("no update command was sent")
+	return nil
+}
+
+func TestSnoozeUntil(t *testing.T) {
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+	todoID := primitive.NewObjectID()
+	due := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	until := due.Add(48 * time.Hour)
+
+	withMockDB(t, "until", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(bson.D{{Key: "_id", Value: todoID}, {Key: "due_date", Value: due}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		w := serve(SnoozeTodo, snoozeTodo(todoID, cookie, `{"until": "`+until.Format(time.RFC3339)+`"}`))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		update := snoozeUpdate(t, mt)
+		if got := update.Lookup("$set", "due_date").Time(); !got.Equal(until) {
+			t.Errorf("due_date set to %v, want %v", got, until)
+		}
+		snooze := update.Lookup("$push", "snoozes", "$each").Array().Index(0).Value().Document()
+		if from := snooze.Lookup("from").Time(); !from.Equal(due) {
+			t.Errorf("snooze history from = %v, want %v", from, due)
+		}
+		if slice := update.Lookup("$push", "snoozes", "$slice").Int32(); slice != -maxSnoozeHistory {
+			t.Errorf("history slice = %d, want %d", slice, -maxSnoozeHistory)
+		}
+
+		var body struct {
+			DueDate string `json:"due_date"`
+		}
+		decodeBody(t, w, &body)
+		if body.DueDate != until.Format(time.RFC3339) {
+			t.Errorf("response due_date = %q", body.DueDate)
+		}
+	})
+}
+
+func TestSnoozeDuration(t *testing.T) {
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+	todoID := primitive.NewObjectID()
+
+	withMockDB(t, "from due date", func(mt *mtest.T) {
+		due := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		mt.AddMockResponses(
+			cursorResponse(bson.D{{Key: "_id", Value: todoID}, {Key: "due_date", Value: due}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		if w := serve(SnoozeTodo, snoozeTodo(todoID, cookie, `{"duration": "24h"}`)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if got, want := snoozeUpdate(t, mt).Lookup("$set", "due_date").Time(), due.Add(24*time.Hour); !got.Equal(want) {
+			t.Errorf("due_date set to %v, want %v", got, want)
+		}
+	})
+
+	withMockDB(t, "from now when overdue", func(mt *mtest.T) {
+		due := time.Now().Add(-72 * time.Hour).UTC().Truncate(time.Second)
+		mt.AddMockResponses(
+			cursorResponse(bson.D{{Key: "_id", Value: todoID}, {Key: "due_date", Value: due}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		before := time.Now().Truncate(time.Second)
+		if w := serve(SnoozeTodo, snoozeTodo(todoID, cookie, `{"duration": "30m"}`)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		got := snoozeUpdate(t, mt).Lookup("$set", "due_date").Time()
+		if got.Before(before.Add(30*time.Minute)) || got.After(time.Now().Add(30*time.Minute)) {
+			t.Errorf("due_date set to %v, want 30m from now", got)
+		}
+	})
+}
+
+func TestSnoozeRejectsPastDate(t *testing.T) {
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+	todoID := primitive.NewObjectID()
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	withMockDB(t, "past", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.D{{Key: "_id", Value: todoID}}))
+		if w := serve(SnoozeTodo, snoozeTodo(todoID, cookie, `{"until": "`+past+`"}`)); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", w.Code)
+		}
+	})
+
+	withMockDB(t, "earlier than due", func(mt *mtest.T) {
+		due := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+		until := due.Add(-24 * time.Hour).Format(time.RFC3339)
+		mt.AddMockResponses(cursorResponse(bson.D{{Key: "_id", Value: todoID}, {Key: "due_date", Value: due}}))
+		if w := serve(SnoozeTodo, snoozeTodo(todoID, cookie, `{"until": "`+until+`"}`)); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", w.Code)
+		}
+	})
+
+	for _, body := range []string{`{}`, `{"until": "` + past + `", "duration": "1h"}`, `{"duration": "-1h"}`, `{"duration": "soon"}`} {
+		if w := serve(SnoozeTodo, snoozeTodo(todoID, cookie, body)); w.Code != http.StatusBadRequest {
+			t.Errorf("body %s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
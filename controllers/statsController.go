@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultAdminStatsTTL is how long computed stats are reused unless
+// ADMIN_STATS_TTL says otherwise.
+const defaultAdminStatsTTL = 30 * time.Second
+
+// statsWindow is the recent period the *_24h stats cover.
+const statsWindow = 24 * time.Hour
+
+// SystemStats is the dashboard summary of one tenant's users and todos.
+type SystemStats struct {
+	TotalUsers      int64 `json:"total_users"`
+	ActiveUsers24h  int64 `json:"active_users_24h"`
+	TotalTodos      int64 `json:"total_todos"`
+	TodosCreated24h int64 `json:"todos_created_24h"`
+	// DoneRatio is the share of todos that are completed, 0 with no todos
+	DoneRatio   float64         `json:"done_ratio"`
+	GeneratedAt models.JSONTime `json:"generated_at"`
+}
+
+var adminStatsCache = newStatsCache(adminStatsTTL())
+
+// statsCache keeps the latest stats per tenant so that frequent dashboard
+// polls do not each run the aggregations.
+type statsCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]SystemStats
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{ttl: ttl, entries: map[string]SystemStats{}}
+}
+
+func adminStatsTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("ADMIN_STATS_TTL"))
+	if err != nil || ttl < 0 {
+		return defaultAdminStatsTTL
+	}
+	return ttl
+}
+
+// get returns the stats stored for tenant if they are younger than the TTL.
+func (sc *statsCache) get(tenant string, now time.Time) (SystemStats, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	stats, ok := sc.entries[tenant]
+	if !ok || now.Sub(stats.GeneratedAt.Time) >= sc.ttl {
+		return SystemStats{}, false
+	}
+	return stats, true
+}
+
+func (sc *statsCache) store(tenant string, stats SystemStats) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.entries[tenant] = stats
+}
+
+// AdminStats reports user and todo totals for the tenant, recent activity
+// and the share of completed todos. Results are cached for ADMIN_STATS_TTL;
+// generated_at tells when they were computed.
+func AdminStats(c *gin.Context) {
+	if !auth.ValidateAdminAPI(c) {
+		return
+	}
+
+	tenant := requestTenant(c)
+	if stats, ok := adminStatsCache.get(tenant, time.Now()); ok {
+		c.JSON(http.StatusOK, stats)
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	stats, err := computeStats(ctx, usersFor(c), todosFor(c), auditLogFor(c), time.Now())
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	adminStatsCache.store(tenant, stats)
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// computeStats runs one query per collection. Active users are those with a
+// successful login in the audit log during the window.
+func computeStats(ctx context.Context, users, todos, auditLog *mongo.Collection, now time.Time) (SystemStats, error) {
+	since := now.Add(-statsWindow)
+	stats := SystemStats{GeneratedAt: models.NewJSONTime(now)}
+
+	var err error
+	if stats.TotalUsers, err = users.CountDocuments(ctx, bson.M{}); err != nil {
+		return SystemStats{}, err
+	}
+
+	active, err := auditLog.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"event": auditLoginSuccess, "timestamp": bson.M{"$gte": since}}},
+		bson.M{"$group": bson.M{"_id": "$user"}},
+		bson.M{"$count": "users"},
+	})
+	if err != nil {
+		return SystemStats{}, err
+	}
+	var activeCounts []struct {
+		Users int64 `bson:"users"`
+	}
+	if err := active.All(ctx, &activeCounts); err != nil {
+		return SystemStats{}, err
+	}
+	if len(activeCounts) > 0 {
+		stats.ActiveUsers24h = activeCounts[0].Users
+	}
+
+	totals, err := todos.Aggregate(ctx, bson.A{
+		// Drafts and archived todos are not counted, as in the lists
+		bson.M{"$match": bson.M{"draft": bson.M{"$ne": true}, "archived": bson.M{"$ne": true}}},
+		bson.M{"$group": bson.M{
+			"_id":     nil,
+			"total":   bson.M{"$sum": 1},
+			"created": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$created_at", since}}, 1, 0}}},
+			"done":    bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", statusCompleted}}, 1, 0}}},
+		}},
+	})
+	if err != nil {
+		return SystemStats{}, err
+	}
+	var todoCounts []struct {
+		Total   int64 `bson:"total"`
+		Created int64 `bson:"created"`
+		Done    int64 `bson:"done"`
+	}
+	if err := totals.All(ctx, &todoCounts); err != nil {
+		return SystemStats{}, err
+	}
+	if len(todoCounts) > 0 {
+		stats.TotalTodos = todoCounts[0].Total
+		stats.TodosCreated24h = todoCounts[0].Created
+		if stats.TotalTodos > 0 {
+			stats.DoneRatio = float64(todoCounts[0].Done) / float64(stats.TotalTodos)
+		}
+	}
+	return stats, nil
+}
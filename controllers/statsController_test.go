@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestComputeStatsSkipsDraftsAndArchived(t *testing.T) {
+	withMockDB(t, "stats", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(bson.M{"n": 3}),
+			cursorResponse(bson.M{"users": 2}),
+			cursorResponse(bson.M{"total": 4, "created": 1, "done": 1}),
+		)
+		collection := func(name string) *mongo.Collection { return database.OpenCollection(mt.Client, name) }
+		stats, err := computeStats(context.Background(), collection("users"), collection("todos"), collection("auditlog"), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalUsers != 3 || stats.ActiveUsers24h != 2 || stats.TotalTodos != 4 || stats.TodosCreated24h != 1 || stats.DoneRatio != 0.25 {
+			t.Fatalf("stats = %+v", stats)
+		}
+
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		evt := mt.GetStartedEvent()
+		match, err := evt.Command.Lookup("pipeline").Array().Index(0).Value().Document().LookupErr("$match")
+		if err != nil {
+			t.Fatalf("todo aggregation starts without $match: %v", evt.Command)
+		}
+		for _, field := range []string{"draft", "archived"} {
+			if _, err := match.Document().LookupErr(field); err != nil {
+				t.Errorf("$match %v does not filter %s", match, field)
+			}
+		}
+	})
+}
+
+func TestAdminStatsServesRepeatCallsFromCache(t *testing.T) {
+	admin := newTestUser(t, auth.RoleAdmin)
+	previous := adminStatsCache
+	adminStatsCache = newStatsCache(time.Minute)
+	defer func() { adminStatsCache = previous }()
+
+	withMockDB(t, "cached", func(mt *mtest.T) {
+		// Only one computation is mocked; a second would fail with 500
+		mt.AddMockResponses(
+			cursorResponse(bson.M{"n": 3}),
+			cursorResponse(bson.M{"users": 2}),
+			cursorResponse(bson.M{"total": 4, "created": 1, "done": 1}),
+		)
+		var first SystemStats
+		for i := 0; i < 2; i++ {
+			w := serve(AdminStats, testRequest{method: http.MethodGet, route: "/admin/stats", path: "/admin/stats", cookie: sessionCookie(t, admin)})
+			if w.Code != http.StatusOK {
+				t.Fatalf("call %d: status = %d, body %s", i+1, w.Code, w.Body)
+			}
+			var stats SystemStats
+			decodeBody(t, w, &stats)
+			if i == 0 {
+				first = stats
+			} else if stats != first {
+				t.Fatalf("second call returned %+v, want the cached %+v", stats, first)
+			}
+		}
+		if first.TotalTodos != 4 || first.DoneRatio != 0.25 {
+			t.Fatalf("stats = %+v", first)
+		}
+	})
+}
+
+func TestAdminStatsRequiresAdmin(t *testing.T) {
+	user := newTestUser(t, "")
+	w := serve(AdminStats, testRequest{method: http.MethodGet, route: "/admin/stats", path: "/admin/stats", cookie: sessionCookie(t, user)})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+}
+
+func TestStatsCacheExpires(t *testing.T) {
+	cache := newStatsCache(time.Minute)
+	now := time.Now()
+	cache.store("acme", SystemStats{TotalUsers: 1, GeneratedAt: models.NewJSONTime(now)})
+
+	if _, ok := cache.get("acme", now.Add(30*time.Second)); !ok {
+		t.Fatal("stats within the TTL were not cached")
+	}
+	if _, ok := cache.get("acme", now.Add(time.Minute)); ok {
+		t.Fatal("stats older than the TTL were served")
+	}
+	if _, ok := cache.get("other", now); ok {
+		t.Fatal("another tenant's stats were served")
+	}
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/ctxkeys"
+	"github.com/jeffthorne/tasky/database"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// tenantHeader selects the tenant database a request reads and writes.
+const tenantHeader = "X-Tenant-ID"
+
+// TenantScope records the tenant named by the X-Tenant-ID header, rejecting
+// tenants not listed in TENANTS. Requests without the header use the
+// default database.
+func TenantScope(c *gin.Context) {
+	tenant := c.GetHeader(tenantHeader)
+	if tenant == "" {
+		c.Next()
+		return
+	}
+	if !database.TenantAllowed(tenant) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown tenant", "code": "UNKNOWN_TENANT"})
+		return
+	}
+	ctxkeys.SetTenant(c, tenant)
+	c.Next()
+}
+
+// requestTenant returns the request's tenant, empty for the default database.
+func requestTenant(c *gin.Context) string {
+	tenant, _ := ctxkeys.GetTenant(c)
+	return tenant
+}
+
+// tenantCollection returns the named collection of the request's tenant.
+func tenantCollection(c *gin.Context, name string) *mongo.Collection {
+	return database.OpenTenantCollection(database.Client, requestTenant(c), name)
+}
+
+// todosFor returns the todo collection of the request's tenant.
+func todosFor(c *gin.Context) *mongo.Collection {
+	return tenantCollection(c, "todos")
+}
+
+// usersFor returns the user collection of the request's tenant. Sessions are
+// checked against it, so a token only works within the tenant that issued it.
+func usersFor(c *gin.Context) *mongo.Collection {
+	return tenantCollection(c, "user")
+}
+
+// tenantScoped qualifies a cache key with the request's tenant.
+func tenantScoped(c *gin.Context, key string) string {
+	if tenant := requestTenant(c); tenant != "" {
+		return tenant + "/" + key
+	}
+	return key
+}
+
+// collectionIndex is an index the controllers rely on.
+type collectionIndex struct {
+	collection string
+	model      mongo.IndexModel
+}
+
+// indexes records every ensureIndex call, so EnsureIndexes can recreate them.
+var indexes []collectionIndex
+
+// EnsureIndexes creates every index the controllers rely on in the tenant's
+// database, returning the first error. The server creates them at startup
+// too, but only logs failures.
+func EnsureIndexes(ctx context.Context, tenant string) error {
+	for _, index := range indexes {
+		collection := database.OpenTenantCollection(database.Client, tenant, index.collection)
+		if _, err := collection.Indexes().CreateOne(ctx, index.model); err != nil {
+			return fmt.Errorf("creating index on %v.%v: %w", database.TenantDatabase(tenant), index.collection, err)
+		}
+	}
+	return nil
+}
+
+// ensureIndex creates an index on the named collection in the default
+// database and every tenant database. It is a no-op without a database
+// connection, and failures are only logged.
+func ensureIndex(collectionName string, model mongo.IndexModel) {
+	indexes = append(indexes, collectionIndex{collection: collectionName, model: model})
+	if database.Client == nil {
+		return
+	}
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	for _, tenant := range append([]string{""}, database.Tenants()...) {
+		collection := database.OpenTenantCollection(database.Client, tenant, collectionName)
+		if _, err := collection.Indexes().CreateOne(ctx, model); err != nil {
+			log.Printf("Error creating index on %v.%v: %v", database.TenantDatabase(tenant), collectionName, err)
+		}
+	}
+}
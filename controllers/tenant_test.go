@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// serveTenant runs r through TenantScope and handler as tenant.
+func serveTenant(handler gin.HandlerFunc, r testRequest, tenant string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(r.method, r.route, TenantScope, handler)
+
+	req := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(tenantHeader, tenant)
+	if r.cookie != nil {
+		req.AddCookie(r.cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// newTenantUser is newTestUser for a user of tenant.
+func newTenantUser(t *testing.T, tenant string) models.User {
+	t.Helper()
+	user := newTestUser(t, "")
+	sessionUserCache.invalidate(user.ID.Hex())
+	sessionUserCache.store(tenant+"/"+user.ID.Hex(), user)
+	return user
+}
+
+func TestTenantScopeRejectsUnknownTenant(t *testing.T) {
+	t.Setenv("TENANTS", "acme")
+	user := newTestUser(t, "")
+	w := serveTenant(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex(), cookie: sessionCookie(t, user)}, "globex")
+	assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusBadRequest, "UNKNOWN_TENANT")
+}
+
+func TestTenantTodosAreIsolated(t *testing.T) {
+	t.Setenv("TENANTS", "acme,globex")
+	user := newTenantUser(t, "acme")
+	acme, globex := database.TenantDatabase("acme"), database.TenantDatabase("globex")
+
+	withMockDB(t, "create under acme", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(), mtest.CreateSuccessResponse(), cursorResponse())
+		w := serveTenant(AddTodo, testRequest{method: http.MethodPost, route: "/todo/:userid", path: "/todo/" + user.ID.Hex(), body: `{"name": "acme only"}`, cookie: sessionCookie(t, user)}, "acme")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		inserted := false
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "insert" {
+				inserted = true
+				if evt.DatabaseName != acme {
+					t.Fatalf("todo was inserted into %s, want %s", evt.DatabaseName, acme)
+				}
+			}
+		}
+		if !inserted {
+			t.Fatal("no todo was inserted")
+		}
+	})
+
+	withMockDB(t, "list under acme", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"name": "acme only", "userid": user.ID}))
+		w := serveTenant(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex(), cookie: sessionCookie(t, user)}, "acme")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "acme only") {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if evt := mt.GetStartedEvent(); evt.DatabaseName != acme {
+			t.Fatalf("listed todos from %s, want %s", evt.DatabaseName, acme)
+		}
+	})
+
+	withMockDB(t, "list under globex", func(mt *mtest.T) {
+		// acme's user does not exist in globex's database
+		mt.AddMockResponses(cursorResponse())
+		w := serveTenant(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex(), cookie: sessionCookie(t, user)}, "globex")
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, body %s; want the session rejected", w.Code, w.Body)
+		}
+		evt := mt.GetStartedEvent()
+		if evt.DatabaseName != globex || evt.Command.Lookup("find").StringValue() != "user" {
+			t.Fatalf("session was checked with a %s on %s", evt.CommandName, evt.DatabaseName)
+		}
+		if evt := mt.GetStartedEvent(); evt != nil {
+			t.Fatalf("sent %s on %s after rejecting the session", evt.CommandName, evt.DatabaseName)
+		}
+	})
+}
+
+func TestOpenTenantCollectionCachesHandles(t *testing.T) {
+	withMockDB(t, "handles", func(mt *mtest.T) {
+		first := database.OpenTenantCollection(mt.Client, "acme", "todos")
+		if again := database.OpenTenantCollection(mt.Client, "acme", "todos"); again != first {
+			t.Error("the handle was not cached")
+		}
+		if other := database.OpenTenantCollection(mt.Client, "globex", "todos"); other == first || other.Database().Name() != database.TenantDatabase("globex") {
+			t.Errorf("globex got the handle of %s", other.Database().Name())
+		}
+	})
+}
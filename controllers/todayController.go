@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TodayTodos lists the session user's incomplete todos due during the
+// current day in the tz time zone (an IANA name, default UTC), highest
+// priority first and then by due time.
+func TodayTodos(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	loc, ok := locationFromQuery(c)
+	if !ok {
+		return
+	}
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	filter, ok := todoListFilter(c, owner)
+	if !ok {
+		return
+	}
+	start, end := dayBounds(time.Now(), loc)
+	filter["due_date"] = bson.M{"$gte": start, "$lt": end}
+	filter["$and"] = bson.A{bson.M{"status": bson.M{"$ne": statusCompleted}}}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	findOptions := options.Find().
+		SetProjection(bson.M{"notes": 0}).
+		SetSort(bson.D{{Key: "due_date", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := todosForRead(c, owner.Hex()).Find(ctx, filter, findOptions)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todos := []models.Todo{}
+	if err := cursor.All(ctx, &todos); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Already in due order, so a stable sort by priority keeps it within ties
+	sort.SliceStable(todos, func(i, j int) bool {
+		return priorityRank(todos[i].Priority) < priorityRank(todos[j].Priority)
+	})
+
+	c.JSON(http.StatusOK, todos)
+}
+
+// locationFromQuery reads the tz query parameter as an IANA time zone,
+// defaulting to UTC. It responds with 400 and returns ok=false for an
+// unknown zone.
+func locationFromQuery(c *gin.Context) (*time.Location, bool) {
+	name := c.Query("tz")
+	if name == "" {
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tz must be an IANA time zone such as Europe/Paris"})
+		return nil, false
+	}
+	return loc, true
+}
+
+// dayBounds returns the start of the day containing t in loc and the start
+// of the next day, which differ by other than 24 hours across DST changes.
+func dayBounds(t time.Time, loc *time.Location) (time.Time, time.Time) {
+	local := t.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// priorityRank orders priorities from most to least urgent, unset last.
+func priorityRank(priority string) int {
+	switch priority {
+	case priorityHigh:
+		return 0
+	case priorityMedium:
+		return 1
+	case priorityLow:
+		return 2
+	default:
+		return 3
+	}
+}
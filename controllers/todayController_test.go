@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestDayBoundsInZone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	// 23:30 UTC on the 3rd is already 08:30 on the 4th in Tokyo
+	start, end := dayBounds(time.Date(2024, 6, 3, 23, 30, 0, 0, time.UTC), tokyo)
+	if want := time.Date(2024, 6, 3, 15, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("start = %v, want %v", start.UTC(), want)
+	}
+	if want := time.Date(2024, 6, 4, 15, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("end = %v, want %v", end.UTC(), want)
+	}
+
+	// A minute before Tokyo midnight still belongs to the 4th
+	start, _ = dayBounds(time.Date(2024, 6, 4, 14, 59, 0, 0, time.UTC), tokyo)
+	if start.In(tokyo).Day() != 4 {
+		t.Errorf("14:59 UTC falls on Tokyo day %d, want 4", start.In(tokyo).Day())
+	}
+	start, _ = dayBounds(time.Date(2024, 6, 4, 15, 0, 0, 0, time.UTC), tokyo)
+	if start.In(tokyo).Day() != 5 {
+		t.Errorf("15:00 UTC falls on Tokyo day %d, want 5", start.In(tokyo).Day())
+	}
+}
+
+func TestDayBoundsAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	start, end := dayBounds(time.Date(2024, 3, 10, 12, 0, 0, 0, newYork), newYork)
+	if got := end.Sub(start); got != 23*time.Hour {
+		t.Fatalf("the day clocks spring forward lasts %v, want 23h", got)
+	}
+}
+
+func TestTodayTodos(t *testing.T) {
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+
+	withMockDB(t, "sorted", func(mt *mtest.T) {
+		due := time.Now().UTC().Truncate(time.Second)
+		mt.AddMockResponses(cursorResponse(
+			bson.M{"_id": primitive.NewObjectID(), "name": "low", "priority": priorityLow, "due_date": due},
+			bson.M{"_id": primitive.NewObjectID(), "name": "unset", "due_date": due},
+			bson.M{"_id": primitive.NewObjectID(), "name": "high", "priority": priorityHigh, "due_date": due.Add(time.Minute)},
+			bson.M{"_id": primitive.NewObjectID(), "name": "medium", "priority": priorityMedium, "due_date": due},
+		))
+		w := serve(TodayTodos, testRequest{method: http.MethodGet, route: "/todos/today", path: "/todos/today?tz=Asia/Tokyo", cookie: cookie})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var todos []struct {
+			Name string `json:"name"`
+		}
+		decodeBody(t, w, &todos)
+		var names []string
+		for _, todo := range todos {
+			names = append(names, todo.Name)
+		}
+		if got := strings.Join(names, ","); got != "high,medium,low,unset" {
+			t.Errorf("order = %s, want high,medium,low,unset", got)
+		}
+
+		filter := commandFilter(t, mt, "find")
+		start := filter.Lookup("due_date", "$gte").Time()
+		end := filter.Lookup("due_date", "$lt").Time()
+		tokyo, _ := time.LoadLocation("Asia/Tokyo")
+		if local := start.In(tokyo); local.Hour() != 0 || local.Minute() != 0 || end.Sub(start) != 24*time.Hour {
+			t.Errorf("due window [%v, %v) is not a Tokyo day", start, end)
+		}
+		if status := filter.Lookup("$and").Array().Index(0).Value().Document().Lookup("status", "$ne").StringValue(); status != statusCompleted {
+			t.Errorf("completed todos are not excluded, status $ne %q", status)
+		}
+	})
+
+	withMockDB(t, "default UTC", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		if w := serve(TodayTodos, testRequest{method: http.MethodGet, route: "/todos/today", path: "/todos/today", cookie: cookie}); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		start := commandFilter(t, mt, "find").Lookup("due_date", "$gte").Time().UTC()
+		if start.Hour() != 0 || start.Minute() != 0 {
+			t.Errorf("window starts at %v, want UTC midnight", start)
+		}
+	})
+
+	if w := serve(TodayTodos, testRequest{method: http.MethodGet, route: "/todos/today", path: "/todos/today?tz=Mars/Olympus", cookie: cookie}); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown zone: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultTodoCacheTTL bounds how stale a fallback todo list may be when
+// TODO_CACHE_TTL is unset or invalid.
+const defaultTodoCacheTTL = 60 * time.Second
+
+// defaultTodoCacheSize is the number of users whose lists are kept when
+// TODO_CACHE_SIZE is unset or invalid.
+const defaultTodoCacheSize = 1000
+
+// maxCachedListsPerUser caps the filter and sort combinations kept per user.
+const maxCachedListsPerUser = 8
+
+// staleWarning is the RFC 7234 warning attached to responses served from the
+// fallback cache.
+const staleWarning = `110 - "Response is Stale"`
+
+var todoListCache = newListCache(todoCacheTTL(), todoCacheSize())
+
+// listCache remembers the most recent todo-list responses per user so that a
+// transient database failure can be answered with slightly stale data instead
+// of an error. It is only consulted when a read fails. Users are evicted least
+// recently used first, and expired lists are swept on every store.
+type listCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently stored or served
+	entries map[string]*list.Element
+}
+
+// listCacheUser holds one user's lists by variant.
+type listCacheUser struct {
+	userID   string
+	lists    map[string]listCacheEntry
+	storedAt time.Time // of the newest list
+}
+
+type listCacheEntry struct {
+	todos    []models.Todo
+	storedAt time.Time
+}
+
+func newListCache(ttl time.Duration, size int) *listCache {
+	return &listCache{ttl: ttl, size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func todoCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("TODO_CACHE_TTL"))
+	if err != nil || ttl < 0 {
+		return defaultTodoCacheTTL
+	}
+	return ttl
+}
+
+// todoCacheSize reads TODO_CACHE_SIZE, the number of users kept.
+func todoCacheSize() int {
+	size, err := strconv.Atoi(os.Getenv("TODO_CACHE_SIZE"))
+	if err != nil || size < 1 {
+		return defaultTodoCacheSize
+	}
+	return size
+}
+
+// store records the list returned for userID and query variant.
+func (lc *listCache) store(userID, variant string, todos []models.Todo) {
+	if lc.ttl == 0 {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	now := time.Now()
+	elem, ok := lc.entries[userID]
+	if !ok {
+		elem = lc.order.PushFront(&listCacheUser{userID: userID, lists: map[string]listCacheEntry{}})
+		lc.entries[userID] = elem
+	}
+	user := elem.Value.(*listCacheUser)
+	user.lists[variant] = listCacheEntry{todos: todos, storedAt: now}
+	user.storedAt = now
+	lc.order.MoveToFront(elem)
+
+	for len(user.lists) > maxCachedListsPerUser {
+		oldest := ""
+		for key, entry := range user.lists {
+			if oldest == "" || entry.storedAt.Before(user.lists[oldest].storedAt) {
+				oldest = key
+			}
+		}
+		delete(user.lists, oldest)
+	}
+	lc.sweep(now)
+}
+
+// sweep drops the least recently used users beyond the size, and users at
+// the back whose newest list has expired. Users are ordered by use, so
+// expired ones collect at the back.
+func (lc *listCache) sweep(now time.Time) {
+	for back := lc.order.Back(); back != nil; back = lc.order.Back() {
+		user := back.Value.(*listCacheUser)
+		if lc.order.Len() <= lc.size && now.Sub(user.storedAt) <= lc.ttl {
+			return
+		}
+		lc.order.Remove(back)
+		delete(lc.entries, user.userID)
+	}
+}
+
+// get returns the cached list for userID and variant if it is within the TTL.
+func (lc *listCache) get(userID, variant string) ([]models.Todo, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	elem, ok := lc.entries[userID]
+	if !ok {
+		return nil, false
+	}
+	user := elem.Value.(*listCacheUser)
+	entry, ok := user.lists[variant]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.storedAt) > lc.ttl {
+		delete(user.lists, variant)
+		return nil, false
+	}
+	lc.order.MoveToFront(elem)
+	return entry.todos, true
+}
+
+// invalidate drops every cached list for userID after one of their todos changed.
+func (lc *listCache) invalidate(userID string) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if elem, ok := lc.entries[userID]; ok {
+		lc.order.Remove(elem)
+		delete(lc.entries, userID)
+	}
+}
+
+// todoListVariant names the list a GetTodos request asks for by its filter
+// and sort parameters alone, in a fixed order, so the cache holds one entry
+// per distinct list however the query string is spelled.
+func todoListVariant(c *gin.Context, sortName string) string {
+	return url.Values{
+		"archived":        {strconv.FormatBool(c.Query("archived") == "true")},
+		"drafts":          {strconv.FormatBool(c.Query("drafts") == "true")},
+		"overdue":         {strconv.FormatBool(c.Query("overdue") == "true")},
+		"status":          {c.Query("status")},
+		"completed_since": {c.Query("completed_since")},
+		"sort":            {sortName},
+	}.Encode()
+}
+
+// isTransientDBError reports whether err is a connectivity problem worth
+// papering over with cached data rather than a genuine query failure.
+func isTransientDBError(err error) bool {
+	return mongo.IsNetworkError(err) || mongo.IsTimeout(err) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestListCache(t *testing.T) {
+	cache := newListCache(time.Minute, 10)
+	todos := []models.Todo{{Name: "cached"}}
+	cache.store("user", "status=pending", todos)
+
+	if got, ok := cache.get("user", "status=pending"); !ok || len(got) != 1 {
+		t.Fatalf("get = %v, %v; want the stored list", got, ok)
+	}
+	if _, ok := cache.get("user", ""); ok {
+		t.Fatal("another query variant was served from the cache")
+	}
+
+	cache.invalidate("user")
+	if _, ok := cache.get("user", "status=pending"); ok {
+		t.Fatal("the list was served after invalidation")
+	}
+
+	expired := newListCache(time.Minute, 10)
+	expired.store("user", "", todos)
+	user := expired.entries["user"].Value.(*listCacheUser)
+	user.lists[""] = listCacheEntry{todos: todos, storedAt: time.Now().Add(-2 * time.Minute)}
+	if _, ok := expired.get("user", ""); ok {
+		t.Fatal("a list older than the TTL was served")
+	}
+}
+
+func TestListCacheBounds(t *testing.T) {
+	cache := newListCache(time.Minute, 2)
+	cache.store("first", "", nil)
+	cache.store("second", "", nil)
+	cache.get("first", "")
+	cache.store("third", "", nil)
+	if _, ok := cache.get("second", ""); ok {
+		t.Error("the least recently used user was kept past the size")
+	}
+	if _, ok := cache.get("first", ""); !ok {
+		t.Error("a recently served user was evicted")
+	}
+
+	for i := 0; i <= maxCachedListsPerUser; i++ {
+		cache.store("first", fmt.Sprintf("page=%d", i), nil)
+	}
+	if n := len(cache.entries["first"].Value.(*listCacheUser).lists); n != maxCachedListsPerUser {
+		t.Errorf("kept %d lists for one user, want %d", n, maxCachedListsPerUser)
+	}
+}
+
+func TestListCacheSweepsExpiredUsers(t *testing.T) {
+	cache := newListCache(time.Minute, 10)
+	cache.store("idle", "", nil)
+	cache.entries["idle"].Value.(*listCacheUser).storedAt = time.Now().Add(-2 * time.Minute)
+	cache.store("active", "", nil)
+	if _, ok := cache.entries["idle"]; ok || cache.order.Len() != 1 {
+		t.Fatalf("an expired user was not swept: %d users cached", cache.order.Len())
+	}
+}
+
+func TestTodoListVariantIsNormalized(t *testing.T) {
+	variant := func(query string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/todos/u"+query, nil)
+		return todoListVariant(c, "created_desc")
+	}
+	same := []string{"?status=pending&archived=false", "?archived=no&status=pending&cb=123", "?status=pending"}
+	for _, query := range same[1:] {
+		if variant(query) != variant(same[0]) {
+			t.Errorf("%q and %q are cached apart", query, same[0])
+		}
+	}
+	if variant("?status=pending&archived=true") == variant(same[0]) {
+		t.Error("archived and unarchived lists share an entry")
+	}
+}
+
+func TestIsTransientDBError(t *testing.T) {
+	if !isTransientDBError(fmt.Errorf("find: %w", context.DeadlineExceeded)) {
+		t.Error("a deadline is not transient")
+	}
+	if isTransientDBError(errors.New("bad query")) {
+		t.Error("a query error is transient")
+	}
+}
+
+// networkErrorResponse is a mocked reply failing with a network error.
+func networkErrorResponse() bson.D {
+	return mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 6, Name: "HostUnreachable", Message: "connection reset", Labels: []string{"NetworkError"}})
+}
+
+func TestListServedStaleOnTransientError(t *testing.T) {
+	user := newTestUser(t, "")
+	list := testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex(), cookie: sessionCookie(t, user)}
+	todo := models.Todo{ID: primitive.NewObjectID(), Name: "cached", Status: statusPending, UserID: user.ID}
+
+	withMockDB(t, "stale", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(todo), networkErrorResponse())
+		if w := serve(GetTodos, list); w.Code != http.StatusOK {
+			t.Fatalf("first list: status = %d, body %s", w.Code, w.Body)
+		}
+
+		w := serve(GetTodos, list)
+		if w.Code != http.StatusOK || w.Header().Get("Warning") != staleWarning {
+			t.Fatalf("got %d with Warning %q, want the cached list", w.Code, w.Header().Get("Warning"))
+		}
+		var todos []models.Todo
+		decodeBody(t, w, &todos)
+		if len(todos) != 1 || todos[0].ID != todo.ID {
+			t.Fatalf("served %v, want the cached list", todos)
+		}
+	})
+}
+
+func TestWriteInvalidatesCachedList(t *testing.T) {
+	user := newTestUser(t, "")
+	list := testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex(), cookie: sessionCookie(t, user)}
+
+	withMockDB(t, "invalidate", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			cursorResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			networkErrorResponse(),
+		)
+		if w := serve(GetTodos, list); w.Code != http.StatusOK {
+			t.Fatalf("first list: status = %d, body %s", w.Code, w.Body)
+		}
+		archive := testRequest{method: http.MethodPost, route: "/todos/:id/archive", path: "/todos/" + id.Hex() + "/archive", cookie: sessionCookie(t, user)}
+		if w := serve(ArchiveTodo, archive); w.Code != http.StatusOK {
+			t.Fatalf("archive: status = %d, body %s", w.Code, w.Body)
+		}
+
+		if w := serve(GetTodos, list); w.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500 once the cached list was invalidated", w.Code)
+		}
+	})
+}
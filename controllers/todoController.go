@@ -3,34 +3,95 @@ package controller
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jeffthorne/tasky/auth"
 	"github.com/jeffthorne/tasky/database"
 	"github.com/jeffthorne/tasky/models"
+	"github.com/jeffthorne/tasky/webhook"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var todoCollection *mongo.Collection = database.OpenCollection(database.Client, "todos")
+const (
+	statusPending   = models.StatusPending
+	statusCompleted = models.StatusCompleted
 
+	priorityLow    = models.PriorityLow
+	priorityMedium = models.PriorityMedium
+	priorityHigh   = models.PriorityHigh
+
+	maxNotesLength = models.MaxNotesLength
+)
+
+// maxBatchGetIDs caps the todos one batch-get request can fetch.
+const maxBatchGetIDs = 100
+
+func init() {
+	// Short ids must be unique, but todos created before they existed have none
+	ensureIndex("todos", mongo.IndexModel{
+		Keys: bson.D{{Key: "short_id", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"short_id": bson.M{"$exists": true}}),
+	})
+	// Concurrent unique=true creates of the same text must agree on one todo
+	ensureIndex("todos", mongo.IndexModel{
+		Keys: bson.D{{Key: "userid", Value: 1}, {Key: "unique_key", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"unique_key": bson.M{"$exists": true}}),
+	})
+}
+
+// GetTodo returns one of the session user's todos by id or short id, with
+// an ETag for conditional requests. Other users' todos are reported as not
+// found. It also serves HEAD.
 func GetTodo(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
 	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+	ctx = txnContext(c, ctx)
 
-	id := c.Param("id")
-	objId, _ := primitive.ObjectIDFromHex(id)
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	filter, ok := todoIDParam(c, "id")
+	if !ok {
+		return
+	}
+	filter["userid"] = ownerMatch(owner)
 
 	var todo models.Todo
-	err := todoCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&todo)
+	err := todosFor(c).FindOne(ctx, filter).Decode(&todo)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error ": err.Error()})
+		respondInternalError(c, err)
+		return
+	}
+	todos := []models.Todo{todo}
+	if err := markBlocked(ctx, todosFor(c), todos); err != nil {
+		respondInternalError(c, err)
+		return
 	}
 
-	defer cancel()
-	c.JSON(http.StatusOK, todo)
+	respondCacheable(c, todos[0])
 }
 
 func ClearAll(c *gin.Context) {
@@ -40,15 +101,22 @@ func ClearAll(c *gin.Context) {
 	}
 
 	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	userid := c.Param("userid")
-	_, err := todoCollection.DeleteMany(ctx, bson.M{"userid": userid})
+	defer cancel()
+	ctx = txnContext(c, ctx)
+	// The segment holds a user id; it is named id to share the DELETE route
+	// tree with the per-todo routes
+	userid, ok := paramOwner(c, "id")
+	if !ok {
+		return
+	}
+	_, err := todosFor(c).DeleteMany(ctx, bson.M{"userid": ownerMatch(userid)})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondInternalError(c, err)
 		return
 	}
+	todosChanged(c, userid.Hex())
 
-	defer cancel()
 	c.JSON(http.StatusOK, gin.H{"success": "All todos deleted."})
 
 }
@@ -59,9 +127,49 @@ func GetTodos(c *gin.Context) {
 		return
 	}
 	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	userid := c.Param("userid")
-	findResult, err := todoCollection.Find(ctx, bson.M{"userid": userid})
+	defer cancel()
+	ctx = txnContext(c, ctx)
+	userid, ok := paramOwner(c, "userid")
+	if !ok {
+		return
+	}
+	filter, ok := todoListFilter(c, userid)
+	if !ok {
+		return
+	}
+
+	// Paginated requests get an envelope; the plain array stays the default
+	if wantsCursorPage(c) {
+		if c.Query("sort") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort cannot be combined with cursor pagination"})
+			return
+		}
+		listTodoCursorPage(ctx, c, todosForRead(c, userid.Hex()), filter)
+		return
+	}
+
+	// Notes can be large, so they are only returned by the detail endpoint.
+	// Pinned todos come first whatever the sort
+	sortName := c.Query("sort")
+	if sortName == "" {
+		sortName = defaultTodoSort()
+	}
+	order, ok := todoSorts[sortName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be created_asc, created_desc or order_asc"})
+		return
+	}
+	findOptions := options.Find().
+		SetProjection(bson.M{"notes": 0}).
+		SetSort(append(bson.D{{Key: "pinned", Value: -1}}, order...))
+	variant := todoListVariant(c, sortName)
+	findResult, err := todosForRead(c, userid.Hex()).Find(ctx, filter, findOptions)
 	if err != nil {
+		if cached, ok := todoListCache.get(tenantScoped(c, userid.Hex()), variant); ok && isTransientDBError(err) {
+			c.Header("Warning", staleWarning)
+			c.JSON(http.StatusOK, cached)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"FindError": err.Error()})
 		return
 	}
@@ -76,7 +184,11 @@ func GetTodos(c *gin.Context) {
 		}
 		todos = append(todos, todo)
 	}
-	defer cancel()
+	if err := markBlocked(ctx, todosForRead(c, userid.Hex()), todos); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todoListCache.store(tenantScoped(c, userid.Hex()), variant, todos)
 
 	c.JSON(http.StatusOK, todos)
 }
@@ -87,72 +199,1012 @@ func DeleteTodo(c *gin.Context) {
 		return
 	}
 	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+	ctx = txnContext(c, ctx)
 
 	id := c.Param("id")
-	userid := c.Param("userid")
-	objId, _ := primitive.ObjectIDFromHex(id)
-	deleteResult, err := todoCollection.DeleteOne(ctx, bson.M{"_id": objId, "userid": userid})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	userid, ok := paramOwner(c, "userid")
+	if !ok {
 		return
 	}
-	if deleteResult.DeletedCount == 0 {
+	filter, ok := todoIDParam(c, "id")
+	if !ok {
+		return
+	}
+	filter["userid"] = ownerMatch(userid)
+	var deleted models.Todo
+	err := todosFor(c).FindOneAndDelete(ctx, filter).Decode(&deleted)
+	if err == mongo.ErrNoDocuments {
 		msg := fmt.Sprintf("No todo with id : %v was found, no deletion occurred.", id)
 		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
-	defer cancel()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todosChanged(c, userid.Hex())
+	dispatchTodoEvent(c, userid, webhook.TodoDeleted, deleted)
 
 	msg := fmt.Sprintf("todo with id : %v was deleted successfully.", id)
 	c.JSON(http.StatusOK, gin.H{"success": msg})
 
 }
 
+// UpdateTodo is the frontend's edit of one of the session user's todos,
+// named by ID in the body. It sets the name and, when given, the status,
+// priority, tags and due_date; every other field has its own endpoint.
 func UpdateTodo(c *gin.Context) {
 	session := auth.ValidateSessionAPI(c)
 	if !session {
 		return
 	}
+
+	var body struct {
+		ID       string           `json:"ID"`
+		Name     string           `json:"name"`
+		Status   string           `json:"status"`
+		Priority *string          `json:"priority"`
+		Tags     []string         `json:"tags"`
+		DueDate  *models.JSONTime `json:"due_date"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	filter, ok := todoIDFilter(body.ID)
+	if !ok {
+		respondInvalidID(c, "todo")
+		return
+	}
+	filter["userid"] = ownerMatch(owner)
+
+	// The fields follow the same rules as when the todo was created
+	input := models.TodoInput{Name: body.Name, Status: body.Status, Tags: body.Tags}
+	if body.Priority != nil {
+		input.Priority = *body.Priority
+	}
+	if err := validateImportItem(input, importLimitsFromEnv()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	set := bson.M{"name": body.Name, "updated_at": models.Now()}
+	if body.Status != "" {
+		set["status"] = body.Status
+	}
+	if body.Priority != nil {
+		set["priority"] = *body.Priority
+	}
+	if body.Tags != nil {
+		set["tags"] = body.Tags
+	}
+	if body.DueDate != nil {
+		set["due_date"] = *body.DueDate
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	completed, err := stampCompletion(ctx, todosFor(c), filter, body.Status)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	var todo models.Todo
+	// A renamed todo no longer holds its unique=true text
+	update := bson.M{"$set": set, "$unset": bson.M{"unique_key": ""}, "$inc": bson.M{"version": 1}}
+	err = todosFor(c).FindOneAndUpdate(ctx, filter, completionUpdate(update, body.Status),
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&todo)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todosChanged(c, owner.Hex())
+	if completed {
+		dispatchTodoEvent(c, owner, webhook.TodoCompleted, todo)
+	}
+
+	c.JSON(http.StatusOK, todo)
+}
+
+func AddTodo(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
 	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	var newTodo models.Todo
-	if err := c.BindJSON(&newTodo); err != nil {
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	var input models.TodoInput
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	owner, ok := paramOwner(c, "userid")
+	if !ok {
+		return
+	}
+	todo, err := models.NewTodo(owner, input)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err := todoCollection.UpdateOne(ctx, bson.M{"_id": newTodo.ID, "userid": newTodo.UserID}, bson.M{"$set": newTodo})
+	unique := c.Query("unique") == "true"
+	if unique {
+		var existing models.Todo
+		err := todosFor(c).FindOne(ctx, sameTextFilter(owner, todo.Name)).Decode(&existing)
+		if err == nil {
+			c.JSON(http.StatusOK, gin.H{"insertedId": existing.ID, "shortId": existing.ShortID, "existing": true})
+			return
+		}
+		if err != mongo.ErrNoDocuments {
+			respondInternalError(c, err)
+			return
+		}
+	}
+
+	order, err := nextTodoOrder(ctx, todosFor(c), todo.UserID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		fmt.Println(err.Error())
+		respondInternalError(c, err)
 		return
 	}
+	todo.Order = order
 
+	if unique {
+		existing, err := insertUniqueTodo(ctx, todosFor(c), todo)
+		if database.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a todo with the same text is being created", "code": "DUPLICATE_TODO"})
+			return
+		}
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		if existing != nil {
+			c.JSON(http.StatusOK, gin.H{"insertedId": existing.ID, "shortId": existing.ShortID, "existing": true})
+			return
+		}
+	} else if err := insertWithShortID(ctx, todosFor(c), todo); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todosChanged(c, todo.UserID.Hex())
+	dispatchTodoEvent(c, todo.UserID, webhook.TodoCreated, *todo)
+	c.JSON(http.StatusOK, gin.H{"insertedId": todo.ID, "shortId": todo.ShortID})
+}
+
+// sameTextFilter matches the user's unarchived todos whose name equals name
+// ignoring case, surrounding whitespace and runs of inner whitespace.
+func sameTextFilter(owner primitive.ObjectID, name string) bson.M {
+	words := strings.Fields(name)
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	pattern := `^\s*` + strings.Join(words, `\s+`) + `\s*$`
+	return bson.M{
+		"userid":   ownerMatch(owner),
+		"archived": bson.M{"$ne": true},
+		"name":     primitive.Regex{Pattern: pattern, Options: "i"},
+	}
+}
+
+// uniqueTextKey normalizes name the way sameTextFilter compares it.
+func uniqueTextKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// insertUniqueTodo inserts todo unless the owner has a todo created through
+// a unique create with the same text, which it returns instead. The unique
+// index on (userid, unique_key) keeps concurrent creates from both inserting;
+// a duplicate key error that outlasts the retries is returned.
+func insertUniqueTodo(ctx context.Context, todos *mongo.Collection, todo *models.Todo) (*models.Todo, error) {
+	todo.UniqueKey = uniqueTextKey(todo.Name)
+	filter := bson.M{"userid": todo.UserID, "unique_key": todo.UniqueKey}
+	upsert := options.FindOneAndUpdate().SetUpsert(true)
+
+	var err error
+	for attempt := 0; attempt < maxShortIDAttempts; attempt++ {
+		if todo.ShortID, err = newShortID(); err != nil {
+			return nil, err
+		}
+		// A collision on either index is retried: a new short id, or the
+		// todo that won the race, which the next attempt finds
+		var existing models.Todo
+		err = todos.FindOneAndUpdate(ctx, filter, bson.M{"$setOnInsert": todo}, upsert).Decode(&existing)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		if err == nil {
+			return &existing, nil
+		}
+		if !database.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// ReorderTodos sets the manual order of the session user's todos to the
+// order of the ids in the request. Todos belonging to other users are ignored.
+func ReorderTodos(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if !bindGuardedJSON(c, &body) {
+		return
+	}
+	if len(body.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids must list at least one todo"})
+		return
+	}
+
+	userid, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	writes := make([]mongo.WriteModel, 0, len(body.IDs))
+	for i, id := range body.IDs {
+		filter, ok := todoIDFilter(id)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid todo id: %v", id)})
+			return
+		}
+		filter["userid"] = ownerMatch(userid)
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(bson.M{"$set": bson.M{"order": i + 1, "updated_at": models.Now()}}))
+	}
+
+	ctx, cancel := database.GetContext()
 	defer cancel()
+	ctx = txnContext(c, ctx)
 
-	c.JSON(http.StatusOK, newTodo)
+	bulkResult, err := todosFor(c).BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todosChanged(c, userid.Hex())
+
+	c.JSON(http.StatusOK, gin.H{"reordered": bulkResult.MatchedCount})
 }
 
-func AddTodo(c *gin.Context) {
+// BatchDeleteTodos deletes several of the session user's todos. By default
+// the batch is all-or-nothing: if any id is invalid or not owned, nothing is
+// deleted. With atomic=false each id is processed independently and the
+// response reports a status per item.
+func BatchDeleteTodos(c *gin.Context) {
 	session := auth.ValidateSessionAPI(c)
 	if !session {
 		return
 	}
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+
+	atomic, ok := atomicMode(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if !bindGuardedJSON(c, &body) {
+		return
+	}
+	if len(body.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids must list at least one todo"})
+		return
+	}
+
+	userid, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	defer todosChanged(c, userid.Hex())
+
+	if !atomic {
+		results := make([]itemResult, len(body.IDs))
+		for i, id := range body.IDs {
+			results[i] = itemResult{Index: i, Status: http.StatusOK}
+
+			filter, ok := todoIDFilter(id)
+			if !ok {
+				results[i].Status, results[i].Error = http.StatusBadRequest, "invalid todo id"
+				continue
+			}
+			filter["userid"] = ownerMatch(userid)
+
+			deleteResult, err := todosFor(c).DeleteOne(ctx, filter)
+			if err != nil {
+				results[i].Status, results[i].Error = http.StatusInternalServerError, err.Error()
+			} else if deleteResult.DeletedCount == 0 {
+				results[i].Status, results[i].Error = http.StatusNotFound, "todo not found"
+			}
+		}
+		respondMultiStatus(c, results)
+		return
+	}
+
+	filters := make(bson.A, 0, len(body.IDs))
+	seen := map[string]bool{}
+	for _, id := range body.IDs {
+		filter, ok := todoIDFilter(id)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid todo id: %v", id)})
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			filters = append(filters, filter)
+		}
+	}
+	batchFilter := bson.M{"userid": ownerMatch(userid), "$or": filters}
+
+	// Check every todo exists before deleting any, so a bad id leaves the
+	// batch untouched
+	count, err := todosFor(c).CountDocuments(ctx, batchFilter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if count != int64(len(filters)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "some todos were not found, no deletion occurred."})
+		return
+	}
+
+	deleteResult, err := todosFor(c).DeleteMany(ctx, batchFilter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleteResult.DeletedCount})
+}
+
+// BatchGetTodos fetches several of the session user's todos in one query, so
+// a board does not need a round trip per todo. Todos come back in the order
+// their ids were requested; ids that are unknown or belong to another user
+// are left out.
+func BatchGetTodos(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if !bindGuardedJSON(c, &body) {
+		return
+	}
+	if len(body.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids must list at least one todo"})
+		return
+	}
+	if len(body.IDs) > maxBatchGetIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d ids can be fetched at once", maxBatchGetIDs)})
+		return
+	}
+
+	userid, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	objectIDs := bson.A{}
+	shortIDs := bson.A{}
+	for _, id := range body.IDs {
+		if objId, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objId)
+		} else if isShortID(id) {
+			shortIDs = append(shortIDs, id)
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid todo id: %v", id)})
+			return
+		}
+	}
+	filter := bson.M{
+		"userid": ownerMatch(userid),
+		"$or": bson.A{
+			bson.M{"_id": bson.M{"$in": objectIDs}},
+			bson.M{"short_id": bson.M{"$in": shortIDs}},
+		},
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	cursor, err := todosFor(c).Find(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	var found []models.Todo
+	if err := cursor.All(ctx, &found); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"todos": orderTodosByID(found, body.IDs)})
+}
+
+// orderTodosByID arranges todos in the order of ids, which may mix ObjectIDs
+// and short ids. Each todo appears once, at its first requested position.
+func orderTodosByID(todos []models.Todo, ids []string) []models.Todo {
+	byID := make(map[string]models.Todo, 2*len(todos))
+	for _, todo := range todos {
+		byID[todo.ID.Hex()] = todo
+		if todo.ShortID != "" {
+			byID[todo.ShortID] = todo
+		}
+	}
+
+	ordered := make([]models.Todo, 0, len(todos))
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range ids {
+		todo, ok := byID[id]
+		if !ok || seen[todo.ID] {
+			continue
+		}
+		seen[todo.ID] = true
+		ordered = append(ordered, todo)
+	}
+	return ordered
+}
+
+// nextTodoOrder returns the order value that places a new todo last in
+// userid's manual ordering.
+func nextTodoOrder(ctx context.Context, todos *mongo.Collection, owner primitive.ObjectID) (int, error) {
+	var last models.Todo
+	findOptions := options.FindOne().
+		SetSort(bson.D{{Key: "order", Value: -1}}).
+		SetProjection(bson.M{"order": 1})
+	err := todos.FindOne(ctx, bson.M{"userid": ownerMatch(owner)}, findOptions).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return last.Order + 1, nil
+}
+
+// CountTodos returns how many of the session user's todos match the list
+// filters, letting clients render a badge without fetching the list.
+func CountTodos(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	filter, ok := todoListFilter(c, owner)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	count, err := todosForRead(c, owner.Hex()).CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"count": count})
+}
+
+// todoSorts are the list orders clients may request with sort. Each ends
+// with _id so that todos with equal keys always come back in the same order.
+var todoSorts = map[string]bson.D{
+	"created_asc":  {{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}},
+	"created_desc": {{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	"order_asc":    {{Key: "order", Value: 1}, {Key: "_id", Value: 1}},
+}
+
+// defaultTodoSortName is the list order used when neither the request nor
+// DEFAULT_TODO_SORT names one.
+const defaultTodoSortName = "created_desc"
+
+// defaultTodoSort reads DEFAULT_TODO_SORT, the list order applied when a
+// request has no sort parameter.
+func defaultTodoSort() string {
+	value := os.Getenv("DEFAULT_TODO_SORT")
+	if value == "" {
+		return defaultTodoSortName
+	}
+	if _, ok := todoSorts[value]; !ok {
+		log.Printf("Invalid DEFAULT_TODO_SORT %q, using %s", value, defaultTodoSortName)
+		return defaultTodoSortName
+	}
+	return value
+}
+
+// todoListFilter builds the query for owner's todos from the list query
+// parameters. It responds with 400 and returns false for invalid values.
+func todoListFilter(c *gin.Context, owner primitive.ObjectID) (bson.M, bool) {
+	filter := bson.M{"userid": ownerMatch(owner)}
+
+	// Archived todos are hidden from the default list and only shown on request
+	if c.Query("archived") == "true" {
+		filter["archived"] = true
+	} else {
+		filter["archived"] = bson.M{"$ne": true}
+	}
+
+	// Drafts are likewise only shown on request
+	if c.Query("drafts") == "true" {
+		filter["draft"] = true
+	} else {
+		filter["draft"] = bson.M{"$ne": true}
+	}
+
+	if status := c.Query("status"); status != "" {
+		if status != statusPending && status != statusCompleted {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending or completed"})
+			return nil, false
+		}
+		filter["status"] = status
+	}
+
+	if since := c.Query("completed_since"); since != "" {
+		t, err := parseSearchTime(since, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "completed_since must be a date (YYYY-MM-DD) or an RFC 3339 time"})
+			return nil, false
+		}
+		filter["completed_at"] = bson.M{"$gte": t}
+	}
+
+	// Matches models.Todo.IsOverdue, combined with any status filter
+	if c.Query("overdue") == "true" {
+		filter["due_date"] = bson.M{"$lt": time.Now()}
+		filter["$and"] = bson.A{bson.M{"status": bson.M{"$ne": statusCompleted}}}
+	}
+
+	return filter, true
+}
+
+// PatchTodo changes the name, status or priority of a todo owned by the
+// session user. Fields left out of the body keep their value. Completing the
+// todo records completed_at and reopening it clears the timestamp.
+func PatchTodo(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name     *string `json:"name"`
+		Status   *string `json:"status"`
+		Priority *string `json:"priority"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	set := bson.M{"updated_at": models.Now()}
+	if body.Name != nil {
+		if err := validateTodoName(*body.Name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set["name"] = *body.Name
+	}
+	status := ""
+	if body.Status != nil {
+		status = *body.Status
+		if status != statusPending && status != statusCompleted {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending or completed"})
+			return
+		}
+		set["status"] = status
+	}
+	if body.Priority != nil {
+		if !validPriority(*body.Priority) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be low, medium or high"})
+			return
+		}
+		set["priority"] = *body.Priority
+	}
+	if len(set) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must set name, status or priority"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	completed, err := stampCompletion(ctx, todosFor(c), filter, status)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
 
 	var todo models.Todo
-	if err := c.BindJSON(&todo); err != nil {
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if body.Name != nil {
+		update["$unset"] = bson.M{"unique_key": ""}
+	}
+	err = todosFor(c).FindOneAndUpdate(ctx, filter, completionUpdate(update, status),
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&todo)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todosChanged(c, todo.UserID.Hex())
+	if completed {
+		dispatchTodoEvent(c, todo.UserID, webhook.TodoCompleted, todo)
+	}
+
+	c.JSON(http.StatusOK, todo)
+}
+
+// ReplaceTodo replaces the editable fields of a todo owned by the session
+// user with the body: name, status, priority, tags, due_date and notes.
+// Unlike PatchTodo, fields left out are reset to their defaults. The id,
+// owner, short id and creation time never change.
+func ReplaceTodo(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	// A replacement has the same shape and limits as an imported todo
+	var body importItem
+	if !bindJSON(c, &body) {
+		return
+	}
+	if err := validateImportItem(body, importLimitsFromEnv()); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if body.Status == "" {
+		body.Status = statusPending
+	}
+
+	set := bson.M{"name": body.Name, "status": body.Status, "updated_at": models.Now()}
+	// A renamed todo no longer holds its unique=true text
+	unset := bson.M{"unique_key": ""}
+	for field, value := range map[string]interface{}{
+		"priority": body.Priority,
+		"notes":    body.Notes,
+	} {
+		if value == "" {
+			unset[field] = ""
+		} else {
+			set[field] = value
+		}
+	}
+	if len(body.Tags) == 0 {
+		unset["tags"] = ""
+	} else {
+		set["tags"] = body.Tags
+	}
+	if body.DueDate.IsZero() {
+		unset["due_date"] = ""
+	} else {
+		set["due_date"] = body.DueDate
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	completed, err := stampCompletion(ctx, todosFor(c), filter, body.Status)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	var todo models.Todo
+	update := bson.M{"$set": set, "$unset": unset, "$inc": bson.M{"version": 1}}
+	err = todosFor(c).FindOneAndUpdate(ctx, filter, completionUpdate(update, body.Status),
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&todo)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	todosChanged(c, todo.UserID.Hex())
+	if completed {
+		dispatchTodoEvent(c, todo.UserID, webhook.TodoCompleted, todo)
+	}
+
+	c.JSON(http.StatusOK, todo)
+}
+
+// stampCompletion sets completed_at on the todo matched by filter when status
+// completes it, reporting whether the todo was not completed before. It must
+// run before the status is written, since only a todo that is not yet
+// completed gets a new timestamp.
+func stampCompletion(ctx context.Context, todos *mongo.Collection, filter bson.M, status string) (bool, error) {
+	if status != statusCompleted {
+		return false, nil
+	}
+	transition := bson.M{"status": bson.M{"$ne": statusCompleted}}
+	for key, value := range filter {
+		transition[key] = value
+	}
+	result, err := todos.UpdateOne(ctx, transition, bson.M{"$set": bson.M{"completed_at": models.Now()}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// completionUpdate adds clearing completed_at to update when status reopens
+// the todo.
+func completionUpdate(update bson.M, status string) bson.M {
+	if status == statusPending {
+		unset, ok := update["$unset"].(bson.M)
+		if !ok {
+			unset = bson.M{}
+			update["$unset"] = unset
+		}
+		unset["completed_at"] = ""
+	}
+	return update
+}
+
+// UpdateNotes sets the long-form notes of a todo owned by the session user.
+func UpdateNotes(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Notes string `json:"notes"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	if utf8.RuneCountInString(body.Notes) > maxNotesLength {
+		msg := fmt.Sprintf("notes must be at most %d characters", maxNotesLength)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	updateResult, err := todosFor(c).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"notes": body.Notes, "updated_at": models.Now()}})
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if updateResult.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+	todosChanged(c, sessionUserID(c))
+
+	c.JSON(http.StatusOK, gin.H{"success": "notes updated"})
+}
+
+// ArchiveTodo hides a todo owned by the session user from the default list.
+func ArchiveTodo(c *gin.Context) {
+	setArchived(c, true)
+}
+
+// UnarchiveTodo returns an archived todo to the default list.
+func UnarchiveTodo(c *gin.Context) {
+	setArchived(c, false)
+}
+
+func setArchived(c *gin.Context, archived bool) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	// Retention windows count from archived_at, which unarchiving clears. An
+	// archived todo no longer counts for unique=true creates.
+	update := bson.M{
+		"$set":   bson.M{"archived": archived, "updated_at": models.Now()},
+		"$unset": bson.M{"archived_at": ""},
+	}
+	if archived {
+		update = bson.M{
+			"$set":   bson.M{"archived": true, "archived_at": models.Now(), "updated_at": models.Now()},
+			"$unset": bson.M{"unique_key": ""},
+		}
+	}
+	updateResult, err := todosFor(c).UpdateOne(ctx, filter, update)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if updateResult.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+	todosChanged(c, sessionUserID(c))
+
+	c.JSON(http.StatusOK, gin.H{"archived": archived})
+}
 
-	todo.ID = primitive.NewObjectID()
-	todo.UserID = c.Param("userid")
+// PinTodo keeps a todo owned by the session user at the top of the list.
+func PinTodo(c *gin.Context) {
+	setPinned(c, true)
+}
+
+// UnpinTodo returns a pinned todo to its normal place in the list.
+func UnpinTodo(c *gin.Context) {
+	setPinned(c, false)
+}
+
+func setPinned(c *gin.Context, pinned bool) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
 
-	_, err := todoCollection.InsertOne(ctx, todo)
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	update := bson.M{"$set": bson.M{"pinned": true, "updated_at": models.Now()}}
+	if !pinned {
+		update = bson.M{"$set": bson.M{"updated_at": models.Now()}, "$unset": bson.M{"pinned": ""}}
+	}
+	updateResult, err := todosFor(c).UpdateOne(ctx, filter, update)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondInternalError(c, err)
+		return
+	}
+	if updateResult.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+	todosChanged(c, sessionUserID(c))
+
+	c.JSON(http.StatusOK, gin.H{"pinned": pinned})
+}
+
+// PublishTodo turns a draft owned by the session user into a regular todo.
+func PublishTodo(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	filter, ok := ownedTodoFilter(c)
+	if !ok {
 		return
 	}
+
+	ctx, cancel := database.GetContext()
 	defer cancel()
-	c.JSON(http.StatusOK, gin.H{"insertedId": todo.ID})
+	ctx = txnContext(c, ctx)
+
+	update := bson.M{"$set": bson.M{"updated_at": models.Now()}, "$unset": bson.M{"draft": ""}}
+	updateResult, err := todosFor(c).UpdateOne(ctx, filter, update)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if updateResult.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+	todosChanged(c, sessionUserID(c))
+
+	c.JSON(http.StatusOK, gin.H{"draft": false})
+}
+
+// ownedTodoFilter builds a filter matching the todo in the :id path parameter
+// that belongs to the session user. It responds with 400 and returns false when
+// the id is malformed.
+func ownedTodoFilter(c *gin.Context) (bson.M, bool) {
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return nil, false
+	}
+	filter, ok := todoIDParam(c, "id")
+	if !ok {
+		return nil, false
+	}
+	filter["userid"] = ownerMatch(owner)
+	return filter, true
+}
+
+// todoIDFilter matches a todo by either its ObjectID hex or its short id.
+func todoIDFilter(id string) (bson.M, bool) {
+	if objId, err := primitive.ObjectIDFromHex(id); err == nil {
+		return bson.M{"_id": objId}, true
+	}
+	if isShortID(id) {
+		return bson.M{"short_id": id}, true
+	}
+	return nil, false
+}
+
+// insertWithShortID assigns todo a fresh short id and inserts it, generating a
+// new id whenever the unique index reports a collision.
+func insertWithShortID(ctx context.Context, todos *mongo.Collection, todo *models.Todo) error {
+	for attempt := 0; attempt < maxShortIDAttempts; attempt++ {
+		shortID, err := newShortID()
+		if err != nil {
+			return err
+		}
+		todo.ShortID = shortID
+
+		_, err = todos.InsertOne(ctx, todo)
+		if !database.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("could not generate a unique short id after %d attempts", maxShortIDAttempts)
+}
+
+// validPriority reports whether priority is empty or a known priority value.
+func validPriority(priority string) bool {
+	return models.ValidPriority(priority)
 }
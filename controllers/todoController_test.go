@@ -0,0 +1,905 @@
+package controller
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetTodoRequiresSession(t *testing.T) {
+	w := serve(GetTodo, testRequest{method: http.MethodGet, route: "/todo/:id", path: "/todo/" + primitive.NewObjectID().Hex()})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+}
+
+func TestGetTodoOfAnotherUserIsNotFound(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "other owner", func(mt *mtest.T) {
+		// The owner is part of the filter, so another user's todo matches nothing
+		mt.AddMockResponses(cursorResponse())
+		w := serve(GetTodo, testRequest{
+			method: http.MethodGet, route: "/todo/:id",
+			path:   "/todo/" + primitive.NewObjectID().Hex(),
+			cookie: sessionCookie(t, user),
+		})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", w.Code)
+		}
+		filter := commandFilter(t, mt, "find")
+		if _, err := filter.LookupErr("userid"); err != nil {
+			t.Fatalf("filter %v is not scoped to the owner", filter)
+		}
+	})
+}
+
+func TestNotesRoundTripOnDetailEndpoint(t *testing.T) {
+	user := newTestUser(t, "")
+	id := primitive.NewObjectID()
+	notes := strings.Repeat("long form ", 50)
+
+	withMockDB(t, "set notes", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		w := serve(UpdateNotes, testRequest{
+			method: http.MethodPut, route: "/todos/:id/notes", path: "/todos/" + id.Hex() + "/notes",
+			body: `{"notes": "` + notes + `"}`, cookie: sessionCookie(t, user),
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		evt := mt.GetStartedEvent()
+		set := evt.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set")
+		if got := set.Document().Lookup("notes").StringValue(); got != notes {
+			t.Fatalf("stored notes = %q", got)
+		}
+	})
+
+	withMockDB(t, "get notes", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(models.Todo{ID: id, Name: "write", Status: statusPending, UserID: user.ID, Notes: notes}))
+		w := serve(GetTodo, testRequest{method: http.MethodGet, route: "/todo/:id", path: "/todo/" + id.Hex(), cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var todo models.Todo
+		decodeBody(t, w, &todo)
+		if todo.Notes != notes {
+			t.Fatalf("notes = %q, want the stored notes", todo.Notes)
+		}
+	})
+}
+
+func TestNotesTooLongAreRejected(t *testing.T) {
+	user := newTestUser(t, "")
+	w := serve(UpdateNotes, testRequest{
+		method: http.MethodPut, route: "/todos/:id/notes", path: "/todos/" + primitive.NewObjectID().Hex() + "/notes",
+		body: `{"notes": "` + strings.Repeat("x", maxNotesLength+1) + `"}`, cookie: sessionCookie(t, user),
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestListLeavesOutNotes(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "list", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(models.Todo{ID: primitive.NewObjectID(), Name: "write", Status: statusPending, UserID: user.ID}))
+		w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex(), cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		evt := mt.GetStartedEvent()
+		if projection, err := evt.Command.LookupErr("projection", "notes"); err != nil || projection.AsInt64() != 0 {
+			t.Fatalf("list projection does not exclude notes: %v", evt.Command)
+		}
+		if strings.Contains(w.Body.String(), `"notes"`) {
+			t.Fatalf("list response contains notes: %s", w.Body)
+		}
+	})
+}
+
+func TestArchiveTodo(t *testing.T) {
+	user := newTestUser(t, "")
+	id := primitive.NewObjectID()
+	for _, tc := range []struct {
+		action  string
+		handler gin.HandlerFunc
+		want    bool
+	}{
+		{"archive", ArchiveTodo, true},
+		{"unarchive", UnarchiveTodo, false},
+	} {
+		action, handler, want := tc.action, tc.handler, tc.want
+		withMockDB(t, action, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+			w := serve(handler, testRequest{method: http.MethodPost, route: "/todos/:id/" + action, path: "/todos/" + id.Hex() + "/" + action, cookie: sessionCookie(t, user)})
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: status = %d, body %s", action, w.Code, w.Body)
+			}
+			evt := mt.GetStartedEvent()
+			statement := evt.Command.Lookup("updates").Array().Index(0).Value().Document()
+			if archived := statement.Lookup("u", "$set", "archived").Boolean(); archived != want {
+				t.Fatalf("%s set archived to %v", action, archived)
+			}
+			if _, err := statement.LookupErr("q", "userid"); err != nil {
+				t.Fatalf("%s is not scoped to the owner: %v", action, statement)
+			}
+		})
+	}
+}
+
+func TestListShowsArchivedOnlyOnRequest(t *testing.T) {
+	user := newTestUser(t, "")
+	for query, want := range map[string]string{"": `{"$ne": true}`, "?archived=true": "true"} {
+		withMockDB(t, "archived"+query, func(mt *mtest.T) {
+			mt.AddMockResponses(cursorResponse())
+			w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + query, cookie: sessionCookie(t, user)})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if archived := commandFilter(t, mt, "find").Lookup("archived"); archived.String() != want {
+				t.Fatalf("%q: archived filter = %v, want %s", query, archived, want)
+			}
+		})
+	}
+}
+
+func TestCountTodos(t *testing.T) {
+	user := newTestUser(t, "")
+	cases := []struct {
+		query  string
+		status string
+		reply  bson.D
+		want   int64
+	}{
+		{"?status=pending", statusPending, cursorResponse(bson.M{"n": 3}), 3},
+		{"?status=completed", statusCompleted, cursorResponse(bson.M{"n": 2}), 2},
+		{"", "", cursorResponse(bson.M{"n": 5}), 5},
+		// CountDocuments gets no batch at all when nothing matches
+		{"?status=pending", statusPending, cursorResponse(), 0},
+	}
+	for _, tc := range cases {
+		withMockDB(t, "count"+tc.query, func(mt *mtest.T) {
+			mt.AddMockResponses(tc.reply)
+			w := serve(CountTodos, testRequest{method: http.MethodGet, route: "/todos/count", path: "/todos/count" + tc.query, cookie: sessionCookie(t, user)})
+			if w.Code != http.StatusOK {
+				t.Fatalf("%q: status = %d, body %s", tc.query, w.Code, w.Body)
+			}
+			var body struct {
+				Count int64 `json:"count"`
+			}
+			decodeBody(t, w, &body)
+			if body.Count != tc.want {
+				t.Fatalf("%q: count = %d, want %d", tc.query, body.Count, tc.want)
+			}
+
+			match := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+			status, _ := match.Lookup("status").StringValueOK()
+			if status != tc.status {
+				t.Fatalf("%q: counted status %q, want %q", tc.query, status, tc.status)
+			}
+			if _, err := match.LookupErr("userid"); err != nil {
+				t.Fatalf("%q: count is not scoped to the owner", tc.query)
+			}
+		})
+	}
+}
+
+func TestCountTodosRejectsUnknownStatus(t *testing.T) {
+	user := newTestUser(t, "")
+	w := serve(CountTodos, testRequest{method: http.MethodGet, route: "/todos/count", path: "/todos/count?status=maybe", cookie: sessionCookie(t, user)})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestReorderTodosPersistsOrder(t *testing.T) {
+	user := newTestUser(t, "")
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	withMockDB(t, "reorder", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 3}, bson.E{Key: "nModified", Value: 3}))
+		body := `{"ids": ["` + ids[2].Hex() + `", "` + ids[0].Hex() + `", "` + ids[1].Hex() + `"]}`
+		w := serve(ReorderTodos, testRequest{method: http.MethodPost, route: "/todos/reorder", path: "/todos/reorder", body: body, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		updates, _ := mt.GetStartedEvent().Command.Lookup("updates").Array().Values()
+		want := map[primitive.ObjectID]int32{ids[2]: 1, ids[0]: 2, ids[1]: 3}
+		if len(updates) != len(want) {
+			t.Fatalf("sent %d updates, want %d", len(updates), len(want))
+		}
+		for _, update := range updates {
+			statement := update.Document()
+			id := statement.Lookup("q", "_id").ObjectID()
+			if _, err := statement.LookupErr("q", "userid"); err != nil {
+				t.Fatalf("update of %v is not scoped to the owner", id)
+			}
+			if order := statement.Lookup("u", "$set", "order").Int32(); order != want[id] {
+				t.Errorf("todo %v got order %d, want %d", id, order, want[id])
+			}
+		}
+	})
+}
+
+func TestReorderTodosRejectsBadInput(t *testing.T) {
+	user := newTestUser(t, "")
+	for _, body := range []string{`{"ids": []}`, `{"ids": ["not an id"]}`} {
+		w := serve(ReorderTodos, testRequest{method: http.MethodPost, route: "/todos/reorder", path: "/todos/reorder", body: body, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestListHonorsManualOrder(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "order_asc", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + "?sort=order_asc", cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		elements, _ := mt.GetStartedEvent().Command.Lookup("sort").Document().Elements()
+		var keys []string
+		for _, element := range elements {
+			keys = append(keys, element.Key())
+		}
+		if strings.Join(keys, ",") != "pinned,order,_id" {
+			t.Fatalf("sorted by %v, want pinned, order, _id", keys)
+		}
+	})
+}
+
+func TestAddTodoAppendsToManualOrder(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "append", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(bson.M{"_id": primitive.NewObjectID(), "order": 4}),
+			mtest.CreateSuccessResponse(),
+			cursorResponse(), // no webhook configured
+		)
+		w := serve(AddTodo, testRequest{method: http.MethodPost, route: "/todo/:userid", path: "/todo/" + user.ID.Hex(), body: `{"name": "last"}`, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		mt.GetStartedEvent() // the lookup of the current last todo
+		inserted := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if order := inserted.Lookup("order").AsInt64(); order != 5 {
+			t.Fatalf("new todo has order %d, want 5", order)
+		}
+	})
+}
+
+func TestBatchDeleteNonAtomicReportsEachItem(t *testing.T) {
+	user := newTestUser(t, "")
+	owned, missing := primitive.NewObjectID(), primitive.NewObjectID()
+	withMockDB(t, "non-atomic", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		)
+		body := `{"ids": ["` + owned.Hex() + `", "not an id", "` + missing.Hex() + `"]}`
+		w := serve(BatchDeleteTodos, testRequest{method: http.MethodPost, route: "/todos/batch-delete", path: "/todos/batch-delete?atomic=false", body: body, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusMultiStatus {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		var response struct {
+			Results []itemResult `json:"results"`
+		}
+		decodeBody(t, w, &response)
+		want := []int{http.StatusOK, http.StatusBadRequest, http.StatusNotFound}
+		if len(response.Results) != len(want) {
+			t.Fatalf("got %d results, want %d", len(response.Results), len(want))
+		}
+		for i, result := range response.Results {
+			if result.Index != i || result.Status != want[i] {
+				t.Errorf("result %d = %+v, want index %d status %d", i, result, i, want[i])
+			}
+			if (result.Status == http.StatusOK) != (result.Error == "") {
+				t.Errorf("result %d: status %d with error %q", i, result.Status, result.Error)
+			}
+		}
+
+		// The invalid id is skipped without a query
+		for _, id := range []primitive.ObjectID{owned, missing} {
+			if got := commandFilter(t, mt, "delete").Lookup("_id").ObjectID(); got != id {
+				t.Errorf("deleted %v, want %v", got, id)
+			}
+		}
+	})
+}
+
+func TestBatchDeleteIsAtomicByDefault(t *testing.T) {
+	user := newTestUser(t, "")
+	body := `{"ids": ["` + primitive.NewObjectID().Hex() + `", "` + primitive.NewObjectID().Hex() + `"]}`
+	withMockDB(t, "atomic", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"n": 1}))
+		w := serve(BatchDeleteTodos, testRequest{method: http.MethodPost, route: "/todos/batch-delete", path: "/todos/batch-delete", body: body, cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		mt.GetStartedEvent() // the count
+		if evt := mt.GetStartedEvent(); evt != nil {
+			t.Fatalf("sent %s after a todo was not found", evt.CommandName)
+		}
+	})
+}
+
+func TestBatchDeleteRejectsInvalidAtomic(t *testing.T) {
+	user := newTestUser(t, "")
+	w := serve(BatchDeleteTodos, testRequest{method: http.MethodPost, route: "/todos/batch-delete", path: "/todos/batch-delete?atomic=sometimes", body: `{"ids": ["x"]}`, cookie: sessionCookie(t, user)})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
+func TestListOverdueMatchesIsOverdue(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "overdue", func(mt *mtest.T) {
+		late := bson.M{"_id": primitive.NewObjectID(), "name": "late", "userid": user.ID, "status": "pending", "due_date": time.Now().Add(-time.Hour)}
+		mt.AddMockResponses(cursorResponse(late))
+		w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + "?overdue=true", cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"is_overdue":true`) {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		filter := commandFilter(t, mt, "find")
+		if due := filter.Lookup("due_date", "$lt").Time(); time.Since(due) > time.Minute {
+			t.Errorf("due_date bound %v, want now", due)
+		}
+		status := filter.Lookup("$and").Array().Index(0).Value().Document()
+		if got := status.Lookup("status", "$ne").StringValue(); got != statusCompleted {
+			t.Errorf("overdue filter does not leave out completed todos: %v", filter)
+		}
+	})
+}
+
+// addUniqueTodo creates a todo named "Buy milk" with unique=true.
+func addUniqueTodo(t *testing.T, user models.User) (int, map[string]interface{}) {
+	w := serve(AddTodo, testRequest{
+		method: http.MethodPost, route: "/todo/:userid", path: "/todo/" + user.ID.Hex() + "?unique=true",
+		body: `{"name": " buy  MILK "}`, cookie: sessionCookie(t, user),
+	})
+	var body map[string]interface{}
+	decodeBody(t, w, &body)
+	return w.Code, body
+}
+
+func TestUniqueCreateInsertsWithKey(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "insert", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(),
+			cursorResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+		)
+		status, body := addUniqueTodo(t, user)
+		if status != http.StatusOK || body["existing"] != nil {
+			t.Fatalf("got %d %v, want a new todo", status, body)
+		}
+
+		evt := mt.GetStartedEvent()
+		for evt != nil && evt.CommandName != "findAndModify" {
+			evt = mt.GetStartedEvent()
+		}
+		if evt == nil {
+			t.Fatal("no upsert was sent")
+		}
+		if key := evt.Command.Lookup("query", "unique_key").StringValue(); key != "buy milk" {
+			t.Fatalf("upsert keyed on %q", key)
+		}
+		if !evt.Command.Lookup("upsert").Boolean() {
+			t.Fatal("the create is not an upsert")
+		}
+		if _, err := evt.Command.LookupErr("update", "$setOnInsert", "unique_key"); err != nil {
+			t.Fatalf("the inserted todo has no unique_key: %v", evt.Command)
+		}
+	})
+}
+
+func TestUniqueCreateLosingRaceReturnsWinner(t *testing.T) {
+	user := newTestUser(t, "")
+	winner := primitive.NewObjectID()
+	withMockDB(t, "race", func(mt *mtest.T) {
+		// The text check finds nothing, then the concurrent create commits
+		mt.AddMockResponses(
+			cursorResponse(),
+			cursorResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.M{"_id": winner, "name": "Buy milk", "short_id": "abc123"}}),
+		)
+		status, body := addUniqueTodo(t, user)
+		if status != http.StatusOK || body["existing"] != true || body["insertedId"] != winner.Hex() {
+			t.Fatalf("got %d %v, want the winning todo", status, body)
+		}
+	})
+}
+
+func TestUniqueCreateDuplicateKeyIsConflict(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "conflict", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(), cursorResponse())
+		for i := 0; i < maxShortIDAttempts; i++ {
+			mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Name: "DuplicateKey", Message: "E11000 duplicate key error"}))
+		}
+		status, body := addUniqueTodo(t, user)
+		if status != http.StatusConflict || body["code"] != "DUPLICATE_TODO" {
+			t.Fatalf("got %d %v, want 409 DUPLICATE_TODO", status, body)
+		}
+	})
+}
+
+func TestUniqueTextKey(t *testing.T) {
+	for _, name := range []string{"Buy milk", "  buy   MILK ", "buy\tmilk"} {
+		if got := uniqueTextKey(name); got != "buy milk" {
+			t.Errorf("uniqueTextKey(%q) = %q", name, got)
+		}
+	}
+}
+
+func TestPatchTodoValidatesName(t *testing.T) {
+	user := newTestUser(t, "")
+	for _, name := range []string{"   ", strings.Repeat("x", defaultImportMaxNameLength+1)} {
+		w := serve(PatchTodo, testRequest{
+			method: http.MethodPatch, route: "/todos/:id", path: "/todos/" + primitive.NewObjectID().Hex(),
+			body: `{"name": "` + name + `"}`, cookie: sessionCookie(t, user),
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("name of %d characters: status = %d, want 400", len(name), w.Code)
+		}
+	}
+}
+
+func TestPatchTodoStampsCompletion(t *testing.T) {
+	user := newTestUser(t, "")
+	id := primitive.NewObjectID()
+	withMockDB(t, "complete", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.M{"_id": id, "name": "write", "status": statusCompleted, "userid": user.ID}}),
+		)
+		w := serve(PatchTodo, testRequest{
+			method: http.MethodPatch, route: "/todos/:id", path: "/todos/" + id.Hex(),
+			body: `{"status": "completed"}`, cookie: sessionCookie(t, user),
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		evt := mt.GetStartedEvent()
+		statement := evt.Command.Lookup("updates").Array().Index(0).Value().Document()
+		if _, err := statement.LookupErr("q", "status", "$ne"); err != nil {
+			t.Fatalf("completed_at is stamped on todos that are already completed: %v", statement)
+		}
+		if _, err := statement.LookupErr("u", "$set", "completed_at"); err != nil {
+			t.Fatalf("completing does not set completed_at: %v", statement)
+		}
+	})
+
+	withMockDB(t, "reopen", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.M{"_id": id, "name": "write", "status": statusPending, "userid": user.ID}}))
+		w := serve(PatchTodo, testRequest{
+			method: http.MethodPatch, route: "/todos/:id", path: "/todos/" + id.Hex(),
+			body: `{"status": "pending"}`, cookie: sessionCookie(t, user),
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		evt := mt.GetStartedEvent()
+		if _, err := evt.Command.LookupErr("update", "$unset", "completed_at"); err != nil {
+			t.Fatalf("reopening does not clear completed_at: %v", evt.Command)
+		}
+	})
+}
+
+func TestListCompletedSince(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "since", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse())
+		w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + "?completed_since=2024-06-03", cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if _, err := commandFilter(t, mt, "find").LookupErr("completed_at", "$gte"); err != nil {
+			t.Fatal("completed_since does not filter on completed_at")
+		}
+	})
+
+	w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + "?completed_since=June", cookie: sessionCookie(t, user)})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400 for an invalid date", w.Code)
+	}
+}
+
+// batchGet posts ids to the batch-get endpoint as user.
+func batchGet(t *testing.T, user models.User, ids ...string) testRequest {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = `"` + id + `"`
+	}
+	return testRequest{
+		method: http.MethodPost, route: "/todos/batch-get", path: "/todos/batch-get",
+		body: `{"ids": [` + strings.Join(quoted, ",") + `]}`, cookie: sessionCookie(t, user),
+	}
+}
+
+func TestBatchGetPreservesRequestOrder(t *testing.T) {
+	user := newTestUser(t, "")
+	a, b, c := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	unknown, foreign := primitive.NewObjectID(), primitive.NewObjectID()
+	shortB := strings.Repeat("b", shortIDLength)
+
+	withMockDB(t, "batch", func(mt *mtest.T) {
+		// The database returns only the caller's todos, in its own order
+		mt.AddMockResponses(cursorResponse(
+			bson.M{"_id": a, "name": "a", "userid": user.ID},
+			bson.M{"_id": b, "name": "b", "short_id": shortB, "userid": user.ID},
+			bson.M{"_id": c, "name": "c", "userid": user.ID},
+		))
+		w := serve(BatchGetTodos, batchGet(t, user, c.Hex(), unknown.Hex(), a.Hex(), foreign.Hex(), shortB, c.Hex()))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var body struct {
+			Todos []struct {
+				Name string `json:"name"`
+			} `json:"todos"`
+		}
+		decodeBody(t, w, &body)
+		var names []string
+		for _, todo := range body.Todos {
+			names = append(names, todo.Name)
+		}
+		if got := strings.Join(names, ","); got != "c,a,b" {
+			t.Errorf("todos = %s, want c,a,b", got)
+		}
+
+		filter := commandFilter(t, mt, "find")
+		if _, err := filter.LookupErr("userid"); err != nil {
+			t.Error("the query is not scoped to the caller")
+		}
+		or := filter.Lookup("$or").Array()
+		if n := len(mustValues(t, or.Index(0).Value().Document().Lookup("_id", "$in").Array())); n != 5 {
+			t.Errorf("queried %d ObjectIDs, want 5", n)
+		}
+		if short := or.Index(1).Value().Document().Lookup("short_id", "$in").Array().Index(0).Value().StringValue(); short != shortB {
+			t.Errorf("queried short id %q", short)
+		}
+	})
+}
+
+func TestBatchGetValidatesIDs(t *testing.T) {
+	user := newTestUser(t, "")
+	tooMany := make([]string, maxBatchGetIDs+1)
+	for i := range tooMany {
+		tooMany[i] = primitive.NewObjectID().Hex()
+	}
+	for name, req := range map[string]testRequest{
+		"none":       batchGet(t, user),
+		"too many":   batchGet(t, user, tooMany...),
+		"invalid id": batchGet(t, user, primitive.NewObjectID().Hex(), "not-an-id"),
+	} {
+		if w := serve(BatchGetTodos, req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, w.Code)
+		}
+	}
+}
+
+// mustValues returns the elements of a BSON array.
+func mustValues(t *testing.T, array bson.Raw) []bson.RawValue {
+	t.Helper()
+	values, err := array.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+// editTodo sends body to todo id with method, as user, and returns the
+// update document of the findAndModify it caused.
+func editTodo(t *testing.T, mt *mtest.T, handler gin.HandlerFunc, method string, user models.User, id primitive.ObjectID, body string) bson.Raw {
+	t.Helper()
+	mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.M{"_id": id, "name": "renamed", "status": statusPending, "userid": user.ID, "version": 2}}))
+	w := serve(handler, testRequest{method: method, route: "/todos/:id", path: "/todos/" + id.Hex(), body: body, cookie: sessionCookie(t, user)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, body %s", method, w.Code, w.Body)
+	}
+	for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+		if evt.CommandName == "findAndModify" {
+			if owner := evt.Command.Lookup("query", "userid", "$in").Array().Index(0).Value().ObjectID(); owner != user.ID {
+				t.Errorf("%s: edited a todo of %s", method, owner.Hex())
+			}
+			return evt.Command.Lookup("update").Document()
+		}
+	}
+	t.Fatalf("%s: no findAndModify was sent", method)
+	return nil
+}
+
+func TestReplaceTodoVersusPatch(t *testing.T) {
+	user := newTestUser(t, "")
+	id := primitive.NewObjectID()
+	body := `{"name": "renamed", "status": "pending"}`
+
+	withMockDB(t, "put clears omitted fields", func(mt *mtest.T) {
+		update := editTodo(t, mt, ReplaceTodo, http.MethodPut, user, id, body)
+		for _, field := range []string{"priority", "notes", "tags", "due_date"} {
+			if _, err := update.LookupErr("$unset", field); err != nil {
+				t.Errorf("PUT without %s does not clear it: %v", field, update)
+			}
+		}
+		for _, field := range []string{"_id", "userid", "short_id", "created_at"} {
+			if _, err := update.LookupErr("$set", field); err == nil {
+				t.Errorf("PUT overwrote the immutable %s", field)
+			}
+		}
+		if version := update.Lookup("$inc", "version").AsInt64(); version != 1 {
+			t.Errorf("version incremented by %d", version)
+		}
+		if _, err := update.LookupErr("$set", "updated_at"); err != nil {
+			t.Error("PUT does not bump updated_at")
+		}
+	})
+
+	withMockDB(t, "patch keeps omitted fields", func(mt *mtest.T) {
+		update := editTodo(t, mt, PatchTodo, http.MethodPatch, user, id, body)
+		for _, field := range []string{"priority", "notes", "tags", "due_date"} {
+			if _, err := update.LookupErr("$unset", field); err == nil {
+				t.Errorf("PATCH without %s cleared it", field)
+			}
+		}
+		if version := update.Lookup("$inc", "version").AsInt64(); version != 1 {
+			t.Errorf("version incremented by %d", version)
+		}
+	})
+
+	withMockDB(t, "put sets given fields", func(mt *mtest.T) {
+		update := editTodo(t, mt, ReplaceTodo, http.MethodPut, user, id,
+			`{"name": "renamed", "priority": "high", "tags": ["home"], "notes": "n", "due_date": "2030-01-02T00:00:00Z"}`)
+		if priority := update.Lookup("$set", "priority").StringValue(); priority != "high" {
+			t.Errorf("priority set to %q", priority)
+		}
+		if status := update.Lookup("$set", "status").StringValue(); status != statusPending {
+			t.Errorf("omitted status replaced with %q, want pending", status)
+		}
+		if _, err := update.LookupErr("$unset", "tags"); err == nil {
+			t.Errorf("given tags were cleared: %v", update)
+		}
+	})
+}
+
+func TestReplaceTodoNotOwned(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "missing", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+		w := serve(ReplaceTodo, testRequest{
+			method: http.MethodPut, route: "/todos/:id", path: "/todos/" + primitive.NewObjectID().Hex(),
+			body: `{"name": "mine now"}`, cookie: sessionCookie(t, user),
+		})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", w.Code)
+		}
+	})
+}
+
+// sortKey maps a todo field value to a comparable rank and value. A missing
+// field sorts before any value, as in MongoDB; a sorted field never mixes
+// other types.
+func sortKey(value interface{}) (int, string) {
+	switch v := value.(type) {
+	case nil:
+		return 0, ""
+	case bool:
+		return 1, fmt.Sprint(v)
+	case int:
+		return 1, fmt.Sprintf("%020d", v)
+	case time.Time:
+		return 1, v.UTC().Format(time.RFC3339Nano)
+	case primitive.ObjectID:
+		return 1, v.Hex()
+	}
+	panic(fmt.Sprintf("sortKey: unsupported %T", value))
+}
+
+// sortTodos orders docs by the sort document sent with a find, as MongoDB
+// would.
+func sortTodos(t *testing.T, docs []bson.M, spec bson.Raw) {
+	t.Helper()
+	elems, err := spec.Elements()
+	if err != nil {
+		t.Fatalf("sort %v: %v", spec, err)
+	}
+	less := func(i, j int) bool {
+		for _, elem := range elems {
+			rankI, valueI := sortKey(docs[i][elem.Key()])
+			rankJ, valueJ := sortKey(docs[j][elem.Key()])
+			if rankI == rankJ && valueI == valueJ {
+				continue
+			}
+			ascending := rankI < rankJ || (rankI == rankJ && valueI < valueJ)
+			return ascending == (elem.Value().AsInt64() > 0)
+		}
+		return false
+	}
+	sort.SliceStable(docs, less)
+}
+
+func TestPinnedTodosListFirst(t *testing.T) {
+	user := newTestUser(t, "")
+	start := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	todos := make([]bson.M, 4)
+	for i := range todos {
+		todos[i] = bson.M{"_id": primitive.NewObjectID(), "order": i, "created_at": start.Add(time.Duration(i) * time.Hour)}
+	}
+	third := todos[2]["_id"].(primitive.ObjectID)
+
+	listed := func(sortName string) []primitive.ObjectID {
+		var ids []primitive.ObjectID
+		withMockDB(t, sortName, func(mt *mtest.T) {
+			mt.AddMockResponses(cursorResponse())
+			w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + "?sort=" + sortName, cookie: sessionCookie(t, user)})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			evt := mt.GetStartedEvent()
+			for evt != nil && evt.CommandName != "find" {
+				evt = mt.GetStartedEvent()
+			}
+			if evt == nil {
+				t.Fatal("no find was sent")
+			}
+			docs := append([]bson.M(nil), todos...)
+			sortTodos(t, docs, evt.Command.Lookup("sort").Document())
+			for _, doc := range docs {
+				ids = append(ids, doc["_id"].(primitive.ObjectID))
+			}
+		})
+		return ids
+	}
+
+	for _, sortName := range []string{"order_asc", "created_desc"} {
+		before := listed(sortName)
+
+		todos[2]["pinned"] = true
+		if pinned := listed(sortName); pinned[0] != third {
+			t.Errorf("%s: pinned todo listed at %v, want first", sortName, pinned)
+		}
+
+		delete(todos[2], "pinned")
+		if after := listed(sortName); !reflect.DeepEqual(after, before) {
+			t.Errorf("%s: unpinned order %v, want %v", sortName, after, before)
+		}
+	}
+}
+
+func TestPinTodo(t *testing.T) {
+	user := newTestUser(t, "")
+	id := primitive.NewObjectID()
+	pin := func(action string) testRequest {
+		return testRequest{method: http.MethodPost, route: "/todos/:id/" + action, path: "/todos/" + id.Hex() + "/" + action, cookie: sessionCookie(t, user)}
+	}
+
+	withMockDB(t, "pin", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		if w := serve(PinTodo, pin("pin")); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if owner := statement.Lookup("q", "userid", "$in").Array().Index(0).Value().ObjectID(); owner != user.ID {
+			t.Errorf("pinned a todo of %s", owner.Hex())
+		}
+		if !statement.Lookup("u", "$set", "pinned").Boolean() {
+			t.Errorf("update %v does not pin", statement)
+		}
+	})
+
+	withMockDB(t, "unpin", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		if w := serve(UnpinTodo, pin("unpin")); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if _, err := statement.LookupErr("u", "$unset", "pinned"); err != nil {
+			t.Errorf("update %v does not unpin", statement)
+		}
+	})
+
+	withMockDB(t, "not owned", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		if w := serve(PinTodo, pin("pin")); w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", w.Code)
+		}
+	})
+}
+
+func TestListShowsDraftsOnlyOnRequest(t *testing.T) {
+	user := newTestUser(t, "")
+	for query, wantDrafts := range map[string]bool{"": false, "?drafts=true": true} {
+		withMockDB(t, "drafts"+query, func(mt *mtest.T) {
+			mt.AddMockResponses(cursorResponse())
+			w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + query, cookie: sessionCookie(t, user)})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			draft := commandFilter(t, mt, "find").Lookup("draft")
+			want := `{"$ne": true}`
+			if wantDrafts {
+				want = "true"
+			}
+			if draft.String() != want {
+				t.Fatalf("%q: draft filter = %v, want %s", query, draft, want)
+			}
+		})
+	}
+}
+
+func TestDefaultTodoSortIsDeterministic(t *testing.T) {
+	user := newTestUser(t, "")
+	same := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	todos := make([]bson.M, 6)
+	for i := range todos {
+		// Half the todos share a creation time, so only _id can order them
+		todos[i] = bson.M{"_id": primitive.NewObjectID(), "order": i % 2, "created_at": same.Add(time.Duration(i/3) * time.Hour)}
+	}
+
+	// listOrder lists the todos with query, stored in a fresh random order,
+	// and returns their ids as the sort sent would order them
+	listOrder := func(query string) []primitive.ObjectID {
+		var ids []primitive.ObjectID
+		withMockDB(t, "list"+query, func(mt *mtest.T) {
+			mt.AddMockResponses(cursorResponse())
+			w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + query, cookie: sessionCookie(t, user)})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			evt := mt.GetStartedEvent()
+			for evt != nil && evt.CommandName != "find" {
+				evt = mt.GetStartedEvent()
+			}
+			if evt == nil {
+				t.Fatal("no find was sent")
+			}
+			docs := append([]bson.M(nil), todos...)
+			rand.Shuffle(len(docs), func(i, j int) { docs[i], docs[j] = docs[j], docs[i] })
+			sortTodos(t, docs, evt.Command.Lookup("sort").Document())
+			for _, doc := range docs {
+				ids = append(ids, doc["_id"].(primitive.ObjectID))
+			}
+		})
+		return ids
+	}
+
+	newestFirst := listOrder("")
+	if newestFirst[0] != todos[5]["_id"] || newestFirst[5] != todos[0]["_id"] {
+		t.Errorf("default order %v is not created_desc", newestFirst)
+	}
+	for i := 0; i < 5; i++ {
+		if again := listOrder(""); !reflect.DeepEqual(again, newestFirst) {
+			t.Fatalf("repeated request %d listed %v, want %v", i, again, newestFirst)
+		}
+	}
+
+	t.Setenv("DEFAULT_TODO_SORT", "order_asc")
+	byOrder := listOrder("")
+	if !reflect.DeepEqual(byOrder, listOrder("?sort=order_asc")) || reflect.DeepEqual(byOrder, newestFirst) {
+		t.Errorf("DEFAULT_TODO_SORT=order_asc listed %v", byOrder)
+	}
+	t.Setenv("DEFAULT_TODO_SORT", "random")
+	if fallback := listOrder(""); !reflect.DeepEqual(fallback, newestFirst) {
+		t.Errorf("an invalid DEFAULT_TODO_SORT listed %v, want created_desc", fallback)
+	}
+
+	w := serve(GetTodos, testRequest{method: http.MethodGet, route: "/todos/:userid", path: "/todos/" + user.ID.Hex() + "?sort=name", cookie: sessionCookie(t, user)})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for an unknown sort", w.Code)
+	}
+}
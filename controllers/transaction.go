@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/ctxkeys"
+	"github.com/jeffthorne/tasky/database"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Transaction runs each mutating request in a MongoDB transaction, committed
+// when the handler responds with a 2xx status and aborted on any other status
+// or a panic. Reads, and deployments without transaction support, run
+// without one. Handlers opt their writes in with txnContext.
+func Transaction(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	if !database.TransactionsSupported() {
+		c.Next()
+		return
+	}
+
+	session, err := database.Client.StartSession()
+	if err != nil {
+		log.Printf("Error starting MongoDB session: %v", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "database unavailable"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer session.EndSession(ctx)
+
+	ctxkeys.Set(c, ctxkeys.DBSession, session)
+	runInTransaction(c, ctx, session)
+}
+
+// maxTxnAttempts bounds how often a request's transaction is run when
+// MongoDB reports a transient error, and how often a commit with an unknown
+// result is retried.
+const maxTxnAttempts = 3
+
+// MongoDB error labels and codes that ask for a transaction to be retried.
+const (
+	transientTxnLabel    = "TransientTransactionError"
+	unknownCommitLabel   = "UnknownTransactionCommitResult"
+	writeConflictCode    = 112
+	maxTimeMSExpiredCode = 50
+)
+
+// txnSession is the part of mongo.Session that runInTransaction drives.
+type txnSession interface {
+	StartTransaction(opts ...*options.TransactionOptions) error
+	AbortTransaction(ctx context.Context) error
+	CommitTransaction(ctx context.Context) error
+}
+
+// runInTransaction runs the rest of the handler chain in a transaction on
+// session. The response is held back until the transaction has committed, so
+// a failed commit is answered with 500 instead of the handler's success.
+//
+// Like mongo.Session.WithTransaction, it runs the route's handler again in a
+// new transaction after a TransientTransactionError or WriteConflict, whether
+// the handler recorded it with respondInternalError or the commit returned
+// it, and retries a commit whose result is unknown. Functions queued with
+// afterCommit run once the transaction has committed.
+func runInTransaction(c *gin.Context, ctx context.Context, session txnSession) {
+	w := &txnWriter{ResponseWriter: c.Writer, header: c.Writer.Header().Clone()}
+	c.Writer = w
+	body := replayRequestBody(c.Request)
+	var hooks []func()
+	ctxkeys.Set(c, ctxkeys.AfterCommit, &hooks)
+	defer func() {
+		// A panic discards the held response; recovery answers instead
+		c.Writer = w.ResponseWriter
+		if r := recover(); r != nil {
+			session.AbortTransaction(ctx)
+			panic(r)
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		if err := session.StartTransaction(); err != nil {
+			log.Printf("Error starting MongoDB transaction: %v", err)
+			c.Writer = w.ResponseWriter
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "database unavailable"})
+			return
+		}
+		if attempt == 1 {
+			c.Next()
+		} else {
+			// Route middlewares such as rate limits already ran once
+			c.Handler()(c)
+		}
+
+		if status := w.Status(); status < 200 || status >= 300 {
+			if err := session.AbortTransaction(ctx); err != nil {
+				log.Printf("Error aborting transaction: %v", err)
+			}
+			if attempt < maxTxnAttempts && recordedTransientError(c) {
+				retryTransaction(c, w, body, &hooks)
+				continue
+			}
+			w.flush()
+			return
+		}
+
+		err := commitTransaction(ctx, session)
+		if err == nil {
+			for _, hook := range hooks {
+				hook()
+			}
+			w.flush()
+			return
+		}
+		if attempt < maxTxnAttempts && isTransientTxnError(err) {
+			log.Printf("Retrying transaction for %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+			retryTransaction(c, w, body, &hooks)
+			continue
+		}
+		log.Printf("Error committing transaction for %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		c.Writer = w.ResponseWriter
+		for _, name := range []string{"Content-Length", "ETag", "Location"} {
+			c.Writer.Header().Del(name)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "COMMIT_FAILED", "error": "the change could not be saved, please try again"})
+		return
+	}
+}
+
+// commitTransaction commits, retrying while MongoDB cannot tell whether the
+// commit applied. Retried commits are idempotent.
+func commitTransaction(ctx context.Context, session txnSession) error {
+	var err error
+	for attempt := 1; attempt <= maxTxnAttempts; attempt++ {
+		err = session.CommitTransaction(ctx)
+		var serverErr mongo.ServerError
+		if !errors.As(err, &serverErr) || !serverErr.HasErrorLabel(unknownCommitLabel) || serverErr.HasErrorCode(maxTimeMSExpiredCode) {
+			return err
+		}
+	}
+	return err
+}
+
+// retryTransaction resets the request for another run of its handler: the
+// held response, the recorded errors, the queued side effects and the body.
+func retryTransaction(c *gin.Context, w *txnWriter, body *replayBody, hooks *[]func()) {
+	w.reset()
+	c.Errors = c.Errors[:0]
+	*hooks = (*hooks)[:0]
+	if body != nil {
+		body.rewind()
+		c.Request.Body = body
+	}
+}
+
+// isTransientTxnError reports whether MongoDB asks for the transaction that
+// returned err to be run again.
+func isTransientTxnError(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && (serverErr.HasErrorLabel(transientTxnLabel) || serverErr.HasErrorCode(writeConflictCode))
+}
+
+// recordedTransientError reports whether the handler recorded a transient
+// transaction error on the request.
+func recordedTransientError(c *gin.Context) bool {
+	for _, recorded := range c.Errors {
+		if isTransientTxnError(recorded.Err) {
+			return true
+		}
+	}
+	return false
+}
+
+// respondInternalError answers 500 with err's message and records err on the
+// request, where the Transaction middleware looks for transient errors and
+// the access log reports it.
+func respondInternalError(c *gin.Context, err error) {
+	c.Error(err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// afterCommit runs fn once the request's transaction has committed, or at
+// once when the request has no transaction. Side effects others can observe,
+// such as cache invalidation and webhooks, go through it so that a write that
+// is rolled back or retried does not trigger them.
+func afterCommit(c *gin.Context, fn func()) {
+	if value, ok := ctxkeys.Get(c, ctxkeys.AfterCommit); ok {
+		hooks := value.(*[]func())
+		*hooks = append(*hooks, fn)
+		return
+	}
+	fn()
+}
+
+// replayBody keeps what the handler has read of the request body, so that
+// a retried handler reads it again from the start. Only the part read is
+// kept, so limits the handler puts on the body still apply.
+type replayBody struct {
+	src  io.Reader
+	body io.Closer
+	read bytes.Buffer
+}
+
+// replayRequestBody makes the body of r replayable, or returns nil when it
+// has none.
+func replayRequestBody(r *http.Request) *replayBody {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body := &replayBody{src: r.Body, body: r.Body}
+	r.Body = body
+	return body
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	n, err := b.src.Read(p)
+	b.read.Write(p[:n])
+	return n, err
+}
+
+func (b *replayBody) Close() error {
+	return b.body.Close()
+}
+
+// rewind replays the bytes read so far before the rest of the body.
+func (b *replayBody) rewind() {
+	read := append([]byte(nil), b.read.Bytes()...)
+	b.read.Reset()
+	b.src = io.MultiReader(bytes.NewReader(read), b.src)
+}
+
+// txnWriter holds back the response body while the transaction is open. The
+// status and headers are only recorded until the first write anyway.
+type txnWriter struct {
+	gin.ResponseWriter
+	header http.Header // as the handler chain found it
+	body   bytes.Buffer
+}
+
+func (w *txnWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *txnWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// reset discards the held response, restoring the headers set before the
+// handler ran.
+func (w *txnWriter) reset() {
+	w.body.Reset()
+	header := w.Header()
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range w.header {
+		header[name] = values
+	}
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+}
+
+// flush sends the held response.
+func (w *txnWriter) flush() {
+	if w.body.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// txnContext binds ctx to the request's transaction, if it has one, so
+// operations run with it join the transaction.
+func txnContext(c *gin.Context, ctx context.Context) context.Context {
+	if value, ok := ctxkeys.Get(c, ctxkeys.DBSession); ok {
+		session := value.(mongo.Session)
+		return mongo.NewSessionContext(ctx, session)
+	}
+	return ctx
+}
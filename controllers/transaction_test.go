@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fakeSession records how runInTransaction ends the transaction. Commits
+// return commitErrs in turn, then commitErr.
+type fakeSession struct {
+	commitErr          error
+	commitErrs         []error
+	starts, commits    int
+	committed, aborted bool
+}
+
+func (s *fakeSession) StartTransaction(...*options.TransactionOptions) error {
+	s.starts++
+	return nil
+}
+
+func (s *fakeSession) AbortTransaction(context.Context) error {
+	s.aborted = true
+	return nil
+}
+
+func (s *fakeSession) CommitTransaction(context.Context) error {
+	s.committed = true
+	s.commits++
+	if len(s.commitErrs) > 0 {
+		err := s.commitErrs[0]
+		s.commitErrs = s.commitErrs[1:]
+		return err
+	}
+	return s.commitErr
+}
+
+// Errors MongoDB labels for a transaction retry and a commit retry.
+var (
+	writeConflict = mongo.CommandError{Code: 112, Name: "WriteConflict", Labels: []string{"TransientTransactionError"}}
+	unknownCommit = mongo.CommandError{Code: 91, Name: "ShutdownInProgress", Labels: []string{"UnknownTransactionCommitResult"}}
+)
+
+// serveInTransaction runs handler behind runInTransaction on session.
+func serveInTransaction(session *fakeSession, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, _ interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.POST("/", func(c *gin.Context) {
+		runInTransaction(c, context.Background(), session)
+	}, handler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "retried"}`)))
+	return w
+}
+
+func TestTransactionCommitsBeforeResponding(t *testing.T) {
+	session := &fakeSession{}
+	w := serveInTransaction(session, func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"saved": true})
+	})
+	if !session.committed || session.aborted {
+		t.Fatalf("committed = %v, aborted = %v", session.committed, session.aborted)
+	}
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"saved"`) {
+		t.Fatalf("got %d %s, want the handler's response", w.Code, w.Body)
+	}
+}
+
+func TestTransactionAbortsOnErrorStatus(t *testing.T) {
+	session := &fakeSession{}
+	w := serveInTransaction(session, func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad", "code": "INVALID"})
+	})
+	if session.committed || !session.aborted {
+		t.Fatalf("committed = %v, aborted = %v", session.committed, session.aborted)
+	}
+	assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusBadRequest, "INVALID")
+}
+
+func TestTransactionCommitFailureIsServerError(t *testing.T) {
+	session := &fakeSession{commitErr: errors.New("write conflict")}
+	w := serveInTransaction(session, func(c *gin.Context) {
+		c.Header("Location", "/todo/1")
+		c.JSON(http.StatusCreated, gin.H{"saved": true})
+	})
+	assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusInternalServerError, "COMMIT_FAILED")
+	if strings.Contains(w.Body.String(), `"saved"`) || w.Header().Get("Location") != "" {
+		t.Fatalf("the uncommitted response leaked: %v %s", w.Header(), w.Body)
+	}
+}
+
+func TestTransactionAbortsOnPanic(t *testing.T) {
+	session := &fakeSession{}
+	w := serveInTransaction(session, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"saved": true})
+		panic("boom")
+	})
+	if session.committed || !session.aborted {
+		t.Fatalf("committed = %v, aborted = %v", session.committed, session.aborted)
+	}
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), `"saved"`) {
+		t.Fatalf("got %d %s, want an empty 500", w.Code, w.Body)
+	}
+}
+
+func TestTransactionRunsSideEffectsAfterCommit(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest} {
+		session := &fakeSession{}
+		ran := false
+		serveInTransaction(session, func(c *gin.Context) {
+			afterCommit(c, func() {
+				if !session.committed {
+					t.Error("a side effect ran before the commit")
+				}
+				ran = true
+			})
+			c.Status(status)
+		})
+		if ran != (status == http.StatusOK) {
+			t.Errorf("status %d: side effect ran = %v", status, ran)
+		}
+	}
+}
+
+func TestTransactionRetriesTransientHandlerError(t *testing.T) {
+	session := &fakeSession{}
+	var bodies []string
+	w := serveInTransaction(session, func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			c.Header("X-First-Attempt", "true")
+			afterCommit(c, func() { t.Error("a side effect of the failed attempt ran") })
+			respondInternalError(c, fmt.Errorf("update: %w", writeConflict))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"saved": true})
+	})
+	if w.Code != http.StatusOK || session.starts != 2 || session.commits != 1 {
+		t.Fatalf("got %d after %d starts and %d commits, want 200 after a retry", w.Code, session.starts, session.commits)
+	}
+	if len(bodies) != 2 || bodies[1] != bodies[0] || bodies[0] == "" {
+		t.Errorf("the retry read the body %q", bodies)
+	}
+	if w.Header().Get("X-First-Attempt") != "" || strings.Contains(w.Body.String(), "WriteConflict") {
+		t.Errorf("the failed attempt's response leaked: %v %s", w.Header(), w.Body)
+	}
+}
+
+func TestTransactionDoesNotRetryOtherErrors(t *testing.T) {
+	session := &fakeSession{}
+	w := serveInTransaction(session, func(c *gin.Context) {
+		respondInternalError(c, errors.New("bad query"))
+	})
+	if w.Code != http.StatusInternalServerError || session.starts != 1 {
+		t.Fatalf("got %d after %d starts, want one failed attempt", w.Code, session.starts)
+	}
+}
+
+func TestTransactionRetriesCommit(t *testing.T) {
+	cases := []struct {
+		name          string
+		commitErrs    []error
+		runs, commits int
+		wantStatus    int
+	}{
+		{"transient commit runs the handler again", []error{writeConflict}, 2, 2, http.StatusCreated},
+		{"unknown result retries the commit", []error{unknownCommit}, 1, 2, http.StatusCreated},
+		{"gives up after the last attempt", []error{writeConflict, writeConflict, writeConflict}, maxTxnAttempts, maxTxnAttempts, http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		session := &fakeSession{commitErrs: tc.commitErrs}
+		runs := 0
+		w := serveInTransaction(session, func(c *gin.Context) {
+			runs++
+			c.JSON(http.StatusCreated, gin.H{"saved": true})
+		})
+		if w.Code != tc.wantStatus || runs != tc.runs || session.commits != tc.commits {
+			t.Errorf("%s: got %d after %d runs and %d commits, want %d after %d and %d", tc.name, w.Code, runs, session.commits, tc.wantStatus, tc.runs, tc.commits)
+		}
+	}
+}
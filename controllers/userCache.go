@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultUserCacheTTL  = 30 * time.Second
+	defaultUserCacheSize = 1000
+)
+
+var sessionUserCache = newUserCache(userCacheTTL(), userCacheSize())
+
+// userCacheTTL reads USER_CACHE_TTL. It bounds how long role changes made
+// directly in the database take to apply; 0 disables the cache.
+func userCacheTTL() time.Duration {
+	value := os.Getenv("USER_CACHE_TTL")
+	if value == "" {
+		return defaultUserCacheTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return defaultUserCacheTTL
+	}
+	return ttl
+}
+
+// userCacheSize reads USER_CACHE_SIZE, the number of users kept.
+func userCacheSize() int {
+	size, err := strconv.Atoi(os.Getenv("USER_CACHE_SIZE"))
+	if err != nil || size < 1 {
+		return defaultUserCacheSize
+	}
+	return size
+}
+
+// userCache is a TTL and LRU bounded cache of the user fields checked on
+// every authenticated request: name, role, active state and token version.
+// Writes to those fields must invalidate the user.
+type userCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type userCacheEntry struct {
+	key      string
+	user     models.User
+	storedAt time.Time
+}
+
+func newUserCache(ttl time.Duration, size int) *userCache {
+	return &userCache{ttl: ttl, size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (uc *userCache) get(key string) (models.User, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	elem, ok := uc.entries[key]
+	if !ok {
+		return models.User{}, false
+	}
+	entry := elem.Value.(*userCacheEntry)
+	if time.Since(entry.storedAt) > uc.ttl {
+		uc.order.Remove(elem)
+		delete(uc.entries, key)
+		return models.User{}, false
+	}
+	uc.order.MoveToFront(elem)
+	return entry.user, true
+}
+
+func (uc *userCache) store(key string, user models.User) {
+	if uc.ttl == 0 {
+		return
+	}
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if elem, ok := uc.entries[key]; ok {
+		elem.Value = &userCacheEntry{key: key, user: user, storedAt: time.Now()}
+		uc.order.MoveToFront(elem)
+		return
+	}
+	uc.entries[key] = uc.order.PushFront(&userCacheEntry{key: key, user: user, storedAt: time.Now()})
+	for uc.order.Len() > uc.size {
+		oldest := uc.order.Back()
+		uc.order.Remove(oldest)
+		delete(uc.entries, oldest.Value.(*userCacheEntry).key)
+	}
+}
+
+func (uc *userCache) invalidate(key string) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if elem, ok := uc.entries[key]; ok {
+		uc.order.Remove(elem)
+		delete(uc.entries, key)
+	}
+}
+
+// sessionUser returns the cached session fields of a user, loading them from
+// the request tenant's database on a miss. Errors come from FindOne, so a
+// missing user is mongo.ErrNoDocuments.
+func sessionUser(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (models.User, error) {
+	key := tenantScoped(c, userID.Hex())
+	if user, ok := sessionUserCache.get(key); ok {
+		return user, nil
+	}
+
+	var user models.User
+	findOptions := options.FindOne().SetProjection(bson.M{"name": 1, "role": 1, "active": 1, "token_version": 1})
+	if err := usersFor(c).FindOne(ctx, bson.M{"_id": userID}, findOptions).Decode(&user); err != nil {
+		return models.User{}, err
+	}
+	sessionUserCache.store(key, user)
+	return user, nil
+}
+
+// invalidateSessionUser drops a user's cached session fields once a write to
+// them has committed.
+func invalidateSessionUser(c *gin.Context, userID primitive.ObjectID) {
+	key := tenantScoped(c, userID.Hex())
+	afterCommit(c, func() { sessionUserCache.invalidate(key) })
+}
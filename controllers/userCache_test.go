@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserCacheHitAndMiss(t *testing.T) {
+	cache := newUserCache(time.Minute, 10)
+	if _, ok := cache.get("a"); ok {
+		t.Fatal("an empty cache hit")
+	}
+	cache.store("a", models.User{Role: "admin"})
+	if user, ok := cache.get("a"); !ok || user.Role != "admin" {
+		t.Fatalf("get = %+v, %v; want the stored user", user, ok)
+	}
+	cache.invalidate("a")
+	if _, ok := cache.get("a"); ok {
+		t.Fatal("an invalidated user was served")
+	}
+}
+
+func TestUserCacheExpires(t *testing.T) {
+	cache := newUserCache(20*time.Millisecond, 10)
+	cache.store("a", models.User{})
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := cache.get("a"); ok {
+		t.Fatal("a user older than the TTL was served")
+	}
+	if len(cache.entries) != 0 || cache.order.Len() != 0 {
+		t.Fatal("the expired entry was not dropped")
+	}
+
+	disabled := newUserCache(0, 10)
+	disabled.store("a", models.User{})
+	if _, ok := disabled.get("a"); ok {
+		t.Fatal("a zero TTL still caches")
+	}
+}
+
+func TestUserCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newUserCache(time.Minute, 2)
+	cache.store("a", models.User{})
+	cache.store("b", models.User{})
+	cache.get("a")
+	cache.store("c", models.User{})
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("the least recently used user was kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+}
+
+func TestSessionUserLoadsOnceUntilInvalidated(t *testing.T) {
+	id := primitive.NewObjectID()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	t.Cleanup(func() { sessionUserCache.invalidate(id.Hex()) })
+
+	withMockDB(t, "load", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.M{"_id": id, "role": "admin"}))
+		for i := 0; i < 3; i++ {
+			user, err := sessionUser(mt.Context(), c, id)
+			if err != nil || user.Role != "admin" {
+				t.Fatalf("lookup %d: %+v, %v", i, user, err)
+			}
+		}
+		mt.GetStartedEvent()
+		if evt := mt.GetStartedEvent(); evt != nil {
+			t.Fatalf("cached user was loaded again with %s", evt.CommandName)
+		}
+
+		invalidateSessionUser(c, id)
+		mt.AddMockResponses(cursorResponse(bson.M{"_id": id, "role": ""}))
+		if user, _ := sessionUser(mt.Context(), c, id); user.Role != "" {
+			t.Fatal("the stale role was served after invalidation")
+		}
+	})
+}
+
+func TestChangePasswordInvalidatesCachedUser(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	user := newTestUser(t, "")
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("old password")
+	stored := bson.M{"_id": user.ID, "email": *user.Email, "password": hash}
+
+	withMockDB(t, "change", func(mt *mtest.T) {
+		cookie := sessionCookie(t, user)
+		mt.AddMockResponses(cursorResponse(stored), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		w := serve(ChangePassword, testRequest{
+			method: http.MethodPost, route: "/me/password", path: "/me/password",
+			body:   `{"current_password": "old password", "new_password": "Zebra#Lamp7Quiet"}`,
+			cookie: cookie,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if _, ok := sessionUserCache.get(user.ID.Hex()); ok {
+			t.Fatal("the user is still cached after a password change")
+		}
+	})
+}
+
+func TestDeactivateInvalidatesCachedUser(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "deactivate", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}), mtest.CreateSuccessResponse())
+		w := serve(DeactivateAccount, testRequest{method: http.MethodPost, route: "/me/deactivate", path: "/me/deactivate", cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if _, ok := sessionUserCache.get(user.ID.Hex()); ok {
+			t.Fatal("the user is still cached after deactivating the account")
+		}
+	})
+}
+
+func TestRevokeSessionsInvalidatesCachedUser(t *testing.T) {
+	user := newTestUser(t, "")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+	withMockDB(t, "revoke", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.M{"_id": user.ID, "token_version": 4}}))
+		version, err := revokeSessions(mt.Context(), c, user.ID)
+		if err != nil || version != 4 {
+			t.Fatalf("revokeSessions = %d, %v", version, err)
+		}
+		if _, ok := sessionUserCache.get(user.ID.Hex()); ok {
+			t.Fatal("the user is still cached after revoking their sessions")
+		}
+	})
+}
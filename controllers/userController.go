@@ -1,203 +1,693 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"net/mail"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/ctxkeys"
 	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/featureflags"
+	"github.com/jeffthorne/tasky/mailer"
 	"github.com/jeffthorne/tasky/models"
+	"github.com/jeffthorne/tasky/server"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
+func init() {
+	auth.SetSessionChecker(checkUserSession)
+	// Emails are unique, so concurrent signups cannot both create an account
+	ensureIndex("user", mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+}
+
+// checkUserSession rejects tokens for accounts that were deactivated or whose
+// token version has been bumped since the token was issued, and sessions idle
+// past IDLE_TIMEOUT. It also refreshes
+// the role so promotions and demotions apply without logging in again.
+func checkUserSession(c *gin.Context, claims *auth.Claims) error {
+	objId, err := primitive.ObjectIDFromHex(claims.Username)
+	if err != nil {
+		return auth.ErrSessionRevoked
+	}
+
+	// Outside the request's transaction: the activity upsert in checkIdle
+	// would otherwise make concurrent requests of a session conflict
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	user, err := sessionUser(ctx, c, objId)
+	if err == mongo.ErrNoDocuments {
+		return auth.ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+
+	if !user.IsActive() || user.TokenVersion != claims.Version {
+		return auth.ErrSessionRevoked
+	}
+	if err := checkIdle(ctx, c, claims); err != nil {
+		return err
+	}
+	ctxkeys.SetRole(c, user.Role)
+	return nil
+}
 
 func SignUp(c *gin.Context) {
+	if !featureflags.SignupsEnabled() {
+		c.JSON(http.StatusForbidden, gin.H{"code": "SIGNUPS_DISABLED", "error": "Signups are currently disabled"})
+		return
+	}
+
 	var user models.User
-	if err := c.BindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &user) {
+		return
+	}
+
+	// Validate required fields
+	if user.Email == nil || user.Password == nil || user.Name == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email, password, and username are required"})
+		return
+	}
+
+	if addr, err := mail.ParseAddress(*user.Email); err != nil || addr.Address != *user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email address is not valid"})
+		return
+	}
+	normalizeEmail(user.Email)
+
+	if !emailDomainAllowed(*user.Email) {
+		c.JSON(http.StatusForbidden, gin.H{"code": "DOMAIN_NOT_ALLOWED", "error": "Signups are not allowed for this email domain"})
 		return
 	}
 
 	// Use the database helper for consistent context management
 	ctx, cancel := database.GetContext()
 	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	// A retried signup with the same Idempotency-Key gets the original result
+	// and a fresh session instead of a duplicate-email error
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	if idempotencyKey != "" && !featureflags.EnumerationSafe() && replaySignup(ctx, c, idempotencyKey, user) {
+		return
+	}
 
 	// Check if user with this email already exists
-	emailCount, err := userCollection.CountDocuments(ctx, bson.M{"email": user.Email})
+	emailCount, err := usersFor(c).CountDocuments(ctx, bson.M{"email": user.Email})
 	if err != nil {
 		log.Printf("Error checking email existence: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking for the email"})
 		return
 	}
 
-	if emailCount > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User with this email already exists!"})
+	// Hash the password before branching, so both outcomes take as long
+	password, err := auth.HashPassword(*user.Password)
+	if errors.Is(err, auth.ErrBusy) {
+		respondAuthBusy(c)
 		return
 	}
-
-	// Validate required fields
-	if user.Email == nil || user.Password == nil || user.Name == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Email, password, and username are required"})
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user was not created"})
 		return
 	}
 
-	// Hash the password
-	password := HashPassword(*user.Password)
+	enumerationSafe := featureflags.EnumerationSafe()
+	if emailCount > 0 {
+		respondEmailTaken(c, *user.Email, enumerationSafe)
+		return
+	}
 	user.Password = &password
 	user.ID = primitive.NewObjectID()
+	user.CreatedAt = models.Now()
+	user.UpdatedAt = user.CreatedAt
 
 	// Insert the user
-	resultInsertionNumber, insertErr := userCollection.InsertOne(ctx, user)
+	resultInsertionNumber, insertErr := usersFor(c).InsertOne(ctx, user)
+	if database.IsDuplicateKeyError(insertErr) {
+		// Another signup with this email won the race since the count above
+		respondEmailTaken(c, *user.Email, enumerationSafe)
+		return
+	}
 	if insertErr != nil {
 		log.Printf("Error inserting user: %v", insertErr)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "user was not created"})
 		return
 	}
+	recordAudit(c, user.ID.Hex(), auditSignup)
+
+	// Logging in here would reveal the email was new, so the user is sent
+	// to the login page by email instead
+	if enumerationSafe {
+		sendSignupEmail(*user.Email, "Welcome to Tasky",
+			"Your account is ready. Log in with this email address to get started.")
+		respondSignupPending(c)
+		return
+	}
+
+	if idempotencyKey != "" {
+		if err := storeSignupIdempotency(ctx, c, idempotencyKey, *user.Email, user.ID); err != nil {
+			log.Printf("Error storing signup idempotency key: %v", err)
+		}
+	}
 
 	// Generate JWT token and set cookies
-	userId := user.ID.Hex()
-	username := *user.Name
+	token, ok := startSession(c, user)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, withSessionToken(gin.H{"InsertedID": resultInsertionNumber.InsertedID}, token))
+}
+
+// normalizeEmail lowercases email in place. Emails are stored lowercased, so
+// lookups must be too.
+func normalizeEmail(email *string) {
+	*email = strings.ToLower(*email)
+}
+
+// respondBadCredentials answers a login with an unknown email or a wrong
+// password. Both get exactly the same status, headers and body, so the
+// response does not reveal which emails have an account.
+func respondBadCredentials(c *gin.Context, throttleKeys []string) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "email or password is incorrect", "captcha_required": captchaRequired(throttleKeys)})
+}
+
+// sessionToken is a token issued to a client that just signed in.
+type sessionToken struct {
+	value   string
+	expires time.Time
+}
 
-	token, err, expirationTime := auth.GenerateJWT(userId)
+// startSession issues a token for user and sets the session cookies. It
+// responds with 500 and returns false if the token cannot be generated.
+func startSession(c *gin.Context, user models.User) (sessionToken, bool) {
+	userId := user.ID.Hex()
+	token, err, expirationTime := auth.GenerateJWT(userId, user.Role, user.TokenVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while generating token"})
+		return sessionToken{}, false
+	}
+
+	setAuthCookies(c, expirationTime,
+		authCookie{"token", token},
+		authCookie{"userID", userId},
+		authCookie{"username", *user.Name},
+	)
+	return sessionToken{value: token, expires: expirationTime}, true
+}
+
+// authCookie is one of the cookies set when a session starts.
+type authCookie struct {
+	name, value string
+}
+
+// setAuthCookies sets session cookies expiring with the token, unless
+// TOKEN_TRANSPORT=header keeps sessions out of cookies. Max-Age carries the
+// same lifetime relative to now, which browsers prefer over Expires, so a
+// client with a skewed clock still keeps the cookie as long as the token.
+func setAuthCookies(c *gin.Context, expires time.Time, cookies ...authCookie) {
+	if !auth.CookiesEnabled() {
 		return
 	}
+	maxAge := int(time.Until(expires).Round(time.Second).Seconds())
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+	for _, cookie := range cookies {
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:    cookie.name,
+			Path:    server.CookiePath(),
+			Value:   cookie.value,
+			Expires: expires,
+			MaxAge:  maxAge,
+		})
+	}
+}
+
+// withSessionToken adds the token to a sign-in response body when clients
+// may send it in the Authorization header, since they cannot read it from a
+// cookie.
+func withSessionToken(body gin.H, token sessionToken) gin.H {
+	if auth.HeadersEnabled() && token.value != "" {
+		body["token"] = token.value
+		body["expires_at"] = models.NewJSONTime(token.expires)
+	}
+	return body
+}
 
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:    "token",
-		Value:   token,
-		Expires: expirationTime,
-	})
+// signupMailer delivers the emails of enumeration-safe signups.
+var signupMailer = mailer.FromEnv()
 
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:    "userID",
-		Value:   userId,
-		Expires: expirationTime,
-	})
+// sendSignupEmail sends a signup outcome email. Failures are only logged, as
+// the response must not differ.
+func sendSignupEmail(to string, subject string, body string) {
+	if err := signupMailer.Send(to, subject, body); err != nil {
+		log.Printf("Error sending signup email: %v", err)
+	}
+}
 
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:    "username",
-		Value:   username,
-		Expires: expirationTime,
-	})
+// respondAuthBusy tells the client to retry when password hashing is
+// saturated.
+func respondAuthBusy(c *gin.Context) {
+	c.Header("Retry-After", "1")
+	c.JSON(http.StatusServiceUnavailable, gin.H{"code": "AUTH_BUSY", "error": "server is busy, please retry"})
+}
 
-	c.JSON(http.StatusOK, resultInsertionNumber)
+// respondSignupPending is the enumeration-safe response to every signup.
+func respondSignupPending(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"msg": "check your email to continue"})
 }
+
+// respondEmailTaken answers a signup for an email that already has an
+// account. With enumeration safety on, the owner is emailed instead.
+func respondEmailTaken(c *gin.Context, email string, enumerationSafe bool) {
+	if enumerationSafe {
+		sendSignupEmail(email, "You already have an account",
+			"Someone tried to sign up with this email address, which already has an account. "+
+				"If it was you, log in instead. If not, you can ignore this email.")
+		respondSignupPending(c)
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "User with this email already exists!"})
+}
+
 func Login(c *gin.Context) {
-	var user models.User
+	var body struct {
+		models.User
+		CaptchaToken string `json:"captcha_token"`
+	}
 	var foundUser models.User
 
-	if err := c.BindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "bind error"})
+	// Classic form posts send the credentials form-encoded
+	if c.ContentType() == gin.MIMEPOSTForm {
+		email, password := c.PostForm("email"), c.PostForm("password")
+		if email != "" {
+			body.Email = &email
+		}
+		if password != "" {
+			body.Password = &password
+		}
+		body.CaptchaToken = c.PostForm("captcha_token")
+	} else if !bindJSON(c, &body) {
+		return
+	}
+	user := body.User
+	if user.Email == nil || user.Password == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email and password are required"})
 		return
 	}
+	normalizeEmail(user.Email)
 
 	// Use consistent context management
 	ctx, cancel := database.GetContext()
 	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	// After repeated failures the password is only checked once a captcha
+	// has been solved
+	throttleKeys := loginThrottleKeys(c.ClientIP(), *user.Email)
+	if captchaRequired(throttleKeys) {
+		solved, err := captchaVerifier.Verify(ctx, body.CaptchaToken, c.ClientIP())
+		if err != nil {
+			log.Printf("Error verifying captcha: %v", err)
+		}
+		if !solved {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "captcha required", "code": "CAPTCHA_REQUIRED", "captcha_required": true})
+			return
+		}
+		loginFailures.clear(throttleKeys...)
+	}
 
 	// Find user by email
-	err := userCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&foundUser)
+	err := usersFor(c).FindOne(ctx, bson.M{"email": user.Email}).Decode(&foundUser)
+	if err == mongo.ErrNoDocuments {
+		loginFailures.record(throttleKeys...)
+		recordAudit(c, *user.Email, auditLoginFailure)
+		respondBadCredentials(c, throttleKeys)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "email or password is incorrect"})
+		log.Printf("Error looking up user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed, please try again"})
 		return
 	}
 
-	// Verify password
-	passwordIsValid, msg := VerifyPassword(*user.Password, *foundUser.Password)
+	// Verify password, upgrading a legacy stored value on first success
+	var passwordIsValid bool
+	if auth.IsLegacyHash(*foundUser.Password) {
+		passwordIsValid = auth.VerifyLegacyPassword(*user.Password, *foundUser.Password)
+		if passwordIsValid {
+			upgradeLegacyPassword(c, foundUser.ID, *user.Password)
+		}
+	} else {
+		passwordIsValid, _, err = VerifyPassword(*user.Password, *foundUser.Password)
+		if err != nil {
+			respondAuthBusy(c)
+			return
+		}
+	}
 	if !passwordIsValid {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		loginFailures.record(throttleKeys...)
+		recordAudit(c, foundUser.ID.Hex(), auditLoginFailure)
+		respondBadCredentials(c, throttleKeys)
 		return
 	}
+	loginFailures.clear(throttleKeys...)
 
 	if foundUser.Email == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found!"})
 		return
 	}
 
+	if !foundUser.IsActive() {
+		c.JSON(http.StatusForbidden, gin.H{"code": "ACCOUNT_DEACTIVATED", "error": "this account has been deactivated"})
+		return
+	}
+
 	userId := foundUser.ID.Hex()
 	username := *foundUser.Name
 
+	// In single-session mode every login signs the user's other devices out,
+	// so the token held by this client must be replaced as well
+	singleSession := featureflags.SingleSession()
+	if singleSession {
+		version, err := revokeSessions(ctx, c, foundUser.ID)
+		if err != nil {
+			log.Printf("Error revoking sessions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed, please try again"})
+			return
+		}
+		foundUser.TokenVersion = version
+	}
+
 	shouldRefresh, err, expirationTime := auth.RefreshToken(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "refresh token error"})
 		return
 	}
 
-	if shouldRefresh {
-		token, err, expirationTime := auth.GenerateJWT(userId)
+	session := sessionToken{expires: expirationTime}
+	if shouldRefresh || singleSession {
+		token, err, expirationTime := auth.GenerateJWT(userId, foundUser.Role, foundUser.TokenVersion)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while generating token"})
 			return
 		}
-
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:    "token",
-			Value:   token,
-			Expires: expirationTime,
-		})
-
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:    "userID",
-			Value:   userId,
-			Expires: expirationTime,
-		})
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:    "username",
-			Value:   username,
-			Expires: expirationTime,
-		})
-
+		session = sessionToken{value: token, expires: expirationTime}
+		setAuthCookies(c, expirationTime, authCookie{"token", token})
 	} else {
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:    "userID",
-			Value:   userId,
-			Expires: expirationTime,
-		})
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:    "username",
-			Value:   username,
-			Expires: expirationTime,
-		})
+		// The current token is kept, and returned for header clients
+		session.value, _ = c.Cookie("token")
 	}
-	c.JSON(http.StatusOK, gin.H{"msg": "login successful"})
+	setAuthCookies(c, session.expires,
+		authCookie{"userID", userId},
+		authCookie{"username", username},
+	)
+	recordAudit(c, userId, auditLoginSuccess)
+
+	// Browsers continue to the todo page, or to next if it is a safe target
+	if wantsHTML(c) {
+		safeRedirect(c, c.DefaultQuery("next", server.BasePath()+"/todo"))
+		return
+	}
+	response := gin.H{"msg": "login successful"}
+	if foundUser.MustChangePassword {
+		response["must_change_password"] = true
+	}
+	c.JSON(http.StatusOK, withSessionToken(response, session))
 }
 
 func Todo(c *gin.Context) {
 	session := auth.ValidateSession(c)
 	if session {
-		c.HTML(http.StatusOK, "todo.html", nil)
+		c.HTML(http.StatusOK, "todo.html", NewPageData(sessionUsername(c)))
 	} else {
 		// Redirect unauthorized users back to login page
-		c.Redirect(http.StatusFound, "/")
+		safeRedirect(c, server.BasePath()+"/")
+	}
+}
+
+// DeactivateAccount disables the session user's account and revokes every
+// token issued for it. An admin can reactivate the account later.
+func DeactivateAccount(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	objId, err := primitive.ObjectIDFromHex(sessionUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	update := bson.M{"$set": bson.M{"active": false, "updated_at": models.Now()}, "$inc": bson.M{"token_version": 1}}
+	if _, err := usersFor(c).UpdateOne(ctx, bson.M{"_id": objId}, update); err != nil {
+		log.Printf("Error deactivating user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "account was not deactivated"})
+		return
+	}
+	invalidateSessionUser(c, objId)
+
+	recordAudit(c, objId.Hex(), auditDeactivated)
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"success": "account deactivated"})
+}
+
+// Logout ends the browser session by removing the session cookies. Tokens
+// held by header clients stay valid until they expire.
+func Logout(c *gin.Context) {
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"success": "logged out"})
+}
+
+// revokeSessions bumps the user's token version, which invalidates every
+// token issued to them so far, and returns the new version.
+func revokeSessions(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (int, error) {
+	var user models.User
+	err := usersFor(c).FindOneAndUpdate(ctx, bson.M{"_id": userID}, bson.M{"$inc": bson.M{"token_version": 1}},
+		options.FindOneAndUpdate().
+			SetProjection(bson.M{"token_version": 1}).
+			SetReturnDocument(options.After)).Decode(&user)
+	if err != nil {
+		return 0, err
+	}
+	invalidateSessionUser(c, userID)
+	return user.TokenVersion, nil
+}
+
+// clearAuthCookies removes the session cookies from the browser.
+func clearAuthCookies(c *gin.Context) {
+	if !auth.CookiesEnabled() {
+		return
+	}
+	for _, name := range []string{"token", "userID", "username"} {
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:    name,
+			Path:    server.CookiePath(),
+			Value:   "",
+			Expires: time.Unix(0, 0),
+			MaxAge:  -1,
+		})
+	}
+}
+
+// PasswordStrength scores a candidate password so the signup form can give
+// live feedback. The password is not stored.
+func PasswordStrength(c *gin.Context) {
+	var body struct {
+		Password string `json:"password"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	score, suggestions := auth.PasswordStrength(body.Password)
+	c.JSON(http.StatusOK, gin.H{"score": score, "max_score": auth.MaxPasswordScore, "suggestions": suggestions})
+}
+
+// upgradeLegacyPassword replaces a user's legacy stored password with a
+// current hash. Failures are logged; the user can still log in and the
+// upgrade is retried next time.
+func upgradeLegacyPassword(c *gin.Context, userID primitive.ObjectID, password string) {
+	hashed, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing legacy password: %v", err)
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	update := bson.M{"$set": bson.M{"password": hashed, "updated_at": models.Now()}}
+	if _, err := usersFor(c).UpdateOne(ctx, bson.M{"_id": userID}, update); err != nil {
+		log.Printf("Error upgrading legacy password: %v", err)
 	}
+	invalidateSessionUser(c, userID)
 }
 
-func HashPassword(password string) string {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+// ChangePassword replaces the session user's password after checking the
+// current one. The new password must reach minPasswordScore, and changing it
+// clears the must-change flag of a temporary password.
+func ChangePassword(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	if score, suggestions := auth.PasswordStrength(body.NewPassword); score < minPasswordScore {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "WEAK_PASSWORD", "error": "new password is too weak", "suggestions": suggestions})
+		return
+	}
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	var user models.User
+	if err := usersFor(c).FindOne(ctx, bson.M{"_id": owner}).Decode(&user); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	var valid bool
+	if auth.IsLegacyHash(*user.Password) {
+		valid = auth.VerifyLegacyPassword(body.CurrentPassword, *user.Password)
+	} else {
+		var err error
+		if valid, _, err = VerifyPassword(body.CurrentPassword, *user.Password); err != nil {
+			respondAuthBusy(c)
+			return
+		}
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		return
+	}
+
+	hashed, err := auth.HashPassword(body.NewPassword)
+	if errors.Is(err, auth.ErrBusy) {
+		respondAuthBusy(c)
+		return
+	}
 	if err != nil {
-		log.Panic(err)
+		log.Printf("Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password was not changed"})
+		return
+	}
+	update := bson.M{
+		"$set":   bson.M{"password": hashed, "updated_at": models.Now()},
+		"$unset": bson.M{"must_change_password": ""},
 	}
-	return string(bytes)
+	if _, err := usersFor(c).UpdateOne(ctx, bson.M{"_id": owner}, update); err != nil {
+		log.Printf("Error changing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password was not changed"})
+		return
+	}
+	invalidateSessionUser(c, owner)
+
+	c.JSON(http.StatusOK, gin.H{"success": "password changed"})
 }
 
-func VerifyPassword(userPassword string, providedPassword string) (bool, string) {
-	err := bcrypt.CompareHashAndPassword([]byte(providedPassword), []byte(userPassword))
-	check := true
+func VerifyPassword(userPassword string, providedPassword string) (bool, string, error) {
+	check, err := auth.VerifyPassword(userPassword, providedPassword)
+	if errors.Is(err, auth.ErrBusy) {
+		return false, "", err
+	}
 	msg := ""
 
 	if err != nil {
+		log.Printf("Error verifying password: %v", err)
+	}
+	if !check {
 		msg = "email or password is incorrect"
-		check = false
 	}
 
-	return check, msg
+	return check, msg, nil
+}
+
+// emailDomainAllowed reports whether signups are permitted for the domain of
+// email. ALLOWED_EMAIL_DOMAINS is a comma-separated list; an empty list allows
+// every domain. Matching is case-insensitive and an entry also covers its
+// subdomains, so "example.com" allows "eng.example.com" but not "badexample.com".
+func emailDomainAllowed(email string) bool {
+	allowed := os.Getenv("ALLOWED_EMAIL_DOMAINS")
+	if strings.TrimSpace(allowed) == "" {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+
+	for _, entry := range strings.Split(allowed, ",") {
+		entry = strings.ToLower(strings.Trim(strings.TrimSpace(entry), "@."))
+		if entry == "" {
+			continue
+		}
+		if domain == entry || strings.HasSuffix(domain, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileCompleteness reports which optional profile items the session user
+// has yet to fill in, for onboarding nudges.
+func ProfileCompleteness(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	objId, err := primitive.ObjectIDFromHex(sessionUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	var user models.User
+	if err := usersFor(c).FindOne(ctx, bson.M{"_id": objId}).Decode(&user); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondCacheable(c, user.ProfileCompleteness())
 }
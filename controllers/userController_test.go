@@ -0,0 +1,651 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/featureflags"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestEmailDomainAllowed(t *testing.T) {
+	cases := []struct {
+		allowed string
+		email   string
+		want    bool
+	}{
+		{"", "anyone@anywhere.org", true},
+		{"example.com", "jo@example.com", true},
+		{"example.com", "Jo@EXAMPLE.com", true},
+		{"example.com", "jo@eng.example.com", true},
+		{"example.com", "jo@badexample.com", false},
+		{"example.com", "jo@example.org", false},
+		{"example.org, @Example.com", "jo@example.com", true},
+	}
+	for _, tc := range cases {
+		t.Setenv("ALLOWED_EMAIL_DOMAINS", tc.allowed)
+		if got := emailDomainAllowed(tc.email); got != tc.want {
+			t.Errorf("ALLOWED_EMAIL_DOMAINS=%q: emailDomainAllowed(%q) = %v, want %v", tc.allowed, tc.email, got, tc.want)
+		}
+	}
+}
+
+func TestSignUpOutsideAllowedDomains(t *testing.T) {
+	t.Setenv("ALLOWED_EMAIL_DOMAINS", "example.com")
+	w := serve(SignUp, testRequest{
+		method: http.MethodPost, route: "/signup", path: "/signup",
+		body: `{"username": "Jo", "email": "jo@elsewhere.org", "password": "correct horse battery staple"}`,
+	})
+	assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusForbidden, "DOMAIN_NOT_ALLOWED")
+}
+
+// storedUser returns an account whose stored password is hash.
+func storedUser(hash string) models.User {
+	name, email := "Stored User", primitive.NewObjectID().Hex()+"@example.com"
+	return models.User{ID: primitive.NewObjectID(), Name: &name, Email: &email, Password: &hash}
+}
+
+// login posts the credentials to Login, with mt replying to the user lookup
+// with user and accepting the audit entry. Failed attempts are forgotten
+// when the test ends, so they do not trigger captchas in other tests.
+func login(t *testing.T, mt *mtest.T, user models.User, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	t.Cleanup(func() { loginFailures.clear(loginThrottleKeys(testClientIP, *user.Email)...) })
+	mt.AddMockResponses(cursorResponse(user), mtest.CreateSuccessResponse())
+	return serve(Login, testRequest{
+		method: http.MethodPost, route: "/login", path: "/login",
+		body: `{"email": "` + *user.Email + `", "password": "` + password + `"}`,
+	})
+}
+
+func TestLoginVerifiesEitherAlgorithm(t *testing.T) {
+	bcryptHash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	argon2Hash, _ := auth.Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}.Hash("correct horse")
+
+	for _, algo := range []string{"bcrypt", "argon2id"} {
+		t.Setenv("PASSWORD_ALGO", algo)
+		for _, hash := range []string{bcryptHash, argon2Hash} {
+			withMockDB(t, algo, func(mt *mtest.T) {
+				if w := login(t, mt, storedUser(hash), "correct horse"); w.Code != http.StatusOK {
+					t.Fatalf("PASSWORD_ALGO=%s, stored %.10s...: status = %d, body %s", algo, hash, w.Code, w.Body)
+				}
+				if w := login(t, mt, storedUser(hash), "wrong horse"); w.Code != http.StatusUnauthorized {
+					t.Fatalf("PASSWORD_ALGO=%s, stored %.10s...: wrong password got %d", algo, hash, w.Code)
+				}
+			})
+		}
+	}
+}
+
+func TestPasswordStrengthEndpoint(t *testing.T) {
+	cases := []struct {
+		password string
+		weak     bool
+	}{
+		{"password", true},
+		{"Tr1cky-Horse-Battery", false},
+	}
+	for _, tc := range cases {
+		w := serve(PasswordStrength, testRequest{
+			method: http.MethodPost, route: "/auth/password-strength", path: "/auth/password-strength",
+			body: `{"password": "` + tc.password + `"}`,
+		})
+		var body struct {
+			Score       int      `json:"score"`
+			MaxScore    int      `json:"max_score"`
+			Suggestions []string `json:"suggestions"`
+		}
+		decodeBody(t, w, &body)
+		if w.Code != http.StatusOK || body.MaxScore != auth.MaxPasswordScore {
+			t.Fatalf("%q: got %d %s", tc.password, w.Code, w.Body)
+		}
+		if weak := body.Score < body.MaxScore && len(body.Suggestions) > 0; weak != tc.weak {
+			t.Errorf("%q: score %d with suggestions %v", tc.password, body.Score, body.Suggestions)
+		}
+	}
+}
+
+func TestLoginBlockedWhileDeactivated(t *testing.T) {
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	user := storedUser(hash)
+	for _, active := range []bool{false, true} {
+		active := active
+		user.Active = &active
+		withMockDB(t, "login", func(mt *mtest.T) {
+			w := login(t, mt, user, "correct horse")
+			if active && w.Code != http.StatusOK {
+				t.Fatalf("reactivated: status = %d, body %s", w.Code, w.Body)
+			}
+			if !active {
+				assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusForbidden, "ACCOUNT_DEACTIVATED")
+			}
+		})
+	}
+}
+
+func TestDeactivatedSessionIsRejected(t *testing.T) {
+	user := newTestUser(t, "")
+	inactive := false
+	user.Active = &inactive
+	sessionUserCache.store(user.ID.Hex(), user)
+
+	w := serve(GetTodo, testRequest{method: http.MethodGet, route: "/todo/:id", path: "/todo/" + primitive.NewObjectID().Hex(), cookie: sessionCookie(t, user)})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401 for a deactivated account", w.Code)
+	}
+}
+
+func TestDeactivateAccount(t *testing.T) {
+	user := newTestUser(t, "")
+	withMockDB(t, "deactivate", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+		w := serve(DeactivateAccount, testRequest{method: http.MethodPost, route: "/me/deactivate", path: "/me/deactivate", cookie: sessionCookie(t, user)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		if update.Lookup("$set", "active").Boolean() {
+			t.Fatal("the account was not marked inactive")
+		}
+		if _, err := update.LookupErr("$inc", "token_version"); err != nil {
+			t.Fatal("the account's sessions were not revoked")
+		}
+		if cookie := w.Header().Get("Set-Cookie"); !strings.Contains(cookie, "token=;") {
+			t.Fatalf("the session cookie was not cleared: %q", cookie)
+		}
+	})
+}
+
+// sentMail records the messages of a fake mailer.
+type sentMail struct {
+	to, subject []string
+}
+
+func (m *sentMail) Send(to string, subject string, body string) error {
+	m.to = append(m.to, to)
+	m.subject = append(m.subject, subject)
+	return nil
+}
+
+// useSignupMailer swaps the signup mailer for one that records messages.
+func useSignupMailer(t *testing.T) *sentMail {
+	sent := &sentMail{}
+	previous := signupMailer
+	signupMailer = sent
+	t.Cleanup(func() { signupMailer = previous })
+	return sent
+}
+
+// setFlag sets a feature flag variable and reloads the flags, restoring both
+// when the test ends.
+func setFlag(t *testing.T, name string, value string) {
+	t.Cleanup(func() { featureflags.Load() })
+	t.Setenv(name, value)
+	featureflags.Load()
+}
+
+// signUp posts a signup for email, with mt replying as if the email were
+// already registered or not. Passwords are hashed at the lowest cost.
+func signUp(t *testing.T, mt *mtest.T, email string, existing bool) *httptest.ResponseRecorder {
+	t.Helper()
+	t.Setenv("BCRYPT_COST", "4")
+	if existing {
+		mt.AddMockResponses(cursorResponse(bson.M{"n": 1}))
+	} else {
+		mt.AddMockResponses(cursorResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+	}
+	return serve(SignUp, testRequest{
+		method: http.MethodPost, route: "/signup", path: "/signup",
+		body: `{"username": "Jo", "email": "` + email + `", "password": "correct horse battery staple"}`,
+	})
+}
+
+func TestSignUpExistingEmailExplicitByDefault(t *testing.T) {
+	sent := useSignupMailer(t)
+	withMockDB(t, "explicit", func(mt *mtest.T) {
+		w := signUp(t, mt, "taken@example.com", true)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "already exists") {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if len(sent.to) != 0 {
+			t.Fatalf("sent %v", sent.subject)
+		}
+	})
+}
+
+func TestSignUpEnumerationSafe(t *testing.T) {
+	setFlag(t, "ENUMERATION_SAFE", "true")
+	sent := useSignupMailer(t)
+	withMockDB(t, "enumeration safe", func(mt *mtest.T) {
+		existing := signUp(t, mt, "taken@example.com", true)
+		fresh := signUp(t, mt, "new@example.com", false)
+
+		for _, w := range []*httptest.ResponseRecorder{existing, fresh} {
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "check your email to continue") {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if cookies := w.Result().Cookies(); len(cookies) != 0 {
+				t.Fatalf("a session was started: %v", cookies)
+			}
+		}
+		if existing.Body.String() != fresh.Body.String() {
+			t.Fatalf("responses differ: %s and %s", existing.Body, fresh.Body)
+		}
+
+		want := []string{"taken@example.com", "new@example.com"}
+		if len(sent.to) != 2 || sent.to[0] != want[0] || sent.to[1] != want[1] {
+			t.Fatalf("emailed %v, want %v", sent.to, want)
+		}
+		if sent.subject[0] != "You already have an account" || sent.subject[0] == sent.subject[1] {
+			t.Fatalf("subjects = %q", sent.subject)
+		}
+	})
+}
+
+func TestLoginUpgradesLegacyPassword(t *testing.T) {
+	t.Setenv("LEGACY_PASSWORD_SCHEME", "sha256")
+	t.Setenv("BCRYPT_COST", "4")
+	user := storedUser("f52fbd32b2b3b86ff88ef6c490628285f482af15ddcb29541f94bcf526a3f6c7") // sha256 of hunter2
+
+	withMockDB(t, "upgrade", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(user),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+		w := serve(Login, testRequest{
+			method: http.MethodPost, route: "/login", path: "/login",
+			body: `{"email": "` + *user.Email + `", "password": "hunter2"}`,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+
+		var upgrade bson.Raw
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "update" {
+				upgrade = evt.Command.Lookup("updates").Array().Index(0).Value().Document()
+			}
+		}
+		if upgrade == nil {
+			t.Fatal("the legacy password was not rehashed")
+		}
+		if id := upgrade.Lookup("q", "_id").ObjectID(); id != user.ID {
+			t.Fatalf("updated %v, want %v", id, user.ID)
+		}
+		rehashed := upgrade.Lookup("u", "$set", "password").StringValue()
+		if auth.IsLegacyHash(rehashed) || bcrypt.CompareHashAndPassword([]byte(rehashed), []byte("hunter2")) != nil {
+			t.Fatalf("stored %q, want a bcrypt hash of the password", rehashed)
+		}
+	})
+}
+
+func TestLoginRejectsLegacyPasswordWithoutScheme(t *testing.T) {
+	user := storedUser("hunter2")
+	withMockDB(t, "no scheme", func(mt *mtest.T) {
+		if w := login(t, mt, user, "hunter2"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", w.Code)
+		}
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "update" {
+				t.Fatal("a password was rewritten after a failed login")
+			}
+		}
+	})
+}
+
+func TestTodoPageRedirectsUnderBasePath(t *testing.T) {
+	for basePath, want := range map[string]string{"": "/", "/tasky": "/tasky/", "tasky/": "/tasky/"} {
+		t.Setenv("BASE_PATH", basePath)
+		w := serve(Todo, testRequest{method: http.MethodGet, route: "/todo", path: "/todo"})
+		if w.Code != http.StatusFound || w.Header().Get("Location") != want {
+			t.Errorf("BASE_PATH=%q: got %d to %q, want a redirect to %q", basePath, w.Code, w.Header().Get("Location"), want)
+		}
+	}
+}
+
+func TestSessionCookiesUseBasePath(t *testing.T) {
+	t.Setenv("BASE_PATH", "/tasky")
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	withMockDB(t, "login", func(mt *mtest.T) {
+		w := login(t, mt, storedUser(hash), "correct horse")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) == 0 {
+			t.Fatal("no session cookie was set")
+		}
+		for _, cookie := range cookies {
+			if cookie.Path != "/tasky" {
+				t.Errorf("cookie %s has path %q, want /tasky", cookie.Name, cookie.Path)
+			}
+		}
+	})
+}
+
+func TestProfileCompletenessEndpoint(t *testing.T) {
+	user := newTestUser(t, "")
+	cookie := sessionCookie(t, user)
+	withMockDB(t, "completeness", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(bson.D{{Key: "_id", Value: user.ID}, {Key: "name", Value: *user.Name}, {Key: "email", Value: *user.Email}}))
+		w := serve(ProfileCompleteness, testRequest{method: http.MethodGet, route: "/me/completeness", path: "/me/completeness", cookie: cookie})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var body struct {
+			Score   int      `json:"score"`
+			Missing []string `json:"missing"`
+		}
+		decodeBody(t, w, &body)
+		if body.Score != 66 || len(body.Missing) != 1 || body.Missing[0] != "calendar_feed" {
+			t.Errorf("got %+v, want score 66 missing [calendar_feed]", body)
+		}
+		if id := commandFilter(t, mt, "find").Lookup("_id").ObjectID(); id != user.ID {
+			t.Errorf("looked up user %s, want the session user %s", id.Hex(), user.ID.Hex())
+		}
+	})
+}
+
+func TestSignUpLosingRaceIsEmailTaken(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	withMockDB(t, "race", func(mt *mtest.T) {
+		// The count finds no account, but another signup inserts one first
+		mt.AddMockResponses(cursorResponse(), mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "E11000 duplicate key error index: email_1"}))
+		w := serve(SignUp, testRequest{
+			method: http.MethodPost, route: "/signup", path: "/signup",
+			body: `{"username": "Jo", "email": "race@example.com", "password": "correct horse battery staple"}`,
+		})
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "already exists") {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+}
+
+// loginAccepting logs user in with the given Accept header, content type and
+// body, with mt replying to the lookup and the audit entry.
+func loginAccepting(t *testing.T, mt *mtest.T, user models.User, accept string, contentType string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	t.Cleanup(func() { loginFailures.clear(loginThrottleKeys(testClientIP, *user.Email)...) })
+	mt.AddMockResponses(cursorResponse(user), mtest.CreateSuccessResponse())
+	headers := map[string]string{"Content-Type": contentType}
+	if accept != "" {
+		headers["Accept"] = accept
+	}
+	return serve(Login, testRequest{method: http.MethodPost, route: "/login", path: "/login", body: body, headers: headers})
+}
+
+func TestLoginNegotiatesResponse(t *testing.T) {
+	t.Setenv("BASE_PATH", "/tasky")
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	user := storedUser(hash)
+	jsonBody := `{"email": "` + *user.Email + `", "password": "correct horse"}`
+
+	withMockDB(t, "form post", func(mt *mtest.T) {
+		form := "email=" + url.QueryEscape(*user.Email) + "&password=correct+horse"
+		w := loginAccepting(t, mt, user, "text/html,application/xhtml+xml,*/*;q=0.8", "application/x-www-form-urlencoded", form)
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "/tasky/todo" {
+			t.Fatalf("got %d to %q, want a redirect to /tasky/todo", w.Code, w.Header().Get("Location"))
+		}
+		if !strings.Contains(w.Header().Get("Set-Cookie"), "token=") {
+			t.Error("the redirect does not set the session cookie")
+		}
+	})
+
+	for _, accept := range []string{"application/json", ""} {
+		withMockDB(t, "json", func(mt *mtest.T) {
+			w := loginAccepting(t, mt, user, accept, "application/json", jsonBody)
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "login successful") {
+				t.Fatalf("Accept %q: status = %d, body %s", accept, w.Code, w.Body)
+			}
+		})
+	}
+
+	withMockDB(t, "wrong password", func(mt *mtest.T) {
+		w := loginAccepting(t, mt, user, "text/html", "application/json", `{"email": "`+*user.Email+`", "password": "wrong"}`)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401 rather than a redirect", w.Code)
+		}
+	})
+}
+
+func TestLoginTokenTransport(t *testing.T) {
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	for _, tc := range []struct {
+		transport     string
+		cookie, token bool
+	}{
+		{auth.TransportBoth, true, true},
+		{auth.TransportCookie, true, false},
+		{auth.TransportHeader, false, true},
+	} {
+		t.Setenv("TOKEN_TRANSPORT", tc.transport)
+		withMockDB(t, tc.transport, func(mt *mtest.T) {
+			w := login(t, mt, storedUser(hash), "correct horse")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if cookies := w.Result().Cookies(); (len(cookies) > 0) != tc.cookie {
+				t.Errorf("set cookies %v, want cookies %v", cookies, tc.cookie)
+			}
+			var body struct {
+				Token string `json:"token"`
+			}
+			decodeBody(t, w, &body)
+			if (body.Token != "") != tc.token {
+				t.Errorf("token in body = %q, want one %v", body.Token, tc.token)
+			}
+		})
+
+		w := serve(Logout, testRequest{method: http.MethodPost, route: "/logout", path: "/logout"})
+		if cleared := w.Header().Get("Set-Cookie") != ""; cleared != tc.cookie {
+			t.Errorf("TOKEN_TRANSPORT=%s: logout cleared cookies %v, want %v", tc.transport, cleared, tc.cookie)
+		}
+	}
+}
+
+func TestSessionCookieLifetime(t *testing.T) {
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	withMockDB(t, "login", func(mt *mtest.T) {
+		w := login(t, mt, storedUser(hash), "correct horse")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 3 {
+			t.Fatalf("set cookies %v, want token, userID and username", cookies)
+		}
+		for _, cookie := range cookies {
+			if cookie.Expires.IsZero() || cookie.MaxAge <= 0 {
+				t.Fatalf("%s: Expires %v, Max-Age %d; want both", cookie.Name, cookie.Expires, cookie.MaxAge)
+			}
+			lifetime := time.Until(cookie.Expires)
+			if skew := lifetime - time.Duration(cookie.MaxAge)*time.Second; skew < -2*time.Second || skew > 2*time.Second {
+				t.Errorf("%s: Max-Age %ds disagrees with Expires in %v", cookie.Name, cookie.MaxAge, lifetime)
+			}
+		}
+	})
+
+	w := serve(Logout, testRequest{method: http.MethodPost, route: "/logout", path: "/logout"})
+	cookies := w.Result().Cookies()
+	if len(cookies) != 3 {
+		t.Fatalf("logout set cookies %v, want token, userID and username cleared", cookies)
+	}
+	for _, cookie := range cookies {
+		if cookie.MaxAge >= 0 || cookie.Value != "" || !cookie.Expires.Before(time.Now()) {
+			t.Errorf("%s is not cleared: Max-Age %d, Expires %v", cookie.Name, cookie.MaxAge, cookie.Expires)
+		}
+	}
+}
+
+// sessionWorks reports whether token still authenticates an API request,
+// with mt answering a lookup of the session user with stored.
+func sessionWorks(t *testing.T, mt *mtest.T, stored models.User, token string) bool {
+	t.Helper()
+	mt.AddMockResponses(cursorResponse(stored))
+	w := serve(func(c *gin.Context) {
+		if auth.ValidateSessionAPI(c) {
+			c.Status(http.StatusNoContent)
+		}
+	}, testRequest{method: http.MethodGet, route: "/me", path: "/me", cookie: &http.Cookie{Name: "token", Value: token}})
+	return w.Code == http.StatusNoContent
+}
+
+// loginToken logs user in on a new device, with mt replying to a session
+// revocation with version when one is made, and returns the session token.
+func loginToken(t *testing.T, mt *mtest.T, user models.User, version int) string {
+	t.Helper()
+	t.Cleanup(func() { loginFailures.clear(loginThrottleKeys(testClientIP, *user.Email)...) })
+	mt.AddMockResponses(cursorResponse(user))
+	if featureflags.SingleSession() {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.M{"_id": user.ID, "token_version": version}}))
+	}
+	mt.AddMockResponses(mtest.CreateSuccessResponse())
+	w := serve(Login, testRequest{
+		method: http.MethodPost, route: "/login", path: "/login",
+		body: `{"email": "` + *user.Email + `", "password": "correct horse"}`,
+	})
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "token" {
+			return cookie.Value
+		}
+	}
+	t.Fatalf("login set no token: %d %s", w.Code, w.Body)
+	return ""
+}
+
+func TestSingleSession(t *testing.T) {
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+
+	withMockDB(t, "default", func(mt *mtest.T) {
+		user := storedUser(hash)
+		first := loginToken(t, mt, user, 0)
+		second := loginToken(t, mt, user, 0)
+		if !sessionWorks(t, mt, user, first) || !sessionWorks(t, mt, user, second) {
+			t.Fatal("a second login signed the first device out without SINGLE_SESSION")
+		}
+	})
+
+	setFlag(t, "SINGLE_SESSION", "true")
+	withMockDB(t, "single", func(mt *mtest.T) {
+		user := storedUser(hash)
+		first := loginToken(t, mt, user, 1)
+		user.TokenVersion = 1
+		second := loginToken(t, mt, user, 2)
+		user.TokenVersion = 2
+
+		if sessionWorks(t, mt, user, first) {
+			t.Error("the first device's token still works after a second login")
+		}
+		if !sessionWorks(t, mt, user, second) {
+			t.Error("the second device's token does not work")
+		}
+
+		var revocations int
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "findAndModify" && evt.Command.Lookup("update", "$inc", "token_version").AsInt64() == 1 {
+				revocations++
+			}
+		}
+		if revocations != 2 {
+			t.Errorf("%d logins bumped the token version, want 2", revocations)
+		}
+	})
+}
+
+func TestBadCredentialsAreIndistinguishable(t *testing.T) {
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("correct horse")
+	var unknown, wrong *httptest.ResponseRecorder
+
+	withMockDB(t, "unknown email", func(mt *mtest.T) {
+		email := primitive.NewObjectID().Hex() + "@example.com"
+		t.Cleanup(func() { loginFailures.clear(loginThrottleKeys(testClientIP, email)...) })
+		mt.AddMockResponses(cursorResponse(), mtest.CreateSuccessResponse())
+		unknown = serve(Login, testRequest{
+			method: http.MethodPost, route: "/login", path: "/login",
+			body: `{"email": "` + email + `", "password": "correct horse"}`,
+		})
+	})
+	withMockDB(t, "wrong password", func(mt *mtest.T) {
+		wrong = login(t, mt, storedUser(hash), "wrong horse")
+	})
+
+	if unknown.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized {
+		t.Fatalf("statuses %d and %d, want 401 for both", unknown.Code, wrong.Code)
+	}
+	if !bytes.Equal(unknown.Body.Bytes(), wrong.Body.Bytes()) {
+		t.Errorf("bodies differ:\n%s\n%s", unknown.Body, wrong.Body)
+	}
+	if !reflect.DeepEqual(unknown.Header(), wrong.Header()) {
+		t.Errorf("headers differ:\n%v\n%v", unknown.Header(), wrong.Header())
+	}
+
+	withMockDB(t, "database error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11600, Message: "interrupted"}))
+		w := serve(Login, testRequest{
+			method: http.MethodPost, route: "/login", path: "/login",
+			body: `{"email": "someone@example.com", "password": "correct horse"}`,
+		})
+		if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "incorrect") {
+			t.Errorf("a lookup failure answered %d %s, want a 500 that does not blame the credentials", w.Code, w.Body)
+		}
+	})
+}
+
+func TestChangePasswordClearsMustChange(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	hash, _ := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("temporary-password-1")
+	user := storedUser(hash)
+	user.MustChangePassword = true
+	// The session user is cached again for every request, since a change
+	// evicts it
+	change := func(body string) testRequest {
+		sessionUserCache.store(user.ID.Hex(), user)
+		return testRequest{method: http.MethodPut, route: "/me/password", path: "/me/password", body: body, cookie: sessionCookie(t, user)}
+	}
+
+	withMockDB(t, "changed", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(user), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		w := serve(ChangePassword, change(`{"current_password": "temporary-password-1", "new_password": "`+strongPassword+`"}`))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var update bson.Raw
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "update" {
+				update = evt.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+			}
+		}
+		if ok, _ := auth.VerifyPassword(strongPassword, update.Lookup("$set", "password").StringValue()); !ok {
+			t.Error("the new password was not stored")
+		}
+		if _, err := update.LookupErr("$unset", "must_change_password"); err != nil {
+			t.Errorf("update %v keeps the must-change flag", update)
+		}
+	})
+
+	withMockDB(t, "wrong current password", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorResponse(user))
+		if w := serve(ChangePassword, change(`{"current_password": "guess", "new_password": "`+strongPassword+`"}`)); w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", w.Code)
+		}
+	})
+
+	w := serve(ChangePassword, change(`{"current_password": "temporary-password-1", "new_password": "password"}`))
+	assertErrorCode(t, w.Code, w.Body.Bytes(), http.StatusBadRequest, "WEAK_PASSWORD")
+}
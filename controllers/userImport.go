@@ -0,0 +1,288 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxUserImportRows caps the accounts one import may create. Every row is a
+// password hash, so large batches would hold the request for a long time.
+const maxUserImportRows = 100
+
+// userImportWorkers bounds the rows of one import hashed at once. Each hash
+// also waits for a slot under AUTH_MAX_CONCURRENCY, so imports cannot starve
+// logins.
+const userImportWorkers = 4
+
+// minPasswordScore is the auth.PasswordStrength score a password chosen on
+// someone's behalf, or changed later, must reach.
+const minPasswordScore = 3
+
+// userImportRow is one account to create. Without a password a temporary one
+// is generated and the user must change it.
+type userImportRow struct {
+	Name     string  `json:"name"`
+	Email    string  `json:"email"`
+	Password *string `json:"password"`
+}
+
+// userImportResult reports what happened to one row, in request order.
+type userImportResult struct {
+	Index int    `json:"index"`
+	Email string `json:"email"`
+	ID    string `json:"id,omitempty"`
+	// TemporaryPassword is only returned for rows without a password, and
+	// only in this response
+	TemporaryPassword string `json:"temporary_password,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// ImportUsers creates accounts for admins from a JSON array of rows. Each row
+// is validated on its own; rows that fail are reported and the others are
+// still created. The response lists every row's outcome.
+func ImportUsers(c *gin.Context) {
+	if !auth.ValidateAdminAPI(c) {
+		return
+	}
+
+	var rows []userImportRow
+	if !bindGuardedJSON(c, &rows) {
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be a non-empty array of users"})
+		return
+	}
+	if len(rows) > maxUserImportRows {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("at most %d users can be imported at once", maxUserImportRows)})
+		return
+	}
+
+	results := make([]userImportResult, len(rows))
+	seen := map[string]bool{}
+	emails := []string{}
+	for i := range rows {
+		row := &rows[i]
+		row.Name = strings.TrimSpace(row.Name)
+		results[i] = userImportResult{Index: i, Email: row.Email}
+		if err := validateImportUser(*row); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		normalizeEmail(&row.Email)
+		results[i].Email = row.Email
+		if seen[row.Email] {
+			results[i].Error = "email appears more than once in the import"
+			continue
+		}
+		seen[row.Email] = true
+		emails = append(emails, row.Email)
+	}
+
+	// Hash first: the query timeout and the transaction start with the
+	// first database call and should not be spent waiting on bcrypt
+	passwords, err := importPasswords(rows, results)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate a password"})
+		return
+	}
+	hashes, err := hashImportPasswords(passwords)
+	if errors.Is(err, auth.ErrBusy) {
+		respondAuthBusy(c)
+		return
+	}
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "users were not imported"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	taken, err := existingEmails(ctx, usersFor(c), emails)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	var users []interface{}
+	var userRows []int
+	now := models.Now()
+	for i, row := range rows {
+		if results[i].Error != "" {
+			continue
+		}
+		if taken[row.Email] {
+			results[i].Error = "a user with this email already exists"
+			continue
+		}
+
+		mustChange, hash := row.Password == nil, hashes[i]
+		name, email := row.Name, row.Email
+		user := models.User{
+			ID:                 primitive.NewObjectID(),
+			Name:               &name,
+			Email:              &email,
+			Password:           &hash,
+			MustChangePassword: mustChange,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+		}
+		users = append(users, user)
+		userRows = append(userRows, i)
+		results[i].ID = user.ID.Hex()
+		if mustChange {
+			results[i].TemporaryPassword = passwords[i]
+		}
+	}
+
+	if len(users) > 0 {
+		// Unordered, so a row that loses a race on the unique email index
+		// does not stop the rows after it
+		_, err := usersFor(c).InsertMany(ctx, users, options.InsertMany().SetOrdered(false))
+		var bulkErr mongo.BulkWriteException
+		if err != nil && !errors.As(err, &bulkErr) {
+			log.Printf("Error importing users: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "users were not imported"})
+			return
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			i := userRows[writeErr.Index]
+			results[i].ID = ""
+			results[i].TemporaryPassword = ""
+			results[i].Error = "user was not created"
+			if database.IsDuplicateKeyCode(writeErr.Code) {
+				results[i].Error = "a user with this email already exists"
+			}
+		}
+	}
+
+	created := 0
+	for _, result := range results {
+		if result.Error == "" {
+			created++
+			recordAudit(c, result.ID, auditUserImported)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"created": created, "failed": len(results) - created, "results": results})
+}
+
+// validateImportUser checks the fields of one import row on their own.
+func validateImportUser(row userImportRow) error {
+	if row.Name == "" || row.Email == "" {
+		return errors.New("name and email are required")
+	}
+	if addr, err := mail.ParseAddress(row.Email); err != nil || addr.Address != row.Email {
+		return errors.New("email address is not valid")
+	}
+	if row.Password != nil {
+		if score, _ := auth.PasswordStrength(*row.Password); score < minPasswordScore {
+			return errors.New("password is too weak")
+		}
+	}
+	return nil
+}
+
+// importPasswords returns the password to set for each row that passed
+// validation, generating a temporary one for rows without. Rows that failed
+// get "".
+func importPasswords(rows []userImportRow, results []userImportResult) ([]string, error) {
+	passwords := make([]string, len(rows))
+	for i, row := range rows {
+		switch {
+		case results[i].Error != "":
+		case row.Password != nil:
+			passwords[i] = *row.Password
+		default:
+			password, err := temporaryPassword()
+			if err != nil {
+				return nil, err
+			}
+			passwords[i] = password
+		}
+	}
+	return passwords, nil
+}
+
+// hashImportPasswords hashes every non-empty password, userImportWorkers at
+// a time. It returns the hashes by row, or the first error.
+func hashImportPasswords(passwords []string) ([]string, error) {
+	hashes := make([]string, len(passwords))
+	errs := make([]error, len(passwords))
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < userImportWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rows {
+				hashes[i], errs[i] = auth.HashPassword(passwords[i])
+			}
+		}()
+	}
+	for i, password := range passwords {
+		if password != "" {
+			rows <- i
+		}
+	}
+	close(rows)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+// existingEmails returns which of emails already belong to an account.
+func existingEmails(ctx context.Context, users *mongo.Collection, emails []string) (map[string]bool, error) {
+	taken := map[string]bool{}
+	if len(emails) == 0 {
+		return taken, nil
+	}
+	cursor, err := users.Find(ctx, bson.M{"email": bson.M{"$in": emails}}, options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []models.User
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	for _, user := range found {
+		if user.Email != nil {
+			taken[*user.Email] = true
+		}
+	}
+	return taken, nil
+}
+
+// temporaryPassword returns a random 24-character password, long enough to
+// reach minPasswordScore on its own.
+func temporaryPassword() (string, error) {
+	raw := make([]byte, 18)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jeffthorne/tasky/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+const strongPassword = "Vq8#mZr!2pLx9@Tw"
+
+// importUsers posts body to the user import as an admin and decodes the
+// per-row results.
+func importUsers(t *testing.T, body string) (int, []userImportResult) {
+	t.Helper()
+	w := serve(ImportUsers, testRequest{
+		method: http.MethodPost, route: "/admin/users/import", path: "/admin/users/import",
+		body: body, cookie: sessionCookie(t, newTestUser(t, "admin")),
+	})
+	var response struct {
+		Results []userImportResult `json:"results"`
+	}
+	if w.Code == http.StatusOK {
+		decodeBody(t, w, &response)
+	}
+	return w.Code, response.Results
+}
+
+// insertedUsers returns the documents of the InsertMany sent.
+func insertedUsers(t *testing.T, mt *mtest.T) []bson.Raw {
+	t.Helper()
+	for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+		if evt.CommandName == "insert" && evt.Command.Lookup("insert").StringValue() == "user" {
+			values, _ := evt.Command.Lookup("documents").Array().Values()
+			docs := make([]bson.Raw, len(values))
+			for i, value := range values {
+				docs[i] = value.Document()
+			}
+			return docs
+		}
+	}
+	t.Fatal("no users were inserted")
+	return nil
+}
+
+func TestImportUsers(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	body := `[
+		{"name": "Ada", "email": "ada@example.com", "password": "` + strongPassword + `"},
+		{"name": "Grace", "email": "Grace@Example.com"},
+		{"name": "Ada again", "email": "ada@example.com"},
+		{"name": "Taken", "email": "taken@example.com"},
+		{"name": "Weak", "email": "weak@example.com", "password": "password"},
+		{"name": "Broken", "email": "not an email"}
+	]`
+
+	withMockDB(t, "mixed rows", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(bson.M{"email": "taken@example.com"}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+		status, results := importUsers(t, body)
+		if status != http.StatusOK || len(results) != 6 {
+			t.Fatalf("status = %d, results %+v", status, results)
+		}
+
+		for i, want := range []string{"", "", "more than once", "already exists", "too weak", "not valid"} {
+			if got := results[i].Error; (want == "") != (got == "") || !strings.Contains(got, want) {
+				t.Errorf("row %d: error %q, want %q", i, got, want)
+			}
+		}
+		if results[0].TemporaryPassword != "" || results[0].ID == "" {
+			t.Errorf("row with a password: %+v", results[0])
+		}
+		temporary := results[1].TemporaryPassword
+		if len(temporary) != 24 || results[1].Email != "grace@example.com" {
+			t.Errorf("row without a password: %+v", results[1])
+		}
+
+		users := insertedUsers(t, mt)
+		if len(users) != 2 {
+			t.Fatalf("inserted %d users, want 2", len(users))
+		}
+		if _, err := users[0].LookupErr("must_change_password"); err == nil {
+			t.Error("a user who chose a password must change it")
+		}
+		if !users[1].Lookup("must_change_password").Boolean() {
+			t.Error("a user with a temporary password need not change it")
+		}
+		for i, password := range []string{strongPassword, temporary} {
+			stored := users[i].Lookup("password").StringValue()
+			if ok, err := auth.VerifyPassword(password, stored); err != nil || !ok {
+				t.Errorf("user %d: stored %q does not verify the password", i, stored)
+			}
+		}
+	})
+
+	withMockDB(t, "lost race", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorResponse(),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}),
+			mtest.CreateSuccessResponse(),
+		)
+		_, results := importUsers(t, `[{"name": "A", "email": "a@example.com"}, {"name": "B", "email": "b@example.com"}]`)
+		if results[0].Error != "" || results[0].TemporaryPassword == "" {
+			t.Errorf("first row: %+v", results[0])
+		}
+		if !strings.Contains(results[1].Error, "already exists") || results[1].ID != "" || results[1].TemporaryPassword != "" {
+			t.Errorf("row that lost the race: %+v", results[1])
+		}
+	})
+}
+
+func TestImportUsersLimits(t *testing.T) {
+	rows := make([]string, maxUserImportRows+1)
+	for i := range rows {
+		rows[i] = fmt.Sprintf(`{"name": "u", "email": "u%d@example.com"}`, i)
+	}
+	if status, _ := importUsers(t, "["+strings.Join(rows, ",")+"]"); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("%d rows: status = %d, want 413", len(rows), status)
+	}
+	if status, _ := importUsers(t, "[]"); status != http.StatusBadRequest {
+		t.Errorf("no rows: status = %d, want 400", status)
+	}
+
+	w := serve(ImportUsers, testRequest{
+		method: http.MethodPost, route: "/admin/users/import", path: "/admin/users/import",
+		body: `[{"name": "u", "email": "u@example.com"}]`, cookie: sessionCookie(t, newTestUser(t, "")),
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d, want 403", w.Code)
+	}
+}
+
+func TestHashImportPasswords(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	passwords := []string{"first", "", "second", "third", "fourth", "fifth"}
+	hashes, err := hashImportPasswords(passwords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, password := range passwords {
+		if password == "" {
+			if hashes[i] != "" {
+				t.Errorf("row %d has no password but was hashed", i)
+			}
+			continue
+		}
+		if ok, err := auth.VerifyPassword(password, hashes[i]); err != nil || !ok {
+			t.Errorf("row %d: hash %q does not verify its password", i, hashes[i])
+		}
+	}
+}
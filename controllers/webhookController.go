@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/models"
+	"github.com/jeffthorne/tasky/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetWebhook configures the URL that receives the session user's todo
+// events, and issues a new signing secret. An empty url removes the webhook.
+func SetWebhook(c *gin.Context) {
+	session := auth.ValidateSessionAPI(c)
+	if !session {
+		return
+	}
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		URL string `json:"url"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	update := bson.M{"$unset": bson.M{"webhook": ""}, "$set": bson.M{"updated_at": models.Now()}}
+	var secret string
+	if body.URL != "" {
+		if err := webhook.ValidateURL(body.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate webhook secret"})
+			return
+		}
+		secret = hex.EncodeToString(raw)
+		update = bson.M{"$set": bson.M{
+			"webhook":    models.Webhook{URL: body.URL, Secret: secret},
+			"updated_at": models.Now(),
+		}}
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+	ctx = txnContext(c, ctx)
+
+	if _, err := usersFor(c).UpdateOne(ctx, bson.M{"_id": owner}, update); err != nil {
+		log.Printf("Error storing webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "webhook was not saved"})
+		return
+	}
+
+	if body.URL == "" {
+		c.JSON(http.StatusOK, gin.H{"success": "webhook removed"})
+		return
+	}
+	// The secret is only shown here; configuring the webhook again rotates it
+	c.JSON(http.StatusOK, gin.H{"url": body.URL, "secret": secret})
+}
+
+// dispatchTodoEvent notifies owner's webhook, if any, of an event for each of
+// todos once the change has committed. Deliveries happen in the background
+// and never fail the request.
+func dispatchTodoEvent(c *gin.Context, owner primitive.ObjectID, eventType string, todos ...models.Todo) {
+	afterCommit(c, func() { notifyTodoEvent(c, owner, eventType, todos) })
+}
+
+func notifyTodoEvent(c *gin.Context, owner primitive.ObjectID, eventType string, todos []models.Todo) {
+	// Read outside the request transaction, which has ended
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	var user models.User
+	findOptions := options.FindOne().SetProjection(bson.M{"webhook": 1})
+	if err := usersFor(c).FindOne(ctx, bson.M{"_id": owner}, findOptions).Decode(&user); err != nil {
+		log.Printf("Error loading webhook for %v: %v", owner.Hex(), err)
+		return
+	}
+	if user.Webhook == nil {
+		return
+	}
+	for _, todo := range todos {
+		webhook.Default.Dispatch(user.Webhook.URL, user.Webhook.Secret, webhook.Event{
+			Type:      eventType,
+			Timestamp: time.Now().UTC(),
+			Data:      todo,
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// setWebhook puts body to the session user's webhook setting.
+func setWebhook(t *testing.T, body string) testRequest {
+	return testRequest{method: http.MethodPut, route: "/me/webhook", path: "/me/webhook", body: body, cookie: sessionCookie(t, newTestUser(t, ""))}
+}
+
+func TestSetWebhookIssuesSecret(t *testing.T) {
+	withMockDB(t, "set", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		w := serve(SetWebhook, setWebhook(t, `{"url": "https://hooks.example.com/tasky"}`))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var body struct {
+			URL    string `json:"url"`
+			Secret string `json:"secret"`
+		}
+		decodeBody(t, w, &body)
+		if len(body.Secret) != 64 {
+			t.Errorf("secret %q is not 32 random bytes in hex", body.Secret)
+		}
+
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if url := statement.Lookup("u", "$set", "webhook", "url").StringValue(); url != body.URL {
+			t.Errorf("stored url %q, want %q", url, body.URL)
+		}
+		if secret := statement.Lookup("u", "$set", "webhook", "secret").StringValue(); secret != body.Secret {
+			t.Error("the stored secret differs from the one returned")
+		}
+	})
+}
+
+func TestSetWebhookRemoves(t *testing.T) {
+	withMockDB(t, "remove", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		if w := serve(SetWebhook, setWebhook(t, `{"url": ""}`)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if _, err := statement.LookupErr("u", "$unset", "webhook"); err != nil {
+			t.Error("the webhook was not unset")
+		}
+	})
+}
+
+func TestSetWebhookRequiresHTTPS(t *testing.T) {
+	for _, url := range []string{"http://hooks.example.com/tasky", "hooks.example.com", "https://user:pw@example.com/"} {
+		if w := serve(SetWebhook, setWebhook(t, `{"url": "`+url+`"}`)); w.Code != http.StatusBadRequest {
+			t.Errorf("url %q: status = %d, want 400", url, w.Code)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package ctxkeys names the values middlewares store in the gin context and
+// reads them back typed, so handlers never spell a context key by hand.
+package ctxkeys
+
+import "github.com/gin-gonic/gin"
+
+// Key is a gin context key. gin keys are plain strings; using Key through
+// Set and Get keeps every key declared here.
+type Key string
+
+const (
+	// UserID is the authenticated user's id as a hex string.
+	UserID Key = "userID"
+	// Role is the authenticated user's role.
+	Role Key = "role"
+	// Tenant is the tenant named by the X-Tenant-ID header; absent for the
+	// default database.
+	Tenant Key = "tenant"
+	// Claims holds the *auth.Claims of an accepted session token.
+	Claims Key = "claims"
+	// DBSession holds the mongo.Session of the request's transaction.
+	DBSession Key = "dbSession"
+	// AfterCommit holds the *[]func() run once the request's transaction
+	// has committed.
+	AfterCommit Key = "afterCommit"
+)
+
+// Set stores value under key.
+func Set(c *gin.Context, key Key, value interface{}) {
+	c.Set(string(key), value)
+}
+
+// Get returns the value stored under key, if any.
+func Get(c *gin.Context, key Key) (interface{}, bool) {
+	return c.Get(string(key))
+}
+
+// SetUserID records the authenticated user's id.
+func SetUserID(c *gin.Context, id string) {
+	Set(c, UserID, id)
+}
+
+// GetUserID returns the authenticated user's id. ok is false before
+// authentication.
+func GetUserID(c *gin.Context) (string, bool) {
+	return getString(c, UserID)
+}
+
+// SetRole records the authenticated user's role.
+func SetRole(c *gin.Context, role string) {
+	Set(c, Role, role)
+}
+
+// GetRole returns the authenticated user's role. ok is false before
+// authentication.
+func GetRole(c *gin.Context) (string, bool) {
+	return getString(c, Role)
+}
+
+// SetTenant records the tenant the request is scoped to.
+func SetTenant(c *gin.Context, tenant string) {
+	Set(c, Tenant, tenant)
+}
+
+// GetTenant returns the tenant the request is scoped to. ok is false for
+// requests using the default database.
+func GetTenant(c *gin.Context) (string, bool) {
+	return getString(c, Tenant)
+}
+
+func getString(c *gin.Context, key Key) (string, bool) {
+	value, ok := Get(c, key)
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	return s, ok
+}
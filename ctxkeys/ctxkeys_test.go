@@ -0,0 +1,78 @@
+package ctxkeys
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	return c
+}
+
+func TestStringAccessors(t *testing.T) {
+	for _, tc := range []struct {
+		key Key
+		set func(*gin.Context, string)
+		get func(*gin.Context) (string, bool)
+	}{
+		{UserID, SetUserID, GetUserID},
+		{Role, SetRole, GetRole},
+		{Tenant, SetTenant, GetTenant},
+	} {
+		c := newContext()
+		if value, ok := tc.get(c); ok || value != "" {
+			t.Errorf("%s before set = %q, %v, want absent", tc.key, value, ok)
+		}
+
+		tc.set(c, "value")
+		if value, ok := tc.get(c); !ok || value != "value" {
+			t.Errorf("%s = %q, %v, want %q", tc.key, value, ok, "value")
+		}
+		// The key strings are what gin stores, so they must not change
+		if value, _ := c.Get(string(tc.key)); value != "value" {
+			t.Errorf("gin key %q holds %v", tc.key, value)
+		}
+
+		// An empty value is still present
+		tc.set(c, "")
+		if value, ok := tc.get(c); !ok || value != "" {
+			t.Errorf("%s set empty = %q, %v, want present and empty", tc.key, value, ok)
+		}
+	}
+}
+
+func TestStringAccessorsRejectOtherTypes(t *testing.T) {
+	c := newContext()
+	Set(c, UserID, 42)
+	if value, ok := GetUserID(c); ok || value != "" {
+		t.Errorf("GetUserID with an int = %q, %v, want absent", value, ok)
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	c := newContext()
+	if _, ok := Get(c, Claims); ok {
+		t.Error("Claims present before set")
+	}
+	claims := &struct{ Username string }{"someone"}
+	Set(c, Claims, claims)
+	if value, ok := Get(c, Claims); !ok || value != claims {
+		t.Errorf("Claims = %v, %v, want %v", value, ok, claims)
+	}
+	if _, ok := Get(c, DBSession); ok {
+		t.Error("setting Claims set DBSession")
+	}
+}
+
+func TestKeysAreDistinct(t *testing.T) {
+	seen := map[Key]bool{}
+	for _, key := range []Key{UserID, Role, Tenant, Claims, DBSession, AfterCommit} {
+		if seen[key] {
+			t.Errorf("key %q is declared twice", key)
+		}
+		seen[key] = true
+	}
+}
@@ -4,33 +4,45 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jeffthorne/tasky/secrets"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 var Client *mongo.Client
 
+// minPoolSize is the number of connections the pool keeps open, and the
+// number primed by warm-up.
+const minPoolSize = 2
+
+// connectAttempts is how many times startup pings MongoDB before giving up,
+// so the app can start alongside a database that is still booting.
+const connectAttempts = 3
+
+// init connects eagerly unless SKIP_DB_INIT is set, which leaves Client nil
+// so tests of pure helpers can import the package without a database.
 func init() {
+	if skip, _ := strconv.ParseBool(os.Getenv("SKIP_DB_INIT")); skip {
+		log.Println("SKIP_DB_INIT is set, not connecting to MongoDB")
+		return
+	}
 	Client = CreateMongoClient()
 }
 
 func CreateMongoClient() *mongo.Client {
 	godotenv.Overload()
-	MongoDbURI := os.Getenv("MONGODB_URI")
+	MongoDbURI := secrets.Resolve("MONGODB_URI")
 
-	// Create client options with connection pooling and timeouts
-	clientOptions := options.Client().
-		ApplyURI(MongoDbURI).
-		SetMaxPoolSize(10).                         // Maximum number of connections in the pool
-		SetMinPoolSize(2).                          // Minimum number of connections in the pool
-		SetMaxConnIdleTime(30 * time.Second).       // Maximum time a connection can be idle
-		SetServerSelectionTimeout(5 * time.Second). // Server selection timeout
-		SetConnectTimeout(10 * time.Second).        // Connection timeout
-		SetSocketTimeout(10 * time.Second)          // Socket timeout for operations
+	clientOptions := newClientOptions(MongoDbURI)
 
 	// Create context with timeout for connection
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -43,17 +55,145 @@ func CreateMongoClient() *mongo.Client {
 	}
 
 	// Test the connection
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		log.Fatal("Failed to ping MongoDB:", err)
+	for attempt := 1; ; attempt++ {
+		pingCtx, pingCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = client.Ping(pingCtx, nil)
+		pingCancel()
+		if err == nil {
+			break
+		}
+		if attempt == connectAttempts {
+			log.Fatal("Failed to ping MongoDB:", err)
+		}
+		log.Printf("MongoDB ping failed (attempt %d of %d), retrying: %v", attempt, connectAttempts, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
 	}
 
-	fmt.Println("Connected to MONGO -> ", MongoDbURI)
+	if warmupEnabled() {
+		warmUp(ctx, client, minPoolSize)
+	}
+
+	fmt.Println("Connected to MONGO -> ", redactURI(MongoDbURI))
 	return client
 }
 
+// redactURI masks the password in a MongoDB connection string so it can be
+// logged.
+func redactURI(uri string) string {
+	if u, err := url.Parse(uri); err == nil {
+		return u.Redacted()
+	}
+	// Seed lists such as host1:27017,host2:27017 are not valid URLs
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return "<unparseable URI>"
+	}
+	end := strings.Index(rest, "/")
+	if end < 0 {
+		end = len(rest)
+	}
+	authority := rest[:end]
+	if at := strings.LastIndex(authority, "@"); at >= 0 {
+		if user, _, hasPassword := strings.Cut(authority[:at], ":"); hasPassword {
+			authority = user + ":xxxxx" + authority[at:]
+		}
+	}
+	return scheme + "://" + authority + rest[end:]
+}
+
+// defaultAppName identifies the app's connections in MongoDB's currentOp
+// output and logs when neither MONGO_APP_NAME nor the URI names it.
+const defaultAppName = "tasky"
+
+// newClientOptions builds the client options for uri, including the optional
+// settings read from the environment.
+func newClientOptions(uri string) *options.ClientOptions {
+	// Create client options with connection pooling and timeouts
+	clientOptions := options.Client().
+		ApplyURI(uri).
+		SetMaxPoolSize(10).                         // Maximum number of connections in the pool
+		SetMinPoolSize(minPoolSize).                // Minimum number of connections in the pool
+		SetMaxConnIdleTime(30 * time.Second).       // Maximum time a connection can be idle
+		SetServerSelectionTimeout(5 * time.Second). // Server selection timeout
+		SetConnectTimeout(10 * time.Second).        // Connection timeout
+		SetSocketTimeout(10 * time.Second).         // Socket timeout for operations
+		SetPoolMonitor(newPoolMonitor())            // Export pool utilization metrics
+
+	// MONGO_APP_NAME overrides an appName in the URI
+	if appName := os.Getenv("MONGO_APP_NAME"); appName != "" {
+		clientOptions.SetAppName(appName)
+	} else if clientOptions.AppName == nil {
+		clientOptions.SetAppName(defaultAppName)
+	}
+
+	// Optional durability tuning for replica-set deployments
+	if wc := writeConcernFromEnv(); wc != nil {
+		clientOptions.SetWriteConcern(wc)
+	}
+	if rp := readPreferenceFromEnv(); rp != nil {
+		clientOptions.SetReadPreference(rp)
+	}
+	if monitor := newCommandMonitor(slowQueryThresholdFromEnv()); monitor != nil {
+		clientOptions.SetMonitor(monitor)
+	}
+	return clientOptions
+}
+
 func OpenCollection(client *mongo.Client, collectionName string) *mongo.Collection {
-	return client.Database("go-mongodb").Collection(collectionName)
+	return OpenTenantCollection(client, "", collectionName)
+}
+
+// writeConcernFromEnv returns the write concern named by MONGO_WRITE_CONCERN,
+// or nil to keep the driver default when it is unset or invalid.
+func writeConcernFromEnv() *writeconcern.WriteConcern {
+	value := os.Getenv("MONGO_WRITE_CONCERN")
+	if value == "" {
+		return nil
+	}
+	wc, err := parseWriteConcern(value)
+	if err != nil {
+		log.Printf("Ignoring MONGO_WRITE_CONCERN: %v", err)
+		return nil
+	}
+	return wc
+}
+
+// parseWriteConcern accepts "majority" or a non-negative acknowledgement count.
+func parseWriteConcern(value string) (*writeconcern.WriteConcern, error) {
+	if strings.EqualFold(value, "majority") {
+		return writeconcern.New(writeconcern.WMajority()), nil
+	}
+	w, err := strconv.Atoi(value)
+	if err != nil || w < 0 {
+		return nil, fmt.Errorf("unsupported write concern %q, expected \"majority\" or a number", value)
+	}
+	return writeconcern.New(writeconcern.W(w)), nil
+}
+
+// readPreferenceFromEnv returns the read preference named by
+// MONGO_READ_PREFERENCE, or nil to keep the driver default when it is unset
+// or invalid.
+func readPreferenceFromEnv() *readpref.ReadPref {
+	value := os.Getenv("MONGO_READ_PREFERENCE")
+	if value == "" {
+		return nil
+	}
+	rp, err := parseReadPreference(value)
+	if err != nil {
+		log.Printf("Ignoring MONGO_READ_PREFERENCE: %v", err)
+		return nil
+	}
+	return rp
+}
+
+// parseReadPreference accepts the standard mode names such as "primary",
+// "primaryPreferred", "secondary", "secondaryPreferred" and "nearest".
+func parseReadPreference(value string) (*readpref.ReadPref, error) {
+	mode, err := readpref.ModeFromString(value)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported read preference %q", value)
+	}
+	return readpref.New(mode)
 }
 
 // GetContext returns a context with timeout for database operations
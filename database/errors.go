@@ -0,0 +1,47 @@
+package database
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// duplicateKeyCodes are the server error codes for a unique index violation.
+// 11001 and 12582 are older servers' codes for the same error.
+var duplicateKeyCodes = map[int]bool{11000: true, 11001: true, 12582: true}
+
+// IsDuplicateKeyCode reports whether a server error code, such as that of one
+// write in a bulk write, is a unique index violation.
+func IsDuplicateKeyCode(code int) bool {
+	return duplicateKeyCodes[code]
+}
+
+// IsDuplicateKeyError reports whether err, or any error it wraps, is a unique
+// index violation from an insert, update, bulk write or command.
+func IsDuplicateKeyError(err error) bool {
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) {
+		for _, writeErr := range writeException.WriteErrors {
+			if duplicateKeyCodes[writeErr.Code] {
+				return true
+			}
+		}
+		return writeException.WriteConcernError != nil && duplicateKeyCodes[writeException.WriteConcernError.Code]
+	}
+
+	var bulkException mongo.BulkWriteException
+	if errors.As(err, &bulkException) {
+		for _, writeErr := range bulkException.WriteErrors {
+			if duplicateKeyCodes[writeErr.Code] {
+				return true
+			}
+		}
+		return bulkException.WriteConcernError != nil && duplicateKeyCodes[bulkException.WriteConcernError.Code]
+	}
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) {
+		return duplicateKeyCodes[int(commandErr.Code)]
+	}
+	return false
+}
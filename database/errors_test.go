@@ -0,0 +1,43 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIsDuplicateKeyError(t *testing.T) {
+	duplicate := mongo.WriteError{Code: 11000, Message: "E11000 duplicate key error collection: go-mongodb.user index: email_1"}
+	for name, tc := range map[string]struct {
+		err  error
+		want bool
+	}{
+		"write error":         {mongo.WriteException{WriteErrors: mongo.WriteErrors{duplicate}}, true},
+		"second write error":  {mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 2}, duplicate}}, true},
+		"write concern error": {mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: 11001}}, true},
+		"bulk write":          {mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: duplicate}}}, true},
+		"command error":       {mongo.CommandError{Code: 11000, Message: "E11000"}, true},
+		"legacy update code":  {mongo.CommandError{Code: 12582}, true},
+		"wrapped":             {fmt.Errorf("inserting user: %w", mongo.WriteException{WriteErrors: mongo.WriteErrors{duplicate}}), true},
+		"other write error":   {mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121, Message: "Document failed validation"}}}, false},
+		"other bulk error":    {mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Code: 2}}}}, false},
+		"other command error": {mongo.CommandError{Code: 13, Message: "not authorized"}, false},
+		"generic error":       {errors.New("E11000 in the message is not enough"), false},
+		"no documents":        {mongo.ErrNoDocuments, false},
+		"nil":                 {nil, false},
+	} {
+		if got := IsDuplicateKeyError(tc.err); got != tc.want {
+			t.Errorf("%s: IsDuplicateKeyError = %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func TestIsDuplicateKeyCode(t *testing.T) {
+	for code, want := range map[int]bool{11000: true, 11001: true, 12582: true, 0: false, 2: false, 112: false} {
+		if got := IsDuplicateKeyCode(code); got != want {
+			t.Errorf("IsDuplicateKeyCode(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"github.com/jeffthorne/tasky/metrics"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Connection-pool gauges, aggregated across every server the client talks to.
+var (
+	poolOpen      = metrics.NewGauge("tasky_mongo_pool_open_connections", "Connections currently open in the MongoDB pool.")
+	poolInUse     = metrics.NewGauge("tasky_mongo_pool_in_use_connections", "Connections currently checked out of the MongoDB pool.")
+	poolIdle      = metrics.NewGauge("tasky_mongo_pool_idle_connections", "Open connections waiting in the MongoDB pool.")
+	poolWaitQueue = metrics.NewGauge("tasky_mongo_pool_wait_queue_length", "Operations waiting to check out a MongoDB connection.")
+)
+
+// newPoolMonitor returns a monitor that keeps the pool gauges current.
+func newPoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: recordPoolEvent}
+}
+
+func recordPoolEvent(evt *event.PoolEvent) {
+	switch evt.Type {
+	case event.ConnectionCreated:
+		poolOpen.Inc()
+	case event.ConnectionClosed:
+		poolOpen.Dec()
+	case event.GetStarted:
+		poolWaitQueue.Inc()
+	case event.GetSucceeded:
+		poolWaitQueue.Dec()
+		poolInUse.Inc()
+	case event.GetFailed:
+		poolWaitQueue.Dec()
+	case event.ConnectionReturned:
+		poolInUse.Dec()
+	default:
+		return
+	}
+	poolIdle.Set(poolOpen.Value() - poolInUse.Value())
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestPoolEventsUpdateGauges(t *testing.T) {
+	monitor := newPoolMonitor()
+	send := func(types ...string) {
+		for _, eventType := range types {
+			monitor.Event(&event.PoolEvent{Type: eventType})
+		}
+	}
+	check := func(step string, open, inUse, idle, waiting float64) {
+		t.Helper()
+		if poolOpen.Value() != open || poolInUse.Value() != inUse || poolIdle.Value() != idle || poolWaitQueue.Value() != waiting {
+			t.Fatalf("after %s: open %v, in use %v, idle %v, waiting %v; want %v, %v, %v, %v", step,
+				poolOpen.Value(), poolInUse.Value(), poolIdle.Value(), poolWaitQueue.Value(), open, inUse, idle, waiting)
+		}
+	}
+
+	send(event.ConnectionCreated, event.ConnectionCreated)
+	check("two connections", 2, 0, 2, 0)
+	send(event.GetStarted, event.GetStarted)
+	check("two checkouts waiting", 2, 0, 2, 2)
+	send(event.GetSucceeded, event.GetFailed)
+	check("one checkout", 2, 1, 1, 0)
+	send(event.ConnectionReturned)
+	check("checkin", 2, 0, 2, 0)
+	send(event.ConnectionClosed)
+	check("close", 1, 0, 1, 0)
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"os"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// ReadFromSecondary reports whether READ_FROM_SECONDARY routes reads that
+// tolerate replication lag to secondaries.
+func ReadFromSecondary() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("READ_FROM_SECONDARY"))
+	return enabled
+}
+
+// SecondaryPreferred returns coll with the secondaryPreferred read
+// preference, for reads that may return slightly stale data. Writes through
+// the returned handle still go to the primary.
+func SecondaryPreferred(coll *mongo.Collection) *mongo.Collection {
+	clone, err := coll.Clone(options.Collection().SetReadPreference(readpref.SecondaryPreferred()))
+	if err != nil {
+		return coll
+	}
+	return clone
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// slowQueryThresholdFromEnv reads SLOW_QUERY_MS. Slow-query logging is off
+// when it is unset, zero or invalid.
+func slowQueryThresholdFromEnv() time.Duration {
+	value := os.Getenv("SLOW_QUERY_MS")
+	if value == "" {
+		return 0
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms < 0 {
+		log.Printf("Ignoring invalid SLOW_QUERY_MS %q", value)
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// slowQueryLogger logs commands that take longer than threshold. The shape of
+// each command is captured when it starts, since finished events carry no
+// command document.
+type slowQueryLogger struct {
+	threshold time.Duration
+	logf      func(format string, args ...interface{})
+	started   sync.Map // request id -> slowQuery
+}
+
+type slowQuery struct {
+	collection string
+	shape      string
+}
+
+// newCommandMonitor returns a monitor that logs slow commands, or nil when
+// threshold disables slow-query logging.
+func newCommandMonitor(threshold time.Duration) *event.CommandMonitor {
+	if threshold <= 0 {
+		return nil
+	}
+	l := &slowQueryLogger{threshold: threshold, logf: log.Printf}
+	return &event.CommandMonitor{
+		Started:   l.start,
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) { l.finish(evt.CommandFinishedEvent, "") },
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			l.finish(evt.CommandFinishedEvent, evt.Failure)
+		},
+	}
+}
+
+func (l *slowQueryLogger) start(_ context.Context, evt *event.CommandStartedEvent) {
+	collection, _ := evt.Command.Lookup(evt.CommandName).StringValueOK()
+	l.started.Store(evt.RequestID, slowQuery{collection: collection, shape: commandShape(evt.CommandName, evt.Command)})
+}
+
+func (l *slowQueryLogger) finish(evt event.CommandFinishedEvent, failure string) {
+	value, ok := l.started.LoadAndDelete(evt.RequestID)
+	if !ok {
+		return
+	}
+	elapsed := time.Duration(evt.DurationNanos)
+	if elapsed < l.threshold {
+		return
+	}
+	query := value.(slowQuery)
+	if failure != "" {
+		failure = " failed=" + strconv.Quote(failure)
+	}
+	l.logf("WARN slow query: %s on %q took %v (threshold %v) shape=%s%s",
+		evt.CommandName, query.collection, elapsed, l.threshold, query.shape, failure)
+}
+
+// commandShape describes the filter of a command with every value replaced by
+// "?", so slow-query logs never contain user data.
+func commandShape(name string, cmd bson.Raw) string {
+	switch name {
+	case "find", "count", "distinct", "findAndModify":
+		for _, key := range []string{"filter", "query"} {
+			if doc, ok := cmd.Lookup(key).DocumentOK(); ok {
+				return valueShape(bson.RawValue{Type: bsontype.EmbeddedDocument, Value: doc})
+			}
+		}
+	case "delete", "update":
+		if statements, ok := cmd.Lookup(name + "s").ArrayOK(); ok {
+			if first, err := statements.IndexErr(0); err == nil {
+				if doc, ok := first.Value().DocumentOK(); ok {
+					return valueShape(doc.Lookup("q"))
+				}
+			}
+		}
+	case "aggregate":
+		return valueShape(cmd.Lookup("pipeline"))
+	}
+	return "{}"
+}
+
+func valueShape(value bson.RawValue) string {
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		elems, err := value.Document().Elements()
+		if err != nil {
+			return "?"
+		}
+		keys := make([]string, len(elems))
+		for i, elem := range elems {
+			keys[i] = elem.Key() + ": " + valueShape(elem.Value())
+		}
+		sort.Strings(keys)
+		return "{" + strings.Join(keys, ", ") + "}"
+	case bsontype.Array:
+		values, err := value.Array().Values()
+		if err != nil {
+			return "?"
+		}
+		shapes := make([]string, len(values))
+		for i, v := range values {
+			shapes[i] = valueShape(v)
+		}
+		return "[" + strings.Join(shapes, ", ") + "]"
+	case bsontype.Type(0):
+		return "{}"
+	default:
+		return "?"
+	}
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// runCommand passes a find on todos that took elapsed through l.
+func runCommand(t *testing.T, l *slowQueryLogger, requestID int64, elapsed time.Duration) {
+	t.Helper()
+	cmd, err := bson.Marshal(bson.D{
+		{Key: "find", Value: "todos"},
+		{Key: "filter", Value: bson.D{{Key: "userid", Value: "secret-user"}, {Key: "tags", Value: bson.D{{Key: "$all", Value: bson.A{"private"}}}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.start(context.Background(), &event.CommandStartedEvent{Command: cmd, CommandName: "find", RequestID: requestID})
+	l.finish(event.CommandFinishedEvent{CommandName: "find", RequestID: requestID, DurationNanos: elapsed.Nanoseconds()}, "")
+}
+
+func TestSlowQueryLogging(t *testing.T) {
+	var logged []string
+	l := &slowQueryLogger{threshold: 100 * time.Millisecond, logf: func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}}
+
+	runCommand(t, l, 1, 20*time.Millisecond)
+	if len(logged) != 0 {
+		t.Fatalf("fast query was logged: %v", logged)
+	}
+
+	runCommand(t, l, 2, 250*time.Millisecond)
+	if len(logged) != 1 {
+		t.Fatalf("slow query logged %d entries, want 1", len(logged))
+	}
+	entry := logged[0]
+	for _, want := range []string{"WARN slow query", `"todos"`, "250ms", "shape={tags: {$all: [?]}, userid: ?}"} {
+		if !strings.Contains(entry, want) {
+			t.Errorf("entry %q does not contain %q", entry, want)
+		}
+	}
+	for _, secret := range []string{"secret-user", "private"} {
+		if strings.Contains(entry, secret) {
+			t.Errorf("entry %q contains the query value %q", entry, secret)
+		}
+	}
+}
+
+func TestSlowQueryThresholdFromEnv(t *testing.T) {
+	cases := map[string]time.Duration{"": 0, "250": 250 * time.Millisecond, "-5": 0, "fast": 0}
+	for value, want := range cases {
+		t.Setenv("SLOW_QUERY_MS", value)
+		if got := slowQueryThresholdFromEnv(); got != want {
+			t.Errorf("SLOW_QUERY_MS=%q: got %v, want %v", value, got, want)
+		}
+	}
+	if newCommandMonitor(0) != nil {
+		t.Error("a zero threshold still installs a command monitor")
+	}
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultDatabase holds the data of requests that name no tenant.
+const DefaultDatabase = "go-mongodb"
+
+// tenantCollections caches collection handles by client, database and
+// collection name.
+var tenantCollections sync.Map
+
+type collectionKey struct {
+	client *mongo.Client
+	name   string
+}
+
+// Tenants returns the tenant ids allowed by the comma-separated TENANTS
+// variable. Tenancy is disabled when it is empty.
+func Tenants() []string {
+	var tenants []string
+	for _, tenant := range strings.Split(os.Getenv("TENANTS"), ",") {
+		if tenant = strings.TrimSpace(tenant); tenant != "" {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants
+}
+
+// TenantAllowed reports whether tenant is listed in TENANTS.
+func TenantAllowed(tenant string) bool {
+	for _, allowed := range Tenants() {
+		if tenant == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantDatabase returns the name of the database holding tenant's data.
+func TenantDatabase(tenant string) string {
+	if tenant == "" {
+		return DefaultDatabase
+	}
+	return DefaultDatabase + "-" + tenant
+}
+
+// OpenTenantCollection returns a cached handle to the named collection in
+// tenant's database; an empty tenant selects the default database.
+func OpenTenantCollection(client *mongo.Client, tenant string, collectionName string) *mongo.Collection {
+	key := collectionKey{client: client, name: TenantDatabase(tenant) + "." + collectionName}
+	if collection, ok := tenantCollections.Load(key); ok {
+		return collection.(*mongo.Collection)
+	}
+	collection, _ := tenantCollections.LoadOrStore(key, client.Database(TenantDatabase(tenant)).Collection(collectionName))
+	return collection.(*mongo.Collection)
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"log"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	transactionsOnce      sync.Once
+	transactionsSupported bool
+)
+
+// TransactionsSupported reports whether the deployment can run multi-document
+// transactions, which needs a replica set or a sharded cluster. It asks the
+// server once and remembers the answer.
+func TransactionsSupported() bool {
+	transactionsOnce.Do(func() {
+		if Client == nil {
+			return
+		}
+		ctx, cancel := GetContext()
+		defer cancel()
+
+		var reply struct {
+			SetName string `bson:"setName"`
+			Msg     string `bson:"msg"`
+		}
+		err := Client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&reply)
+		if err != nil {
+			log.Printf("Could not detect transaction support, running without transactions: %v", err)
+			return
+		}
+		transactionsSupported = reply.SetName != "" || reply.Msg == "isdbgrid"
+	})
+	return transactionsSupported
+}
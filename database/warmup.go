@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// pinger is the part of *mongo.Client used for warm-up, separated so the
+// priming logic can run against a stub.
+type pinger interface {
+	Ping(ctx context.Context, rp *readpref.ReadPref) error
+}
+
+// warmupEnabled reports whether MONGO_WARMUP asks for the pool to be primed.
+func warmupEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("MONGO_WARMUP"))
+	return enabled
+}
+
+// warmUp issues n concurrent pings so the pool opens n connections, and
+// completes their handshakes, before the first request arrives. Failures are
+// logged rather than fatal; the pool will still connect lazily.
+func warmUp(ctx context.Context, client pinger, n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Ping(ctx, readpref.Primary()); err != nil {
+				log.Printf("MongoDB warm-up ping failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
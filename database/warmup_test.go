@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// stubPinger counts pings and holds each one until all want have arrived, so
+// a warm-up that pinged one connection at a time would time out.
+type stubPinger struct {
+	mu    sync.Mutex
+	pings int
+	want  int
+	all   chan struct{}
+	err   error
+}
+
+func newStubPinger(want int, err error) *stubPinger {
+	return &stubPinger{want: want, all: make(chan struct{}), err: err}
+}
+
+func (p *stubPinger) Ping(ctx context.Context, rp *readpref.ReadPref) error {
+	p.mu.Lock()
+	p.pings++
+	if p.pings == p.want {
+		close(p.all)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.all:
+	case <-time.After(time.Second):
+		return errors.New("pings were not concurrent")
+	}
+	return p.err
+}
+
+func TestWarmUpPrimesEachConnection(t *testing.T) {
+	stub := newStubPinger(minPoolSize, nil)
+	warmUp(context.Background(), stub, minPoolSize)
+
+	select {
+	case <-stub.all:
+	default:
+		t.Fatalf("warm-up sent %d concurrent pings, want %d", stub.pings, minPoolSize)
+	}
+	if stub.pings != minPoolSize {
+		t.Fatalf("warm-up sent %d pings, want %d", stub.pings, minPoolSize)
+	}
+}
+
+func TestWarmUpToleratesFailures(t *testing.T) {
+	stub := newStubPinger(3, errors.New("connection refused"))
+	warmUp(context.Background(), stub, 3)
+	if stub.pings != 3 {
+		t.Fatalf("warm-up sent %d pings, want 3", stub.pings)
+	}
+}
+
+func TestWarmupEnabled(t *testing.T) {
+	cases := map[string]bool{"": false, "true": true, "1": true, "false": false, "yes": false}
+	for value, want := range cases {
+		t.Setenv("MONGO_WARMUP", value)
+		if got := warmupEnabled(); got != want {
+			t.Errorf("MONGO_WARMUP=%q: got %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Package featureflags centralizes the env-gated switches that change
+// application behavior, so handlers read typed values instead of calling
+// os.Getenv directly.
+package featureflags
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Flags holds the effective value of every feature flag.
+type Flags struct {
+	// SignupsEnabled allows new accounts to be created (SIGNUPS_ENABLED).
+	SignupsEnabled bool `json:"signups_enabled"`
+	// MaintenanceMode rejects writes while operators work on the system
+	// (MAINTENANCE_MODE).
+	MaintenanceMode bool `json:"maintenance_mode"`
+	// EnumerationSafe gives signups the same response whether or not the
+	// email is registered, and reports the outcome by email instead
+	// (ENUMERATION_SAFE).
+	EnumerationSafe bool `json:"enumeration_safe"`
+	// GraceReads lets GET requests use a session token that expired moments
+	// ago, so a late refresh does not fail reads (ALLOW_GRACE_READS).
+	GraceReads bool `json:"grace_reads"`
+	// SingleSession signs a user's other devices out whenever they log in
+	// (SINGLE_SESSION).
+	SingleSession bool `json:"single_session"`
+}
+
+// Defaults returns the flag values used when nothing is configured.
+func Defaults() Flags {
+	return Flags{
+		SignupsEnabled:  true,
+		MaintenanceMode: false,
+		EnumerationSafe: false,
+		GraceReads:      false,
+		SingleSession:   false,
+	}
+}
+
+var (
+	mu      sync.RWMutex
+	current = Defaults()
+)
+
+// Load reads the flags from the environment and makes them current. It is
+// called once at startup, after any .env file has been applied.
+func Load() Flags {
+	flags := FromEnv(os.Getenv)
+
+	mu.Lock()
+	current = flags
+	mu.Unlock()
+	return flags
+}
+
+// FromEnv builds flags from lookup, falling back to the defaults for unset or
+// unparsable values.
+func FromEnv(lookup func(string) string) Flags {
+	flags := Defaults()
+	flags.SignupsEnabled = parseBool(lookup, "SIGNUPS_ENABLED", flags.SignupsEnabled)
+	flags.MaintenanceMode = parseBool(lookup, "MAINTENANCE_MODE", flags.MaintenanceMode)
+	flags.EnumerationSafe = parseBool(lookup, "ENUMERATION_SAFE", flags.EnumerationSafe)
+	flags.GraceReads = parseBool(lookup, "ALLOW_GRACE_READS", flags.GraceReads)
+	flags.SingleSession = parseBool(lookup, "SINGLE_SESSION", flags.SingleSession)
+	return flags
+}
+
+// Current returns the flags loaded at startup.
+func Current() Flags {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// SignupsEnabled reports whether new accounts may be created.
+func SignupsEnabled() bool {
+	return Current().SignupsEnabled
+}
+
+// MaintenanceMode reports whether writes are currently refused.
+func MaintenanceMode() bool {
+	return Current().MaintenanceMode
+}
+
+// EnumerationSafe reports whether signup responses must not reveal whether
+// an email is registered.
+func EnumerationSafe() bool {
+	return Current().EnumerationSafe
+}
+
+// GraceReads reports whether reads may use a recently expired session token.
+func GraceReads() bool {
+	return Current().GraceReads
+}
+
+// SingleSession reports whether a login revokes the user's other sessions.
+func SingleSession() bool {
+	return Current().SingleSession
+}
+
+func parseBool(lookup func(string) string, name string, fallback bool) bool {
+	value := lookup(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: expected a boolean", name, value)
+		return fallback
+	}
+	return parsed
+}
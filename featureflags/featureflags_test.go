@@ -0,0 +1,52 @@
+package featureflags
+
+import "testing"
+
+// env returns a lookup function over a fixed set of variables.
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestFromEnvDefaults(t *testing.T) {
+	if got := FromEnv(env(nil)); got != Defaults() {
+		t.Fatalf("FromEnv with nothing set = %+v, want %+v", got, Defaults())
+	}
+	if !Defaults().SignupsEnabled || Defaults().MaintenanceMode {
+		t.Fatalf("unexpected defaults %+v", Defaults())
+	}
+}
+
+func TestFromEnvOverrides(t *testing.T) {
+	got := FromEnv(env(map[string]string{
+		"SIGNUPS_ENABLED":   "false",
+		"MAINTENANCE_MODE":  "1",
+		"ENUMERATION_SAFE":  "true",
+		"ALLOW_GRACE_READS": "TRUE",
+		"SINGLE_SESSION":    "t",
+	}))
+	want := Flags{SignupsEnabled: false, MaintenanceMode: true, EnumerationSafe: true, GraceReads: true, SingleSession: true}
+	if got != want {
+		t.Fatalf("FromEnv = %+v, want %+v", got, want)
+	}
+}
+
+func TestFromEnvIgnoresInvalidValues(t *testing.T) {
+	got := FromEnv(env(map[string]string{"SIGNUPS_ENABLED": "nope", "MAINTENANCE_MODE": "on"}))
+	if got != Defaults() {
+		t.Fatalf("FromEnv = %+v, want the defaults for unparsable values", got)
+	}
+}
+
+func TestLoadMakesFlagsCurrent(t *testing.T) {
+	t.Setenv("MAINTENANCE_MODE", "true")
+	defer func() {
+		mu.Lock()
+		current = Defaults()
+		mu.Unlock()
+	}()
+
+	Load()
+	if !MaintenanceMode() || !Current().MaintenanceMode {
+		t.Fatal("the loaded flags are not current")
+	}
+}
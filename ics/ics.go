@@ -0,0 +1,90 @@
+// Package ics writes minimal iCalendar (RFC 5545) documents.
+package ics
+
+import (
+	"strings"
+	"time"
+)
+
+// Event is a single VEVENT.
+type Event struct {
+	UID     string
+	Start   time.Time
+	Summary string
+}
+
+// Calendar is a VCALENDAR holding events.
+type Calendar struct {
+	ProductID string
+	Name      string
+	Events    []Event
+}
+
+const (
+	timeFormat = "20060102T150405Z"
+	// maxLineOctets is the longest content line allowed before folding.
+	maxLineOctets = 75
+)
+
+// Encode renders the calendar with CRLF line endings and folded long lines.
+// stamp is used as the DTSTAMP of every event.
+func (cal Calendar) Encode(stamp time.Time) string {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(fold(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:" + cal.ProductID)
+	line("CALSCALE:GREGORIAN")
+	if cal.Name != "" {
+		line("X-WR-CALNAME:" + escapeText(cal.Name))
+	}
+	for _, event := range cal.Events {
+		line("BEGIN:VEVENT")
+		line("UID:" + escapeText(event.UID))
+		line("DTSTAMP:" + stamp.UTC().Format(timeFormat))
+		line("DTSTART:" + event.Start.UTC().Format(timeFormat))
+		line("SUMMARY:" + escapeText(event.Summary))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// escapeText escapes a TEXT property value.
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// fold splits a content line into 75-octet pieces joined by CRLF and a space,
+// without splitting a multi-byte UTF-8 character.
+func fold(s string) string {
+	if len(s) <= maxLineOctets {
+		return s
+	}
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	stamp := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	cal := Calendar{
+		ProductID: "-//test//EN",
+		Name:      "Mine",
+		Events: []Event{
+			{UID: "1@test", Start: time.Date(2024, 5, 2, 14, 30, 0, 0, time.FixedZone("CEST", 2*60*60)), Summary: "Call Bob; bring notes, pens"},
+			{UID: "2@test", Start: stamp, Summary: "Second"},
+		},
+	}
+	out := cal.Encode(stamp)
+
+	if !strings.HasSuffix(out, "\r\n") || strings.Contains(strings.ReplaceAll(out, "\r\n", ""), "\n") {
+		t.Fatal("lines are not terminated by CRLF")
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	if lines[0] != "BEGIN:VCALENDAR" || lines[len(lines)-1] != "END:VCALENDAR" {
+		t.Fatalf("calendar is not wrapped in VCALENDAR: %q", lines)
+	}
+	for _, want := range []string{
+		"VERSION:2.0",
+		"PRODID:-//test//EN",
+		"X-WR-CALNAME:Mine",
+		"DTSTART:20240502T123000Z",
+		"DTSTAMP:20240501T090000Z",
+		`SUMMARY:Call Bob\; bring notes\, pens`,
+	} {
+		if !strings.Contains(out, want+"\r\n") {
+			t.Errorf("missing line %q", want)
+		}
+	}
+	if begins, ends := strings.Count(out, "BEGIN:VEVENT\r\n"), strings.Count(out, "END:VEVENT\r\n"); begins != 2 || ends != 2 {
+		t.Errorf("got %d BEGIN and %d END VEVENT lines, want 2 of each", begins, ends)
+	}
+}
+
+func TestEncodeWithoutEvents(t *testing.T) {
+	out := Calendar{ProductID: "-//test//EN"}.Encode(time.Now())
+	if strings.Contains(out, "VEVENT") || strings.Contains(out, "X-WR-CALNAME") {
+		t.Fatalf("unexpected content: %q", out)
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	if got := escapeText("a\\b\r\nc\nd"); got != `a\\b\nc\nd` {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestFold(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("é", 100)
+	folded := fold(line)
+	pieces := strings.Split(folded, "\r\n")
+	if len(pieces) < 3 {
+		t.Fatalf("a %d-octet line was folded into %d pieces", len(line), len(pieces))
+	}
+	for i, piece := range pieces {
+		if len(piece) > maxLineOctets {
+			t.Errorf("piece %d is %d octets", i, len(piece))
+		}
+		if i > 0 && !strings.HasPrefix(piece, " ") {
+			t.Errorf("continuation %d does not start with a space", i)
+		}
+		if !strings.HasPrefix(strings.TrimPrefix(piece, " "), "é") && i > 0 {
+			t.Errorf("piece %d splits a character", i)
+		}
+	}
+	if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != line {
+		t.Fatal("unfolding does not restore the line")
+	}
+	if fold("short") != "short" {
+		t.Fatal("a short line was folded")
+	}
+}
@@ -0,0 +1,62 @@
+// Package mailer sends transactional email to users.
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Sender delivers a plain-text message to a single recipient.
+type Sender interface {
+	Send(to string, subject string, body string) error
+}
+
+// LogSender writes messages to the log instead of delivering them, for
+// development without a mail server.
+type LogSender struct{}
+
+func (LogSender) Send(to string, subject string, body string) error {
+	log.Printf("Email to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// SMTPSender delivers messages through an SMTP server.
+type SMTPSender struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func (s SMTPSender) Send(to string, subject string, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("mailer: header values must not contain line breaks")
+	}
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{to}, []byte(msg))
+}
+
+// FromEnv returns an SMTPSender when SMTP_ADDR (host:port) is set, using
+// SMTP_FROM as the sender and SMTP_USERNAME/SMTP_PASSWORD for PLAIN auth if
+// given. Otherwise it returns a LogSender.
+func FromEnv() Sender {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return LogSender{}
+	}
+	sender := SMTPSender{Addr: addr, From: os.Getenv("SMTP_FROM")}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		sender.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return sender
+}
@@ -1,36 +1,232 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
 	"net/http"
-	controller "github.com/jeffthorne/tasky/controllers"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/auth"
+	controller "github.com/jeffthorne/tasky/controllers"
+	"github.com/jeffthorne/tasky/database"
+	"github.com/jeffthorne/tasky/featureflags"
+	"github.com/jeffthorne/tasky/metrics"
+	"github.com/jeffthorne/tasky/ratelimit"
+	"github.com/jeffthorne/tasky/selftest"
+	"github.com/jeffthorne/tasky/server"
+	"github.com/jeffthorne/tasky/sweeper"
 	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func index(c *gin.Context) {
-	c.HTML(http.StatusOK, "login.html", nil)
+	c.HTML(http.StatusOK, "login.html", controller.NewPageData(""))
 }
 
 func main() {
+	selfTest := flag.Bool("selftest", false, "run the startup self-test and exit")
+	flag.Parse()
+
 	godotenv.Overload()
-	
-	router := gin.Default()
+	featureflags.Load()
+	// Resolve the token signing key now that .env is applied, so a secret
+	// source that fails stops startup rather than the first login
+	auth.SecretKey()
+
+	if *selfTest || os.Getenv("SELFTEST") == "true" {
+		os.Exit(runSelfTest())
+	}
+
+	// Rate limits and login lockouts are shared between replicas via Redis
+	// when REDIS_URL is set
+	counters, err := ratelimit.StoreFromEnv()
+	if err != nil {
+		log.Fatalf("Error opening the rate limit store: %v", err)
+	}
+	ratelimit.SetDefaultStore(counters)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go sweeper.Run(ctx, sweeper.IntervalFromEnv(), sweeper.DefaultTargets)
+
+	router := gin.New()
+	// Client IPs come from X-Forwarded-For only behind TRUSTED_PROXIES
+	if err := server.TrustProxies(router); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.Use(server.AccessLog(server.LogFormatFromEnv(), gin.DefaultWriter), gin.Recovery())
+	// Probes and scrapes must answer even when the server is saturated
+	base := server.BasePath()
+	router.Use(ratelimit.MaxInFlight(ratelimit.MaxInFlightFromEnv(), base+"/healthz", base+"/readyz", base+"/metrics"))
+	// Preflights are answered before they count against the rate limits
+	router.Use(controller.CORS())
+	router.Use(ratelimit.Tiered(
+		ratelimit.FromEnv("RATE_LIMIT_ANONYMOUS", 60, time.Minute),
+		ratelimit.FromEnv("RATE_LIMIT_AUTHENTICATED", 600, time.Minute),
+		auth.TokenUserID,
+	))
+	router.Use(controller.PrettyJSON, controller.MaintenanceGate, controller.TenantScope, controller.Transaction)
 	router.LoadHTMLGlob("assets/*.html")
-	router.Static("/assets", "./assets")
 
-	router.GET("/", index)
-	router.GET("/todos/:userid", controller.GetTodos)
-	router.GET("/todo/:id", controller.GetTodo)
-	router.POST("/todo/:userid", controller.AddTodo)
-	router.DELETE("/todo/:userid/:id", controller.DeleteTodo)
-	router.DELETE("/todos/:userid", controller.ClearAll)
-	router.PUT("/todo", controller.UpdateTodo)
+	// Behind a reverse proxy the app may live under a subpath (BASE_PATH)
+	app := router.Group(server.BasePath())
+	app.Static("/assets", "./assets")
+
+	app.GET("/", index)
+	app.GET("/metrics", metrics.Handler)
+	app.GET("/healthz", controller.Healthz)
+	app.GET("/readyz", controller.Readyz)
+	app.GET("/config", controller.GetConfig)
+	app.GET("/todos/:userid", controller.GetTodos)
+	app.GET("/todos/count", controller.CountTodos)
+	app.GET("/todos/search", controller.SearchTodos)
+	app.GET("/todos/today", controller.TodayTodos)
+	app.GET("/todos/next", controller.NextTodo)
+	app.GET("/todos/calendar.ics", controller.CalendarFeed)
+	app.GET("/todos/activity", controller.TodoActivity)
+	app.GET("/todo/:id", controller.GetTodo)
+	app.HEAD("/todo/:id", controller.GetTodo)
+	app.POST("/todo/:userid", controller.AddTodo)
+	app.DELETE("/todo/:userid/:id", controller.DeleteTodo)
+	app.DELETE("/todos/:id", controller.ClearAll)
+	app.PUT("/todo", controller.UpdateTodo)
+	app.PUT("/todos/:id/notes", controller.UpdateNotes)
+	app.PUT("/todos/:id/blocked-by", controller.SetBlockers)
+	app.PUT("/todos/:id", controller.ReplaceTodo)
+	app.PATCH("/todos/:id", controller.PatchTodo)
+	app.POST("/todos/:id/archive", controller.ArchiveTodo)
+	app.POST("/todos/:id/unarchive", controller.UnarchiveTodo)
+	app.POST("/todos/:id/pin", controller.PinTodo)
+	app.POST("/todos/:id/unpin", controller.UnpinTodo)
+	app.POST("/todos/:id/publish", controller.PublishTodo)
+	app.POST("/todos/:id/snooze", controller.SnoozeTodo)
+	app.POST("/todos/:id/attachments", controller.AddAttachment)
+	app.DELETE("/todos/:id/attachments/:attachmentId", controller.DeleteAttachment)
+	app.POST("/todos/reorder", controller.ReorderTodos)
+	app.POST("/todos/import", controller.ImportTodos)
+	app.POST("/todos/quick", controller.QuickCapture)
+	app.POST("/todos/batch-delete", controller.BatchDeleteTodos)
+	app.POST("/todos/batch-get", controller.BatchGetTodos)
+
+	app.POST("/signup", controller.SignUp)
+	app.POST("/login", controller.Login)
+	app.POST("/logout", controller.Logout)
+	app.POST("/auth/password-strength", ratelimit.PerIP(30, time.Minute), controller.PasswordStrength)
+	app.GET("/auth/session", controller.SessionInfo)
+	app.GET("/todo", controller.Todo)
 
+	app.POST("/me/deactivate", controller.DeactivateAccount)
+	app.POST("/me/feed-token", controller.CreateFeedToken)
+	app.PUT("/me/webhook", controller.SetWebhook)
+	app.PUT("/me/retention", controller.SetRetention)
+	app.PUT("/me/password", controller.ChangePassword)
+	app.GET("/me/completeness", controller.ProfileCompleteness)
+	app.HEAD("/me/completeness", controller.ProfileCompleteness)
+	app.GET("/me/login-history", controller.LoginHistory)
+	app.POST("/me/api-keys", controller.CreateAPIKey)
+	app.GET("/me/api-keys", controller.ListAPIKeys)
+	app.DELETE("/me/api-keys/:id", controller.RevokeAPIKey)
+
+	app.GET("/admin/flags", controller.GetFlags)
+	app.POST("/admin/drain", controller.Drain)
+	app.GET("/admin/auth-benchmark", ratelimit.PerIP(5, time.Minute), controller.AuthBenchmark)
+	app.GET("/admin/hash-audit", controller.HashAudit)
+	app.GET("/admin/stats", controller.AdminStats)
+	app.GET("/admin/users", controller.ListUsers)
+	app.POST("/admin/users/import", controller.ImportUsers)
+	app.POST("/admin/users/:id/reactivate", controller.ReactivateUser)
+	app.GET("/admin/audit/export", controller.ExportAuditLog)
+
+	// Unknown paths and methods get JSON errors consistent with the API
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(controller.NotFound)
+	router.NoMethod(controller.MethodNotAllowed(router.Routes))
+
+	// Serve HTTPS directly when certificates are configured; behind a
+	// TLS-terminating proxy they are not, and plain HTTP is served
+	srv := &http.Server{Addr: ":8080", Handler: router}
+	serve := srv.ListenAndServe
+	certFile, keyFile, useTLS := server.TLSFiles(os.Getenv)
+	if useTLS {
+		tlsConfig, err := server.TLSConfigFromEnv(os.Getenv)
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv.TLSConfig = tlsConfig
+		serve = func() error { return srv.ListenAndServeTLS(certFile, keyFile) }
+	}
+
+	go func() {
+		if err := serve(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// On SIGTERM or SIGINT stop accepting connections and let requests in
+	// flight finish, up to SHUTDOWN_TIMEOUT
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+	<-signals.Done()
+
+	server.StartDraining()
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down: %v", err)
+	}
+}
+
+// shutdownTimeout reads SHUTDOWN_TIMEOUT, defaulting to 30 seconds.
+func shutdownTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		return 30 * time.Second
+	}
+	return timeout
+}
 
-	router.POST("/signup", controller.SignUp)
-	router.POST("/login", controller.Login)
-	router.GET("/todo", controller.Todo)
+// runSelfTest checks MongoDB, token signing and password hashing, prints a
+// JSON report and returns the process exit code.
+func runSelfTest() int {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	router.Run(":8080" )
+	var db *mongo.Database
+	if database.Client != nil {
+		db = database.Client.Database(database.DefaultDatabase)
+	}
+	report := selftest.Run(ctx, []selftest.Check{
+		selftest.MongoCheck(db),
+		selftest.JWTCheck(
+			func() (string, error) {
+				if len(auth.SecretKey()) == 0 {
+					return "", errors.New("SECRET_KEY is not set")
+				}
+				token, err, _ := auth.GenerateJWT(primitive.NewObjectID().Hex(), "", 0)
+				return token, err
+			},
+			func(token string) error {
+				_, err := auth.ValidateJWT(token)
+				return err
+			},
+		),
+		selftest.PasswordCheck(auth.HashPassword, auth.VerifyPassword),
+	})
 
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if !report.OK {
+		return 1
+	}
+	return 0
 }
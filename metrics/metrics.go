@@ -0,0 +1,153 @@
+// Package metrics exposes application gauges in the Prometheus text
+// exposition format without pulling in the full Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]collector{}
+)
+
+type collector interface {
+	write(b *strings.Builder)
+}
+
+// Gauge is a value that can go up and down, such as a connection count.
+type Gauge struct {
+	name string
+	help string
+
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge creates a gauge and registers it for exposition. It panics if a
+// metric with the same name is already registered.
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(name, g)
+	return g
+}
+
+// Set replaces the gauge value.
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.value = v
+	g.mu.Unlock()
+}
+
+// Add adds delta, which may be negative, to the gauge value.
+func (g *Gauge) Add(delta float64) {
+	g.mu.Lock()
+	g.value += delta
+	g.mu.Unlock()
+}
+
+// Inc increments the gauge by one.
+func (g *Gauge) Inc() { g.Add(1) }
+
+// Dec decrements the gauge by one.
+func (g *Gauge) Dec() { g.Add(-1) }
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	fmt.Fprintf(b, "%s %s\n", g.name, formatValue(g.Value()))
+}
+
+// CounterVec is a family of counters split by one label. The label values
+// are fixed when the family is created, so the number of series exposed
+// stays bounded no matter what callers pass.
+type CounterVec struct {
+	name  string
+	help  string
+	label string
+
+	mu     sync.Mutex
+	values []string
+	counts map[string]float64
+}
+
+// NewCounterVec creates a counter family with the given label values and
+// registers it for exposition. Every value is exposed from the start, at 0.
+// It panics if a metric with the same name is already registered.
+func NewCounterVec(name, help, label string, values ...string) *CounterVec {
+	v := &CounterVec{name: name, help: help, label: label, values: values, counts: map[string]float64{}}
+	for _, value := range values {
+		v.counts[value] = 0
+	}
+	register(name, v)
+	return v
+}
+
+// Inc increments the counter for value. Values the family was not created
+// with panic, since they would make the label cardinality unbounded.
+func (v *CounterVec) Inc(value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.counts[value]; !ok {
+		panic("metrics: unknown " + v.label + " value " + strconv.Quote(value) + " for " + v.name)
+	}
+	v.counts[value]++
+}
+
+// Value returns the current count for value.
+func (v *CounterVec) Value(value string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.counts[value]
+}
+
+func (v *CounterVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", v.name, v.help, v.name)
+	for _, value := range v.values {
+		fmt.Fprintf(b, "%s{%s=%s} %s\n", v.name, v.label, strconv.Quote(value), formatValue(v.Value(value)))
+	}
+}
+
+func register(name string, c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic("metrics: duplicate metric " + name)
+	}
+	registry[name] = c
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves every registered metric, sorted by name.
+func Handler(c *gin.Context) {
+	registryMu.Lock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		registry[name].write(&b)
+	}
+	registryMu.Unlock()
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
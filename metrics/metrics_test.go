@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGauge(t *testing.T) {
+	g := NewGauge("test_gauge", "A gauge for tests.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	g.Add(2.5)
+	if g.Value() != 3.5 {
+		t.Fatalf("value = %v, want 3.5", g.Value())
+	}
+	g.Set(7)
+	if g.Value() != 7 {
+		t.Fatalf("value = %v, want 7", g.Value())
+	}
+}
+
+func TestHandlerExposesGauges(t *testing.T) {
+	NewGauge("test_exposed_gauge", "Exposed in tests.").Set(42)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/metrics", Handler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+	want := "# HELP test_exposed_gauge Exposed in tests.\n# TYPE test_exposed_gauge gauge\ntest_exposed_gauge 42\n"
+	if !strings.Contains(w.Body.String(), want) {
+		t.Fatalf("body does not contain the gauge:\n%s", w.Body)
+	}
+}
+
+func TestDuplicateMetricPanics(t *testing.T) {
+	NewGauge("test_duplicate", "Registered twice.")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a duplicate metric did not panic")
+		}
+	}()
+	NewGauge("test_duplicate", "Registered twice.")
+}
+
+func TestCounterVec(t *testing.T) {
+	v := NewCounterVec("test_counter_total", "A counter for tests.", "reason", "a", "b")
+	v.Inc("a")
+	v.Inc("a")
+	if v.Value("a") != 2 || v.Value("b") != 0 {
+		t.Fatalf("a = %v, b = %v; want 2 and 0", v.Value("a"), v.Value("b"))
+	}
+
+	var b strings.Builder
+	v.write(&b)
+	want := "# HELP test_counter_total A counter for tests.\n# TYPE test_counter_total counter\n" +
+		"test_counter_total{reason=\"a\"} 2\ntest_counter_total{reason=\"b\"} 0\n"
+	if b.String() != want {
+		t.Fatalf("exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestCounterVecRejectsUnknownValues(t *testing.T) {
+	v := NewCounterVec("test_bounded_total", "Bounded labels.", "reason", "known")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("an unknown label value did not panic")
+		}
+	}()
+	v.Inc("attacker-controlled")
+}
@@ -0,0 +1,133 @@
+// Package migrate backfills fields that documents written before a schema
+// change lack. Every step only matches documents still missing the change, so
+// running it again modifies nothing.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Step is one backfill and the number of documents it modified.
+type Step struct {
+	Name     string
+	Modified int64
+}
+
+// Report lists the steps run against one database. Conflicts counts users
+// whose email was left alone because its lowercase form is already taken.
+type Report struct {
+	Database  string
+	Steps     []Step
+	Conflicts int64
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:\n", r.Database)
+	for _, step := range r.Steps {
+		fmt.Fprintf(&b, "  %-28s %d modified\n", step.Name, step.Modified)
+	}
+	if r.Conflicts > 0 {
+		fmt.Fprintf(&b, "  %d users kept a mixed-case email because the lowercase one is taken\n", r.Conflicts)
+	}
+	return b.String()
+}
+
+// backfill applies set to the documents matching filter. The values in set
+// are aggregation expressions evaluated against each document.
+type backfill struct {
+	name       string
+	collection string
+	filter     bson.M
+	set        bson.M
+}
+
+// backfills run in order; updated_at is derived from created_at, so it
+// comes after it. Todo owners written as hex strings become ObjectIDs.
+var backfills = []backfill{
+	{"todos.userid", "todos",
+		bson.M{"userid": bson.M{"$type": "string", "$regex": "^[0-9a-fA-F]{24}$"}},
+		bson.M{"userid": bson.M{"$toObjectId": "$userid"}}},
+	{"todos.created_at", "todos",
+		bson.M{"created_at": bson.M{"$exists": false}, "_id": bson.M{"$type": "objectId"}},
+		bson.M{"created_at": bson.M{"$toDate": "$_id"}}},
+	{"todos.updated_at", "todos",
+		bson.M{"updated_at": bson.M{"$exists": false}, "created_at": bson.M{"$exists": true}},
+		bson.M{"updated_at": "$created_at"}},
+	{"todos.status", "todos",
+		bson.M{"status": bson.M{"$in": bson.A{nil, ""}}},
+		bson.M{"status": "pending"}},
+	{"user.created_at", "user",
+		bson.M{"created_at": bson.M{"$exists": false}, "_id": bson.M{"$type": "objectId"}},
+		bson.M{"created_at": bson.M{"$toDate": "$_id"}}},
+	{"user.updated_at", "user",
+		bson.M{"updated_at": bson.M{"$exists": false}, "created_at": bson.M{"$exists": true}},
+		bson.M{"updated_at": "$created_at"}},
+}
+
+// Run backfills the collections of db. It needs MongoDB 4.2 or later for
+// pipeline updates.
+func Run(ctx context.Context, db *mongo.Database) (Report, error) {
+	report := Report{Database: db.Name()}
+	for _, b := range backfills {
+		result, err := db.Collection(b.collection).UpdateMany(ctx, b.filter, mongo.Pipeline{{{Key: "$set", Value: b.set}}})
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", b.name, err)
+		}
+		report.Steps = append(report.Steps, Step{Name: b.name, Modified: result.ModifiedCount})
+	}
+
+	modified, conflicts, err := lowercaseEmails(ctx, db.Collection("user"))
+	if err != nil {
+		return report, fmt.Errorf("user.email: %w", err)
+	}
+	report.Steps = append(report.Steps, Step{Name: "user.email", Modified: modified})
+	report.Conflicts = conflicts
+	return report, nil
+}
+
+// lowercaseEmails lowercases stored emails, skipping any whose lowercase form
+// belongs to another user so two accounts never share an email.
+func lowercaseEmails(ctx context.Context, users *mongo.Collection) (modified int64, conflicts int64, err error) {
+	filter := bson.M{
+		"email": bson.M{"$type": "string"},
+		"$expr": bson.M{"$ne": bson.A{"$email", bson.M{"$toLower": "$email"}}},
+	}
+	cursor, err := users.Find(ctx, filter)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user struct {
+			ID    interface{} `bson:"_id"`
+			Email string      `bson:"email"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return modified, conflicts, err
+		}
+		lower := strings.ToLower(user.Email)
+
+		taken, err := users.CountDocuments(ctx, bson.M{"email": lower, "_id": bson.M{"$ne": user.ID}})
+		if err != nil {
+			return modified, conflicts, err
+		}
+		if taken > 0 {
+			conflicts++
+			continue
+		}
+
+		result, err := users.UpdateOne(ctx, bson.M{"_id": user.ID, "email": user.Email}, bson.M{"$set": bson.M{"email": lower}})
+		if err != nil {
+			return modified, conflicts, err
+		}
+		modified += result.ModifiedCount
+	}
+	return modified, conflicts, cursor.Err()
+}
@@ -0,0 +1,227 @@
+package migrate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// matches evaluates the subset of query operators the backfill filters use.
+func matches(t *testing.T, doc bson.M, filter bson.M) bool {
+	t.Helper()
+	for field, condition := range filter {
+		value, present := doc[field]
+		operators, ok := condition.(bson.M)
+		if !ok {
+			if value != condition {
+				return false
+			}
+			continue
+		}
+		for operator, operand := range operators {
+			switch operator {
+			case "$exists":
+				if present != operand.(bool) {
+					return false
+				}
+			case "$type":
+				switch operand {
+				case "string":
+					if _, ok := value.(string); !ok {
+						return false
+					}
+				case "objectId":
+					if _, ok := value.(primitive.ObjectID); !ok {
+						return false
+					}
+				default:
+					t.Fatalf("unsupported $type %v", operand)
+				}
+			case "$regex":
+				s, _ := value.(string)
+				if !regexp.MustCompile(operand.(string)).MatchString(s) {
+					return false
+				}
+			case "$in":
+				found := false
+				for _, candidate := range operand.(bson.A) {
+					if value == candidate {
+						found = true
+					}
+				}
+				if !found {
+					return false
+				}
+			default:
+				t.Fatalf("unsupported operator %s", operator)
+			}
+		}
+	}
+	return true
+}
+
+// evaluate computes the subset of aggregation expressions the backfills set.
+func evaluate(t *testing.T, doc bson.M, expression interface{}) interface{} {
+	t.Helper()
+	switch e := expression.(type) {
+	case string:
+		if strings.HasPrefix(e, "$") {
+			return doc[e[1:]]
+		}
+		return e
+	case bson.M:
+		for operator, operand := range e {
+			value := evaluate(t, doc, operand)
+			switch operator {
+			case "$toObjectId":
+				id, err := primitive.ObjectIDFromHex(value.(string))
+				if err != nil {
+					t.Fatalf("$toObjectId of %v: %v", value, err)
+				}
+				return id
+			case "$toDate":
+				return value.(primitive.ObjectID).Timestamp()
+			}
+			t.Fatalf("unsupported expression %s", operator)
+		}
+	}
+	t.Fatalf("unsupported expression %v", expression)
+	return nil
+}
+
+// backfillAll runs every backfill over collections in memory and returns the
+// number of documents each modified.
+func backfillAll(t *testing.T, collections map[string][]bson.M) []int {
+	var modified []int
+	for _, b := range backfills {
+		n := 0
+		for _, doc := range collections[b.collection] {
+			if !matches(t, doc, b.filter) {
+				continue
+			}
+			for field, expression := range b.set {
+				doc[field] = evaluate(t, doc, expression)
+			}
+			n++
+		}
+		modified = append(modified, n)
+	}
+	return modified
+}
+
+func TestBackfillsOldSchema(t *testing.T) {
+	owner := primitive.NewObjectID()
+	oldTodoID := primitive.NewObjectIDFromTimestamp(time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC))
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	oldTodo := bson.M{"_id": oldTodoID, "name": "legacy", "userid": owner.Hex()}
+	blankStatus := bson.M{"_id": primitive.NewObjectID(), "name": "blank", "userid": owner, "created_at": created, "updated_at": created, "status": ""}
+	current := bson.M{"_id": primitive.NewObjectID(), "name": "current", "userid": owner, "created_at": created, "updated_at": created, "status": "completed"}
+	oldUserID := primitive.NewObjectIDFromTimestamp(time.Date(2021, 7, 4, 0, 0, 0, 0, time.UTC))
+	oldUser := bson.M{"_id": oldUserID, "email": "old@example.com"}
+	collections := map[string][]bson.M{
+		"todos": {oldTodo, blankStatus, current},
+		"user":  {oldUser},
+	}
+
+	modified := backfillAll(t, collections)
+	want := []int{1, 1, 1, 2, 1, 1}
+	for i, b := range backfills {
+		if modified[i] != want[i] {
+			t.Errorf("%s modified %d, want %d", b.name, modified[i], want[i])
+		}
+	}
+
+	if oldTodo["userid"] != owner {
+		t.Errorf("todo owner = %v, want ObjectID %s", oldTodo["userid"], owner.Hex())
+	}
+	if got := oldTodo["created_at"]; got != oldTodoID.Timestamp() {
+		t.Errorf("todo created_at = %v, want the id's %v", got, oldTodoID.Timestamp())
+	}
+	if oldTodo["updated_at"] != oldTodo["created_at"] {
+		t.Errorf("todo updated_at = %v, want created_at", oldTodo["updated_at"])
+	}
+	if oldTodo["status"] != "pending" || blankStatus["status"] != "pending" {
+		t.Errorf("statuses = %v, %v; want pending", oldTodo["status"], blankStatus["status"])
+	}
+	if current["status"] != "completed" || current["created_at"] != created {
+		t.Errorf("an up-to-date todo was changed: %v", current)
+	}
+	if oldUser["created_at"] != oldUserID.Timestamp() || oldUser["updated_at"] != oldUser["created_at"] {
+		t.Errorf("user timestamps = %v, %v", oldUser["created_at"], oldUser["updated_at"])
+	}
+
+	// A second run finds nothing left to change
+	for i, n := range backfillAll(t, collections) {
+		if n != 0 {
+			t.Errorf("rerun: %s modified %d", backfills[i].name, n)
+		}
+	}
+}
+
+// updateResult is a reply to an update that modified n documents.
+func updateResult(n int32) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+func TestRunReportsModifiedCounts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("run", func(mt *mtest.T) {
+		for i := range backfills {
+			mt.AddMockResponses(updateResult(int32(i + 1)))
+		}
+		mixed := primitive.NewObjectID()
+		taken := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "tasky.user", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: mixed}, {Key: "email", Value: "Mixed@Example.com"}},
+				bson.D{{Key: "_id", Value: taken}, {Key: "email", Value: "Taken@Example.com"}}),
+			mtest.CreateCursorResponse(0, "tasky.user", mtest.FirstBatch, bson.D{{Key: "n", Value: 0}}),
+			updateResult(1),
+			mtest.CreateCursorResponse(0, "tasky.user", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+		)
+
+		report, err := Run(context.Background(), mt.DB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, b := range backfills {
+			if step := report.Steps[i]; step.Name != b.name || step.Modified != int64(i+1) {
+				t.Errorf("step %d = %+v, want %s with %d modified", i, step, b.name, i+1)
+			}
+		}
+		if last := report.Steps[len(report.Steps)-1]; last.Name != "user.email" || last.Modified != 1 {
+			t.Errorf("email step = %+v, want 1 modified", last)
+		}
+		if report.Conflicts != 1 {
+			t.Errorf("conflicts = %d, want 1", report.Conflicts)
+		}
+
+		var emailUpdate bson.Raw
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "update" && evt.Command.Lookup("update").StringValue() == "user" {
+				statement := evt.Command.Lookup("updates").Array().Index(0).Value().Document()
+				if _, err := statement.LookupErr("u", "$set", "email"); err == nil {
+					emailUpdate = statement
+				}
+			}
+		}
+		if emailUpdate == nil {
+			t.Fatal("no email was lowercased")
+		}
+		if id := emailUpdate.Lookup("q", "_id").ObjectID(); id != mixed {
+			t.Errorf("lowercased user %s, want %s", id.Hex(), mixed.Hex())
+		}
+		if email := emailUpdate.Lookup("u", "$set", "email").StringValue(); email != "mixed@example.com" {
+			t.Errorf("email set to %q", email)
+		}
+		if !strings.Contains(report.String(), "1 users kept a mixed-case email") {
+			t.Errorf("report does not mention the conflict:\n%s", report)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package models
+
+import "strings"
+
+// Completeness summarizes which optional profile fields a user has filled in.
+// Score is the percentage of profileChecks that pass.
+type Completeness struct {
+	Score   int      `json:"score"`
+	Missing []string `json:"missing"`
+}
+
+// profileChecks lists the profile items counted towards completeness, in the
+// order they are reported as missing.
+var profileChecks = []struct {
+	name string
+	done func(User) bool
+}{
+	{"username", func(u User) bool { return u.Name != nil && strings.TrimSpace(*u.Name) != "" }},
+	{"email", func(u User) bool { return u.Email != nil && strings.TrimSpace(*u.Email) != "" }},
+	{"calendar_feed", func(u User) bool { return u.FeedToken != "" }},
+}
+
+// ProfileCompleteness scores u without touching the database.
+func (u User) ProfileCompleteness() Completeness {
+	result := Completeness{Missing: []string{}}
+	for _, check := range profileChecks {
+		if !check.done(u) {
+			result.Missing = append(result.Missing, check.name)
+		}
+	}
+	result.Score = 100 * (len(profileChecks) - len(result.Missing)) / len(profileChecks)
+	return result
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfileCompletenessMinimal(t *testing.T) {
+	blank := "  "
+	got := User{Name: &blank}.ProfileCompleteness()
+	if got.Score != 0 {
+		t.Errorf("score = %d, want 0", got.Score)
+	}
+	if missing := strings.Join(got.Missing, ","); missing != "username,email,calendar_feed" {
+		t.Errorf("missing = %s", missing)
+	}
+}
+
+func TestProfileCompletenessPartial(t *testing.T) {
+	name, email := "Jo", "jo@example.com"
+	got := User{Name: &name, Email: &email}.ProfileCompleteness()
+	if got.Score != 66 {
+		t.Errorf("score = %d, want 66", got.Score)
+	}
+	if len(got.Missing) != 1 || got.Missing[0] != "calendar_feed" {
+		t.Errorf("missing = %v, want [calendar_feed]", got.Missing)
+	}
+}
+
+func TestProfileCompletenessComplete(t *testing.T) {
+	name, email := "Jo", "jo@example.com"
+	got := User{Name: &name, Email: &email, FeedToken: "feed"}.ProfileCompleteness()
+	if got.Score != 100 {
+		t.Errorf("score = %d, want 100", got.Score)
+	}
+	// An empty list, not null, so clients can iterate it
+	if got.Missing == nil || len(got.Missing) != 0 {
+		t.Errorf("missing = %#v, want an empty list", got.Missing)
+	}
+}
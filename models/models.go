@@ -1,20 +1,142 @@
 package models
 
 import (
+	"encoding/json"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Todo struct {
-	ID     primitive.ObjectID `bson:"_id"`
-	Name   string             `json:"name"		bson:"name"`
-	Status string             `json:"status"	bson:"status"`
-	UserID string             `json:"user_id"	bson:"user_id"`
+	// ID keeps its historical JSON name, which the frontend reads
+	ID      primitive.ObjectID `json:"ID" bson:"_id"`
+	ShortID string             `json:"short_id,omitempty" bson:"short_id,omitempty"`
+	Name    string             `json:"name" bson:"name"`
+	// Status is pending or completed
+	Status string `json:"status" bson:"status"`
+	// UserID is the owner; it has always been stored as userid
+	UserID   primitive.ObjectID `json:"user_id" bson:"userid"`
+	Notes    string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	Archived bool               `json:"archived" bson:"archived,omitempty"`
+	// Pinned todos are listed before all others
+	Pinned bool `json:"pinned" bson:"pinned,omitempty"`
+	// Draft todos are left out of lists, counts and feeds until published
+	Draft bool `json:"draft" bson:"draft,omitempty"`
+	// BlockedBy lists the owner's todos that must be done before this one
+	BlockedBy []primitive.ObjectID `json:"blocked_by,omitempty" bson:"blocked_by,omitempty"`
+	// IsBlocked is computed for responses: a blocker exists and is not completed
+	IsBlocked bool `json:"is_blocked" bson:"-"`
+	// ArchivedAt is when the todo was archived; retention windows count from it
+	ArchivedAt JSONTime `json:"archived_at" bson:"archived_at,omitempty"`
+	// Priority is low, medium or high; empty means unset
+	Priority string   `json:"priority,omitempty" bson:"priority,omitempty"`
+	Tags     []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	// DueDate is optional; only due-dated todos appear in the calendar feed
+	DueDate JSONTime `json:"due_date" bson:"due_date,omitempty"`
+	// Attachments are managed through their own endpoints, never by updates
+	Attachments []Attachment `json:"attachments,omitempty" bson:"attachments,omitempty"`
+	// Snoozes records each time the due date was deferred, oldest first
+	Snoozes []Snooze `json:"snoozes,omitempty" bson:"snoozes,omitempty"`
+	// Order is the user's manual position, starting at 1; 0 means unset
+	Order int `json:"order,omitempty" bson:"order,omitempty"`
+	// CompletedAt is when the todo last became completed; reopening clears it
+	CompletedAt JSONTime `json:"completed_at" bson:"completed_at,omitempty"`
+	CreatedAt   JSONTime `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt   JSONTime `json:"updated_at" bson:"updated_at,omitempty"`
+	// Version counts the edits made through PUT and PATCH; 0 means never edited
+	Version int `json:"version" bson:"version,omitempty"`
+	// UniqueKey is the normalized name of a todo created with unique=true;
+	// renaming or archiving the todo clears it
+	UniqueKey string `json:"-" bson:"unique_key,omitempty"`
+}
+
+// Attachment is a link to a file kept elsewhere, attached to a todo.
+type Attachment struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id"`
+	Name    string             `json:"name" bson:"name"`
+	URL     string             `json:"url" bson:"url"`
+	AddedAt JSONTime           `json:"added_at" bson:"added_at"`
+}
+
+// Snooze records one deferral of a todo's due date.
+type Snooze struct {
+	From      JSONTime `json:"from" bson:"from,omitempty"`
+	Until     JSONTime `json:"until" bson:"until"`
+	SnoozedAt JSONTime `json:"snoozed_at" bson:"snoozed_at"`
+}
+
+// todoStatusCompleted is the status of a done todo.
+const todoStatusCompleted = "completed"
+
+// IsOverdue reports whether the todo is due before now and not completed.
+func (t Todo) IsOverdue(now time.Time) bool {
+	return !t.DueDate.IsZero() && t.DueDate.Before(now) && t.Status != todoStatusCompleted
+}
+
+// MarshalJSON adds the computed is_overdue field, evaluated at the time of
+// serialization.
+func (t Todo) MarshalJSON() ([]byte, error) {
+	type todo Todo
+	return json.Marshal(struct {
+		todo
+		IsOverdue bool `json:"is_overdue"`
+	}{todo(t), t.IsOverdue(time.Now())})
 }
 
 type User struct {
-	ID     primitive.ObjectID 	`bson:"_id"`
-	Name   *string             	`json:"username"	bson:"username"`
-	Email  *string             	`json:"email"		bson:"email"`
-	Password *string             `json:"password"	bson:"password"`
+	ID       primitive.ObjectID `bson:"_id"`
+	Name     *string            `json:"username"	bson:"username"`
+	Email    *string            `json:"email"		bson:"email"`
+	Password *string            `json:"password"	bson:"password"`
+	// Role is assigned by operators in the database, never from request input
+	Role string `json:"-" bson:"role,omitempty"`
+	// Active is nil for accounts created before deactivation existed
+	Active       *bool `json:"-" bson:"active,omitempty"`
+	TokenVersion int   `json:"-" bson:"token_version,omitempty"`
+	// FeedToken is the SHA-256 hex digest of the calendar feed token
+	FeedToken string `json:"-" bson:"feed_token,omitempty"`
+	// Webhook receives the user's todo events; nil when none is configured
+	Webhook *Webhook `json:"-" bson:"webhook,omitempty"`
+	// RetentionDays overrides how long archived todos are kept; 0 uses the
+	// global ARCHIVE_RETENTION_DAYS
+	RetentionDays int `json:"-" bson:"retention_days,omitempty"`
+	// MustChangePassword is set for accounts given a temporary password
+	MustChangePassword bool     `json:"-" bson:"must_change_password,omitempty"`
+	CreatedAt          JSONTime `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt          JSONTime `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+// IsActive reports whether the account may log in.
+func (u User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}
+
+// Webhook is an endpoint notified of a user's todo events. Secret keys the
+// HMAC signature of each delivery, so it is stored as is.
+type Webhook struct {
+	URL    string `bson:"url"`
+	Secret string `bson:"secret"`
+}
+
+// APIKey is a long-lived credential for scripts. Only a hash of the key is
+// stored; the plaintext is shown once, when the key is created.
+type APIKey struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	UserID     string             `json:"-" bson:"user_id"`
+	Name       string             `json:"name,omitempty" bson:"name,omitempty"`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	Hash       string             `json:"-" bson:"hash"`
+	CreatedAt  JSONTime           `json:"created_at" bson:"created_at,omitempty"`
+	LastUsedAt JSONTime           `json:"last_used_at" bson:"last_used_at,omitempty"`
 }
 
+// AuditEvent records an authentication event for compliance exports.
+type AuditEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Timestamp JSONTime           `json:"timestamp" bson:"timestamp"`
+	// User is the user id, or the submitted email when no account matched
+	User      string `json:"user" bson:"user"`
+	Event     string `json:"event" bson:"event"`
+	IP        string `json:"ip" bson:"ip"`
+	UserAgent string `json:"user_agent" bson:"user_agent"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestUserIsActive(t *testing.T) {
+	active, inactive := true, false
+	for _, tc := range []struct {
+		active *bool
+		want   bool
+	}{
+		{nil, true},
+		{&active, true},
+		{&inactive, false},
+	} {
+		if got := (User{Active: tc.active}).IsActive(); got != tc.want {
+			t.Errorf("IsActive with active %v = %v, want %v", tc.active, got, tc.want)
+		}
+	}
+}
+
+func TestTodoIsOverdue(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	past, future := NewJSONTime(now.Add(-time.Hour)), NewJSONTime(now.Add(time.Hour))
+	for _, tc := range []struct {
+		name string
+		todo Todo
+		want bool
+	}{
+		{"past due and pending", Todo{DueDate: past, Status: "pending"}, true},
+		{"past due without a status", Todo{DueDate: past}, true},
+		{"past due and completed", Todo{DueDate: past, Status: "completed"}, false},
+		{"due later", Todo{DueDate: future, Status: "pending"}, false},
+		{"undated", Todo{Status: "pending"}, false},
+	} {
+		if got := tc.todo.IsOverdue(now); got != tc.want {
+			t.Errorf("%s: IsOverdue = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTodoJSONIncludesIsOverdue(t *testing.T) {
+	for _, tc := range []struct {
+		todo Todo
+		want bool
+	}{
+		{Todo{Name: "late", DueDate: NewJSONTime(time.Now().Add(-time.Hour))}, true},
+		{Todo{Name: "done", DueDate: NewJSONTime(time.Now().Add(-time.Hour)), Status: "completed"}, false},
+		{Todo{Name: "someday"}, false},
+	} {
+		data, err := json.Marshal(tc.todo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			Name      string `json:"name"`
+			IsOverdue *bool  `json:"is_overdue"`
+		}
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Name != tc.todo.Name || out.IsOverdue == nil || *out.IsOverdue != tc.want {
+			t.Errorf("%s marshals as %s, want is_overdue %v", tc.todo.Name, data, tc.want)
+		}
+	}
+}
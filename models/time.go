@@ -0,0 +1,68 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// JSONTime is a timestamp that always marshals to JSON as RFC 3339 in UTC
+// with second precision. The zero value marshals as null. In BSON it is
+// stored as a regular date.
+type JSONTime struct {
+	time.Time
+}
+
+// NewJSONTime normalizes t to UTC with second precision.
+func NewJSONTime(t time.Time) JSONTime {
+	return JSONTime{t.UTC().Truncate(time.Second)}
+}
+
+// Now returns the current time as a JSONTime.
+func Now() JSONTime {
+	return NewJSONTime(time.Now())
+}
+
+func (t JSONTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(`"` + t.UTC().Truncate(time.Second).Format(time.RFC3339) + `"`), nil
+}
+
+// UnmarshalJSON accepts RFC 3339 timestamps with any offset and normalizes
+// them to UTC.
+func (t *JSONTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*t = JSONTime{}
+		return nil
+	}
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return fmt.Errorf("timestamp must be an RFC 3339 string")
+	}
+	parsed, err := time.Parse(time.RFC3339, string(data[1:len(data)-1]))
+	if err != nil {
+		return fmt.Errorf("timestamp must be an RFC 3339 string: %w", err)
+	}
+	*t = NewJSONTime(parsed)
+	return nil
+}
+
+func (t JSONTime) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(t.Time)
+}
+
+func (t *JSONTime) UnmarshalBSONValue(typ bsontype.Type, data []byte) error {
+	if typ == bsontype.Null {
+		*t = JSONTime{}
+		return nil
+	}
+	value, ok := bson.RawValue{Type: typ, Value: data}.TimeOK()
+	if !ok {
+		return fmt.Errorf("cannot decode %v into a timestamp", typ)
+	}
+	*t = NewJSONTime(value)
+	return nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestJSONTimeRoundTripsToUTC(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  string
+	}{
+		{`"2024-03-10T08:30:00Z"`, `"2024-03-10T08:30:00Z"`},
+		{`"2024-03-10T08:30:00+05:30"`, `"2024-03-10T03:00:00Z"`},
+		{`"2024-03-09T23:30:00-08:00"`, `"2024-03-10T07:30:00Z"`},
+		{`"2024-03-10T08:30:00.987654+01:00"`, `"2024-03-10T07:30:00Z"`},
+	} {
+		var ts JSONTime
+		if err := json.Unmarshal([]byte(tc.input), &ts); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", tc.input, err)
+		}
+		if ts.Location() != time.UTC {
+			t.Errorf("Unmarshal(%s) left the time in %v", tc.input, ts.Location())
+		}
+		out, err := json.Marshal(ts)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(out) != tc.want {
+			t.Errorf("%s round-tripped to %s, want %s", tc.input, out, tc.want)
+		}
+	}
+}
+
+func TestJSONTimeMarshalsLocalTimeAsUTC(t *testing.T) {
+	zone := time.FixedZone("UTC-3", -3*60*60)
+	out, err := json.Marshal(JSONTime{time.Date(2024, 1, 2, 21, 15, 30, 500, zone)})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(out) != `"2024-01-03T00:15:30Z"` {
+		t.Fatalf("got %s", out)
+	}
+}
+
+func TestJSONTimeNull(t *testing.T) {
+	out, _ := json.Marshal(JSONTime{})
+	if string(out) != "null" {
+		t.Errorf("zero time marshals as %s, want null", out)
+	}
+	ts := NewJSONTime(time.Now())
+	if err := json.Unmarshal([]byte("null"), &ts); err != nil || !ts.IsZero() {
+		t.Errorf("null unmarshals to %v, %v; want the zero time", ts, err)
+	}
+}
+
+func TestJSONTimeRejectsInvalidInput(t *testing.T) {
+	for _, input := range []string{`"2024-03-10"`, `"yesterday"`, `1710059400`, `"2024-03-10T08:30:00"`} {
+		var ts JSONTime
+		if err := json.Unmarshal([]byte(input), &ts); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", input)
+		}
+	}
+}
+
+func TestJSONTimeBSON(t *testing.T) {
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	in := struct {
+		At JSONTime `bson:"at"`
+	}{JSONTime{time.Date(2024, 6, 1, 12, 0, 0, 0, zone)}}
+	raw, err := bson.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if got := bson.Raw(raw).Lookup("at").Time(); !got.Equal(in.At.Time) {
+		t.Fatalf("stored %v, want a date equal to %v", got, in.At.Time)
+	}
+
+	var out struct {
+		At JSONTime `bson:"at"`
+	}
+	if err := bson.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !out.At.Equal(in.At.Time) || out.At.Location() != time.UTC {
+		t.Fatalf("decoded %v, want %v in UTC", out.At, in.At.Time)
+	}
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Todo status values as stored by the frontend.
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+)
+
+// Todo priority values; a todo may also have no priority.
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+)
+
+// MaxNotesLength caps the long-form notes attached to a single todo.
+const MaxNotesLength = 5000
+
+// TodoInput is what a caller may choose about a new todo. Everything else is
+// set by NewTodo.
+type TodoInput struct {
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Notes    string   `json:"notes"`
+	Priority string   `json:"priority"`
+	Tags     []string `json:"tags"`
+	DueDate  JSONTime `json:"due_date"`
+	Pinned   bool     `json:"pinned"`
+	Draft    bool     `json:"draft"`
+}
+
+// ValidPriority reports whether priority is empty or a known priority value.
+func ValidPriority(priority string) bool {
+	switch priority {
+	case "", PriorityLow, PriorityMedium, PriorityHigh:
+		return true
+	}
+	return false
+}
+
+// Validate checks the rules every new todo must meet. Limits that are
+// configured per deployment, such as name length, are left to the caller.
+func (input TodoInput) Validate() error {
+	switch {
+	case strings.TrimSpace(input.Name) == "":
+		return errors.New("name is required")
+	case input.Status != "" && input.Status != StatusPending && input.Status != StatusCompleted:
+		return errors.New("status must be pending or completed")
+	case !ValidPriority(input.Priority):
+		return errors.New("priority must be low, medium or high")
+	case utf8.RuneCountInString(input.Notes) > MaxNotesLength:
+		return fmt.Errorf("notes must be at most %d characters", MaxNotesLength)
+	}
+	return nil
+}
+
+// NewTodo validates input and returns an unsaved todo owned by ownerID with a
+// fresh id and timestamps. The status defaults to pending, and a todo created
+// completed is completed now. The short id and order are left for the caller,
+// since they depend on what is already stored.
+func NewTodo(ownerID primitive.ObjectID, input TodoInput) (*Todo, error) {
+	if ownerID.IsZero() {
+		return nil, errors.New("owner is required")
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := Now()
+	todo := &Todo{
+		ID:        primitive.NewObjectID(),
+		Name:      input.Name,
+		Status:    input.Status,
+		UserID:    ownerID,
+		Notes:     input.Notes,
+		Pinned:    input.Pinned,
+		Draft:     input.Draft,
+		Priority:  input.Priority,
+		Tags:      input.Tags,
+		DueDate:   input.DueDate,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if todo.Status == "" {
+		todo.Status = StatusPending
+	}
+	if todo.Status == StatusCompleted {
+		todo.CompletedAt = now
+	}
+	return todo, nil
+}
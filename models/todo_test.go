@@ -0,0 +1,102 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewTodoDefaults(t *testing.T) {
+	owner := primitive.NewObjectID()
+	before := time.Now().Add(-time.Second)
+	todo, err := NewTodo(owner, TodoInput{Name: "buy milk", Tags: []string{"errands"}})
+	if err != nil {
+		t.Fatalf("NewTodo: %v", err)
+	}
+	if todo.ID.IsZero() {
+		t.Error("todo has no id")
+	}
+	if todo.UserID != owner {
+		t.Errorf("owner = %s, want %s", todo.UserID.Hex(), owner.Hex())
+	}
+	if todo.Status != StatusPending {
+		t.Errorf("status = %q, want %q", todo.Status, StatusPending)
+	}
+	if todo.CreatedAt.Time.Before(before) || !todo.UpdatedAt.Time.Equal(todo.CreatedAt.Time) {
+		t.Errorf("created %v, updated %v, want both now", todo.CreatedAt.Time, todo.UpdatedAt.Time)
+	}
+	if !todo.CompletedAt.Time.IsZero() {
+		t.Errorf("pending todo completed at %v", todo.CompletedAt.Time)
+	}
+	if todo.ShortID != "" || todo.Order != 0 || todo.Version != 0 {
+		t.Errorf("short id %q, order %d, version %d, want them left unset", todo.ShortID, todo.Order, todo.Version)
+	}
+
+	other, err := NewTodo(owner, TodoInput{Name: "buy milk"})
+	if err != nil {
+		t.Fatalf("NewTodo: %v", err)
+	}
+	if other.ID == todo.ID {
+		t.Error("two todos share an id")
+	}
+}
+
+func TestNewTodoCompleted(t *testing.T) {
+	todo, err := NewTodo(primitive.NewObjectID(), TodoInput{Name: "done already", Status: StatusCompleted})
+	if err != nil {
+		t.Fatalf("NewTodo: %v", err)
+	}
+	if !todo.CompletedAt.Time.Equal(todo.CreatedAt.Time) {
+		t.Errorf("completed at %v, want the creation time %v", todo.CompletedAt.Time, todo.CreatedAt.Time)
+	}
+}
+
+func TestNewTodoValidation(t *testing.T) {
+	owner := primitive.NewObjectID()
+	for _, tc := range []struct {
+		name  string
+		owner primitive.ObjectID
+		input TodoInput
+	}{
+		{"no owner", primitive.NilObjectID, TodoInput{Name: "orphan"}},
+		{"blank name", owner, TodoInput{Name: "  \t"}},
+		{"unknown status", owner, TodoInput{Name: "x", Status: "archived"}},
+		{"unknown priority", owner, TodoInput{Name: "x", Priority: "urgent"}},
+		{"long notes", owner, TodoInput{Name: "x", Notes: strings.Repeat("é", MaxNotesLength+1)}},
+	} {
+		if todo, err := NewTodo(tc.owner, tc.input); err == nil {
+			t.Errorf("%s: got %+v, want an error", tc.name, todo)
+		}
+	}
+
+	// Limits count characters, not bytes
+	if _, err := NewTodo(owner, TodoInput{Name: "x", Notes: strings.Repeat("é", MaxNotesLength), Priority: PriorityHigh}); err != nil {
+		t.Errorf("notes at the limit: %v", err)
+	}
+}
+
+func TestTodoBSONFieldNames(t *testing.T) {
+	todo, err := NewTodo(primitive.NewObjectID(), TodoInput{Name: "x", Priority: PriorityLow})
+	if err != nil {
+		t.Fatalf("NewTodo: %v", err)
+	}
+	raw, err := bson.Marshal(todo)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	doc := bson.Raw(raw)
+	for _, key := range []string{"_id", "name", "status", "userid", "priority", "created_at", "updated_at"} {
+		if _, err := doc.LookupErr(key); err != nil {
+			t.Errorf("stored todo has no %q: %s", key, doc)
+		}
+	}
+	// Unset optional fields are omitted rather than stored empty
+	for _, key := range []string{"short_id", "notes", "tags", "version", "completed_at"} {
+		if _, err := doc.LookupErr(key); err == nil {
+			t.Errorf("stored todo has %q: %s", key, doc)
+		}
+	}
+}
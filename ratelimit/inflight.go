@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultMaxInFlight is how many requests are served at once unless
+// MAX_INFLIGHT says otherwise.
+const defaultMaxInFlight = 100
+
+// MaxInFlight returns middleware that serves at most limit requests at a
+// time and answers the rest with 503 instead of queueing them. Requests for
+// the exempt route paths, such as health checks, always pass. A limit of 0
+// disables the middleware.
+func MaxInFlight(limit int, exempt ...string) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	skip := map[string]bool{}
+	for _, path := range exempt {
+		skip[path] = true
+	}
+	slots := make(chan struct{}, limit)
+	return func(c *gin.Context) {
+		if skip[c.FullPath()] {
+			c.Next()
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			c.Next()
+		default:
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"code": "OVERLOADED", "error": "server is busy, please retry"})
+		}
+	}
+}
+
+// MaxInFlightFromEnv reads MAX_INFLIGHT, the number of requests served at
+// once, where 0 means unlimited.
+func MaxInFlightFromEnv() int {
+	limit := defaultMaxInFlight
+	if value := os.Getenv("MAX_INFLIGHT"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			limit = n
+		} else {
+			log.Printf("Invalid MAX_INFLIGHT %q, using %d", value, defaultMaxInFlight)
+		}
+	}
+	return limit
+}
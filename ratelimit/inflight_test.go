@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	router := gin.New()
+	router.Use(MaxInFlight(2, "/healthz"))
+	router.GET("/slow", func(c *gin.Context) {
+		started <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+	router.GET("/healthz", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := get("/slow"); w.Code != http.StatusOK {
+				t.Errorf("request within the limit: status = %d", w.Code)
+			}
+		}()
+		<-started
+	}
+
+	w := get("/slow")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("overflow request: status = %d, Retry-After %q; want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Errorf("health check at the limit: status = %d, want 200", w.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	go func() { <-started }()
+	if w := get("/slow"); w.Code != http.StatusOK {
+		t.Errorf("after the slots were freed: status = %d, want 200", w.Code)
+	}
+}
+
+func TestMaxInFlightUnlimited(t *testing.T) {
+	router := gin.New()
+	router.Use(MaxInFlight(0))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+}
+
+func TestMaxInFlightFromEnv(t *testing.T) {
+	for value, want := range map[string]int{"": defaultMaxInFlight, "0": 0, "25": 25, "-1": defaultMaxInFlight, "many": defaultMaxInFlight} {
+		t.Setenv("MAX_INFLIGHT", value)
+		if got := MaxInFlightFromEnv(); got != want {
+			t.Errorf("MAX_INFLIGHT=%q: got %d, want %d", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package ratelimit provides fixed-window request limiting for gin routes.
+package ratelimit
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limiter counts events per key within fixed time windows. Its counters live
+// in the default CounterStore, under the limiter's own prefix.
+type Limiter struct {
+	limit  int
+	window time.Duration
+	prefix string
+}
+
+// New returns a limiter allowing limit events per key in every window.
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{limit: limit, window: window}
+}
+
+// Allow records an event for key and reports whether it is within the limit,
+// along with how long until the key's window resets. Requests are allowed
+// when the store cannot be reached, so an outage does not take the API down.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	count, remaining, err := DefaultStore().Incr("ratelimit:"+l.prefix+key, l.window)
+	if err != nil {
+		log.Printf("Rate limit store unavailable, allowing request: %v", err)
+		return true, 0
+	}
+	return count <= l.limit, remaining
+}
+
+// PerIP returns middleware limiting each client IP to limit requests per window.
+func PerIP(limit int, window time.Duration) gin.HandlerFunc {
+	limiter := New(limit, window)
+	return func(c *gin.Context) {
+		// Routes sharing a limit still count separately
+		allowed, retryAfter := limiter.Allow(c.FullPath() + ":" + c.ClientIP())
+		if !allowed {
+			reject(c, retryAfter)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Identify returns the authenticated user making a request, if any.
+type Identify func(c *gin.Context) (userID string, ok bool)
+
+// Tiered returns middleware applying a per-user limit to authenticated
+// requests, as reported by identify, and a separate per-IP limit to all
+// others. A limiter may be nil to leave that tier unlimited.
+func Tiered(anonymous *Limiter, authenticated *Limiter, identify Identify) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter, key := anonymous, "ip:"+c.ClientIP()
+		if userID, ok := identify(c); ok {
+			limiter, key = authenticated, "user:"+userID
+		}
+		if limiter != nil {
+			if allowed, retryAfter := limiter.Allow(key); !allowed {
+				reject(c, retryAfter)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// FromEnv returns a limiter allowing the number of requests per window set
+// in the named variable, fallback if it is unset or invalid, or nil when the
+// limit is 0.
+func FromEnv(name string, fallback int, window time.Duration) *Limiter {
+	limit := fallback
+	if value := os.Getenv(name); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			limit = n
+		} else {
+			log.Printf("Invalid %s %q, using %d", name, value, fallback)
+		}
+	}
+	if limit == 0 {
+		return nil
+	}
+	limiter := New(limit, window)
+	limiter.prefix = name + ":"
+	return limiter
+}
+
+func reject(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"code": "RATE_LIMITED", "error": "too many requests, please slow down"})
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestLimiterAllow(t *testing.T) {
+	limiter := New(2, time.Minute)
+	for i := 1; i <= 3; i++ {
+		allowed, remaining := limiter.Allow("limiter-allow")
+		if allowed != (i <= 2) {
+			t.Fatalf("event %d: allowed = %v", i, allowed)
+		}
+		if remaining <= 0 || remaining > time.Minute {
+			t.Fatalf("event %d: remaining = %v", i, remaining)
+		}
+	}
+	if allowed, _ := limiter.Allow("limiter-other"); !allowed {
+		t.Fatal("another key shares the count")
+	}
+}
+
+func TestPerIP(t *testing.T) {
+	router := gin.New()
+	router.POST("/auth/password-strength", PerIP(2, time.Minute), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/password-strength", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := send("198.51.100.1:1000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i+1, w.Code)
+		}
+	}
+	w := send("198.51.100.1:1000")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("got %d with Retry-After %q, want 429 with a Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := send("198.51.100.2:1000"); w.Code != http.StatusOK {
+		t.Fatalf("another IP: status = %d", w.Code)
+	}
+}
+
+func TestTiered(t *testing.T) {
+	identify := func(c *gin.Context) (string, bool) {
+		userID := c.GetHeader("X-Test-User")
+		return userID, userID != ""
+	}
+	router := gin.New()
+	router.GET("/todos", Tiered(New(2, time.Minute), New(5, time.Minute), identify), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(userID string) int {
+		req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+		req.RemoteAddr = "198.51.100.10:1000"
+		if userID != "" {
+			req.Header.Set("X-Test-User", userID)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 1; i <= 3; i++ {
+		if code := send(""); (code == http.StatusOK) != (i <= 2) {
+			t.Fatalf("anonymous request %d: status = %d", i, code)
+		}
+	}
+	// Signed-in users behind the same IP have their own, higher allowance
+	for i := 1; i <= 6; i++ {
+		if code := send("tiered-user"); (code == http.StatusOK) != (i <= 5) {
+			t.Fatalf("authenticated request %d: status = %d", i, code)
+		}
+	}
+	if code := send("tiered-other"); code != http.StatusOK {
+		t.Fatalf("another user: status = %d", code)
+	}
+}
+
+func TestTieredNilLimiterIsUnlimited(t *testing.T) {
+	router := gin.New()
+	never := func(*gin.Context) (string, bool) { return "", false }
+	router.GET("/", Tiered(nil, New(1, time.Minute), never), func(c *gin.Context) { c.Status(http.StatusOK) })
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i+1, w.Code)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMIT_TEST", "")
+	if limiter := FromEnv("RATE_LIMIT_TEST", 7, time.Minute); limiter == nil || limiter.limit != 7 {
+		t.Fatalf("unset: got %+v, want the fallback of 7", limiter)
+	}
+	t.Setenv("RATE_LIMIT_TEST", "12")
+	if limiter := FromEnv("RATE_LIMIT_TEST", 7, time.Minute); limiter == nil || limiter.limit != 12 {
+		t.Fatalf("12: got %+v", limiter)
+	}
+	t.Setenv("RATE_LIMIT_TEST", "lots")
+	if limiter := FromEnv("RATE_LIMIT_TEST", 7, time.Minute); limiter == nil || limiter.limit != 7 {
+		t.Fatalf("invalid: got %+v, want the fallback of 7", limiter)
+	}
+	t.Setenv("RATE_LIMIT_TEST", "0")
+	if limiter := FromEnv("RATE_LIMIT_TEST", 7, time.Minute); limiter != nil {
+		t.Fatalf("0: got %+v, want no limit", limiter)
+	}
+}
@@ -0,0 +1,253 @@
+package ratelimit
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisDialTimeout    = 2 * time.Second
+	redisCommandTimeout = time.Second
+	// redisMaxIdle is how many connections are kept open between commands.
+	redisMaxIdle = 8
+	// redisKeyPrefix keeps the counters apart from other data in the database.
+	redisKeyPrefix = "tasky:"
+)
+
+// redisIncrScript increments a counter and starts its window on the first
+// event, atomically so concurrent instances agree on the window.
+const redisIncrScript = `local n = redis.call("INCR", KEYS[1])
+if n == 1 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end
+return {n, redis.call("PTTL", KEYS[1])}`
+
+// RedisStore is a CounterStore kept in Redis, shared by every instance
+// pointing at the same server. It speaks the Redis protocol directly over a
+// small pool of connections.
+type RedisStore struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+
+	idle chan *redisConn
+}
+
+// NewRedisStore connects to the server in a redis:// or rediss:// URL, with
+// optional credentials and database number, and checks it answers.
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, errors.New("invalid REDIS_URL: scheme must be redis or rediss")
+	}
+	s := &RedisStore{addr: u.Host, useTLS: u.Scheme == "rediss", idle: make(chan *redisConn, redisMaxIdle)}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if s.db, err = strconv.Atoi(path); err != nil {
+			return nil, errors.New("invalid REDIS_URL: the path must be a database number")
+		}
+	}
+
+	if _, err := s.do("PING"); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return s, nil
+}
+
+// Incr implements CounterStore.
+func (s *RedisStore) Incr(key string, window time.Duration) (int, time.Duration, error) {
+	reply, err := s.do("EVAL", redisIncrScript, "1", redisKeyPrefix+key, strconv.FormatInt(window.Milliseconds(), 10))
+	if err != nil {
+		return 0, 0, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, 0, errors.New("redis: unexpected reply to counter script")
+	}
+	count, _ := values[0].(int64)
+	ttl, _ := values[1].(int64)
+	return int(count), time.Duration(ttl) * time.Millisecond, nil
+}
+
+// Count implements CounterStore.
+func (s *RedisStore) Count(key string) (int, error) {
+	reply, err := s.do("GET", redisKeyPrefix+key)
+	if err != nil || reply == nil {
+		return 0, err
+	}
+	value, _ := reply.(string)
+	return strconv.Atoi(value)
+}
+
+// Reset implements CounterStore.
+func (s *RedisStore) Reset(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, redisKeyPrefix+key)
+	}
+	_, err := s.do(args...)
+	return err
+}
+
+// do runs one command on a pooled connection. A connection that failed is
+// closed rather than returned to the pool.
+func (s *RedisStore) do(args ...string) (interface{}, error) {
+	conn, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection, or dials and sets up a new one.
+func (s *RedisStore) conn() (*redisConn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	var raw net.Conn
+	var err error
+	if s.useTLS {
+		host, _, _ := net.SplitHostPort(s.addr)
+		raw, err = tls.DialWithDialer(dialer, "tcp", s.addr, &tls.Config{ServerName: host})
+	} else {
+		raw, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: raw, r: bufio.NewReader(raw)}
+
+	if s.password != "" {
+		auth := []string{"AUTH", s.password}
+		if s.username != "" {
+			auth = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := conn.do(auth...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(s.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply from the server; the connection stays usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends a command and reads its reply.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(redisCommandTimeout))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply decodes one reply: simple and bulk strings become string,
+// integers int64, arrays []interface{} and nil replies nil.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		// An error element must not stop the read, or the rest of the
+		// reply would be left on the connection
+		for i := range values {
+			values[i], err = c.readReply()
+			var replyErr redisError
+			if errors.As(err, &replyErr) {
+				values[i] = replyErr
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
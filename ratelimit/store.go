@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// CounterStore keeps fixed-window event counters. A window starts with the
+// first event for a key and the count resets once it has passed. Stores shared
+// between instances, such as Redis, let every replica see the same counts.
+type CounterStore interface {
+	// Incr records an event for key, starting a window of the given length
+	// if none is running, and returns the count so far and the time left in
+	// the window.
+	Incr(key string, window time.Duration) (count int, remaining time.Duration, err error)
+	// Count returns the events recorded for key in its current window.
+	Count(key string) (int, error)
+	// Reset forgets the counts of keys.
+	Reset(keys ...string) error
+}
+
+var (
+	storeMu      sync.RWMutex
+	defaultStore CounterStore = NewMemoryStore()
+)
+
+// DefaultStore returns the store used by limiters and the login lockout.
+func DefaultStore() CounterStore {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return defaultStore
+}
+
+// SetDefaultStore replaces the default store. It is called once at startup,
+// before any limiter is created.
+func SetDefaultStore(store CounterStore) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	defaultStore = store
+}
+
+// StoreFromEnv returns a Redis store when REDIS_URL is set, so that counts are
+// shared by all instances, and an in-memory store otherwise.
+func StoreFromEnv() (CounterStore, error) {
+	if url := os.Getenv("REDIS_URL"); url != "" {
+		return NewRedisStore(url)
+	}
+	return NewMemoryStore(), nil
+}
+
+// memorySweepInterval is how often MemoryStore drops finished windows. The
+// sweep walks every key, so it runs at most this often rather than on every
+// new key.
+const memorySweepInterval = time.Minute
+
+// MemoryStore is a CounterStore local to this process.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	nextSweep time.Time
+}
+
+type bucket struct {
+	count   int
+	resetAt time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, nextSweep: time.Now().Add(memorySweepInterval)}
+}
+
+// Incr implements CounterStore.
+func (s *MemoryStore) Incr(key string, window time.Duration) (int, time.Duration, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !now.Before(s.nextSweep) {
+		s.evictExpired(now)
+		s.nextSweep = now.Add(memorySweepInterval)
+	}
+	b, ok := s.buckets[key]
+	if !ok || !now.Before(b.resetAt) {
+		b = &bucket{resetAt: now.Add(window)}
+		s.buckets[key] = b
+	}
+	b.count++
+	return b.count, b.resetAt.Sub(now), nil
+}
+
+// Count implements CounterStore.
+func (s *MemoryStore) Count(key string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok || !time.Now().Before(b.resetAt) {
+		return 0, nil
+	}
+	return b.count, nil
+}
+
+// Reset implements CounterStore.
+func (s *MemoryStore) Reset(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.buckets, key)
+	}
+	return nil
+}
+
+// evictExpired drops finished windows so idle keys do not accumulate.
+func (s *MemoryStore) evictExpired(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.resetAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
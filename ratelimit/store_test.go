@@ -0,0 +1,249 @@
+package ratelimit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCounterStore checks the CounterStore contract: counts grow within a
+// window, keys are independent, Reset forgets them and a finished window
+// starts over.
+func testCounterStore(t *testing.T, store CounterStore) {
+	t.Helper()
+	const window = time.Minute
+	for i := 1; i <= 3; i++ {
+		count, remaining, err := store.Incr("contract-a", window)
+		if err != nil {
+			t.Fatalf("Incr %d: %v", i, err)
+		}
+		if count != i || remaining <= 0 || remaining > window {
+			t.Fatalf("Incr %d = %d, %v; want %d within %v", i, count, remaining, i, window)
+		}
+	}
+	if count, err := store.Count("contract-a"); err != nil || count != 3 {
+		t.Fatalf("Count = %d, %v; want 3", count, err)
+	}
+	if count, err := store.Count("contract-b"); err != nil || count != 0 {
+		t.Fatalf("Count of an unused key = %d, %v; want 0", count, err)
+	}
+	if count, _, _ := store.Incr("contract-b", window); count != 1 {
+		t.Fatalf("another key starts at %d, want 1", count)
+	}
+
+	if err := store.Reset("contract-a", "contract-b"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if count, _ := store.Count("contract-a"); count != 0 {
+		t.Fatalf("Count after Reset = %d, want 0", count)
+	}
+	if err := store.Reset(); err != nil {
+		t.Fatalf("Reset of no keys: %v", err)
+	}
+
+	store.Incr("contract-short", 30*time.Millisecond)
+	store.Incr("contract-short", 30*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if count, _ := store.Count("contract-short"); count != 0 {
+		t.Fatalf("Count after the window = %d, want 0", count)
+	}
+	if count, _, _ := store.Incr("contract-short", 30*time.Millisecond); count != 1 {
+		t.Fatalf("Incr after the window = %d, want a new window at 1", count)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testCounterStore(t, store)
+
+	store.Incr("expired", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	store.Incr("fresh", time.Minute)
+	if _, ok := store.buckets["expired"]; !ok {
+		t.Fatal("finished windows were swept before the sweep interval")
+	}
+
+	store.nextSweep = time.Now()
+	store.Incr("fresh", time.Minute)
+	if _, ok := store.buckets["expired"]; ok {
+		t.Fatal("a finished window was kept past the sweep")
+	}
+	if count, _ := store.Count("fresh"); count != 2 {
+		t.Fatalf("the sweep dropped a running window: count %d", count)
+	}
+}
+
+// fakeRedis serves the few commands RedisStore sends, keeping counters in
+// memory. The counter script is recognised rather than interpreted.
+type fakeRedis struct {
+	net.Listener
+	mu       sync.Mutex
+	values   map[string]int
+	expiries map[string]time.Time
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{Listener: listener, values: map[string]int{}, expiries: map[string]time.Time{}}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, f.reply(args))
+	}
+}
+
+// readCommand reads one command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, strings.Join(args, " "))
+
+	now := time.Now()
+	for key, expiry := range f.expiries {
+		if !now.Before(expiry) {
+			delete(f.values, key)
+			delete(f.expiries, key)
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "EVAL":
+		if args[1] != redisIncrScript {
+			return "-ERR unknown script\r\n"
+		}
+		key := args[3]
+		f.values[key]++
+		if f.values[key] == 1 {
+			ms, _ := strconv.Atoi(args[4])
+			f.expiries[key] = now.Add(time.Duration(ms) * time.Millisecond)
+		}
+		return fmt.Sprintf("*2\r\n:%d\r\n:%d\r\n", f.values[key], f.expiries[key].Sub(now).Milliseconds())
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		s := strconv.Itoa(value)
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+	case "DEL":
+		for _, key := range args[1:] {
+			delete(f.values, key)
+			delete(f.expiries, key)
+		}
+		return fmt.Sprintf(":%d\r\n", len(args)-1)
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// sent reports whether a command starting with prefix was received.
+func (f *fakeRedis) sent(prefix string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, command := range f.commands {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRedisStore(t *testing.T) {
+	server := newFakeRedis(t)
+	store, err := NewRedisStore("redis://tasky:s3cret@" + server.Addr().String() + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCounterStore(t, store)
+
+	if !server.sent("AUTH tasky s3cret") || !server.sent("SELECT 2") {
+		t.Error("the URL's credentials and database were not used")
+	}
+	if !server.sent("GET "+redisKeyPrefix+"contract-a") || server.sent("GET contract-a") {
+		t.Error("keys are not prefixed")
+	}
+}
+
+func TestNewRedisStoreRejectsBadURLs(t *testing.T) {
+	for _, rawURL := range []string{"http://localhost:6379", "redis://localhost:6379/zero", "redis://%zz"} {
+		if _, err := NewRedisStore(rawURL); err == nil {
+			t.Errorf("NewRedisStore(%q) succeeded", rawURL)
+		}
+	}
+}
+
+func TestStoreFromEnv(t *testing.T) {
+	t.Setenv("REDIS_URL", "")
+	if store, err := StoreFromEnv(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := store.(*MemoryStore); !ok {
+		t.Fatalf("without REDIS_URL the store is %T, want a MemoryStore", store)
+	}
+
+	server := newFakeRedis(t)
+	t.Setenv("REDIS_URL", "redis://"+server.Addr().String())
+	if store, err := StoreFromEnv(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := store.(*RedisStore); !ok {
+		t.Fatalf("with REDIS_URL the store is %T, want a RedisStore", store)
+	}
+}
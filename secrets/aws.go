@@ -0,0 +1,211 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// awsTimeout bounds each call to AWS, so a missing network route fails
+// startup instead of hanging it.
+const awsTimeout = 10 * time.Second
+
+// AWSProvider reads secrets from AWS Secrets Manager. The secret id is Prefix
+// followed by the setting name, e.g. "tasky/SECRET_KEY", and its value must be
+// stored as a plain SecretString.
+//
+// Credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN, or, on EKS with IAM roles for service accounts, from
+// AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE.
+type AWSProvider struct {
+	Region string
+	Prefix string
+	Client *http.Client
+}
+
+type awsCredentials struct {
+	AccessKeyID     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	SessionToken    string `xml:"SessionToken"`
+}
+
+func (p AWSProvider) Lookup(name string) (string, error) {
+	if p.Region == "" {
+		return "", fmt.Errorf("AWS_REGION must be set to read secrets from AWS Secrets Manager")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), awsTimeout)
+	defer cancel()
+
+	creds, err := p.credentials(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": p.Prefix + name})
+	if err != nil {
+		return "", err
+	}
+	endpoint := "https://secretsmanager." + p.Region + ".amazonaws.com/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signV4(req, body, creds, p.Region, "secretsmanager", time.Now().UTC())
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("GetSecretValue %s returned %s: %s", p.Prefix+name, resp.Status, detail)
+	}
+
+	var result struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.SecretString, nil
+}
+
+func (p AWSProvider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return &http.Client{Timeout: awsTimeout}
+}
+
+// credentials returns static credentials from the environment, or exchanges
+// the service account token for temporary ones.
+func (p AWSProvider) credentials(ctx context.Context) (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	roleARN := os.Getenv("AWS_ROLE_ARN")
+	tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if roleARN == "" || tokenFile == "" {
+		return awsCredentials{}, fmt.Errorf("no AWS credentials: set AWS_ACCESS_KEY_ID or AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	// AssumeRoleWithWebIdentity is authenticated by the token itself, so the
+	// request is not signed
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {"tasky"},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	endpoint := "https://sts." + p.Region + ".amazonaws.com/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("AssumeRoleWithWebIdentity returned %s", resp.Status)
+	}
+
+	var result struct {
+		Credentials awsCredentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return awsCredentials{}, err
+	}
+	return result.Credentials, nil
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to req.
+func signV4(req *http.Request, body []byte, creds awsCredentials, region string, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
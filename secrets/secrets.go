@@ -0,0 +1,75 @@
+// Package secrets resolves sensitive settings such as SECRET_KEY and
+// MONGODB_URI from the environment, from files, or from a secrets manager,
+// so they can be rotated without baking them into the deployment.
+package secrets
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Provider looks up the secret stored under name. A secret that is not set
+// resolves to the empty string, matching os.Getenv.
+type Provider interface {
+	Lookup(name string) (string, error)
+}
+
+// EnvProvider reads secrets straight from environment variables.
+type EnvProvider struct{}
+
+func (EnvProvider) Lookup(name string) (string, error) {
+	return os.Getenv(name), nil
+}
+
+// FileProvider follows the Docker secrets convention: when NAME_FILE is set,
+// the secret is the content of that file with trailing newlines removed.
+// Otherwise the secret is read from NAME itself.
+type FileProvider struct{}
+
+func (FileProvider) Lookup(name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name), nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// FromEnv returns the provider selected by SECRET_SOURCE: env (the default),
+// file, or aws for AWS Secrets Manager.
+func FromEnv() Provider {
+	source := strings.ToLower(os.Getenv("SECRET_SOURCE"))
+	switch source {
+	case "file":
+		return FileProvider{}
+	case "aws":
+		return AWSProvider{Region: os.Getenv("AWS_REGION"), Prefix: os.Getenv("SECRET_AWS_PREFIX")}
+	case "", "env":
+	default:
+		log.Printf("Unknown SECRET_SOURCE %q, reading secrets from the environment", source)
+	}
+	return EnvProvider{}
+}
+
+var (
+	providerOnce sync.Once
+	provider     Provider
+)
+
+// Resolve looks name up through the provider selected by SECRET_SOURCE. It is
+// called while the application starts, so a secret that cannot be read stops
+// the process rather than running it with an empty value.
+func Resolve(name string) string {
+	providerOnce.Do(func() { provider = FromEnv() })
+	value, err := provider.Lookup(name)
+	if err != nil {
+		log.Fatalf("Failed to resolve secret %s: %v", name, err)
+	}
+	return value
+}
@@ -0,0 +1,129 @@
+package secrets
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("SECRETS_TEST_KEY", "from-env")
+	if value, err := (EnvProvider{}).Lookup("SECRETS_TEST_KEY"); err != nil || value != "from-env" {
+		t.Fatalf("Lookup = %q, %v", value, err)
+	}
+	if value, err := (EnvProvider{}).Lookup("SECRETS_TEST_UNSET"); err != nil || value != "" {
+		t.Fatalf("unset: Lookup = %q, %v; want empty", value, err)
+	}
+}
+
+func TestFileProviderTrimsTrailingNewlines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret_key")
+	if err := os.WriteFile(path, []byte("  s3cret value \r\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETS_TEST_KEY", "ignored")
+	t.Setenv("SECRETS_TEST_KEY_FILE", path)
+	value, err := (FileProvider{}).Lookup("SECRETS_TEST_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only line endings are removed; other whitespace may be part of the secret
+	if value != "  s3cret value " {
+		t.Fatalf("Lookup = %q", value)
+	}
+}
+
+func TestFileProviderFallsBackToEnv(t *testing.T) {
+	t.Setenv("SECRETS_TEST_KEY", "from-env")
+	t.Setenv("SECRETS_TEST_KEY_FILE", "")
+	if value, err := (FileProvider{}).Lookup("SECRETS_TEST_KEY"); err != nil || value != "from-env" {
+		t.Fatalf("Lookup = %q, %v", value, err)
+	}
+}
+
+func TestFileProviderMissingFile(t *testing.T) {
+	t.Setenv("SECRETS_TEST_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := (FileProvider{}).Lookup("SECRETS_TEST_KEY"); err == nil || !strings.Contains(err.Error(), "SECRETS_TEST_KEY_FILE") {
+		t.Fatalf("err = %v, want one naming SECRETS_TEST_KEY_FILE", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	for source, want := range map[string]Provider{
+		"":      EnvProvider{},
+		"env":   EnvProvider{},
+		"FILE":  FileProvider{},
+		"vault": EnvProvider{},
+	} {
+		t.Setenv("SECRET_SOURCE", source)
+		if got := FromEnv(); got != want {
+			t.Errorf("SECRET_SOURCE=%q: got %T, want %T", source, got, want)
+		}
+	}
+
+	t.Setenv("SECRET_SOURCE", "aws")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("SECRET_AWS_PREFIX", "tasky/")
+	if got, ok := FromEnv().(AWSProvider); !ok || got.Region != "eu-west-1" || got.Prefix != "tasky/" {
+		t.Errorf("SECRET_SOURCE=aws: got %+v", got)
+	}
+}
+
+// roundTripper answers requests with a canned response, remembering the
+// last request.
+type roundTripper struct {
+	status int
+	body   string
+	last   *http.Request
+}
+
+func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.last = req
+	return &http.Response{StatusCode: r.status, Status: http.StatusText(r.status), Body: io.NopCloser(strings.NewReader(r.body)), Header: http.Header{}}, nil
+}
+
+func TestAWSProviderLookup(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	transport := &roundTripper{status: http.StatusOK, body: `{"SecretString": "from-aws"}`}
+	provider := AWSProvider{Region: "eu-west-1", Prefix: "tasky/", Client: &http.Client{Transport: transport}}
+
+	value, err := provider.Lookup("SECRET_KEY")
+	if err != nil || value != "from-aws" {
+		t.Fatalf("Lookup = %q, %v", value, err)
+	}
+	req := transport.last
+	if req.URL.Host != "secretsmanager.eu-west-1.amazonaws.com" || req.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+		t.Errorf("sent %s %s with target %q", req.Method, req.URL, req.Header.Get("X-Amz-Target"))
+	}
+	if auth := req.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/secretsmanager/aws4_request") {
+		t.Errorf("Authorization = %q", auth)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if !strings.Contains(string(body), `"SecretId":"tasky/SECRET_KEY"`) {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestAWSProviderErrors(t *testing.T) {
+	if _, err := (AWSProvider{}).Lookup("SECRET_KEY"); err == nil {
+		t.Error("no region: Lookup succeeded")
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	transport := &roundTripper{status: http.StatusBadRequest, body: `{"__type": "ResourceNotFoundException"}`}
+	provider := AWSProvider{Region: "eu-west-1", Client: &http.Client{Transport: transport}}
+	if _, err := provider.Lookup("SECRET_KEY"); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("err = %v, want the AWS error", err)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_ROLE_ARN", "")
+	if _, err := provider.Lookup("SECRET_KEY"); err == nil || !strings.Contains(err.Error(), "no AWS credentials") {
+		t.Errorf("err = %v, want missing credentials", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Package selftest runs quick end-to-end checks of the dependencies the
+// server needs, so deployments can be gated on a working build and
+// environment without starting the HTTP server.
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Check is one named smoke test.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of a self-test run. OK is true only if every check
+// passed.
+type Report struct {
+	OK     bool     `json:"ok"`
+	Checks []Result `json:"checks"`
+}
+
+// Run runs every check in order, continuing after failures so the report
+// covers them all.
+func Run(ctx context.Context, checks []Check) Report {
+	report := Report{OK: true, Checks: make([]Result, 0, len(checks))}
+	for _, check := range checks {
+		start := time.Now()
+		err := check.Run(ctx)
+		result := Result{Name: check.Name, OK: err == nil, DurationMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			result.Error = err.Error()
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// MongoCheck writes a document to a throwaway collection in db, reads it
+// back and drops the collection.
+func MongoCheck(db *mongo.Database) Check {
+	return Check{Name: "mongodb", Run: func(ctx context.Context) error {
+		if db == nil {
+			return errors.New("no MongoDB connection")
+		}
+		collection := db.Collection("selftest_" + primitive.NewObjectID().Hex())
+		defer collection.Drop(ctx)
+
+		want := primitive.NewObjectID()
+		if _, err := collection.InsertOne(ctx, bson.M{"_id": want}); err != nil {
+			return fmt.Errorf("insert: %w", err)
+		}
+		var got struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := collection.FindOne(ctx, bson.M{"_id": want}).Decode(&got); err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+		if got.ID != want {
+			return errors.New("read back a different document")
+		}
+		return nil
+	}}
+}
+
+// JWTCheck signs a token and validates it again.
+func JWTCheck(sign func() (string, error), validate func(token string) error) Check {
+	return Check{Name: "jwt", Run: func(ctx context.Context) error {
+		token, err := sign()
+		if err != nil {
+			return fmt.Errorf("sign: %w", err)
+		}
+		if err := validate(token); err != nil {
+			return fmt.Errorf("validate: %w", err)
+		}
+		return nil
+	}}
+}
+
+// PasswordCheck hashes a password, then verifies it and a wrong one against
+// the hash.
+func PasswordCheck(hash func(password string) (string, error), verify func(password, hash string) (bool, error)) Check {
+	return Check{Name: "password", Run: func(ctx context.Context) error {
+		const password = "selftest-password"
+		hashed, err := hash(password)
+		if err != nil {
+			return fmt.Errorf("hash: %w", err)
+		}
+		if ok, err := verify(password, hashed); err != nil || !ok {
+			return fmt.Errorf("correct password rejected: %v", err)
+		}
+		if ok, err := verify(password+"!", hashed); err != nil || ok {
+			return fmt.Errorf("wrong password accepted: %v", err)
+		}
+		return nil
+	}}
+}
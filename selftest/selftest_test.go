@@ -0,0 +1,123 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRunReportsEveryCheck(t *testing.T) {
+	ran := 0
+	pass := func(context.Context) error { ran++; return nil }
+	fail := func(context.Context) error { ran++; return errors.New("boom") }
+
+	report := Run(context.Background(), []Check{{"first", fail}, {"second", pass}})
+	if report.OK {
+		t.Fatal("report is OK with a failed check")
+	}
+	if ran != 2 || len(report.Checks) != 2 {
+		t.Fatalf("ran %d checks, reported %d; want both after a failure", ran, len(report.Checks))
+	}
+	if first := report.Checks[0]; first.Name != "first" || first.OK || first.Error != "boom" {
+		t.Errorf("first = %+v", first)
+	}
+	if second := report.Checks[1]; second.Name != "second" || !second.OK || second.Error != "" {
+		t.Errorf("second = %+v", second)
+	}
+
+	if !Run(context.Background(), []Check{{"only", pass}}).OK {
+		t.Error("report is not OK with every check passing")
+	}
+}
+
+func TestJWTCheck(t *testing.T) {
+	sign := func() (string, error) { return "token", nil }
+	validate := func(token string) error {
+		if token != "token" {
+			return errors.New("unexpected token")
+		}
+		return nil
+	}
+	if err := JWTCheck(sign, validate).Run(context.Background()); err != nil {
+		t.Fatalf("valid round trip: %v", err)
+	}
+
+	unsigned := func() (string, error) { return "", errors.New("no key") }
+	if err := JWTCheck(unsigned, validate).Run(context.Background()); err == nil || !strings.HasPrefix(err.Error(), "sign:") {
+		t.Errorf("signing failure: err = %v", err)
+	}
+	rejecting := func(string) error { return errors.New("signature invalid") }
+	if err := JWTCheck(sign, rejecting).Run(context.Background()); err == nil || !strings.HasPrefix(err.Error(), "validate:") {
+		t.Errorf("validation failure: err = %v", err)
+	}
+}
+
+func TestPasswordCheck(t *testing.T) {
+	hash := func(password string) (string, error) { return "hashed:" + password, nil }
+	verify := func(password, hash string) (bool, error) { return hash == "hashed:"+password, nil }
+	if err := PasswordCheck(hash, verify).Run(context.Background()); err != nil {
+		t.Fatalf("working hasher: %v", err)
+	}
+
+	acceptsAll := func(string, string) (bool, error) { return true, nil }
+	if err := PasswordCheck(hash, acceptsAll).Run(context.Background()); err == nil || !strings.Contains(err.Error(), "wrong password accepted") {
+		t.Errorf("verifier accepting anything: err = %v", err)
+	}
+	rejectsAll := func(string, string) (bool, error) { return false, nil }
+	if err := PasswordCheck(hash, rejectsAll).Run(context.Background()); err == nil || !strings.Contains(err.Error(), "correct password rejected") {
+		t.Errorf("verifier rejecting everything: err = %v", err)
+	}
+	broken := func(string) (string, error) { return "", errors.New("busy") }
+	if err := PasswordCheck(broken, verify).Run(context.Background()); err == nil || !strings.HasPrefix(err.Error(), "hash:") {
+		t.Errorf("failing hasher: err = %v", err)
+	}
+}
+
+func TestMongoCheck(t *testing.T) {
+	if err := MongoCheck(nil).Run(context.Background()); err == nil {
+		t.Error("no database: check passed")
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("read back", func(mt *mtest.T) {
+		// The document id is random, so any document the mock returns differs
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "selftest.selftest", mtest.FirstBatch, bson.D{{Key: "_id", Value: primitive.NewObjectID()}}),
+			mtest.CreateSuccessResponse(),
+		)
+		if err := MongoCheck(mt.DB).Run(context.Background()); err == nil || !strings.Contains(err.Error(), "different document") {
+			t.Fatalf("err = %v, want a mismatch", err)
+		}
+	})
+
+	mt.Run("nothing read", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "selftest.selftest", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+		)
+		if err := MongoCheck(mt.DB).Run(context.Background()); err == nil || !strings.HasPrefix(err.Error(), "read:") {
+			t.Fatalf("err = %v, want a read failure", err)
+		}
+	})
+
+	mt.Run("insert fails", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "not authorized"}), mtest.CreateSuccessResponse())
+		err := MongoCheck(mt.DB).Run(context.Background())
+		if err == nil || !strings.HasPrefix(err.Error(), "insert:") {
+			t.Fatalf("err = %v, want an insert failure", err)
+		}
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "drop" {
+				return
+			}
+		}
+		t.Error("the throwaway collection was not dropped")
+	})
+}
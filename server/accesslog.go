@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/ctxkeys"
+)
+
+// Access log formats selected by LOG_FORMAT.
+const (
+	// LogFormatText is gin's default colored, human-readable line.
+	LogFormatText = "text"
+	// LogFormatJSON is one JSON object per request, for structured logging.
+	LogFormatJSON = "json"
+	// LogFormatCombined is the Apache/Nginx combined log format.
+	LogFormatCombined = "combined"
+)
+
+// combinedTimeLayout is the %t timestamp of the combined log format.
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// accessEntry holds what is logged about a request, whatever the format.
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	RemoteIP  string    `json:"remote_ip"`
+	UserID    string    `json:"user_id,omitempty"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// LogFormatFromEnv returns the access log format configured by LOG_FORMAT,
+// defaulting to text.
+func LogFormatFromEnv() string {
+	value := os.Getenv("LOG_FORMAT")
+	switch value {
+	case "":
+		return LogFormatText
+	case LogFormatText, LogFormatJSON, LogFormatCombined:
+		return value
+	}
+	log.Printf("Invalid LOG_FORMAT %q, using %s", value, LogFormatText)
+	return LogFormatText
+}
+
+// AccessLog returns middleware writing one line per request to out in
+// format. The text format is gin's own logger.
+func AccessLog(format string, out io.Writer) gin.HandlerFunc {
+	var write func(io.Writer, accessEntry)
+	switch format {
+	case LogFormatJSON:
+		write = writeJSONEntry
+	case LogFormatCombined:
+		write = writeCombinedEntry
+	default:
+		return gin.LoggerWithWriter(out)
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		entry := accessEntry{
+			Time:      start,
+			RemoteIP:  c.ClientIP(),
+			Method:    c.Request.Method,
+			URI:       c.Request.URL.RequestURI(),
+			Proto:     c.Request.Proto,
+			Status:    c.Writer.Status(),
+			Bytes:     c.Writer.Size(),
+			Duration:  float64(time.Since(start).Microseconds()) / 1000,
+			Referer:   c.Request.Referer(),
+			UserAgent: c.Request.UserAgent(),
+			Error:     c.Errors.ByType(gin.ErrorTypePrivate).String(),
+		}
+		entry.UserID, _ = ctxkeys.GetUserID(c)
+		// Nothing was written, for instance on a 304
+		if entry.Bytes < 0 {
+			entry.Bytes = 0
+		}
+		write(out, entry)
+	}
+}
+
+func writeJSONEntry(out io.Writer, entry accessEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding access log entry: %v", err)
+		return
+	}
+	out.Write(append(line, '\n'))
+}
+
+// writeCombinedEntry writes entry as
+// %h %l %u [%t] "%r" %>s %b "%{Referer}i" "%{User-Agent}i", with "-" for
+// missing values and the user id as %u.
+func writeCombinedEntry(out io.Writer, entry accessEntry) {
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = fmt.Sprint(entry.Bytes)
+	}
+	fmt.Fprintf(out, "%s - %s [%s] \"%s %s %s\" %d %s %q %q\n",
+		entry.RemoteIP,
+		orDash(entry.UserID),
+		entry.Time.Format(combinedTimeLayout),
+		entry.Method, entry.URI, entry.Proto,
+		entry.Status,
+		bytes,
+		orDash(entry.Referer),
+		orDash(entry.UserAgent),
+	)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/ctxkeys"
+)
+
+// logRequest serves req through AccessLog in format and returns the log
+// output. The handler authenticates as user when it is not empty.
+func logRequest(t *testing.T, format string, req *http.Request, user string) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	router := gin.New()
+	router.Use(AccessLog(format, &out))
+	router.GET("/todos", func(c *gin.Context) {
+		if user != "" {
+			ctxkeys.SetUserID(c, user)
+		}
+		c.String(http.StatusOK, "hello")
+	})
+	router.GET("/empty", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	return out.String()
+}
+
+func accessRequest(path string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.Header.Set("Referer", "https://app.example.com/")
+	req.Header.Set("User-Agent", "curl/8.0")
+	return req
+}
+
+var combinedLine = regexp.MustCompile(`^(\S+) - (\S+) \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d{3}) (\S+) "([^"]*)" "([^"]*)"\n$`)
+
+func TestAccessLogCombined(t *testing.T) {
+	before := time.Now().Truncate(time.Second)
+	line := logRequest(t, LogFormatCombined, accessRequest("/todos?page=2"), "65f0c0ffee")
+	match := combinedLine.FindStringSubmatch(line)
+	if match == nil {
+		t.Fatalf("line %q does not match the combined log format", line)
+	}
+	want := map[int]string{
+		1: "203.0.113.7", 2: "65f0c0ffee",
+		4: "GET", 5: "/todos?page=2", 6: "HTTP/1.1",
+		7: "200", 8: "5",
+		9: "https://app.example.com/", 10: "curl/8.0",
+	}
+	for group, value := range want {
+		if match[group] != value {
+			t.Errorf("field %d = %q, want %q in %q", group, match[group], value, line)
+		}
+	}
+	logged, err := time.Parse(combinedTimeLayout, match[3])
+	if err != nil {
+		t.Fatalf("timestamp %q: %v", match[3], err)
+	}
+	if logged.Before(before) || logged.After(time.Now()) {
+		t.Errorf("timestamp %v, want the request time", logged)
+	}
+}
+
+func TestAccessLogCombinedDashes(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/empty", nil)
+	line := logRequest(t, LogFormatCombined, req, "")
+	match := combinedLine.FindStringSubmatch(line)
+	if match == nil {
+		t.Fatalf("line %q does not match the combined log format", line)
+	}
+	// No user, no body, no referer and no user agent
+	for _, group := range []int{2, 8, 9, 10} {
+		if match[group] != "-" {
+			t.Errorf("field %d = %q, want - in %q", group, match[group], line)
+		}
+	}
+	if match[7] != "204" {
+		t.Errorf("status %s, want 204", match[7])
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	line := logRequest(t, LogFormatJSON, accessRequest("/todos?page=2"), "65f0c0ffee")
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("output %q, want a single line", line)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("line %q: %v", line, err)
+	}
+	want := map[string]interface{}{
+		"remote_ip":  "203.0.113.7",
+		"user_id":    "65f0c0ffee",
+		"method":     "GET",
+		"uri":        "/todos?page=2",
+		"proto":      "HTTP/1.1",
+		"status":     float64(200),
+		"bytes":      float64(5),
+		"referer":    "https://app.example.com/",
+		"user_agent": "curl/8.0",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+	for _, key := range []string{"time", "duration_ms"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("entry has no %s: %s", key, line)
+		}
+	}
+	if _, ok := entry["error"]; ok {
+		t.Errorf("successful request logged an error: %s", line)
+	}
+}
+
+func TestAccessLogText(t *testing.T) {
+	line := logRequest(t, LogFormatText, accessRequest("/todos"), "")
+	if strings.HasPrefix(line, "{") || !strings.Contains(line, "/todos") || !strings.Contains(line, "200") {
+		t.Errorf("text line %q, want gin's default format", line)
+	}
+}
+
+func TestLogFormatFromEnv(t *testing.T) {
+	for value, want := range map[string]string{
+		"":         LogFormatText,
+		"text":     LogFormatText,
+		"json":     LogFormatJSON,
+		"combined": LogFormatCombined,
+		"apache":   LogFormatText,
+	} {
+		t.Setenv("LOG_FORMAT", value)
+		if got := LogFormatFromEnv(); got != want {
+			t.Errorf("LOG_FORMAT=%q: got %q, want %q", value, got, want)
+		}
+	}
+}
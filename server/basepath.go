@@ -0,0 +1,24 @@
+package server
+
+import (
+	"os"
+	"strings"
+)
+
+// BasePath returns the URL prefix the app is served under, from BASE_PATH,
+// normalized to "" or a path like "/tasky" with no trailing slash.
+func BasePath() string {
+	path := strings.Trim(os.Getenv("BASE_PATH"), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// CookiePath returns the Path for cookies, scoping them to the base path.
+func CookiePath() string {
+	if path := BasePath(); path != "" {
+		return path
+	}
+	return "/"
+}
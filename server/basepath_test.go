@@ -0,0 +1,24 @@
+package server
+
+import "testing"
+
+func TestBasePath(t *testing.T) {
+	cases := []struct {
+		value, path, cookiePath string
+	}{
+		{"", "", "/"},
+		{"/", "", "/"},
+		{"tasky", "/tasky", "/tasky"},
+		{"/tasky/", "/tasky", "/tasky"},
+		{"/apps/tasky", "/apps/tasky", "/apps/tasky"},
+	}
+	for _, tc := range cases {
+		t.Setenv("BASE_PATH", tc.value)
+		if got := BasePath(); got != tc.path {
+			t.Errorf("BASE_PATH=%q: BasePath = %q, want %q", tc.value, got, tc.path)
+		}
+		if got := CookiePath(); got != tc.cookiePath {
+			t.Errorf("BASE_PATH=%q: CookiePath = %q, want %q", tc.value, got, tc.cookiePath)
+		}
+	}
+}
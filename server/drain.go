@@ -0,0 +1,17 @@
+package server
+
+import "sync/atomic"
+
+var draining int32
+
+// StartDraining marks the instance as draining: it keeps serving, but
+// reports itself not ready so load balancers stop sending new traffic before
+// it shuts down. Draining cannot be undone short of a restart.
+func StartDraining() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+// Draining reports whether StartDraining has been called.
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrustedProxiesFromEnv returns the proxy addresses and CIDRs listed,
+// comma-separated, in TRUSTED_PROXIES. It returns nil when none are set.
+func TrustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// TrustProxies makes router believe X-Forwarded-For and X-Real-IP only from
+// the proxies in TRUSTED_PROXIES. With none configured ClientIP is the
+// connection's address, so clients cannot pick their own IP, and with it
+// their rate limit and login throttle buckets, by sending a header.
+func TrustProxies(router *gin.Engine) error {
+	return router.SetTrustedProxies(TrustedProxiesFromEnv())
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeffthorne/tasky/ratelimit"
+)
+
+func TestTrustedProxiesFromEnv(t *testing.T) {
+	cases := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"10.0.0.1", []string{"10.0.0.1"}},
+		{"10.0.0.0/8, 192.0.2.7", []string{"10.0.0.0/8", "192.0.2.7"}},
+	}
+	for _, tc := range cases {
+		t.Setenv("TRUSTED_PROXIES", tc.value)
+		if got := TrustedProxiesFromEnv(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("TRUSTED_PROXIES=%q: got %q, want %q", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestTrustProxiesRejectsInvalidEntries(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "not-an-ip")
+	if err := TrustProxies(gin.New()); err == nil {
+		t.Fatal("an invalid TRUSTED_PROXIES entry was accepted")
+	}
+}
+
+func TestSpoofedForwardedForKeepsRateLimit(t *testing.T) {
+	for _, tc := range []struct {
+		proxies, remote string
+		forwarded       bool
+	}{
+		{"", "198.51.100.1", false},
+		{"192.0.2.0/24", "198.51.100.2", false},
+		{"198.51.100.3", "198.51.100.3", true},
+	} {
+		t.Setenv("TRUSTED_PROXIES", tc.proxies)
+		router := gin.New()
+		if err := TrustProxies(router); err != nil {
+			t.Fatal(err)
+		}
+		router.GET("/limited", ratelimit.PerIP(1, time.Minute), func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+		send := func(forwardedFor string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+			req.RemoteAddr = tc.remote + ":1000"
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		first := send("203.0.113.1")
+		if first.Code != http.StatusOK {
+			t.Fatalf("TRUSTED_PROXIES=%q: first request status = %d", tc.proxies, first.Code)
+		}
+		if forwarded := first.Body.String() == "203.0.113.1"; forwarded != tc.forwarded {
+			t.Errorf("TRUSTED_PROXIES=%q: ClientIP = %s", tc.proxies, first.Body)
+		}
+		// A fresh X-Forwarded-For gets a new bucket only from a trusted proxy
+		if code := send("203.0.113.2").Code; (code == http.StatusOK) != tc.forwarded {
+			t.Errorf("TRUSTED_PROXIES=%q: spoofed X-Forwarded-For got %d", tc.proxies, code)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package server configures the HTTP server the application listens with.
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// secureCipherSuites are the TLS 1.2 suites offered: forward-secret AEAD
+// ciphers only. TLS 1.3 suites are not configurable and are all secure.
+var secureCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// TLSFiles returns the certificate and key paths from TLS_CERT_FILE and
+// TLS_KEY_FILE, and whether both are set so the app should serve HTTPS.
+func TLSFiles(lookup func(string) string) (certFile string, keyFile string, ok bool) {
+	certFile, keyFile = lookup("TLS_CERT_FILE"), lookup("TLS_KEY_FILE")
+	return certFile, keyFile, certFile != "" && keyFile != ""
+}
+
+// TLSConfigFromEnv builds the server TLS settings, with the minimum protocol
+// version taken from TLS_MIN_VERSION (1.2 or 1.3, default 1.2).
+func TLSConfigFromEnv(lookup func(string) string) (*tls.Config, error) {
+	minVersion := uint16(tls.VersionTLS12)
+	switch version := lookup("TLS_MIN_VERSION"); version {
+	case "", "1.2":
+	case "1.3":
+		minVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("TLS_MIN_VERSION must be 1.2 or 1.3, got %q", version)
+	}
+
+	return &tls.Config{
+		MinVersion:       minVersion,
+		CipherSuites:     secureCipherSuites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	}, nil
+}
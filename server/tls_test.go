@@ -0,0 +1,63 @@
+package server
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+// env returns a lookup function over vars.
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestTLSConfigFromEnv(t *testing.T) {
+	for value, want := range map[string]uint16{"": tls.VersionTLS12, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13} {
+		config, err := TLSConfigFromEnv(env(map[string]string{"TLS_MIN_VERSION": value}))
+		if err != nil {
+			t.Fatalf("TLS_MIN_VERSION=%q: %v", value, err)
+		}
+		if config.MinVersion != want {
+			t.Errorf("TLS_MIN_VERSION=%q: MinVersion = %x, want %x", value, config.MinVersion, want)
+		}
+	}
+
+	for _, value := range []string{"1.0", "1.1", "tls1.3"} {
+		if _, err := TLSConfigFromEnv(env(map[string]string{"TLS_MIN_VERSION": value})); err == nil {
+			t.Errorf("TLS_MIN_VERSION=%q was accepted", value)
+		}
+	}
+}
+
+func TestTLSConfigOffersOnlySecureSuites(t *testing.T) {
+	config, _ := TLSConfigFromEnv(env(nil))
+	insecure := map[uint16]bool{}
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.ID] = true
+	}
+	for _, id := range config.CipherSuites {
+		if insecure[id] {
+			t.Errorf("offers insecure suite %s", tls.CipherSuiteName(id))
+		}
+	}
+	if len(config.CipherSuites) == 0 {
+		t.Error("no cipher suites configured")
+	}
+}
+
+func TestTLSFiles(t *testing.T) {
+	cases := []struct {
+		vars map[string]string
+		want bool
+	}{
+		{map[string]string{}, false},
+		{map[string]string{"TLS_CERT_FILE": "cert.pem"}, false},
+		{map[string]string{"TLS_KEY_FILE": "key.pem"}, false},
+		{map[string]string{"TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem"}, true},
+	}
+	for _, tc := range cases {
+		cert, key, ok := TLSFiles(env(tc.vars))
+		if ok != tc.want || cert != tc.vars["TLS_CERT_FILE"] || key != tc.vars["TLS_KEY_FILE"] {
+			t.Errorf("%v: got %q, %q, %v", tc.vars, cert, key, ok)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+package server
+
+// Version identifies the running build. Release builds set it with
+// -ldflags "-X github.com/jeffthorne/tasky/server.Version=<version>".
+var Version = "dev"
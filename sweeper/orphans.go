@@ -0,0 +1,167 @@
+package sweeper
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jeffthorne/tasky/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// What ReconcileOrphans does with todos whose owner no longer exists.
+const (
+	// OrphansReport only logs how many orphans there are.
+	OrphansReport = "report"
+	// OrphansArchive archives them, leaving them to ARCHIVE_RETENTION_DAYS.
+	OrphansArchive = "archive"
+	// OrphansPurge deletes them for good.
+	OrphansPurge = "purge"
+)
+
+// orphanLookupBatch bounds the owner ids looked up in one query.
+const orphanLookupBatch = 1000
+
+// OrphanModeFromEnv returns the action configured by ORPHAN_TODOS. It
+// defaults to a dry run that only reports.
+func OrphanModeFromEnv() string {
+	value := os.Getenv("ORPHAN_TODOS")
+	switch value {
+	case "":
+		return OrphansReport
+	case OrphansReport, OrphansArchive, OrphansPurge:
+		return value
+	}
+	log.Printf("Ignoring ORPHAN_TODOS=%q: expected %s, %s or %s", value, OrphansReport, OrphansArchive, OrphansPurge)
+	return OrphansReport
+}
+
+// ReconcileOrphans finds todos whose owner is not in the user collection, as
+// left behind when a user is deleted directly in the database, and handles
+// them according to mode, in the default database and every tenant database.
+func ReconcileOrphans(ctx context.Context, mode string, now time.Time) {
+	for _, tenant := range append([]string{""}, database.Tenants()...) {
+		name := database.TenantDatabase(tenant) + ".todos"
+		found, changed, err := reconcileTenant(ctx, tenant, mode, now)
+		if err != nil {
+			log.Printf("Error reconciling orphaned todos in %s: %v", name, err)
+			continue
+		}
+		switch {
+		case found == 0:
+		case mode == OrphansArchive:
+			log.Printf("Archived %d of %d orphaned todos in %s", changed, found, name)
+		case mode == OrphansPurge:
+			log.Printf("Purged %d orphaned todos from %s", changed, name)
+		default:
+			log.Printf("Found %d orphaned todos in %s; set ORPHAN_TODOS to archive or purge them", found, name)
+		}
+	}
+}
+
+// reconcileTenant returns how many orphaned todos were found and how many of
+// them mode changed.
+func reconcileTenant(ctx context.Context, tenant string, mode string, now time.Time) (int64, int64, error) {
+	opCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	users := database.OpenTenantCollection(database.Client, tenant, "user")
+	todos := database.OpenTenantCollection(database.Client, tenant, "todos")
+
+	owners, err := todos.Distinct(opCtx, "userid", bson.M{})
+	if err != nil {
+		return 0, 0, err
+	}
+	missing, err := missingOwners(opCtx, users, owners)
+	if err != nil || len(missing) == 0 {
+		return 0, 0, err
+	}
+
+	filter := bson.M{"userid": bson.M{"$in": missing}}
+	found, err := todos.CountDocuments(opCtx, filter)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch mode {
+	case OrphansArchive:
+		filter["archived"] = bson.M{"$ne": true}
+		result, err := todos.UpdateMany(opCtx, filter, bson.M{"$set": bson.M{
+			"archived":    true,
+			"archived_at": now,
+			"updated_at":  now,
+		}})
+		if err != nil {
+			return found, 0, err
+		}
+		return found, result.ModifiedCount, nil
+	case OrphansPurge:
+		result, err := todos.DeleteMany(opCtx, filter)
+		if err != nil {
+			return found, 0, err
+		}
+		return found, result.DeletedCount, nil
+	}
+	return found, 0, nil
+}
+
+// missingOwners returns the todo owner values, as stored, that match no user.
+// Owners are ObjectIDs or, for todos written before that, their hex string;
+// values that are neither are left alone.
+func missingOwners(ctx context.Context, users *mongo.Collection, owners []interface{}) (bson.A, error) {
+	ids := map[primitive.ObjectID][]interface{}{}
+	for _, owner := range owners {
+		switch value := owner.(type) {
+		case primitive.ObjectID:
+			ids[value] = append(ids[value], value)
+		case string:
+			if id, err := primitive.ObjectIDFromHex(value); err == nil {
+				ids[id] = append(ids[id], value)
+			}
+		}
+	}
+
+	batch := make([]primitive.ObjectID, 0, orphanLookupBatch)
+	existing := map[primitive.ObjectID]bool{}
+	lookup := func() error {
+		cursor, err := users.Find(ctx, bson.M{"_id": bson.M{"$in": batch}}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return err
+		}
+		var found []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &found); err != nil {
+			return err
+		}
+		for _, user := range found {
+			existing[user.ID] = true
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for id := range ids {
+		batch = append(batch, id)
+		if len(batch) == orphanLookupBatch {
+			if err := lookup(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := lookup(); err != nil {
+			return nil, err
+		}
+	}
+
+	missing := bson.A{}
+	for id, values := range ids {
+		if !existing[id] {
+			missing = append(missing, values...)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,170 @@
+package sweeper
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// seedOrphans queues the replies of a reconciliation in which the todos
+// belong to live, which exists, and to orphan, which does not and owns todos
+// stored under both its ObjectID and its hex string. count is how many todos
+// the orphan owns.
+func seedOrphans(mt *mtest.T, live primitive.ObjectID, orphan primitive.ObjectID, count int32) {
+	mt.AddMockResponses(
+		mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{live, orphan, orphan.Hex(), "not-an-id"}}),
+		mtest.CreateCursorResponse(0, "tasky.user", mtest.FirstBatch, bson.D{{Key: "_id", Value: live}}),
+		mtest.CreateCursorResponse(0, "tasky.todos", mtest.FirstBatch, bson.D{{Key: "n", Value: count}}),
+	)
+}
+
+// nextCommand returns the next command sent, failing unless it is name.
+func nextCommand(t *testing.T, mt *mtest.T, name string) bson.Raw {
+	t.Helper()
+	evt := mt.GetStartedEvent()
+	if evt == nil || evt.CommandName != name {
+		t.Fatalf("got %v, want a %s", evt, name)
+	}
+	return evt.Command
+}
+
+// assertOrphanFilter checks that filter selects exactly orphan's todos.
+func assertOrphanFilter(t *testing.T, filter bson.Raw, orphan primitive.ObjectID) {
+	t.Helper()
+	values, err := filter.Lookup("userid", "$in").Array().Values()
+	if err != nil {
+		t.Fatalf("filter %s: %v", filter, err)
+	}
+	var ids, hexes int
+	for _, value := range values {
+		if id, ok := value.ObjectIDOK(); ok && id == orphan {
+			ids++
+		} else if hex, ok := value.StringValueOK(); ok && hex == orphan.Hex() {
+			hexes++
+		} else {
+			t.Errorf("filter %s selects %s, which is not the orphan", filter, value)
+		}
+	}
+	if ids != 1 || hexes != 1 {
+		t.Errorf("filter %s, want the orphan's ObjectID and hex string", filter)
+	}
+}
+
+func TestReconcileOrphansDryRun(t *testing.T) {
+	live, orphan := primitive.NewObjectID(), primitive.NewObjectID()
+
+	withMockDB(t, "report", func(mt *mtest.T) {
+		seedOrphans(mt, live, orphan, 3)
+		found, changed, err := reconcileTenant(mt.Context(), "", OrphansReport, time.Now())
+		if err != nil {
+			t.Fatalf("reconcileTenant: %v", err)
+		}
+		if found != 3 || changed != 0 {
+			t.Errorf("found %d, changed %d, want 3 and 0", found, changed)
+		}
+
+		nextCommand(t, mt, "distinct")
+		lookup := nextCommand(t, mt, "find").Lookup("filter", "_id", "$in").Array()
+		if values, _ := lookup.Values(); len(values) != 2 {
+			t.Errorf("looked up owners %s, want the two ObjectIDs", lookup)
+		}
+		count := nextCommand(t, mt, "aggregate").Lookup("pipeline").Array().Index(0).Value().Document()
+		assertOrphanFilter(t, count.Lookup("$match").Document(), orphan)
+		if evt := mt.GetStartedEvent(); evt != nil {
+			t.Errorf("dry run sent %s", evt.CommandName)
+		}
+	})
+
+	withMockDB(t, "no orphans", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{live}}),
+			mtest.CreateCursorResponse(0, "tasky.user", mtest.FirstBatch, bson.D{{Key: "_id", Value: live}}),
+		)
+		found, _, err := reconcileTenant(mt.Context(), "", OrphansPurge, time.Now())
+		if err != nil || found != 0 {
+			t.Fatalf("found %d, err %v, want none", found, err)
+		}
+		nextCommand(t, mt, "distinct")
+		nextCommand(t, mt, "find")
+		if evt := mt.GetStartedEvent(); evt != nil {
+			t.Errorf("sent %s without orphans", evt.CommandName)
+		}
+	})
+}
+
+func TestReconcileOrphansArchive(t *testing.T) {
+	live, orphan := primitive.NewObjectID(), primitive.NewObjectID()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	withMockDB(t, "archive", func(mt *mtest.T) {
+		seedOrphans(mt, live, orphan, 3)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}))
+		found, changed, err := reconcileTenant(mt.Context(), "", OrphansArchive, now)
+		if err != nil {
+			t.Fatalf("reconcileTenant: %v", err)
+		}
+		if found != 3 || changed != 2 {
+			t.Errorf("found %d, changed %d, want 3 and 2", found, changed)
+		}
+
+		for _, name := range []string{"distinct", "find", "aggregate"} {
+			nextCommand(t, mt, name)
+		}
+		statement := nextCommand(t, mt, "update").Lookup("updates").Array().Index(0).Value().Document()
+		filter := statement.Lookup("q").Document()
+		assertOrphanFilter(t, filter, orphan)
+		if ne, ok := filter.Lookup("archived", "$ne").BooleanOK(); !ok || !ne {
+			t.Errorf("filter %s, want already archived todos skipped", filter)
+		}
+		if !statement.Lookup("multi").Boolean() {
+			t.Error("archive updated a single todo")
+		}
+		set := statement.Lookup("u", "$set").Document()
+		if !set.Lookup("archived").Boolean() || !set.Lookup("archived_at").Time().Equal(now) {
+			t.Errorf("update sets %s, want archived at %v", set, now)
+		}
+	})
+}
+
+func TestReconcileOrphansPurge(t *testing.T) {
+	live, orphan := primitive.NewObjectID(), primitive.NewObjectID()
+
+	withMockDB(t, "purge", func(mt *mtest.T) {
+		seedOrphans(mt, live, orphan, 3)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 3}))
+		found, changed, err := reconcileTenant(mt.Context(), "", OrphansPurge, time.Now())
+		if err != nil {
+			t.Fatalf("reconcileTenant: %v", err)
+		}
+		if found != 3 || changed != 3 {
+			t.Errorf("found %d, changed %d, want 3 and 3", found, changed)
+		}
+
+		for _, name := range []string{"distinct", "find", "aggregate"} {
+			nextCommand(t, mt, name)
+		}
+		collection, filter := deleteFilter(t, mt)
+		if collection != "todos" {
+			t.Errorf("purged %s, want todos", collection)
+		}
+		assertOrphanFilter(t, filter, orphan)
+	})
+}
+
+func TestOrphanModeFromEnv(t *testing.T) {
+	for value, want := range map[string]string{
+		"":        OrphansReport,
+		"report":  OrphansReport,
+		"archive": OrphansArchive,
+		"purge":   OrphansPurge,
+		"delete":  OrphansReport,
+	} {
+		t.Setenv("ORPHAN_TODOS", value)
+		if got := OrphanModeFromEnv(); got != want {
+			t.Errorf("ORPHAN_TODOS=%q: got %q, want %q", value, got, want)
+		}
+	}
+}
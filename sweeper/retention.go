@@ -0,0 +1,113 @@
+package sweeper
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jeffthorne/tasky/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Bounds on a retention window, in days, whether set globally or per user.
+const (
+	MinRetentionDays = 1
+	MaxRetentionDays = 3650
+)
+
+// RetentionDaysFromEnv returns the global retention window for archived
+// todos configured by ARCHIVE_RETENTION_DAYS. Zero, the default, keeps them
+// until a user sets a window of their own.
+func RetentionDaysFromEnv() int {
+	value := os.Getenv("ARCHIVE_RETENTION_DAYS")
+	if value == "" {
+		return 0
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < MinRetentionDays || days > MaxRetentionDays {
+		log.Printf("Ignoring ARCHIVE_RETENTION_DAYS=%q: expected %d to %d days", value, MinRetentionDays, MaxRetentionDays)
+		return 0
+	}
+	return days
+}
+
+// ArchivedBefore selects todos archived at or before cutoff. Todos archived
+// before archive times were recorded have none and are never matched.
+func ArchivedBefore(cutoff time.Time) bson.M {
+	return bson.M{"archived": true, "archived_at": bson.M{"$lte": cutoff}}
+}
+
+// RetentionCutoff returns the archive time at or before which a todo has
+// outlived a window of days.
+func RetentionCutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
+
+// PurgeArchived permanently deletes archived todos that have outlived their
+// owner's retention window, in the default database and every tenant
+// database. Users with their own retention_days use it; everyone else uses
+// defaultDays, and zero keeps their todos.
+func PurgeArchived(ctx context.Context, defaultDays int, now time.Time) {
+	for _, tenant := range append([]string{""}, database.Tenants()...) {
+		name := database.TenantDatabase(tenant) + ".todos"
+		deleted, err := purgeTenant(ctx, tenant, defaultDays, now)
+		if err != nil {
+			log.Printf("Error purging archived todos from %s: %v", name, err)
+		}
+		if deleted > 0 {
+			log.Printf("Purged %d archived todos from %s", deleted, name)
+		}
+	}
+}
+
+func purgeTenant(ctx context.Context, tenant string, defaultDays int, now time.Time) (int64, error) {
+	opCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	users := database.OpenTenantCollection(database.Client, tenant, "user")
+	todos := database.OpenTenantCollection(database.Client, tenant, "todos")
+
+	cursor, err := users.Find(opCtx, bson.M{"retention_days": bson.M{"$gt": 0}},
+		options.Find().SetProjection(bson.M{"retention_days": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var overrides []struct {
+		ID   primitive.ObjectID `bson:"_id"`
+		Days int                `bson:"retention_days"`
+	}
+	if err := cursor.All(opCtx, &overrides); err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	// Todos written before owners were ObjectIDs hold the hex string instead
+	owners := bson.A{}
+	for _, override := range overrides {
+		ownerIDs := bson.A{override.ID, override.ID.Hex()}
+		owners = append(owners, ownerIDs...)
+
+		filter := ArchivedBefore(RetentionCutoff(now, override.Days))
+		filter["userid"] = bson.M{"$in": ownerIDs}
+		result, err := todos.DeleteMany(opCtx, filter)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += result.DeletedCount
+	}
+
+	if defaultDays <= 0 {
+		return deleted, nil
+	}
+	filter := ArchivedBefore(RetentionCutoff(now, defaultDays))
+	filter["userid"] = bson.M{"$nin": owners}
+	result, err := todos.DeleteMany(opCtx, filter)
+	if err != nil {
+		return deleted, err
+	}
+	return deleted + result.DeletedCount, nil
+}
@@ -0,0 +1,90 @@
+package sweeper
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRetentionWindowBoundary(t *testing.T) {
+	now := time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)
+	cutoff := RetentionCutoff(now, 30)
+	filter := ArchivedBefore(cutoff)
+	if filter["archived"] != true {
+		t.Fatalf("filter %v does not require archived todos", filter)
+	}
+	bound := filter["archived_at"].(bson.M)["$lte"].(time.Time)
+
+	for archivedAt, purged := range map[time.Time]bool{
+		now.AddDate(0, 0, -31):                  true,
+		now.AddDate(0, 0, -30):                  true,
+		now.AddDate(0, 0, -30).Add(time.Second): false,
+		now.AddDate(0, 0, -1):                   false,
+	} {
+		if got := !archivedAt.After(bound); got != purged {
+			t.Errorf("archived at %v: purged %v, want %v", archivedAt, got, purged)
+		}
+	}
+}
+
+func TestRetentionDaysFromEnv(t *testing.T) {
+	for value, want := range map[string]int{"": 0, "30": 30, "0": 0, "3651": 0, "soon": 0, "3650": 3650} {
+		t.Setenv("ARCHIVE_RETENTION_DAYS", value)
+		if got := RetentionDaysFromEnv(); got != want {
+			t.Errorf("ARCHIVE_RETENTION_DAYS=%q: got %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestPurgeArchivedHonorsUserWindows(t *testing.T) {
+	t.Setenv("TENANTS", "")
+	now := time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)
+	strict := primitive.NewObjectID()
+
+	withMockDB(t, "override and default", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "go-mongodb.user", mtest.FirstBatch, bson.D{{Key: "_id", Value: strict}, {Key: "retention_days", Value: 7}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 4}),
+		)
+		PurgeArchived(mt.Context(), 30, now)
+
+		if evt := mt.GetStartedEvent(); evt == nil || evt.CommandName != "find" {
+			t.Fatalf("got %v, want the user overrides looked up first", evt)
+		}
+
+		_, own := deleteFilter(t, mt)
+		if cutoff := own.Lookup("archived_at", "$lte").Time(); !cutoff.Equal(now.AddDate(0, 0, -7)) {
+			t.Errorf("the user's cutoff = %v, want 7 days before %v", cutoff, now)
+		}
+		owners, _ := own.Lookup("userid", "$in").Array().Values()
+		if len(owners) != 2 || owners[0].ObjectID() != strict || owners[1].StringValue() != strict.Hex() {
+			t.Errorf("the user's purge matches owners %v", owners)
+		}
+
+		_, rest := deleteFilter(t, mt)
+		if cutoff := rest.Lookup("archived_at", "$lte").Time(); !cutoff.Equal(now.AddDate(0, 0, -30)) {
+			t.Errorf("the default cutoff = %v, want 30 days before %v", cutoff, now)
+		}
+		excluded, _ := rest.Lookup("userid", "$nin").Array().Values()
+		if len(excluded) != 2 || excluded[0].ObjectID() != strict {
+			t.Errorf("the default purge does not exclude the user with a window: %v", excluded)
+		}
+	})
+}
+
+func TestPurgeArchivedKeepsTodosWithoutAWindow(t *testing.T) {
+	t.Setenv("TENANTS", "")
+	withMockDB(t, "no default", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "go-mongodb.user", mtest.FirstBatch))
+		PurgeArchived(mt.Context(), 0, time.Now())
+
+		mt.GetStartedEvent()
+		if evt := mt.GetStartedEvent(); evt != nil {
+			t.Fatalf("sent %s with no retention window anywhere", evt.CommandName)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+// Package sweeper periodically deletes expired records. It complements
+// MongoDB TTL indexes, whose background monitor only runs once a minute and
+// may be disabled on some servers.
+package sweeper
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jeffthorne/tasky/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultInterval is used when SWEEP_INTERVAL is unset or invalid.
+const DefaultInterval = 10 * time.Minute
+
+// Target is a collection whose documents expire at the time stored in Field.
+type Target struct {
+	Collection string
+	Field      string
+}
+
+// DefaultTargets lists the collections holding short-lived tokens and
+// records. Sweeping a collection that does not exist yet is a no-op.
+var DefaultTargets = []Target{
+	{Collection: "refresh_tokens", Field: "expires_at"},
+	{Collection: "password_resets", Field: "expires_at"},
+	{Collection: "revoked_tokens", Field: "expires_at"},
+	{Collection: "verifications", Field: "expires_at"},
+}
+
+// IntervalFromEnv returns the sweep interval configured by SWEEP_INTERVAL.
+func IntervalFromEnv() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("SWEEP_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return DefaultInterval
+	}
+	return interval
+}
+
+// ExpiredFilter selects documents whose field holds a time at or before now.
+// Documents without the field are never matched.
+func ExpiredFilter(field string, now time.Time) bson.M {
+	return bson.M{field: bson.M{"$lte": now}}
+}
+
+// Run sweeps targets, purges archived todos past their retention window and
+// reconciles orphaned todos every interval until ctx is cancelled.
+func Run(ctx context.Context, interval time.Duration, targets []Target) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	retentionDays := RetentionDaysFromEnv()
+	orphanMode := OrphanModeFromEnv()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			Sweep(ctx, targets)
+			PurgeArchived(ctx, retentionDays, time.Now())
+			ReconcileOrphans(ctx, orphanMode, time.Now())
+		}
+	}
+}
+
+// Sweep deletes the expired documents of every target once, in the default
+// database and every tenant database.
+func Sweep(ctx context.Context, targets []Target) {
+	now := time.Now()
+	for _, tenant := range append([]string{""}, database.Tenants()...) {
+		for _, target := range targets {
+			name := database.TenantDatabase(tenant) + "." + target.Collection
+			opCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			collection := database.OpenTenantCollection(database.Client, tenant, target.Collection)
+			result, err := collection.DeleteMany(opCtx, ExpiredFilter(target.Field, now))
+			cancel()
+
+			if err != nil {
+				log.Printf("Error sweeping %s: %v", name, err)
+				continue
+			}
+			if result.DeletedCount > 0 {
+				log.Printf("Swept %d expired documents from %s", result.DeletedCount, name)
+			}
+		}
+	}
+}
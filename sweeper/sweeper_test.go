@@ -0,0 +1,116 @@
+package sweeper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jeffthorne/tasky/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// withMockDB runs fn with database.Client pointing at a fresh mock
+// deployment.
+func withMockDB(t *testing.T, name string, fn func(mt *mtest.T)) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run(name, func(mt *mtest.T) {
+		previous := database.Client
+		database.Client = mt.Client
+		defer func() { database.Client = previous }()
+		fn(mt)
+	})
+}
+
+// deleteFilter returns the filter of the next delete command.
+func deleteFilter(t *testing.T, mt *mtest.T) (string, bson.Raw) {
+	t.Helper()
+	evt := mt.GetStartedEvent()
+	if evt == nil || evt.CommandName != "delete" {
+		t.Fatalf("got %v, want a delete", evt)
+	}
+	collection := evt.Command.Lookup("delete").StringValue()
+	statement := evt.Command.Lookup("deletes").Array().Index(0).Value().Document()
+	return collection, statement.Lookup("q").Document()
+}
+
+func TestExpiredFilter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	filter := ExpiredFilter("expires_at", now)
+
+	condition, ok := filter["expires_at"].(bson.M)
+	if !ok || len(filter) != 1 {
+		t.Fatalf("filter = %v, want a single condition on expires_at", filter)
+	}
+	if len(condition) != 1 || condition["$lte"] != now {
+		t.Fatalf("condition = %v, want only $lte %v", condition, now)
+	}
+}
+
+func TestSweepDeletesOnlyExpiredRecords(t *testing.T) {
+	t.Setenv("TENANTS", "")
+	targets := []Target{
+		{Collection: "refresh_tokens", Field: "expires_at"},
+		{Collection: "verifications", Field: "valid_until"},
+	}
+	withMockDB(t, "sweep", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		)
+		before := time.Now()
+		Sweep(mt.Context(), targets)
+		after := time.Now()
+
+		for _, target := range targets {
+			collection, filter := deleteFilter(t, mt)
+			if collection != target.Collection {
+				t.Fatalf("swept %s, want %s", collection, target.Collection)
+			}
+			elements, _ := filter.Elements()
+			if len(elements) != 1 || elements[0].Key() != target.Field {
+				t.Fatalf("%s filter = %v, want a single condition on %s", collection, filter, target.Field)
+			}
+			cutoff := filter.Lookup(target.Field, "$lte").Time()
+			if cutoff.Before(before.Truncate(time.Millisecond)) || cutoff.After(after) {
+				t.Errorf("%s cutoff = %v, want the sweep time", collection, cutoff)
+			}
+		}
+	})
+}
+
+func TestSweepCoversTenants(t *testing.T) {
+	t.Setenv("TENANTS", "acme")
+	withMockDB(t, "tenants", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		)
+		Sweep(mt.Context(), DefaultTargets[:1])
+
+		for _, want := range []string{database.TenantDatabase(""), database.TenantDatabase("acme")} {
+			evt := mt.GetStartedEvent()
+			if evt == nil || evt.DatabaseName != want {
+				t.Fatalf("got %v, want a delete in %s", evt, want)
+			}
+		}
+	})
+}
+
+func TestIntervalFromEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", DefaultInterval},
+		{"90s", 90 * time.Second},
+		{"soon", DefaultInterval},
+		{"-1m", DefaultInterval},
+		{"0", DefaultInterval},
+	}
+	for _, tt := range tests {
+		t.Setenv("SWEEP_INTERVAL", tt.value)
+		if got := IntervalFromEnv(); got != tt.want {
+			t.Errorf("SWEEP_INTERVAL=%q: got %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
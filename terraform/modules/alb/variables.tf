@@ -53,7 +53,7 @@ variable "eks_security_group_ids" {
 variable "health_check_path" {
   description = "Health check path for target group"
   type        = string
-  default     = "/"
+  default     = "/readyz"
   validation {
     condition     = can(regex("^/", var.health_check_path))
     error_message = "Health check path must start with '/'."
@@ -142,7 +142,7 @@ variable "eks_node_min_size" {
 variable "alb_health_check_path" {
   description = "Health check path for ALB target group"
   type        = string
-  default     = "/"
+  default     = "/readyz"
 
   validation {
     condition     = can(regex("^/", var.alb_health_check_path))
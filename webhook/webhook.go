@@ -0,0 +1,159 @@
+// Package webhook delivers signed event notifications to user-configured
+// HTTPS endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// Event types sent to webhooks.
+const (
+	TodoCreated   = "todo.created"
+	TodoCompleted = "todo.completed"
+	TodoDeleted   = "todo.deleted"
+)
+
+// Headers sent with every delivery. The signature is "sha256=" followed by
+// the hex HMAC-SHA256 of the body, keyed with the webhook's secret.
+const (
+	SignatureHeader = "X-Tasky-Signature"
+	EventHeader     = "X-Tasky-Event"
+)
+
+// Event is the JSON body of a delivery.
+type Event struct {
+	Type      string      `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Sign returns the signature header value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateURL accepts absolute https URLs only.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return errors.New("webhook url must be an absolute https URL")
+	}
+	return nil
+}
+
+// Dispatcher delivers events in the background, retrying failed deliveries
+// with exponential backoff.
+type Dispatcher struct {
+	Client *http.Client
+	// Attempts is the number of tries per event; Backoff is the delay before
+	// the first retry, doubling after each.
+	Attempts int
+	Backoff  time.Duration
+}
+
+// Default is the dispatcher used by the application. Its client refuses to
+// connect to loopback, private and link-local addresses, so a webhook cannot
+// reach internal services.
+var Default = &Dispatcher{
+	Client:   &http.Client{Timeout: 10 * time.Second, Transport: publicOnlyTransport()},
+	Attempts: 5,
+	Backoff:  time.Second,
+}
+
+// Dispatch delivers event to url in a new goroutine. Failures are logged
+// once every attempt is used up.
+func (d *Dispatcher) Dispatch(url string, secret string, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding webhook event %s: %v", event.Type, err)
+		return
+	}
+	go func() {
+		if err := d.deliver(url, secret, event.Type, body); err != nil {
+			log.Printf("Webhook delivery of %s failed: %v", event.Type, err)
+		}
+	}()
+}
+
+// deliver posts body until the endpoint answers with a non-5xx status.
+// Client errors (4xx) are not retried, since resending would not help.
+func (d *Dispatcher) deliver(url string, secret string, eventType string, body []byte) error {
+	backoff := d.Backoff
+	var err error
+	for attempt := 1; attempt <= d.Attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var status int
+		status, err = d.post(url, secret, eventType, body)
+		if err == nil && status < 500 {
+			if status >= 400 {
+				return fmt.Errorf("endpoint returned %d", status)
+			}
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("endpoint returned %d", status)
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", d.Attempts, err)
+}
+
+func (d *Dispatcher) post(url string, secret string, eventType string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(SignatureHeader, Sign(secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// publicOnlyTransport checks the resolved address of every connection, so
+// DNS names pointing at internal addresses are refused too.
+func publicOnlyTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+				ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+				return fmt.Errorf("webhook address %s is not public", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// endpoint is a test webhook receiver answering with statuses in turn, the
+// last one repeating.
+type endpoint struct {
+	statuses []int
+	calls    int32
+	bodies   chan *http.Request
+	t        *testing.T
+}
+
+func newEndpoint(t *testing.T, statuses ...int) (*endpoint, *httptest.Server) {
+	e := &endpoint{statuses: statuses, bodies: make(chan *http.Request, 10), t: t}
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return e, server
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := int(atomic.AddInt32(&e.calls, 1)) - 1
+	if call >= len(e.statuses) {
+		call = len(e.statuses) - 1
+	}
+	body, _ := io.ReadAll(r.Body)
+	if got, want := r.Header.Get(SignatureHeader), Sign("s3cret", body); got != want {
+		e.t.Errorf("signature = %q, want %q", got, want)
+	}
+	r.Body = io.NopCloser(strings.NewReader(string(body)))
+	e.bodies <- r
+	w.WriteHeader(e.statuses[call])
+}
+
+// testDispatcher delivers to the loopback test server with short backoffs.
+func testDispatcher(server *httptest.Server) *Dispatcher {
+	return &Dispatcher{Client: server.Client(), Attempts: 3, Backoff: time.Millisecond}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"type":"todo.created"}' | openssl dgst -sha256 -hmac s3cret
+	want := "sha256=33711eb9b911f42756eeebd76dbbab12ff98234eede59e878fa84c90fd6e71dc"
+	if got := Sign("s3cret", []byte(`{"type":"todo.created"}`)); got != want {
+		t.Fatalf("Sign = %q, want %q", got, want)
+	}
+	if Sign("s3cret", []byte("a")) == Sign("other", []byte("a")) {
+		t.Fatal("the signature does not depend on the secret")
+	}
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	e, server := newEndpoint(t, http.StatusNoContent)
+	if err := testDispatcher(server).deliver(server.URL, "s3cret", TodoCreated, []byte(`{"type":"todo.created"}`)); err != nil {
+		t.Fatal(err)
+	}
+	r := <-e.bodies
+	if r.Header.Get(EventHeader) != TodoCreated || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", r.Header)
+	}
+}
+
+func TestDeliverRetriesServerErrors(t *testing.T) {
+	e, server := newEndpoint(t, http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK)
+	if err := testDispatcher(server).deliver(server.URL, "s3cret", TodoCompleted, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&e.calls); calls != 3 {
+		t.Fatalf("delivered %d times, want 3", calls)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	e, server := newEndpoint(t, http.StatusInternalServerError)
+	err := testDispatcher(server).deliver(server.URL, "s3cret", TodoDeleted, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "giving up after 3 attempts") {
+		t.Fatalf("err = %v", err)
+	}
+	if calls := atomic.LoadInt32(&e.calls); calls != 3 {
+		t.Fatalf("delivered %d times, want 3", calls)
+	}
+}
+
+func TestDeliverDoesNotRetryClientErrors(t *testing.T) {
+	e, server := newEndpoint(t, http.StatusGone)
+	if err := testDispatcher(server).deliver(server.URL, "s3cret", TodoDeleted, []byte(`{}`)); err == nil {
+		t.Fatal("a 410 counted as delivered")
+	}
+	if calls := atomic.LoadInt32(&e.calls); calls != 1 {
+		t.Fatalf("delivered %d times, want 1", calls)
+	}
+}
+
+func TestDispatchIsAsynchronous(t *testing.T) {
+	e, server := newEndpoint(t, http.StatusOK)
+	testDispatcher(server).Dispatch(server.URL, "s3cret", Event{Type: TodoCreated, Data: map[string]string{"name": "Buy milk"}})
+	select {
+	case r := <-e.bodies:
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"type":"todo.created"`) || !strings.Contains(string(body), `"name":"Buy milk"`) {
+			t.Errorf("body = %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was not delivered")
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	for raw, valid := range map[string]bool{
+		"https://hooks.example.com/tasky": true,
+		"http://hooks.example.com/tasky":  false,
+		"https://user:pw@example.com/":    false,
+		"https:///path":                   false,
+		"/relative":                       false,
+		"":                                false,
+	} {
+		if err := ValidateURL(raw); (err == nil) != valid {
+			t.Errorf("ValidateURL(%q) = %v, want valid %v", raw, err, valid)
+		}
+	}
+}
+
+func TestDefaultClientRefusesLoopback(t *testing.T) {
+	e, server := newEndpoint(t, http.StatusOK)
+	if _, err := Default.post(server.URL, "s3cret", TodoCreated, []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "not public") {
+		t.Fatalf("err = %v, want the loopback address refused", err)
+	}
+	if calls := atomic.LoadInt32(&e.calls); calls != 0 {
+		t.Fatal("the request reached the loopback server")
+	}
+}